@@ -35,6 +35,41 @@ func main() {
 		log.Fatalf("Failed to start analytics scheduler: %v", err)
 	}
 
+	gpsRetentionScheduler := scheduler.NewGPSRetentionScheduler()
+	if err := gpsRetentionScheduler.Start(); err != nil {
+		log.Fatalf("Failed to start GPS retention scheduler: %v", err)
+	}
+
+	gpsImportScheduler := scheduler.NewGPSImportScheduler()
+	if err := gpsImportScheduler.Start(); err != nil {
+		log.Fatalf("Failed to start GPS import scheduler: %v", err)
+	}
+
+	exportScheduler := scheduler.NewExportScheduler()
+	if err := exportScheduler.Start(); err != nil {
+		log.Fatalf("Failed to start export scheduler: %v", err)
+	}
+
+	savedSearchDigestScheduler := scheduler.NewSavedSearchDigestScheduler()
+	if err := savedSearchDigestScheduler.Start(); err != nil {
+		log.Fatalf("Failed to start saved search digest scheduler: %v", err)
+	}
+
+	offerRecurrenceScheduler := scheduler.NewOfferRecurrenceScheduler()
+	if err := offerRecurrenceScheduler.Start(); err != nil {
+		log.Fatalf("Failed to start offer recurrence scheduler: %v", err)
+	}
+
+	offerExpiryScheduler := scheduler.NewOfferExpiryScheduler()
+	if err := offerExpiryScheduler.Start(); err != nil {
+		log.Fatalf("Failed to start offer expiry scheduler: %v", err)
+	}
+
+	offerTenderScheduler := scheduler.NewOfferTenderScheduler()
+	if err := offerTenderScheduler.Start(); err != nil {
+		log.Fatalf("Failed to start offer tender scheduler: %v", err)
+	}
+
 	if err := firebasePush.InitFirebase(); err != nil {
 		log.Fatalf("Failed to initialize Firebase: %v", err)
 	}
@@ -62,6 +97,13 @@ func main() {
 
 	// Stop background jobs
 	analyticsScheduler.Stop()
+	gpsRetentionScheduler.Stop()
+	gpsImportScheduler.Stop()
+	exportScheduler.Stop()
+	savedSearchDigestScheduler.Stop()
+	offerRecurrenceScheduler.Stop()
+	offerExpiryScheduler.Stop()
+	offerTenderScheduler.Stop()
 
 	// Gracefully shutdown the server
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
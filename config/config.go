@@ -25,6 +25,7 @@ type Config struct {
 	API_DEBUG bool
 
 	UPLOAD_PATH      string
+	PRIVATE_PATH     string // files that must not be served from UPLOAD_PATH
 	MAX_FILE_SIZE    int64
 	MAX_FILES_UPLOAD int
 	STATIC_URL       string
@@ -66,6 +67,33 @@ type Config struct {
 	APP_NAME               string
 	FIREBASE_ADMINSDK_FILE string
 
+	GPS_MAX_BATCH_SIZE    int // points accepted per POST /gps/log/ request
+	GPS_SYNC_BATCH_SIZE   int // bigger batches are imported in the background
+	GPS_IMPORT_WORKERS    int
+	GPS_IMPORT_QUEUE_SIZE int
+	GPS_MAX_SPEED_KMH     int // fixes implying a faster move are dropped as jumps
+	GPS_MAX_ACCURACY_M    int // fixes reported less accurate than this are dropped
+	GPS_TRACK_TOLERANCE_M int // simplification tolerance of trip polylines
+
+	GPS_RETENTION_ENABLED        bool
+	GPS_RETENTION_INTERVAL_HOURS int
+
+	SAVED_SEARCH_DIGEST_ENABLED bool
+	SAVED_SEARCH_DIGEST_HOUR    int // daily digests are sent from this hour on
+
+	OFFER_RECURRENCE_ENABLED          bool
+	OFFER_EXPIRY_ENABLED              bool
+	OFFER_EXPIRY_VALIDITY_GRACE_HOURS int // hours after validity_end before an offer is archived
+	OFFER_EXPIRY_DELIVERY_GRACE_HOURS int // hours after delivery_end before an offer is archived
+	OFFER_COUNTER_EXPIRY_HOURS        int // hours a counter-offer can be accepted when it sets no expires_at
+	OFFER_TENDER_ENABLED              bool
+	OFFER_REVIEW_PREMODERATION        bool // new reviews wait for an admin before they count
+
+	EXPORT_SYNC_MAX_ROWS int // longer list exports run as background jobs
+
+	PLAN_QUOTAS_ENABLED bool
+	PLAN_DEFAULT_CODE   string // tbl_plan code of companies without an active plan, empty for none
+
 	FileUpload FileUpload
 }
 
@@ -157,6 +185,7 @@ func InitConfig() error {
 	ENV.SESSION_MAX_AGE = getEnvInt("SESSION_MAX_AGE", 86400*30) // 30 days default
 
 	ENV.UPLOAD_PATH = getEnv("UPLOAD_PATH", "./uploads")
+	ENV.PRIVATE_PATH = getEnv("PRIVATE_PATH", "./private")
 	ENV.MAX_FILE_SIZE = int64(getEnvInt("MAX_FILE_SIZE", 10)) // MB
 	ENV.MAX_FILES_UPLOAD = getEnvInt("MAX_FILES_UPLOAD", 5)
 	ENV.STATIC_URL = fmt.Sprintf("/%s/uploads/", ENV.API_PREFIX)
@@ -167,6 +196,9 @@ func InitConfig() error {
 	if err := os.MkdirAll(ENV.UPLOAD_PATH, 0755); err != nil {
 		return fmt.Errorf("failed to create upload directory: %w", err)
 	}
+	if err := os.MkdirAll(ENV.PRIVATE_PATH, 0755); err != nil {
+		return fmt.Errorf("failed to create private directory: %w", err)
+	}
 
 	ENV.ENCRYPT_PASSWORDS = getEnvBool("ENCRYPT_PASSWORDS", true)
 
@@ -246,6 +278,28 @@ func InitConfig() error {
 	ENV.APP_NAME = getEnv("APP_NAME", "MyApp")
 	ENV.FIREBASE_ADMINSDK_FILE = getEnv("FIREBASE_ADMINSDK_FILE", "")
 
+	ENV.GPS_MAX_BATCH_SIZE = getEnvInt("GPS_MAX_BATCH_SIZE", 10000)
+	ENV.GPS_SYNC_BATCH_SIZE = getEnvInt("GPS_SYNC_BATCH_SIZE", 500)
+	ENV.GPS_IMPORT_WORKERS = getEnvInt("GPS_IMPORT_WORKERS", 2)
+	ENV.GPS_IMPORT_QUEUE_SIZE = getEnvInt("GPS_IMPORT_QUEUE_SIZE", 100)
+	ENV.GPS_MAX_SPEED_KMH = getEnvInt("GPS_MAX_SPEED_KMH", 200)
+	ENV.GPS_MAX_ACCURACY_M = getEnvInt("GPS_MAX_ACCURACY_M", 100)
+	ENV.GPS_TRACK_TOLERANCE_M = getEnvInt("GPS_TRACK_TOLERANCE_M", 15)
+	ENV.GPS_RETENTION_ENABLED = getEnvBool("GPS_RETENTION_ENABLED", true)
+	ENV.GPS_RETENTION_INTERVAL_HOURS = getEnvInt("GPS_RETENTION_INTERVAL_HOURS", 24)
+	ENV.SAVED_SEARCH_DIGEST_ENABLED = getEnvBool("SAVED_SEARCH_DIGEST_ENABLED", true)
+	ENV.SAVED_SEARCH_DIGEST_HOUR = getEnvInt("SAVED_SEARCH_DIGEST_HOUR", 8)
+	ENV.OFFER_RECURRENCE_ENABLED = getEnvBool("OFFER_RECURRENCE_ENABLED", true)
+	ENV.OFFER_EXPIRY_ENABLED = getEnvBool("OFFER_EXPIRY_ENABLED", true)
+	ENV.OFFER_EXPIRY_VALIDITY_GRACE_HOURS = getEnvInt("OFFER_EXPIRY_VALIDITY_GRACE_HOURS", 0)
+	ENV.OFFER_EXPIRY_DELIVERY_GRACE_HOURS = getEnvInt("OFFER_EXPIRY_DELIVERY_GRACE_HOURS", 24)
+	ENV.OFFER_COUNTER_EXPIRY_HOURS = getEnvInt("OFFER_COUNTER_EXPIRY_HOURS", 48)
+	ENV.OFFER_TENDER_ENABLED = getEnvBool("OFFER_TENDER_ENABLED", true)
+	ENV.OFFER_REVIEW_PREMODERATION = getEnvBool("OFFER_REVIEW_PREMODERATION", false)
+	ENV.EXPORT_SYNC_MAX_ROWS = getEnvInt("EXPORT_SYNC_MAX_ROWS", 5000)
+	ENV.PLAN_QUOTAS_ENABLED = getEnvBool("PLAN_QUOTAS_ENABLED", true)
+	ENV.PLAN_DEFAULT_CODE = getEnv("PLAN_DEFAULT_CODE", "TEX_START")
+
 	ENV.FileUpload = FileUpload{
 		MaxFileSize:      ENV.MAX_FILE_SIZE * 1024 * 1024, // Convert MB to bytes
 		MaxFiles:         ENV.MAX_FILES_UPLOAD,
@@ -10,6 +10,7 @@ import (
 	"texApi/internal/chat"
 	"texApi/internal/controllers"
 	"texApi/internal/firebasePush"
+	"texApi/internal/gpsStream"
 	"texApi/pkg/middlewares"
 	"time"
 
@@ -67,6 +68,7 @@ func InitApp() *gin.Engine {
 	controllers.PackagingType(router)
 	controllers.Cargo(router)
 	controllers.Media(router)
+	controllers.Export(router)
 	controllers.VerifyRequest(router)
 	controllers.PlanMove(router)
 	controllers.UserLog(router)
@@ -81,6 +83,7 @@ func InitApp() *gin.Engine {
 	controllers.Claim(router)
 	controllers.Newsletter(router)
 	chat.Chat(router)
+	gpsStream.Controller(router)
 	firebasePush.Controller(router)
 
 	return router
@@ -1,8 +1,10 @@
 package chat
 
 import (
+	"log"
 	"texApi/config"
 	"texApi/database"
+	"texApi/internal/services"
 	"texApi/pkg/middlewares"
 
 	"github.com/gin-gonic/gin"
@@ -14,6 +16,15 @@ func Chat(router *gin.Engine) {
 
 	ChatHub := NewHub()
 	go ChatHub.Run()
+	// system messages are stored first, so users that are offline find them
+	// in their chat history
+	services.SystemMessageSender = func(userID int, content string, extras map[string]interface{}) bool {
+		conversationID, messageID, err := chatRepository.SaveSystemMessage(userID, content)
+		if err != nil {
+			log.Printf("Error saving system message for user %d: %v", userID, err)
+		}
+		return ChatHub.SendSystemMessage(userID, conversationID, messageID, content, extras)
+	}
 	apiHandler := NewAPIHandler(chatRepository, ChatHub, jwtSecret)
 
 	notificationGroup := router.Group(config.ENV.API_PREFIX+"/ws-notification/", middlewares.SysGuard)
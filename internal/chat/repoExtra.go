@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
 )
 
 func (r *Repository) SearchMessages(userID int, searchQuery string, limit, offset int) ([]MessageDetails, error) {
@@ -250,3 +251,103 @@ func (r *Repository) GetPinnedMessages(conversationID int) ([]MessageDetails, er
 	err := pgxscan.Select(context.Background(), r.db, &pinnedMessages, query, conversationID)
 	return pinnedMessages, err
 }
+
+// systemMessageMaxLen is the length of tbl_message.content
+const systemMessageMaxLen = 800
+
+// SaveSystemMessage stores a system message in the user's system conversation,
+// which is created with the first message. It returns the conversation and
+// the message id.
+func (r *Repository) SaveSystemMessage(userID int, content string) (int, int, error) {
+	ctx := context.Background()
+	if runes := []rune(content); len(runes) > systemMessageMaxLen {
+		content = string(runes[:systemMessageMaxLen])
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var conversationID int
+	err = tx.QueryRow(ctx,
+		`SELECT conversation_id FROM tbl_system_conversation WHERE user_id = $1`,
+		userID).Scan(&conversationID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		conversationID, err = createSystemConversation(ctx, tx, userID)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get system conversation: %w", err)
+	}
+
+	// the user is the only member, so the sender of the message too
+	var messageID int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO tbl_message (conversation_id, sender_id, message_type, content)
+		VALUES ($1, $2, 'system', $3)
+		RETURNING id
+	`, conversationID, userID, content).Scan(&messageID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to save system message: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE tbl_conversation
+		SET last_message_id = $1, message_count = message_count + 1, last_activity = CURRENT_TIMESTAMP
+		WHERE id = $2
+	`, messageID, conversationID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to update system conversation: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE tbl_conversation_member
+		SET unread_count = unread_count + 1
+		WHERE conversation_id = $1 AND user_id = $2
+	`, conversationID, userID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to update unread count: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, err
+	}
+	return conversationID, messageID, nil
+}
+
+// createSystemConversation creates the system channel of the user. When a
+// parallel message created it first, that one is used.
+func createSystemConversation(ctx context.Context, tx pgx.Tx, userID int) (int, error) {
+	var created int
+	err := tx.QueryRow(ctx, `
+		INSERT INTO tbl_conversation (chat_type, title, creator_id, member_count)
+		VALUES ('channel', 'System', $1, 1)
+		RETURNING id
+	`, userID).Scan(&created)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO tbl_conversation_member (conversation_id, user_id) VALUES ($1, $2)`,
+		created, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	var conversationID int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO tbl_system_conversation (user_id, conversation_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO NOTHING
+		RETURNING conversation_id
+	`, userID, created).Scan(&conversationID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err := tx.Exec(ctx, `DELETE FROM tbl_conversation WHERE id = $1`, created); err != nil {
+			return 0, err
+		}
+		err = tx.QueryRow(ctx,
+			`SELECT conversation_id FROM tbl_system_conversation WHERE user_id = $1`,
+			userID).Scan(&conversationID)
+	}
+	return conversationID, err
+}
@@ -195,6 +195,43 @@ func (h *Hub) RouteMessage(message *Message) {
 	}
 }
 
+// SendSystemMessage pushes a system notification to every connection of the
+// user, false when the user is not connected. messageID is the stored message
+// in the user's system conversation, 0 when it could not be stored.
+func (h *Hub) SendSystemMessage(userID, conversationID, messageID int, content string, extras map[string]interface{}) bool {
+	senderName := "system"
+	notification := &Message{
+		MessageCommon: MessageCommon{
+			ID:             messageID,
+			ConversationID: conversationID,
+			SenderID:       0,
+			Content:        content,
+			CreatedAt:      time.Now(),
+			MessageType:    "system",
+			SenderName:     &senderName,
+		},
+		Type:   MessageTypeNotification,
+		Extras: &extras,
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	delivered := false
+	for client := range h.clients {
+		if client.userID != userID {
+			continue
+		}
+		select {
+		case client.send <- notification:
+			delivered = true
+		default:
+			log.Printf("Failed to send system message to user %d (channel full)", userID)
+		}
+	}
+	return delivered
+}
+
 func (h *Hub) GetOnlineUsersInConversation(conversationID int) []int {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
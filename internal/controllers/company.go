@@ -12,6 +12,7 @@ func Company(router *gin.Engine) {
 	group := router.Group(config.ENV.API_PREFIX + "/company/")
 	{
 		group.GET("/:id", services.GetCompany)
+		group.GET("/:id/reviews", services.GetCompanyReviews)
 		//group.GET("/followers/:id/", services.GetCompanyFollowers)
 		//group.GET("/following/:id/", services.GetCompanyFollowing)
 
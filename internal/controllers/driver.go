@@ -13,6 +13,7 @@ func Driver(router *gin.Engine) {
 
 	group.GET("/", middlewares.Guard, services.GetDriverList)
 	group.GET("/:id", middlewares.Guard, middlewares.ViewCounterMiddleware("tbl_driver"), services.GetDriver)
+	group.GET("/:id/reviews", middlewares.Guard, services.GetDriverReviews)
 	group.POST("/", middlewares.Guard, services.CreateDriver)
 	group.PUT("/:id", middlewares.Guard, services.UpdateDriver)
 	group.DELETE("/:id", middlewares.Guard, services.DeleteDriver)
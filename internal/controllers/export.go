@@ -0,0 +1,18 @@
+package controllers
+
+import (
+	"texApi/config"
+	"texApi/internal/services"
+	"texApi/pkg/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Export(router *gin.Engine) {
+	group := router.Group(config.ENV.API_PREFIX + "/export/")
+	group.Use(middlewares.Guard)
+
+	group.GET("/", services.GetExportJobs)
+	group.GET("/:uuid", services.GetExportJob)
+	group.GET("/:uuid/file", services.DownloadExportJob)
+}
@@ -4,18 +4,44 @@ import (
 	"github.com/gin-gonic/gin"
 	"texApi/config"
 	"texApi/internal/services"
+	"texApi/pkg/middlewares"
 )
 
 func GPS(router *gin.Engine) {
 	group := router.Group(config.ENV.API_PREFIX + "/gps/")
+	// tracking features need the GPS tracking level of the company's plan
+	basic := middlewares.RequirePlanGPS("basic")
+	advanced := middlewares.RequirePlanGPS("advanced")
 	{
-		group.POST("/trip/start/", services.StartTrip)
-		group.POST("/trip/end/", services.EndTrip)
-		group.GET("/trip/", services.GetTrips)
-		group.GET("/trip/detailed/", services.GetTripsDetailed)
+		group.POST("/trip/start/", middlewares.Guard, services.StartTrip)
+		group.POST("/trip/end/", middlewares.Guard, services.EndTrip)
+		group.GET("/trip/", middlewares.Guard, basic, services.GetTrips)
+		group.GET("/trip/detailed/", middlewares.Guard, basic, services.GetTripsDetailed)
+		group.GET("/trip/:id/eta", middlewares.Guard, services.GetTripETA)
+		group.GET("/trip/:id/export", middlewares.Guard, basic, services.ExportTrip)
+		group.GET("/trip/:id/waypoints", middlewares.Guard, basic, services.GetTripWaypoints)
+		group.PUT("/trip/:id/rule", middlewares.Guard, advanced, services.SaveTripRule)
+		group.GET("/trip/:id/rule", middlewares.Guard, advanced, services.GetTripRule)
+		group.DELETE("/trip/:id/rule", middlewares.Guard, advanced, services.DeleteTripRule)
+		group.GET("/alert/", middlewares.Guard, advanced, services.GetTripAlerts)
 
-		group.POST("/log/", services.CreateGPSLogs)
-		group.GET("/info/", services.GetGPSLogs)
-		group.GET("/info/position/", services.GetLastPositions)
+		group.GET("/retention/", middlewares.GuardAdmin, services.GetGPSRetentionPolicies)
+		group.PUT("/retention/:level", middlewares.GuardAdmin, services.UpdateGPSRetentionPolicy)
+		group.POST("/retention/run/", middlewares.GuardAdmin, services.StartGPSRetention)
+
+		group.POST("/log/", middlewares.GuardGPSDevice, services.CreateGPSLogs)
+		group.GET("/log/rejected/", middlewares.Guard, services.GetRejectedGPSLogs)
+		group.GET("/log/import/:id", middlewares.GuardGPSDevice, services.GetGPSImport)
+		group.GET("/info/", middlewares.Guard, basic, services.GetGPSLogs)
+		group.GET("/info/position/", middlewares.Guard, basic, services.GetLastPositions)
+
+		group.POST("/token/", middlewares.Guard, middlewares.RequirePlanAPIAccess, services.CreateGPSToken)
+		group.GET("/token/", middlewares.Guard, services.GetGPSTokens)
+		group.DELETE("/token/:id", middlewares.Guard, services.DeleteGPSToken)
+
+		group.POST("/geofence/", middlewares.Guard, advanced, services.CreateGeofence)
+		group.GET("/geofence/", middlewares.Guard, advanced, services.GetGeofences)
+		group.DELETE("/geofence/:id", middlewares.Guard, advanced, services.DeleteGeofence)
+		group.GET("/geofence/event/", middlewares.Guard, advanced, services.GetGeofenceEvents)
 	}
 }
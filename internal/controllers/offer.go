@@ -13,10 +13,33 @@ func Offer(router *gin.Engine) {
 	group.Use(middlewares.Guard)
 
 	group.GET("/detailed/", services.GetDetailedOfferList)
+	group.GET("/find/", services.SearchOffers)
+	group.POST("/import/", services.ImportOffers)
+	group.GET("/search/", services.GetSavedSearches)
+	group.GET("/search/:id", services.GetSavedSearch)
+	group.POST("/search/", services.CreateSavedSearch)
+	group.PUT("/search/:id", services.UpdateSavedSearch)
+	group.DELETE("/search/:id", services.DeleteSavedSearch)
+	group.GET("/template/", services.GetOfferTemplates)
+	group.GET("/template/:id", services.GetOfferTemplate)
+	group.POST("/template/", services.CreateOfferTemplate)
+	group.PUT("/template/:id", services.UpdateOfferTemplate)
+	group.DELETE("/template/:id", services.DeleteOfferTemplate)
+	group.POST("/template/:id/offer", services.CreateOfferFromTemplate)
+	group.GET("/review/", middlewares.GuardAdmin, services.GetReviewList)
+	group.PUT("/review/:id", middlewares.GuardAdmin, services.ModerateOfferReview)
+	group.DELETE("/review/:id", middlewares.GuardAdmin, services.DeleteOfferReview)
 	group.GET("/", services.GetOfferListUpdate)
 	group.GET("/my/", services.GetMyOfferListUpdate)
 	group.GET("/:id", services.GetOffer)
 	group.POST("/", services.CreateOffer)
 	group.PUT("/:id", services.UpdateOffer)
+	group.POST("/:id/state", services.ChangeOfferState)
+	group.GET("/:id/matches", services.GetOfferMatches)
+	group.GET("/:id/tender", services.GetOfferTender)
+	group.PUT("/:id/tender", services.SaveOfferTender)
+	group.DELETE("/:id/tender", services.DeleteOfferTender)
+	group.GET("/:id/review", services.GetOfferReviews)
+	group.POST("/:id/review", services.CreateOfferReview)
 	group.DELETE("/:id", services.DeleteOffer)
 }
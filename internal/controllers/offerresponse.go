@@ -14,6 +14,8 @@ func OfferResponse(router *gin.Engine) {
 		offerResponseGroup.GET("/:id", services.GetOfferResponse)
 		offerResponseGroup.POST("/", services.CreateOfferResponse)
 		offerResponseGroup.PUT("/:id", services.UpdateOfferResponse) // Accept Decline Offer Response
+		offerResponseGroup.POST("/:id/counter", services.CounterOfferResponse)
+		offerResponseGroup.GET("/:id/rounds", services.GetOfferResponseRounds)
 		offerResponseGroup.DELETE("/:id", services.DeleteOfferResponse)
 	}
 }
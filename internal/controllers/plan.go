@@ -11,6 +11,7 @@ func Plan(router *gin.Engine) {
 	group := router.Group(config.ENV.API_PREFIX + "/plan/")
 	{
 		group.GET("/", services.GetPlans)
+		group.GET("/usage", middlewares.Guard, services.GetPlanUsage)
 		group.GET("/:uuid", services.GetPlanByID)
 
 		group.POST("/", middlewares.GuardAdmin, services.CreatePlan)
@@ -27,6 +27,23 @@ type CargoMain struct {
 	Note            string `json:"note"`
 	Active          int    `json:"active"`
 	Deleted         int    `json:"deleted"`
+	CargoMeasures
+}
+
+// CargoMeasures are the dimensions of one unit in cm, the stacking, the
+// required temperature in °C and the ADR dangerous goods class of a cargo
+type CargoMeasures struct {
+	LengthCM      float64  `json:"length_cm"`
+	WidthCM       float64  `json:"width_cm"`
+	HeightCM      float64  `json:"height_cm"`
+	MaxStack      int      `json:"max_stack"` // units on top of each other, 1 = not stackable
+	TempMin       *float64 `json:"temp_min"`  // nil = no temperature requirement
+	TempMax       *float64 `json:"temp_max"`
+	ADRClass      string   `json:"adr_class"` // empty = not dangerous goods
+	UNNumber      string   `json:"un_number"`
+	VolumeM3      float64  `json:"volume_m3"`      // computed by the database from qty and the dimensions
+	LoadingMeters float64  `json:"loading_meters"` // computed, floor length on a 2.4 m wide trailer
+	WeightKG      float64  `json:"weight_kg"`      // computed from weight and weight_type
 }
 type Cargo struct {
 	CargoMain
@@ -36,28 +53,36 @@ type Cargo struct {
 }
 
 type CargoUpdate struct {
-	CompanyID       *int    `json:"company_id,omitempty"`
-	Name            *string `json:"name,omitempty"`
-	Description     *string `json:"description,omitempty"`
-	Info            *string `json:"info,omitempty"`
-	Qty             *int    `json:"qty,omitempty"`
-	Weight          *int    `json:"weight,omitempty"`
-	WeightType      *string `json:"weight_type"`
-	Meta            *string `json:"meta,omitempty"`
-	Meta2           *string `json:"meta2,omitempty"`
-	Meta3           *string `json:"meta3,omitempty"`
-	VehicleTypeID   *int    `json:"vehicle_type_id,omitempty"`
-	PackagingTypeID *int    `json:"packaging_type_id,omitempty"`
-	GPS             *int    `json:"gps,omitempty"`
-	Photo1URL       *string `json:"photo1_url,omitempty"`
-	Photo2URL       *string `json:"photo2_url,omitempty"`
-	Photo3URL       *string `json:"photo3_url,omitempty"`
-	Docs1URL        *string `json:"docs1_url,omitempty"`
-	Docs2URL        *string `json:"docs2_url,omitempty"`
-	Docs3URL        *string `json:"docs3_url,omitempty"`
-	Note            *string `json:"note,omitempty"`
-	Active          *int    `json:"active,omitempty"`
-	Deleted         *int    `json:"deleted,omitempty"`
+	CompanyID       *int     `json:"company_id,omitempty"`
+	Name            *string  `json:"name,omitempty"`
+	Description     *string  `json:"description,omitempty"`
+	Info            *string  `json:"info,omitempty"`
+	Qty             *int     `json:"qty,omitempty"`
+	Weight          *int     `json:"weight,omitempty"`
+	WeightType      *string  `json:"weight_type"`
+	Meta            *string  `json:"meta,omitempty"`
+	Meta2           *string  `json:"meta2,omitempty"`
+	Meta3           *string  `json:"meta3,omitempty"`
+	VehicleTypeID   *int     `json:"vehicle_type_id,omitempty"`
+	PackagingTypeID *int     `json:"packaging_type_id,omitempty"`
+	GPS             *int     `json:"gps,omitempty"`
+	Photo1URL       *string  `json:"photo1_url,omitempty"`
+	Photo2URL       *string  `json:"photo2_url,omitempty"`
+	Photo3URL       *string  `json:"photo3_url,omitempty"`
+	Docs1URL        *string  `json:"docs1_url,omitempty"`
+	Docs2URL        *string  `json:"docs2_url,omitempty"`
+	Docs3URL        *string  `json:"docs3_url,omitempty"`
+	Note            *string  `json:"note,omitempty"`
+	Active          *int     `json:"active,omitempty"`
+	Deleted         *int     `json:"deleted,omitempty"`
+	LengthCM        *float64 `json:"length_cm,omitempty"`
+	WidthCM         *float64 `json:"width_cm,omitempty"`
+	HeightCM        *float64 `json:"height_cm,omitempty"`
+	MaxStack        *int     `json:"max_stack,omitempty"`
+	TempMin         *float64 `json:"temp_min,omitempty"`
+	TempMax         *float64 `json:"temp_max,omitempty"`
+	ADRClass        *string  `json:"adr_class,omitempty"`
+	UNNumber        *string  `json:"un_number,omitempty"`
 }
 
 type CargoDetailed struct {
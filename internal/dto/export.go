@@ -0,0 +1,33 @@
+package dto
+
+import "time"
+
+const (
+	ExportStatePending = "pending"
+	ExportStateRunning = "running"
+	ExportStateDone    = "done"
+	ExportStateFailed  = "failed"
+)
+
+// ExportJob is a list export too large to stream in the request, URL links
+// to the download of the file once the job is done
+type ExportJob struct {
+	ID         int        `json:"id" db:"id"`
+	UUID       string     `json:"uuid" db:"uuid"`
+	UserID     int        `json:"user_id" db:"user_id"`
+	CompanyID  int        `json:"company_id" db:"company_id"`
+	List       string     `json:"list" db:"list"`
+	Format     string     `json:"format" db:"format"`
+	Lang       string     `json:"lang" db:"lang"`
+	State      string     `json:"state" db:"state"`
+	RowCount   int        `json:"row_count" db:"row_count"`
+	URL        string     `json:"url,omitempty" db:"url"`
+	Error      string     `json:"error,omitempty" db:"error"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+
+	Query    string `json:"-" db:"query"`
+	Args     string `json:"-" db:"args"`      // JSON, see services.encodeExportArgs
+	FilePath string `json:"-" db:"file_path"` // relative to PRIVATE_PATH
+}
@@ -0,0 +1,80 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	GeofenceKindPickup  = "pickup"
+	GeofenceKindDropoff = "dropoff"
+
+	GeofenceShapeCircle  = "circle"
+	GeofenceShapePolygon = "polygon"
+
+	GeofenceEventArrivedPickup      = "arrived_pickup"
+	GeofenceEventLeftPickup         = "left_pickup"
+	GeofenceEventArrivedDestination = "arrived_destination"
+	GeofenceEventLeftDestination    = "left_destination"
+)
+
+type Geofence struct {
+	ID        int              `json:"id"`
+	UUID      string           `json:"uuid"`
+	OfferID   int              `json:"offer_id"`
+	CompanyID int              `json:"company_id"`
+	Kind      string           `json:"kind"`
+	Shape     string           `json:"shape"`
+	Title     string           `json:"title"`
+	Center    *Point           `json:"center"`
+	RadiusM   float64          `json:"radius_m"`
+	Area      *json.RawMessage `json:"area"` // GeoJSON polygon
+	Meta      string           `json:"meta"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+	Active    int              `json:"active"`
+	Deleted   int              `json:"deleted"`
+}
+
+type GeofenceInput struct {
+	OfferID int     `json:"offer_id" binding:"required"`
+	Kind    string  `json:"kind" binding:"required,oneof=pickup dropoff"`
+	Shape   string  `json:"shape" binding:"required,oneof=circle polygon"`
+	Title   *string `json:"title"`
+	Center  *Point  `json:"center"`
+	RadiusM float64 `json:"radius_m" binding:"omitempty,min=0"`
+	Polygon []Point `json:"polygon"` // outer ring, closing point is optional
+	Meta    *string `json:"meta"`
+}
+
+type GeofenceQuery struct {
+	OfferID *int    `form:"offer_id"`
+	TripID  *int    `form:"trip_id"`
+	Kind    *string `form:"kind" binding:"omitempty,oneof=pickup dropoff"`
+}
+
+type GeofenceEvent struct {
+	ID          int64     `json:"id"`
+	GeofenceID  int       `json:"geofence_id"`
+	OfferID     int       `json:"offer_id"`
+	TripID      *int      `json:"trip_id"`
+	VehicleID   int       `json:"vehicle_id"`
+	DriverID    int       `json:"driver_id"`
+	GPSLogID    int64     `json:"gps_log_id"`
+	EventType   string    `json:"event_type"`
+	Coordinates Point     `json:"coordinates"`
+	EventDt     time.Time `json:"event_dt"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type GeofenceEventQuery struct {
+	OfferID    *int       `form:"offer_id"`
+	TripID     *int       `form:"trip_id"`
+	VehicleID  *int       `form:"vehicle_id"`
+	GeofenceID *int       `form:"geofence_id"`
+	EventType  *string    `form:"event_type" binding:"omitempty,oneof=arrived_pickup left_pickup arrived_destination left_destination"`
+	From       *time.Time `form:"from" time_format:"2006-01-02"`
+	To         *time.Time `form:"to" time_format:"2006-01-02"`
+	Offset     int        `form:"offset" binding:"omitempty,min=0"`
+	Limit      int        `form:"limit" binding:"omitempty,min=1,max=1000"`
+}
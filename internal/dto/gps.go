@@ -153,9 +153,14 @@ type GPSLogQuery struct {
 	Limit       int        `form:"limit" binding:"omitempty,min=1,max=1000"`
 	OrderBy     *string    `form:"order_by" binding:"omitempty,oneof=id log_dt"`
 	OrderDir    *string    `form:"order_dir" binding:"omitempty,oneof=ASC DESC"`
+	Clean       bool       `form:"clean"`                              // drop jumps and inaccurate fixes
+	Simplify    *float64   `form:"simplify" binding:"omitempty,min=0"` // tolerance in meters, implies clean
+
+	ScopeCompanyID *int `form:"-"` // set by the service for non admin users
 }
 
 type TripQuery struct {
+	ID           *int       `form:"id"`
 	DriverID     *int       `form:"driver_id"`
 	VehicleID    *int       `form:"vehicle_id"`
 	FromAddress  *string    `form:"from_address"`
@@ -218,6 +223,8 @@ type TripQuery struct {
 	Limit    int     `form:"limit" binding:"omitempty,min=1,max=1000"`
 	OrderBy  *string `form:"order_by" binding:"omitempty,oneof=id start_date end_date distance_km created_at updated_at"`
 	OrderDir *string `form:"order_dir" binding:"omitempty,oneof=ASC DESC"`
+
+	ScopeCompanyID *int `form:"-"` // set by the service for non admin users
 }
 
 type PositionQuery struct {
@@ -227,6 +234,8 @@ type PositionQuery struct {
 	VehicleIDs []int `form:"vehicle_ids"`
 	TripIDs    []int `form:"trip_ids"`
 	OfferFiltersQuery
+
+	ScopeCompanyID *int `form:"-"` // set by the service for non admin users
 }
 
 type OfferFiltersQuery struct {
@@ -269,12 +278,16 @@ type TripDetailed struct {
 	EndDate      *time.Time       `json:"end_date"`
 	FromLocation *Point           `json:"from_location"`
 	ToLocation   *Point           `json:"to_location"`
-	DistanceKM   *float64         `json:"distance_km"`
+	DistanceKM   *float64         `json:"distance_km"` // driven distance once the trip is completed
+	PlannedKM    *float64         `json:"planned_distance_km"`
+	MovingSec    int              `json:"moving_sec"`
+	IdleSec      int              `json:"idle_sec"`
+	Stops        *json.RawMessage `json:"stops"`
 	Status       string           `json:"status"`
 	Meta         string           `json:"meta"`
 	Meta2        string           `json:"meta2"`
 	Meta3        string           `json:"meta3"`
-	GPSLogs      string           `json:"gps_logs"`
+	Polyline     string           `json:"polyline"` // encoded, cleaned and simplified track
 	CreatedAt    time.Time        `json:"created_at"`
 	UpdatedAt    time.Time        `json:"updated_at"`
 	Deleted      int              `json:"deleted"`
@@ -282,4 +295,144 @@ type TripDetailed struct {
 	Driver       *json.RawMessage `json:"driver"`
 	Vehicle      *json.RawMessage `json:"vehicle"`
 	Offers       *json.RawMessage `json:"offers"`
+	ETA          *TripETA         `json:"eta,omitempty"`
+}
+
+type TripETA struct {
+	TripID         int64     `json:"trip_id"`
+	RemainingKM    float64   `json:"remaining_km"` // road estimate from the last position
+	RecentSpeedKMH *float64  `json:"recent_speed_kmh"`
+	LaneSpeedKMH   *float64  `json:"lane_speed_kmh"`
+	LaneSamples    int       `json:"lane_samples"`
+	SpeedKMH       float64   `json:"speed_kmh"` // speed used for the estimate
+	ETA            time.Time `json:"eta"`
+	ETAEarliest    time.Time `json:"eta_earliest"`
+	ETALatest      time.Time `json:"eta_latest"`
+	Confidence     string    `json:"confidence"` // low, medium, high
+	LastPositionDt time.Time `json:"last_position_dt"`
+}
+
+type TripExportQuery struct {
+	Format   string   `form:"format" binding:"required,oneof=gpx kml geojson"`
+	Clean    bool     `form:"clean"`
+	Simplify *float64 `form:"simplify" binding:"omitempty,gt=0"` // tolerance in meters
+}
+
+type TripStop struct {
+	Location    Point     `json:"location"`
+	StartDt     time.Time `json:"start_dt"`
+	EndDt       time.Time `json:"end_dt"`
+	DurationSec int       `json:"duration_sec"`
+	PointCount  int       `json:"point_count"`
+}
+
+// TripSummary is computed from the cleaned track when a trip ends and stored in tbl_trip.gps_logs
+type TripSummary struct {
+	PointCount     int        `json:"point_count"`
+	DrivenKM       float64    `json:"driven_km"`
+	PlannedKM      *float64   `json:"planned_km"`
+	MovingSec      int        `json:"moving_sec"`
+	IdleSec        int        `json:"idle_sec"`
+	AvgMovingSpeed float64    `json:"avg_moving_speed_kmh"`
+	FirstLogDt     *time.Time `json:"first_log_dt"`
+	LastLogDt      *time.Time `json:"last_log_dt"`
+	Stops          []TripStop `json:"stops"`
+	Polyline       string     `json:"polyline"`
+}
+
+type GPSToken struct {
+	ID         int        `json:"id"`
+	UUID       string     `json:"uuid"`
+	CompanyID  int        `json:"company_id"`
+	DriverID   int        `json:"driver_id"`
+	VehicleID  int        `json:"vehicle_id"`
+	Title      string     `json:"title"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	Meta       string     `json:"meta"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Active     int        `json:"active"`
+	Deleted    int        `json:"deleted"`
+}
+
+type GPSTokenInput struct {
+	DriverID  int        `json:"driver_id" binding:"required_without=VehicleID"`
+	VehicleID int        `json:"vehicle_id" binding:"required_without=DriverID"`
+	Title     *string    `json:"title"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// GPSIngestScope describes who is posting GPS logs, either a device token
+// or an authorized user of the company
+type GPSIngestScope struct {
+	CompanyID int
+	TokenID   int
+	DriverID  int // token bound driver, 0 when not bound
+	VehicleID int // token bound vehicle, 0 when not bound
+	IsAdmin   bool
+}
+
+type GPSLogRejection struct {
+	Index  int         `json:"index"`
+	Reason string      `json:"reason"`
+	Log    GPSLogInput `json:"-"`
+}
+
+type GPSLogRejected struct {
+	ID          int64      `json:"id"`
+	TokenID     int        `json:"token_id"`
+	CompanyID   int        `json:"company_id"`
+	VehicleID   int        `json:"vehicle_id"`
+	DriverID    int        `json:"driver_id"`
+	OfferID     *int       `json:"offer_id"`
+	TripID      *int       `json:"trip_id"`
+	Coordinates *Point     `json:"coordinates"`
+	LogDt       *time.Time `json:"log_dt"`
+	Reason      string     `json:"reason"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type GPSLogRejectedQuery struct {
+	VehicleID *int       `form:"vehicle_id"`
+	DriverID  *int       `form:"driver_id"`
+	TokenID   *int       `form:"token_id"`
+	From      *time.Time `form:"from" time_format:"2006-01-02"`
+	To        *time.Time `form:"to" time_format:"2006-01-02"`
+	Offset    int        `form:"offset" binding:"omitempty,min=0"`
+	Limit     int        `form:"limit" binding:"omitempty,min=1,max=1000"`
+
+	CompanyID *int `form:"-"`
+}
+
+type GPSIngestReport struct {
+	Total          int               `json:"total"`
+	Accepted       int               `json:"accepted"`
+	Duplicates     int               `json:"duplicates"`
+	Rejected       []GPSLogRejection `json:"rejected"` // includes duplicates
+	GeofenceEvents int               `json:"geofence_events"`
+	Alerts         int               `json:"alerts"`
+}
+
+type GPSImport struct {
+	ID         int               `json:"id"`
+	UUID       string            `json:"uuid"`
+	CompanyID  int               `json:"company_id"`
+	TokenID    int               `json:"token_id"`
+	Status     string            `json:"status"`
+	Total      int               `json:"total"`
+	Accepted   int               `json:"accepted"`
+	Duplicates int               `json:"duplicates"`
+	Rejected   int               `json:"rejected"`
+	Report     []GPSLogRejection `json:"report"`
+	Error      string            `json:"error"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+// GPSImportPayload is the batch of a queued import, kept in the import row
+// until the import ends
+type GPSImportPayload struct {
+	Logs  []GPSLogInput  `json:"logs"`
+	Scope GPSIngestScope `json:"scope"`
 }
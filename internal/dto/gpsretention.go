@@ -0,0 +1,26 @@
+package dto
+
+import "time"
+
+type GPSRetentionPolicy struct {
+	Level         string    `json:"level"` // plan gps_tracking_level
+	RawDays       int       `json:"raw_days"`
+	DownsampleSec int       `json:"downsample_sec"`
+	KeepDays      int       `json:"keep_days"` // 0 keeps points forever
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type GPSRetentionPolicyInput struct {
+	RawDays       int `json:"raw_days" binding:"required,min=1"`
+	DownsampleSec int `json:"downsample_sec" binding:"required,min=1"`
+	KeepDays      int `json:"keep_days" binding:"min=0"`
+}
+
+type GPSRetentionReport struct {
+	ArchivedTrips     int       `json:"archived_trips"`
+	DownsampledPoints int64     `json:"downsampled_points"`
+	DeletedPoints     int64     `json:"deleted_points"`
+	DroppedPartitions []string  `json:"dropped_partitions"`
+	StartedAt         time.Time `json:"started_at"`
+	FinishedAt        time.Time `json:"finished_at"`
+}
@@ -31,6 +31,7 @@ type PlanMoveDetails struct {
 	ID          int       `json:"id" db:"id"`
 	UserID      int       `json:"user_id" db:"user_id"`
 	CompanyID   int       `json:"company_id" db:"company_id"`
+	PlanID      int       `json:"plan_id" db:"plan_id"`
 	Status      *string   `json:"status" db:"status"`
 	ValidUntil  time.Time `json:"valid_until" db:"valid_until"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
@@ -48,6 +49,7 @@ type PlanMoveDetails struct {
 type PlanMoveCreate struct {
 	UserID    int    `json:"user_id"`
 	CompanyID int    `json:"company_id"`
+	PlanID    int    `json:"plan_id"` // tbl_plan row the company moves to, 0 keeps the current plan
 	Status    string `json:"status,omitempty"`
 }
 
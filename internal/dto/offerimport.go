@@ -0,0 +1,22 @@
+package dto
+
+const MaxOfferImportRows = 1000
+
+// OfferImportRow is the result of one spreadsheet row, Row counts from 2 as
+// row 1 is the header
+type OfferImportRow struct {
+	Row     int      `json:"row"`
+	Errors  []string `json:"errors,omitempty"`
+	OfferID int      `json:"offer_id,omitempty"` // set once the import is committed
+	CargoID int      `json:"cargo_id,omitempty"` // set when the row created a cargo
+}
+
+type OfferImportReport struct {
+	DryRun    bool             `json:"dry_run"`
+	Committed bool             `json:"committed"`
+	Columns   []string         `json:"columns"`
+	Total     int              `json:"total"`
+	Valid     int              `json:"valid"`
+	Invalid   int              `json:"invalid"`
+	Rows      []OfferImportRow `json:"rows"`
+}
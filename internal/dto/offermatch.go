@@ -0,0 +1,69 @@
+package dto
+
+import "time"
+
+type OfferMatchQuery struct {
+	Limit int `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// MatchScores are the parts of a match score, each between 0 and 1
+type MatchScores struct {
+	VehicleType   float64 `json:"vehicle_type"`
+	Weight        float64 `json:"weight"`
+	Proximity     float64 `json:"proximity"`
+	Rating        float64 `json:"rating"`
+	SuccessfulOps float64 `json:"successful_ops"`
+	Lane          float64 `json:"lane"`
+}
+
+type VehicleMatch struct {
+	VehicleID      int         `json:"vehicle_id"`
+	VehicleTypeID  int         `json:"vehicle_type_id"`
+	Numberplate    string      `json:"numberplate"`
+	PayloadKG      int         `json:"payload_kg"`
+	DistanceKM     *float64    `json:"distance_km"` // last known position to the pickup
+	LastPositionDt *time.Time  `json:"last_position_dt"`
+	Score          float64     `json:"score"` // 0-100
+	Scores         MatchScores `json:"scores"`
+}
+
+// CarrierMatch is a carrier company ranked by its best vehicle for a load
+type CarrierMatch struct {
+	CompanyID     int            `json:"company_id"`
+	CompanyName   string         `json:"company_name"`
+	Rating        int            `json:"rating"`
+	SuccessfulOps int            `json:"successful_ops"`
+	LaneCount     int            `json:"lane_count"` // delivered offers on the same lane
+	Score         float64        `json:"score"`
+	Vehicles      []VehicleMatch `json:"vehicles"`
+}
+
+// LoadMatch is a sender offer ranked for a carrier offer
+type LoadMatch struct {
+	OfferID       int         `json:"offer_id"`
+	CompanyID     int         `json:"company_id"`
+	CompanyName   string      `json:"company_name"`
+	VehicleTypeID int         `json:"vehicle_type_id"`
+	CargoID       int         `json:"cargo_id"`
+	CargoWeightKG *float64    `json:"cargo_weight_kg"`
+	FromCountry   string      `json:"from_country"`
+	FromRegion    string      `json:"from_region"`
+	ToCountry     string      `json:"to_country"`
+	ToRegion      string      `json:"to_region"`
+	OfferPrice    float64     `json:"offer_price"`
+	Currency      string      `json:"currency"`
+	DeliveryStart time.Time   `json:"delivery_start"`
+	DeliveryEnd   time.Time   `json:"delivery_end"`
+	DistanceKM    *float64    `json:"distance_km"` // carrier position to the pickup
+	LaneCount     int         `json:"lane_count"`
+	Score         float64     `json:"score"`
+	Scores        MatchScores `json:"scores"`
+}
+
+// OfferMatches has carriers for sender offers and loads for carrier offers
+type OfferMatches struct {
+	OfferID   int            `json:"offer_id"`
+	OfferRole string         `json:"offer_role"`
+	Carriers  []CarrierMatch `json:"carriers,omitempty"`
+	Loads     []LoadMatch    `json:"loads,omitempty"`
+}
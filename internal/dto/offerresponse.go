@@ -31,6 +31,14 @@ type OfferResponse struct {
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
 	Deleted     int       `json:"deleted" db:"deleted"`
 	TotalCount  int       `json:"total_count,omitempty" db:"total_count"`
+
+	PaymentMethod *string    `json:"payment_method,omitempty" binding:"omitempty,oneof=cash transfer card credit terminal online coupon"`
+	PaymentTerm   *string    `json:"payment_term,omitempty" binding:"omitempty,max=200"`
+	DeliveryStart *time.Time `json:"delivery_start,omitempty"`
+	DeliveryEnd   *time.Time `json:"delivery_end,omitempty"`
+	Round         int        `json:"round" db:"round"`
+	LastCompanyID int        `json:"last_company_id" db:"last_company_id"` // the other side answers the latest terms
+	ExpiresAt     *time.Time `json:"expires_at,omitempty" db:"expires_at"`
 }
 
 type OfferResponseUpdate struct {
@@ -46,4 +54,55 @@ type OfferResponseUpdate struct {
 	Rating   *int     `json:"rating,omitempty"`
 	Active   *int     `json:"active,omitempty"`
 	Deleted  *int     `json:"deleted,omitempty"`
+
+	// terms are changed with OfferResponseCounter only, they are refused here
+	PaymentMethod *string    `json:"payment_method,omitempty"`
+	PaymentTerm   *string    `json:"payment_term,omitempty"`
+	DeliveryStart *time.Time `json:"delivery_start,omitempty"`
+	DeliveryEnd   *time.Time `json:"delivery_end,omitempty"`
+}
+
+// ChangesTerms reports whether the update tries to set any of the terms
+func (u OfferResponseUpdate) ChangesTerms() bool {
+	return u.BidPrice != nil || u.PaymentMethod != nil || u.PaymentTerm != nil ||
+		u.DeliveryStart != nil || u.DeliveryEnd != nil
+}
+
+const (
+	NegotiationOffer   = "offer"
+	NegotiationCounter = "counter"
+	NegotiationAccept  = "accept"
+	NegotiationDecline = "decline"
+	NegotiationExpire  = "expire"
+)
+
+// OfferResponseCounter answers the latest terms of a response with new ones,
+// omitted terms are kept
+type OfferResponseCounter struct {
+	BidPrice      *float64   `json:"bid_price" binding:"omitempty,gt=0"`
+	PaymentMethod *string    `json:"payment_method" binding:"omitempty,oneof=cash transfer card credit terminal online coupon"`
+	PaymentTerm   *string    `json:"payment_term" binding:"omitempty,max=200"`
+	DeliveryStart *time.Time `json:"delivery_start"`
+	DeliveryEnd   *time.Time `json:"delivery_end"`
+	Note          *string    `json:"note" binding:"omitempty,max=1000"`
+	ExpiresAt     *time.Time `json:"expires_at"` // OFFER_COUNTER_EXPIRY_HOURS from now when omitted
+}
+
+// OfferResponseRound is one entry of the negotiation history with the terms
+// of the response after it
+type OfferResponseRound struct {
+	ID            int        `json:"id"`
+	ResponseID    int        `json:"response_id"`
+	Round         int        `json:"round"`
+	Action        string     `json:"action"`
+	CompanyID     int        `json:"company_id"`
+	UserID        int        `json:"user_id"`
+	BidPrice      *float64   `json:"bid_price"`
+	PaymentMethod *string    `json:"payment_method"`
+	PaymentTerm   *string    `json:"payment_term"`
+	DeliveryStart *time.Time `json:"delivery_start"`
+	DeliveryEnd   *time.Time `json:"delivery_end"`
+	Note          *string    `json:"note"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	CreatedAt     time.Time  `json:"created_at"`
 }
@@ -0,0 +1,54 @@
+package dto
+
+import "time"
+
+const (
+	ReviewStatePending   = "pending"
+	ReviewStatePublished = "published"
+	ReviewStateHidden    = "hidden"
+
+	ReviewTargetCompany = "company"
+	ReviewTargetDriver  = "driver"
+)
+
+type OfferReview struct {
+	ID                int        `json:"id"`
+	OfferID           int        `json:"offer_id"`
+	ReviewerUserID    int        `json:"reviewer_user_id"`
+	ReviewerCompanyID int        `json:"reviewer_company_id"`
+	ReviewerDriverID  int        `json:"reviewer_driver_id"`
+	ReviewerName      string     `json:"reviewer_name"` // company name, or the driver's name for driver reviews
+	TargetCompanyID   int        `json:"target_company_id"`
+	TargetDriverID    int        `json:"target_driver_id"`
+	Rating            int        `json:"rating"`
+	Review            string     `json:"review"`
+	State             string     `json:"state"`
+	ModerationNote    string     `json:"moderation_note,omitempty"`
+	ModeratedBy       int        `json:"moderated_by,omitempty"`
+	ModeratedAt       *time.Time `json:"moderated_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	TotalCount        int        `json:"-"`
+}
+
+// OfferReviewInput rates a party of a completed offer. The owner rates the
+// executor company or the driver, the executor and the driver rate the owner.
+type OfferReviewInput struct {
+	Target string `json:"target" binding:"required,oneof=company driver"`
+	Rating int    `json:"rating" binding:"required,min=1,max=5"`
+	Review string `json:"review" binding:"max=2000"`
+}
+
+type OfferReviewModeration struct {
+	State string `json:"state" binding:"required,oneof=pending published hidden"`
+	Note  string `json:"note" binding:"max=1000"`
+}
+
+type OfferReviewListParams struct {
+	OfferID         int
+	TargetCompanyID int
+	TargetDriverID  int
+	States          []string // empty lists every state
+	Page            int
+	PerPage         int
+}
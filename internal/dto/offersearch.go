@@ -0,0 +1,25 @@
+package dto
+
+// OfferSearchQuery is GET /offer/find/: the filters of saved searches plus a
+// full-text query and radius search around pickup and dropoff points
+type OfferSearchQuery struct {
+	OfferSearchFilters
+	Q               string   `form:"q" binding:"max=200"`
+	PickupLat       *float64 `form:"pickup_lat" binding:"omitempty,latitude"`
+	PickupLng       *float64 `form:"pickup_lng" binding:"omitempty,longitude"`
+	PickupRadiusKM  float64  `form:"pickup_radius_km" binding:"omitempty,gt=0,max=2000"`
+	DropoffLat      *float64 `form:"dropoff_lat" binding:"omitempty,latitude"`
+	DropoffLng      *float64 `form:"dropoff_lng" binding:"omitempty,longitude"`
+	DropoffRadiusKM float64  `form:"dropoff_radius_km" binding:"omitempty,gt=0,max=2000"`
+	OrderBy         string   `form:"order_by"`
+	OrderDir        string   `form:"order_dir"`
+	Page            int      `form:"page" binding:"omitempty,min=1"`
+	PerPage         int      `form:"per_page" binding:"omitempty,min=1,max=100"`
+}
+
+type OfferSearchResult struct {
+	Offer
+	Relevance         float64  `json:"relevance"`           // 0 without q
+	PickupDistanceKM  *float64 `json:"pickup_distance_km"`  // set when searching around a pickup point
+	DropoffDistanceKM *float64 `json:"dropoff_distance_km"` // set when searching around a dropoff point
+}
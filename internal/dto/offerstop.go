@@ -0,0 +1,49 @@
+package dto
+
+import "time"
+
+const (
+	OfferStopPickup  = "pickup"
+	OfferStopDropoff = "dropoff"
+
+	MaxOfferStops = 20
+)
+
+// OfferStop is an ordered pickup or dropoff point of an offer, seq follows
+// the order of the stops in the request
+type OfferStop struct {
+	ID              int        `json:"id"`
+	OfferID         int        `json:"offer_id"`
+	Seq             int        `json:"seq"`
+	Kind            string     `json:"kind" binding:"required,oneof=pickup dropoff"`
+	Country         string     `json:"country" binding:"max=100"`
+	CountryID       int        `json:"country_id"`
+	Region          string     `json:"region" binding:"max=100"`
+	CityID          int        `json:"city_id"`
+	Address         string     `json:"address" binding:"max=500"`
+	Location        *Point     `json:"location"`
+	WindowStart     *time.Time `json:"window_start"`
+	WindowEnd       *time.Time `json:"window_end"`
+	ContactName     string     `json:"contact_name" binding:"max=200"`
+	ContactPhone    string     `json:"contact_phone" binding:"max=100"`
+	CargoID         int        `json:"cargo_id"`
+	CargoQty        int        `json:"cargo_qty" binding:"min=0"`
+	CargoWeight     float64    `json:"cargo_weight" binding:"min=0"`
+	CargoWeightType string     `json:"cargo_weight_type" binding:"omitempty,oneof=kg g lbs oz st t tn"`
+	Note            string     `json:"note" binding:"max=1000"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+type TripWaypoint struct {
+	ID          int64      `json:"id"`
+	TripID      int64      `json:"trip_id"`
+	OfferID     int        `json:"offer_id"`
+	OfferStopID *int       `json:"offer_stop_id"` // empty for offers without stops
+	Seq         int        `json:"seq"`
+	Kind        string     `json:"kind"`
+	Address     string     `json:"address"`
+	Location    *Point     `json:"location"`
+	WindowStart *time.Time `json:"window_start"`
+	WindowEnd   *time.Time `json:"window_end"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
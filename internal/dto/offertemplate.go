@@ -0,0 +1,74 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const MaxTemplateLeadDays = 60
+
+type OfferTemplate struct {
+	ID             int              `json:"id"`
+	UUID           string           `json:"uuid"`
+	UserID         int              `json:"user_id"`
+	CompanyID      int              `json:"company_id"`
+	SourceOfferID  int              `json:"source_offer_id"`
+	Name           string           `json:"name"`
+	Offer          *json.RawMessage `json:"offer"` // snapshot of the source offer
+	Stops          []OfferStop      `json:"stops"`
+	AnchorDate     time.Time        `json:"anchor_date"`
+	OfferState     string           `json:"offer_state"`
+	Recurrence     string           `json:"recurrence"`
+	Weekdays       []int            `json:"weekdays"`
+	MonthDay       int              `json:"month_day"`
+	Cron           string           `json:"cron"`
+	StartsOn       *time.Time       `json:"starts_on"`
+	EndsOn         *time.Time       `json:"ends_on"`
+	LeadDays       int              `json:"lead_days"`
+	LastOccurrence *time.Time       `json:"last_occurrence"`
+	NextOccurrence *time.Time       `json:"next_occurrence"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+	Active         int              `json:"active"`
+}
+
+// OfferTemplateInput saves an offer as template, recurrence fields are set
+// together and replace the previous rule
+type OfferTemplateInput struct {
+	OfferID    int        `json:"offer_id" binding:"required"`
+	Name       string     `json:"name" binding:"required,max=200"`
+	OfferState string     `json:"offer_state" binding:"omitempty,oneof=pending draft"`
+	Recurrence string     `json:"recurrence" binding:"omitempty,oneof=none weekly monthly cron"`
+	Weekdays   []int      `json:"weekdays" binding:"omitempty,max=7,dive,min=1,max=7"`
+	MonthDay   int        `json:"month_day" binding:"omitempty,min=1,max=31"`
+	Cron       string     `json:"cron" binding:"max=100"`
+	StartsOn   *time.Time `json:"starts_on"`
+	EndsOn     *time.Time `json:"ends_on"`
+	LeadDays   *int       `json:"lead_days" binding:"omitempty,min=0,max=60"`
+}
+
+type OfferTemplateUpdate struct {
+	Name       *string    `json:"name" binding:"omitempty,max=200"`
+	OfferState *string    `json:"offer_state" binding:"omitempty,oneof=pending draft"`
+	Recurrence *string    `json:"recurrence" binding:"omitempty,oneof=none weekly monthly cron"`
+	Weekdays   []int      `json:"weekdays" binding:"omitempty,max=7,dive,min=1,max=7"`
+	MonthDay   int        `json:"month_day" binding:"omitempty,min=1,max=31"`
+	Cron       string     `json:"cron" binding:"max=100"`
+	StartsOn   *time.Time `json:"starts_on"`
+	EndsOn     *time.Time `json:"ends_on"`
+	LeadDays   *int       `json:"lead_days" binding:"omitempty,min=0,max=60"`
+	Active     *int       `json:"active" binding:"omitempty,oneof=0 1"`
+}
+
+// OfferFromTemplateInput creates one offer from a template, delivery_start
+// is the day the template dates are shifted to
+type OfferFromTemplateInput struct {
+	DeliveryStart time.Time `json:"delivery_start" binding:"required"`
+}
+
+type OfferTemplateRun struct {
+	TemplateID     int       `json:"template_id"`
+	OfferID        int       `json:"offer_id"`
+	OccurrenceDate time.Time `json:"occurrence_date"`
+	Scheduled      bool      `json:"scheduled"`
+}
@@ -0,0 +1,109 @@
+package dto
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	TenderModeOpen   = "open"
+	TenderModeSealed = "sealed"
+
+	TenderAwardManual = "manual"
+	TenderAwardPrice  = "price"
+	TenderAwardRating = "rating"
+	TenderAwardScore  = "score"
+
+	TenderStateOpen    = "open"
+	TenderStateClosed  = "closed"
+	TenderStateAwarded = "awarded"
+	TenderStateNoBids  = "no_bids"
+)
+
+type OfferTender struct {
+	ID               int        `json:"id"`
+	OfferID          int        `json:"offer_id"`
+	Mode             string     `json:"mode"`
+	AwardBy          string     `json:"award_by"`
+	PriceWeight      float64    `json:"price_weight"`
+	RatingWeight     float64    `json:"rating_weight"`
+	Deadline         time.Time  `json:"deadline"`
+	State            string     `json:"state"`
+	WinnerResponseID int        `json:"winner_response_id"`
+	Note             string     `json:"note"`
+	ClosedAt         *time.Time `json:"closed_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// OfferTenderInput opens a tender on an offer or changes it. Once the tender
+// has bids only a later deadline can be set.
+type OfferTenderInput struct {
+	Mode         string    `json:"mode" binding:"omitempty,oneof=open sealed"`
+	AwardBy      string    `json:"award_by" binding:"omitempty,oneof=manual price rating score"`
+	PriceWeight  *float64  `json:"price_weight" binding:"omitempty,min=0,max=1"`
+	RatingWeight *float64  `json:"rating_weight" binding:"omitempty,min=0,max=1"`
+	Deadline     time.Time `json:"deadline" binding:"required"`
+}
+
+// TenderBid is a pending or decided response to a tender offer
+type TenderBid struct {
+	ResponseID  int       `json:"response_id"`
+	CompanyID   int       `json:"company_id"`
+	UserID      int       `json:"-"` // user of the bidding company, notified at the close
+	CompanyName string    `json:"company_name"`
+	Rating      int       `json:"rating"` // tbl_company.rating, 0-5
+	BidPrice    float64   `json:"bid_price"`
+	State       string    `json:"state"`
+	Score       float64   `json:"score"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type OfferTenderDetails struct {
+	OfferTender
+	BidCount  int         `json:"bid_count"`
+	LowestBid *float64    `json:"lowest_bid"` // hidden from bidders while a sealed tender is open
+	MyBid     *TenderBid  `json:"my_bid,omitempty"`
+	Bids      []TenderBid `json:"bids,omitempty"` // owner and admins only
+}
+
+// Rank scores the bids and sorts them best first by the award rule of the
+// tender. The score weighs the price against the lowest bid and the rating
+// against the top rating of 5. Manual tenders are sorted by price.
+func (t OfferTender) Rank(bids []TenderBid) []TenderBid {
+	ranked := append([]TenderBid(nil), bids...)
+	lowest := 0.0
+	for _, bid := range ranked {
+		if bid.BidPrice > 0 && (lowest == 0 || bid.BidPrice < lowest) {
+			lowest = bid.BidPrice
+		}
+	}
+	for i := range ranked {
+		if ranked[i].BidPrice > 0 {
+			ranked[i].Score = t.PriceWeight * lowest / ranked[i].BidPrice
+		}
+		ranked[i].Score += t.RatingWeight * float64(ranked[i].Rating) / 5
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		switch t.AwardBy {
+		case TenderAwardRating:
+			if a.Rating != b.Rating {
+				return a.Rating > b.Rating
+			}
+		case TenderAwardScore:
+			if a.Score != b.Score {
+				return a.Score > b.Score
+			}
+		}
+		if a.BidPrice != b.BidPrice {
+			return a.BidPrice < b.BidPrice
+		}
+		if a.Rating != b.Rating {
+			return a.Rating > b.Rating
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+	return ranked
+}
@@ -119,3 +119,82 @@ type PlanFilter struct {
 	Page          int     `form:"page,default=1" binding:"min=1"`
 	PerPage       int     `form:"per_page,default=10" binding:"min=1,max=100"`
 }
+
+// plan features whose usage is counted per billing cycle
+const (
+	PlanFeatureLoadPosts = "load_posts"
+	PlanFeatureEdocs     = "edocs"
+)
+
+// PlanLevels are the plan_level_t values from lowest to highest
+var PlanLevels = []string{"none", "basic", "advanced", "full"}
+
+// PlanLevelAtLeast reports whether level is the required level or higher
+func PlanLevelAtLeast(level, required string) bool {
+	rank := func(l string) int {
+		for i, value := range PlanLevels {
+			if value == l {
+				return i
+			}
+		}
+		return 0
+	}
+	return rank(level) >= rank(required)
+}
+
+// PlanEntitlement is the plan a company works under in the current billing
+// cycle. Plan is the company's active plan, or the default plan when it has
+// none (Default is set), or nil when there is no default plan either.
+type PlanEntitlement struct {
+	CompanyID  int       `json:"company_id"`
+	Plan       *Plan     `json:"plan"`
+	Default    bool      `json:"default"`
+	CycleStart time.Time `json:"cycle_start"`
+	CycleEnd   time.Time `json:"cycle_end"`
+}
+
+// Quota returns whether the feature is in the plan and its limit per cycle,
+// nil for unlimited
+func (e PlanEntitlement) Quota(feature string) (bool, *int) {
+	if e.Plan == nil {
+		return false, nil
+	}
+	switch feature {
+	case PlanFeatureLoadPosts:
+		if e.Plan.LoadPostsUnlimited {
+			return true, nil
+		}
+		return true, e.Plan.LoadPostsLimit
+	case PlanFeatureEdocs:
+		return e.Plan.EdocsAvailable, e.Plan.EdocsLimit
+	default:
+		return false, nil
+	}
+}
+
+func (e PlanEntitlement) GPSLevel() string {
+	if e.Plan == nil {
+		return "none"
+	}
+	return e.Plan.GPSTrackingLevel
+}
+
+func (e PlanEntitlement) APIAccess() bool {
+	return e.Plan != nil && e.Plan.APIAccess
+}
+
+type PlanQuotaUsage struct {
+	Feature   string `json:"feature"`
+	Available bool   `json:"available"`
+	Used      int    `json:"used"`
+	Limit     *int   `json:"limit"` // null is unlimited
+	Remaining *int   `json:"remaining"`
+}
+
+type PlanUsage struct {
+	PlanEntitlement
+	Quotas           []PlanQuotaUsage `json:"quotas"`
+	GPSTrackingLevel string           `json:"gps_tracking_level"`
+	GPSHasETA        bool             `json:"gps_has_eta"`
+	APIAccess        bool             `json:"api_access"`
+}
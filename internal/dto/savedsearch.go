@@ -0,0 +1,87 @@
+package dto
+
+import "time"
+
+const (
+	SearchFrequencyInstant = "instant"
+	SearchFrequencyDaily   = "daily"
+)
+
+// OfferSearchFilters are the GET /offer/ query parameters a search is saved
+// with, unset filters match every offer
+type OfferSearchFilters struct {
+	CompanyID     *int       `json:"company_id,omitempty" form:"company_id"`
+	OfferRole     *string    `json:"offer_role,omitempty" form:"offer_role" binding:"omitempty,oneof=sender carrier"`
+	VehicleTypeID *int       `json:"vehicle_type_id,omitempty" form:"vehicle_type_id"`
+	CargoID       *int       `json:"cargo_id,omitempty" form:"cargo_id"`
+	FromCountryID *int       `json:"from_country_id,omitempty" form:"from_country_id"`
+	FromCityID    *int       `json:"from_city_id,omitempty" form:"from_city_id"`
+	ToCountryID   *int       `json:"to_country_id,omitempty" form:"to_country_id"`
+	ToCityID      *int       `json:"to_city_id,omitempty" form:"to_city_id"`
+	PaymentMethod *string    `json:"payment_method,omitempty" form:"payment_method"`
+	Tax           *int       `json:"tax,omitempty" form:"tax"`
+	Trade         *int       `json:"trade,omitempty" form:"trade"`
+	Discount      *int       `json:"discount,omitempty" form:"discount"`
+	Featured      *int       `json:"featured,omitempty" form:"featured"`
+	Partner       *int       `json:"partner,omitempty" form:"partner"`
+	ValidityStart *time.Time `json:"validity_start,omitempty" form:"validity_start" time_format:"2006-01-02T15:04:05Z07:00"`
+	ValidityEnd   *time.Time `json:"validity_end,omitempty" form:"validity_end" time_format:"2006-01-02T15:04:05Z07:00"`
+	DeliveryStart *time.Time `json:"delivery_start,omitempty" form:"delivery_start" time_format:"2006-01-02T15:04:05Z07:00"`
+	DeliveryEnd   *time.Time `json:"delivery_end,omitempty" form:"delivery_end" time_format:"2006-01-02T15:04:05Z07:00"`
+	// cargo measures, the weight in kg of any weight_type
+	MaxWeightKG           *float64 `json:"max_weight_kg,omitempty" form:"max_weight_kg" binding:"omitempty,min=0"`
+	MaxVolumeM3           *float64 `json:"max_volume_m3,omitempty" form:"max_volume_m3" binding:"omitempty,min=0"`
+	MaxLoadingMeters      *float64 `json:"max_loading_meters,omitempty" form:"max_loading_meters" binding:"omitempty,min=0"`
+	ADR                   *int     `json:"adr,omitempty" form:"adr" binding:"omitempty,oneof=0 1"`
+	TemperatureControlled *int     `json:"temperature_controlled,omitempty" form:"temperature_controlled" binding:"omitempty,oneof=0 1"`
+	Stackable             *int     `json:"stackable,omitempty" form:"stackable" binding:"omitempty,oneof=0 1"`
+}
+
+type SavedSearch struct {
+	ID           int                `json:"id"`
+	UUID         string             `json:"uuid"`
+	UserID       int                `json:"user_id"`
+	CompanyID    int                `json:"company_id"`
+	Name         string             `json:"name"`
+	Filters      OfferSearchFilters `json:"filters"`
+	Frequency    string             `json:"frequency"`
+	NotifyPush   int                `json:"notify_push"`
+	NotifyEmail  int                `json:"notify_email"`
+	NotifyChat   int                `json:"notify_chat"`
+	LastDigestAt *time.Time         `json:"last_digest_at"`
+	PendingCount int                `json:"pending_count"` // matches waiting for the next digest
+	CreatedAt    time.Time          `json:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at"`
+	Active       int                `json:"active"`
+}
+
+// SavedSearchInput creates a search, filters missing from the body are taken
+// from the query string so a GET /offer/ query can be saved as is
+type SavedSearchInput struct {
+	Name        string              `json:"name" binding:"required,max=200"`
+	Filters     *OfferSearchFilters `json:"filters"`
+	Frequency   string              `json:"frequency" binding:"omitempty,oneof=instant daily"`
+	NotifyPush  *int                `json:"notify_push" binding:"omitempty,oneof=0 1"`
+	NotifyEmail *int                `json:"notify_email" binding:"omitempty,oneof=0 1"`
+	NotifyChat  *int                `json:"notify_chat" binding:"omitempty,oneof=0 1"`
+	Active      *int                `json:"active" binding:"omitempty,oneof=0 1"`
+}
+
+// SavedSearchRecipient is a search with the contact of its owner
+type SavedSearchRecipient struct {
+	SavedSearch
+	Email    string
+	MatchIDs []int
+}
+
+// OfferBrief is the part of an offer shown in search notifications
+type OfferBrief struct {
+	ID            int       `json:"id" db:"id"`
+	FromCountry   string    `json:"from_country" db:"from_country"`
+	FromRegion    string    `json:"from_region" db:"from_region"`
+	ToCountry     string    `json:"to_country" db:"to_country"`
+	ToRegion      string    `json:"to_region" db:"to_region"`
+	OfferPrice    float64   `json:"offer_price" db:"offer_price"`
+	Currency      string    `json:"currency" db:"currency"`
+	DeliveryStart time.Time `json:"delivery_start" db:"delivery_start"`
+}
@@ -0,0 +1,60 @@
+package dto
+
+import "time"
+
+const (
+	TripAlertDeviation = "deviation"
+	TripAlertIdle      = "idle"
+	TripAlertSpeed     = "speed"
+)
+
+type TripRule struct {
+	ID             int       `json:"id"`
+	TripID         int       `json:"trip_id"`
+	CompanyID      int       `json:"company_id"`
+	MaxDeviationKM *float64  `json:"max_deviation_km"`
+	Route          []Point   `json:"route"`
+	MaxIdleMin     *int      `json:"max_idle_min"`
+	MaxSpeedKMH    *float64  `json:"max_speed_kmh"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Active         int       `json:"active"`
+}
+
+type TripRuleInput struct {
+	MaxDeviationKM *float64 `json:"max_deviation_km" binding:"omitempty,gt=0"`
+	Route          []Point  `json:"route"` // planned route, straight line between trip locations when empty
+	MaxIdleMin     *int     `json:"max_idle_min" binding:"omitempty,min=1"`
+	MaxSpeedKMH    *float64 `json:"max_speed_kmh" binding:"omitempty,gt=0"`
+	Active         *int     `json:"active" binding:"omitempty,oneof=0 1"`
+}
+
+type TripAlert struct {
+	ID          int64      `json:"id"`
+	UUID        string     `json:"uuid"`
+	TripID      int        `json:"trip_id"`
+	VehicleID   int        `json:"vehicle_id"`
+	DriverID    int        `json:"driver_id"`
+	GPSLogID    int64      `json:"gps_log_id"`
+	AlertType   string     `json:"alert_type"`
+	Value       float64    `json:"value"`
+	LimitValue  float64    `json:"limit_value"`
+	Coordinates Point      `json:"coordinates"`
+	AlertDt     time.Time  `json:"alert_dt"`
+	ResolvedDt  *time.Time `json:"resolved_dt"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type TripAlertQuery struct {
+	TripID    *int       `form:"trip_id"`
+	OfferID   *int       `form:"offer_id"`
+	VehicleID *int       `form:"vehicle_id"`
+	AlertType *string    `form:"alert_type" binding:"omitempty,oneof=deviation idle speed"`
+	Open      *bool      `form:"open"`
+	From      *time.Time `form:"from" time_format:"2006-01-02"`
+	To        *time.Time `form:"to" time_format:"2006-01-02"`
+	Offset    int        `form:"offset" binding:"omitempty,min=0"`
+	Limit     int        `form:"limit" binding:"omitempty,min=1,max=1000"`
+
+	ScopeCompanyID *int `form:"-"` // set by the service for non admin users
+}
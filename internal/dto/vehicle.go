@@ -33,6 +33,11 @@ type VehicleCreate struct {
 	Meta2              string    `json:"meta2"`
 	Meta3              string    `json:"meta3"`
 	Available          int       `json:"available"`
+	PayloadKG          int       `json:"payload_kg"`                     // 0 when unknown
+	VolumeM3           float64   `json:"volume_m3" binding:"min=0"`      // cargo space, 0 when unknown
+	LoadingMeters      float64   `json:"loading_meters" binding:"min=0"` // floor length, 0 when unknown
+	Reefer             int       `json:"reefer" binding:"oneof=0 1"`     // temperature controlled body
+	ADR                int       `json:"adr" binding:"oneof=0 1"`        // approved for dangerous goods
 	CreatedAt          time.Time `json:"created_at"`
 	UpdatedAt          time.Time `json:"updated_at"`
 	Active             int       `json:"active"`
@@ -41,28 +46,33 @@ type VehicleCreate struct {
 }
 
 type VehicleUpdate struct {
-	CompanyID          *int    `json:"company_id,omitempty"`
-	VehicleTypeID      *int    `json:"vehicle_type_id,omitempty"`
-	VehicleBrandID     *int    `json:"vehicle_brand_id,omitempty"`
-	VehicleModelID     *int    `json:"vehicle_model_id,omitempty"`
-	YearOfIssue        *string `json:"year_of_issue,omitempty"`
-	Mileage            *int    `json:"mileage,omitempty"`
-	Numberplate        *string `json:"numberplate,omitempty"`
-	TrailerNumberplate *string `json:"trailer_numberplate,omitempty"`
-	Gps                *int    `json:"gps,omitempty"`
-	Photo1URL          *string `json:"photo1_url,omitempty"`
-	Photo2URL          *string `json:"photo2_url,omitempty"`
-	Photo3URL          *string `json:"photo3_url,omitempty"`
-	Docs1URL           *string `json:"docs1_url,omitempty"`
-	Docs2URL           *string `json:"docs2_url,omitempty"`
-	Docs3URL           *string `json:"docs3_url,omitempty"`
-	ViewCount          *int    `json:"view_count"`
-	Meta               *string `json:"meta"`
-	Meta2              *string `json:"meta2"`
-	Meta3              *string `json:"meta3"`
-	Available          *int    `json:"available"`
-	Active             *int    `json:"active,omitempty"`
-	Deleted            *int    `json:"deleted,omitempty"`
+	CompanyID          *int     `json:"company_id,omitempty"`
+	VehicleTypeID      *int     `json:"vehicle_type_id,omitempty"`
+	VehicleBrandID     *int     `json:"vehicle_brand_id,omitempty"`
+	VehicleModelID     *int     `json:"vehicle_model_id,omitempty"`
+	YearOfIssue        *string  `json:"year_of_issue,omitempty"`
+	Mileage            *int     `json:"mileage,omitempty"`
+	Numberplate        *string  `json:"numberplate,omitempty"`
+	TrailerNumberplate *string  `json:"trailer_numberplate,omitempty"`
+	Gps                *int     `json:"gps,omitempty"`
+	Photo1URL          *string  `json:"photo1_url,omitempty"`
+	Photo2URL          *string  `json:"photo2_url,omitempty"`
+	Photo3URL          *string  `json:"photo3_url,omitempty"`
+	Docs1URL           *string  `json:"docs1_url,omitempty"`
+	Docs2URL           *string  `json:"docs2_url,omitempty"`
+	Docs3URL           *string  `json:"docs3_url,omitempty"`
+	ViewCount          *int     `json:"view_count"`
+	Meta               *string  `json:"meta"`
+	Meta2              *string  `json:"meta2"`
+	Meta3              *string  `json:"meta3"`
+	Available          *int     `json:"available"`
+	PayloadKG          *int     `json:"payload_kg" binding:"omitempty,min=0"`
+	VolumeM3           *float64 `json:"volume_m3" binding:"omitempty,min=0"`
+	LoadingMeters      *float64 `json:"loading_meters" binding:"omitempty,min=0"`
+	Reefer             *int     `json:"reefer" binding:"omitempty,oneof=0 1"`
+	ADR                *int     `json:"adr" binding:"omitempty,oneof=0 1"`
+	Active             *int     `json:"active,omitempty"`
+	Deleted            *int     `json:"deleted,omitempty"`
 }
 
 type VehicleShort struct {
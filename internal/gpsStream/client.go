@@ -0,0 +1,165 @@
+package gpsStream
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"texApi/internal/repo"
+)
+
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = (pongWait * 9) / 10
+	maxMessageSize = 4096
+)
+
+type Client struct {
+	hub       *Hub
+	conn      *websocket.Conn
+	send      chan *StreamMessage
+	userID    int
+	companyID int
+	isAdmin   bool
+	topics    map[string]bool // guarded by hub.mu
+}
+
+func NewClient(hub *Hub, conn *websocket.Conn, userID, companyID int, isAdmin bool) *Client {
+	return &Client{
+		hub:       hub,
+		conn:      conn,
+		send:      make(chan *StreamMessage, 256),
+		userID:    userID,
+		companyID: companyID,
+		isAdmin:   isAdmin,
+		topics:    make(map[string]bool),
+	}
+}
+
+// authorizedTopics checks every requested id against offer ownership and
+// exec_company_id, denied ids are returned separately
+func (c *Client) authorizedTopics(req SubscriptionRequest) (allowed []string, denied []string) {
+	for _, id := range req.TripIDs {
+		if c.isAdmin || repo.CanCompanyAccessTrip(id, c.companyID) {
+			allowed = append(allowed, TripTopic(id))
+		} else {
+			denied = append(denied, TripTopic(id))
+		}
+	}
+	for _, id := range req.OfferIDs {
+		owner, err := repo.GetOfferOwner(id)
+		if c.isAdmin || (err == nil && owner.CanAccess(c.companyID)) {
+			allowed = append(allowed, OfferTopic(id))
+		} else {
+			denied = append(denied, OfferTopic(id))
+		}
+	}
+	for _, id := range req.VehicleIDs {
+		if c.isAdmin || repo.CanCompanyAccessVehicle(id, c.companyID) {
+			allowed = append(allowed, VehicleTopic(id))
+		} else {
+			denied = append(denied, VehicleTopic(id))
+		}
+	}
+	return allowed, denied
+}
+
+func (c *Client) handleSubscription(req SubscriptionRequest) {
+	switch req.Action {
+	case ActionSubscribe:
+		allowed, denied := c.authorizedTopics(req)
+		if len(allowed) > 0 {
+			c.hub.Subscribe(c, allowed)
+			c.sendMessage(&StreamMessage{Type: MessageTypeSubscribed, Topics: allowed})
+		}
+		if len(denied) > 0 {
+			c.sendMessage(&StreamMessage{Type: MessageTypeError, Topics: denied, Content: "Access denied"})
+		}
+
+	case ActionUnsubscribe:
+		topics := make([]string, 0, len(req.TripIDs)+len(req.OfferIDs)+len(req.VehicleIDs))
+		for _, id := range req.TripIDs {
+			topics = append(topics, TripTopic(id))
+		}
+		for _, id := range req.OfferIDs {
+			topics = append(topics, OfferTopic(id))
+		}
+		for _, id := range req.VehicleIDs {
+			topics = append(topics, VehicleTopic(id))
+		}
+		c.hub.Unsubscribe(c, topics)
+		c.sendMessage(&StreamMessage{Type: MessageTypeUnsubscribed, Topics: topics})
+
+	default:
+		c.sendMessage(&StreamMessage{Type: MessageTypeError, Content: fmt.Sprintf("Unknown action: %s", req.Action)})
+	}
+}
+
+func (c *Client) ReadPump() {
+	defer func() {
+		c.hub.unregister <- c
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("Unexpected GPS stream close: %v", err)
+			}
+			break
+		}
+
+		var req SubscriptionRequest
+		if err := json.Unmarshal(message, &req); err != nil {
+			c.sendMessage(&StreamMessage{Type: MessageTypeError, Content: fmt.Sprintf("Invalid message format: %v", err)})
+			continue
+		}
+		c.handleSubscription(req)
+	}
+}
+
+func (c *Client) WritePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteJSON(message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) sendMessage(message *StreamMessage) {
+	select {
+	case c.send <- message:
+	default:
+		log.Printf("GPS stream channel full for user %d", c.userID)
+	}
+}
@@ -0,0 +1,75 @@
+package gpsStream
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"texApi/config"
+	"texApi/pkg/middlewares"
+	"texApi/pkg/utils"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		return true // same policy as the chat websocket
+	},
+}
+
+func Controller(router *gin.Engine) {
+	hub = NewHub()
+	go hub.Run()
+
+	group := router.Group(config.ENV.API_PREFIX + "/ws/")
+	group.Use(middlewares.GuardURLParam)
+	{
+		group.GET("/gps/", HandleWebSocket)
+	}
+}
+
+// HandleWebSocket upgrades the connection, initial topics can be passed as
+// comma separated trip_ids, offer_ids and vehicle_ids query params
+func HandleWebSocket(ctx *gin.Context) {
+	userID := ctx.MustGet("id").(int)
+	companyID := ctx.MustGet("companyID").(int)
+	role, _ := ctx.MustGet("role").(string)
+
+	initial := SubscriptionRequest{
+		Action:     ActionSubscribe,
+		TripIDs:    parseIDs(ctx.Query("trip_ids")),
+		OfferIDs:   parseIDs(ctx.Query("offer_ids")),
+		VehicleIDs: parseIDs(ctx.Query("vehicle_ids")),
+	}
+
+	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		log.Printf("Error upgrading GPS stream connection: %v", err)
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Failed to open websocket", err.Error()))
+		return
+	}
+
+	client := NewClient(hub, conn, userID, companyID, role == "admin" || role == "system")
+	hub.register <- client
+
+	if len(initial.TripIDs)+len(initial.OfferIDs)+len(initial.VehicleIDs) > 0 {
+		client.handleSubscription(initial)
+	}
+
+	go client.WritePump()
+	go client.ReadPump()
+}
+
+func parseIDs(value string) []int {
+	var ids []int
+	for _, part := range strings.Split(value, ",") {
+		if id, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
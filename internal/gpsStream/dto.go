@@ -0,0 +1,28 @@
+package gpsStream
+
+import "texApi/internal/dto"
+
+const (
+	ActionSubscribe   = "subscribe"
+	ActionUnsubscribe = "unsubscribe"
+
+	MessageTypePoint        = "gps_point"
+	MessageTypeSubscribed   = "subscribed"
+	MessageTypeUnsubscribed = "unsubscribed"
+	MessageTypeError        = "error"
+)
+
+// SubscriptionRequest is sent by the client to (un)subscribe from topics
+type SubscriptionRequest struct {
+	Action     string `json:"action"`
+	TripIDs    []int  `json:"trip_ids"`
+	OfferIDs   []int  `json:"offer_ids"`
+	VehicleIDs []int  `json:"vehicle_ids"`
+}
+
+type StreamMessage struct {
+	Type    string      `json:"type"`
+	Topics  []string    `json:"topics,omitempty"`
+	Point   *dto.GPSLog `json:"point,omitempty"`
+	Content string      `json:"content,omitempty"`
+}
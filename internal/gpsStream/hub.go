@@ -0,0 +1,164 @@
+package gpsStream
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"texApi/internal/dto"
+	"texApi/internal/repo"
+)
+
+type Hub struct {
+	clients    map[*Client]bool
+	topics     map[string]map[*Client]bool
+	register   chan *Client
+	unregister chan *Client
+	mu         sync.RWMutex
+}
+
+// hub is created by Controller, Publish is a no-op until then
+var hub *Hub
+
+func NewHub() *Hub {
+	return &Hub{
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+		clients:    make(map[*Client]bool),
+		topics:     make(map[string]map[*Client]bool),
+	}
+}
+
+func (h *Hub) Run() {
+	for {
+		select {
+		case client := <-h.register:
+			h.mu.Lock()
+			h.clients[client] = true
+			h.mu.Unlock()
+			log.Printf("GPS stream client registered: UserID=%d", client.userID)
+
+		case client := <-h.unregister:
+			h.unregisterClient(client)
+		}
+	}
+}
+
+func (h *Hub) unregisterClient(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	delete(h.clients, client)
+
+	for topic := range client.topics {
+		delete(h.topics[topic], client)
+		if len(h.topics[topic]) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+
+	close(client.send)
+	log.Printf("GPS stream client unregistered: UserID=%d", client.userID)
+}
+
+func (h *Hub) Subscribe(client *Client, topics []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, topic := range topics {
+		if _, ok := h.topics[topic]; !ok {
+			h.topics[topic] = make(map[*Client]bool)
+		}
+		h.topics[topic][client] = true
+		client.topics[topic] = true
+	}
+}
+
+func (h *Hub) Unsubscribe(client *Client, topics []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, topic := range topics {
+		delete(h.topics[topic], client)
+		if len(h.topics[topic]) == 0 {
+			delete(h.topics, topic)
+		}
+		delete(client.topics, topic)
+	}
+}
+
+func (h *Hub) deliver(topics []string, point dto.GPSLog) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	// a client subscribed to both the trip and its offer gets the point once
+	delivered := make(map[*Client]bool)
+	for _, topic := range topics {
+		for client := range h.topics[topic] {
+			if delivered[client] {
+				continue
+			}
+			delivered[client] = true
+
+			message := &StreamMessage{Type: MessageTypePoint, Topics: []string{topic}, Point: &point}
+			select {
+			case client.send <- message:
+			default:
+				log.Printf("GPS stream channel full for user %d, point %d dropped", client.userID, point.ID)
+			}
+		}
+	}
+}
+
+func (h *Hub) hasSubscribers() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.topics) > 0
+}
+
+func TripTopic(id int) string    { return fmt.Sprintf("trip:%d", id) }
+func OfferTopic(id int) string   { return fmt.Sprintf("offer:%d", id) }
+func VehicleTopic(id int) string { return fmt.Sprintf("vehicle:%d", id) }
+
+// Publish pushes committed GPS points to every client watching the point's
+// trip, vehicle, offer or one of the offers linked to the trip.
+func Publish(points []dto.GPSLog) {
+	if hub == nil || len(points) == 0 || !hub.hasSubscribers() {
+		return
+	}
+
+	var tripIDs []int
+	seen := make(map[int]bool)
+	for _, point := range points {
+		if point.TripID != nil && !seen[*point.TripID] {
+			seen[*point.TripID] = true
+			tripIDs = append(tripIDs, *point.TripID)
+		}
+	}
+
+	tripOffers := map[int][]int{}
+	if len(tripIDs) > 0 {
+		var err error
+		tripOffers, err = repo.GetTripOfferIDs(tripIDs)
+		if err != nil {
+			log.Printf("Failed to resolve trip offers for GPS stream: %v", err)
+		}
+	}
+
+	for _, point := range points {
+		topics := []string{VehicleTopic(point.VehicleID)}
+		if point.OfferID != nil {
+			topics = append(topics, OfferTopic(*point.OfferID))
+		}
+		if point.TripID != nil {
+			topics = append(topics, TripTopic(*point.TripID))
+			for _, offerID := range tripOffers[*point.TripID] {
+				topics = append(topics, OfferTopic(offerID))
+			}
+		}
+		hub.deliver(topics, point)
+	}
+}
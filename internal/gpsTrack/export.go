@@ -0,0 +1,256 @@
+package gpsTrack
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"texApi/internal/dto"
+)
+
+const (
+	FormatGPX     = "gpx"
+	FormatKML     = "kml"
+	FormatGeoJSON = "geojson"
+)
+
+// ExportTrack is a trip with its ordered points and detected stops
+type ExportTrack struct {
+	Trip   dto.TripDetailed
+	Points []dto.GPSLog
+	Stops  []dto.TripStop
+}
+
+// ContentType returns the mime type and file extension of the export format
+func ContentType(format string) (string, string) {
+	switch format {
+	case FormatGPX:
+		return "application/gpx+xml", "gpx"
+	case FormatKML:
+		return "application/vnd.google-earth.kml+xml", "kml"
+	default:
+		return "application/geo+json", "geojson"
+	}
+}
+
+// WriteTrack encodes the track in the format straight into w through a
+// buffer, without building the document first. The points themselves are
+// held in memory: KML lists them several times, GeoJSON needs the whole line,
+// and cleaning and simplifying work on the full track.
+func WriteTrack(w io.Writer, format string, track ExportTrack) error {
+	bw := bufio.NewWriter(w)
+
+	var err error
+	switch format {
+	case FormatGPX:
+		err = writeGPX(bw, track)
+	case FormatKML:
+		err = writeKML(bw, track)
+	case FormatGeoJSON:
+		err = writeGeoJSON(bw, track)
+	default:
+		return fmt.Errorf("unsupported export format: %s", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+func trackName(trip dto.TripDetailed) string {
+	name := fmt.Sprintf("Trip #%d", trip.ID)
+	if trip.FromAddress != nil && trip.ToAddress != nil {
+		name += fmt.Sprintf(": %s - %s", *trip.FromAddress, *trip.ToAddress)
+	}
+	return name
+}
+
+func escapeXML(s string) string {
+	var sb strings.Builder
+	_ = xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+func formatCoord(v float64) string {
+	return strconv.FormatFloat(v, 'f', 6, 64)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func stopName(i int, stop dto.TripStop) string {
+	return fmt.Sprintf("Stop %d (%d min)", i+1, stop.DurationSec/60)
+}
+
+func writeGPX(w *bufio.Writer, track ExportTrack) error {
+	name := escapeXML(trackName(track.Trip))
+
+	fmt.Fprint(w, xml.Header)
+	fmt.Fprint(w, `<gpx version="1.1" creator="texApi" xmlns="http://www.topografix.com/GPX/1/1">`+"\n")
+	fmt.Fprintf(w, "<metadata><name>%s</name></metadata>\n", name)
+
+	for i, stop := range track.Stops {
+		fmt.Fprintf(w, `<wpt lat="%s" lon="%s"><time>%s</time><name>%s</name><desc>%s - %s</desc><type>stop</type></wpt>`+"\n",
+			formatCoord(stop.Location.Lat), formatCoord(stop.Location.Lng), formatTime(stop.StartDt),
+			escapeXML(stopName(i, stop)), formatTime(stop.StartDt), formatTime(stop.EndDt))
+	}
+
+	fmt.Fprintf(w, "<trk><name>%s</name><trkseg>\n", name)
+	for _, p := range track.Points {
+		fmt.Fprintf(w, `<trkpt lat="%s" lon="%s"><time>%s</time>`,
+			formatCoord(p.Coordinates.Lat), formatCoord(p.Coordinates.Lng), formatTime(p.LogDt))
+		// speed and course are not part of GPX 1.1 trkpt, they go to extensions
+		if p.Speed != nil || p.Heading != nil {
+			fmt.Fprint(w, "<extensions>")
+			if p.Speed != nil {
+				fmt.Fprintf(w, "<speed>%.2f</speed>", *p.Speed)
+			}
+			if p.Heading != nil {
+				fmt.Fprintf(w, "<course>%.2f</course>", *p.Heading)
+			}
+			fmt.Fprint(w, "</extensions>")
+		}
+		fmt.Fprint(w, "</trkpt>\n")
+	}
+	_, err := fmt.Fprint(w, "</trkseg></trk>\n</gpx>\n")
+	return err
+}
+
+func writeKML(w *bufio.Writer, track ExportTrack) error {
+	name := escapeXML(trackName(track.Trip))
+
+	fmt.Fprint(w, xml.Header)
+	fmt.Fprint(w, `<kml xmlns="http://www.opengis.net/kml/2.2" xmlns:gx="http://www.google.com/kml/ext/2.2">`+"\n")
+	fmt.Fprintf(w, "<Document><name>%s</name>\n", name)
+	fmt.Fprint(w, `<Schema id="trackpoint"><gx:SimpleArrayField name="speed" type="float"><displayName>Speed (km/h)</displayName></gx:SimpleArrayField></Schema>`+"\n")
+
+	fmt.Fprintf(w, "<Placemark><name>%s</name><gx:Track>\n", name)
+	for _, p := range track.Points {
+		fmt.Fprintf(w, "<when>%s</when>\n", formatTime(p.LogDt))
+	}
+	for _, p := range track.Points {
+		fmt.Fprintf(w, "<gx:coord>%s %s 0</gx:coord>\n", formatCoord(p.Coordinates.Lng), formatCoord(p.Coordinates.Lat))
+	}
+	for _, p := range track.Points {
+		heading := 0.0
+		if p.Heading != nil {
+			heading = *p.Heading
+		}
+		fmt.Fprintf(w, "<gx:angles>%.2f 0 0</gx:angles>\n", heading)
+	}
+	fmt.Fprint(w, `<ExtendedData><SchemaData schemaUrl="#trackpoint"><gx:SimpleArrayData name="speed">`+"\n")
+	for _, p := range track.Points {
+		speed := ""
+		if p.Speed != nil {
+			speed = fmt.Sprintf("%.2f", *p.Speed)
+		}
+		fmt.Fprintf(w, "<gx:value>%s</gx:value>\n", speed)
+	}
+	fmt.Fprint(w, "</gx:SimpleArrayData></SchemaData></ExtendedData>\n</gx:Track></Placemark>\n")
+
+	for i, stop := range track.Stops {
+		fmt.Fprintf(w, "<Placemark><name>%s</name><TimeSpan><begin>%s</begin><end>%s</end></TimeSpan><Point><coordinates>%s,%s,0</coordinates></Point></Placemark>\n",
+			escapeXML(stopName(i, stop)), formatTime(stop.StartDt), formatTime(stop.EndDt),
+			formatCoord(stop.Location.Lng), formatCoord(stop.Location.Lat))
+	}
+
+	_, err := fmt.Fprint(w, "</Document>\n</kml>\n")
+	return err
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// writeGeoJSON writes a FeatureCollection with the track as LineString, every
+// point with its time, speed and heading, and the stops
+func writeGeoJSON(w *bufio.Writer, track ExportTrack) error {
+	enc := json.NewEncoder(w)
+
+	fmt.Fprint(w, `{"type":"FeatureCollection","features":[`+"\n")
+
+	line := make([][2]float64, len(track.Points))
+	times := make([]string, len(track.Points))
+	for i, p := range track.Points {
+		line[i] = [2]float64{p.Coordinates.Lng, p.Coordinates.Lat}
+		times[i] = formatTime(p.LogDt)
+	}
+	features := 0
+	writeFeature := func(f geoJSONFeature) error {
+		if features > 0 {
+			fmt.Fprint(w, ",")
+		}
+		features++
+		return enc.Encode(f)
+	}
+
+	err := writeFeature(geoJSONFeature{
+		Type:     "Feature",
+		Geometry: geoJSONGeometry{Type: "LineString", Coordinates: line},
+		Properties: map[string]interface{}{
+			"kind":        "track",
+			"name":        trackName(track.Trip),
+			"trip_id":     track.Trip.ID,
+			"status":      track.Trip.Status,
+			"distance_km": track.Trip.DistanceKM,
+			"start_date":  track.Trip.StartDate,
+			"end_date":    track.Trip.EndDate,
+			"times":       times,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, p := range track.Points {
+		err := writeFeature(geoJSONFeature{
+			Type:     "Feature",
+			Geometry: geoJSONGeometry{Type: "Point", Coordinates: [2]float64{p.Coordinates.Lng, p.Coordinates.Lat}},
+			Properties: map[string]interface{}{
+				"kind":    "point",
+				"id":      p.ID,
+				"log_dt":  formatTime(p.LogDt),
+				"speed":   p.Speed,
+				"heading": p.Heading,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, stop := range track.Stops {
+		err := writeFeature(geoJSONFeature{
+			Type:     "Feature",
+			Geometry: geoJSONGeometry{Type: "Point", Coordinates: [2]float64{stop.Location.Lng, stop.Location.Lat}},
+			Properties: map[string]interface{}{
+				"kind":         "stop",
+				"name":         stopName(i, stop),
+				"start_dt":     formatTime(stop.StartDt),
+				"end_dt":       formatTime(stop.EndDt),
+				"duration_sec": stop.DurationSec,
+				"point_count":  stop.PointCount,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprint(w, "]}\n")
+	return err
+}
@@ -0,0 +1,52 @@
+package gpsTrack
+
+import (
+	"math"
+	"strings"
+
+	"texApi/internal/dto"
+)
+
+// EncodePolyline encodes points with the Google polyline algorithm, precision 5
+func EncodePolyline(points []dto.Point) string {
+	var sb strings.Builder
+	var prevLat, prevLng int64
+
+	for _, p := range points {
+		lat := int64(math.Round(p.Lat * 1e5))
+		lng := int64(math.Round(p.Lng * 1e5))
+
+		encodePolylineValue(&sb, lat-prevLat)
+		encodePolylineValue(&sb, lng-prevLng)
+
+		prevLat, prevLng = lat, lng
+	}
+
+	return sb.String()
+}
+
+func encodePolylineValue(sb *strings.Builder, value int64) {
+	v := value << 1
+	if value < 0 {
+		v = ^v
+	}
+
+	for v >= 0x20 {
+		sb.WriteByte(byte((0x20 | (v & 0x1f)) + 63))
+		v >>= 5
+	}
+	sb.WriteByte(byte(v + 63))
+}
+
+// TrackPolyline cleans, simplifies and encodes a single vehicle track
+func TrackPolyline(logs []dto.GPSLog, toleranceM float64) string {
+	opts := DefaultOptions()
+	opts.ToleranceM = toleranceM
+
+	track := Process(logs, opts)
+	points := make([]dto.Point, len(track))
+	for i, log := range track {
+		points[i] = log.Coordinates
+	}
+	return EncodePolyline(points)
+}
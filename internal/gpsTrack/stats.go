@@ -0,0 +1,90 @@
+package gpsTrack
+
+import (
+	"time"
+
+	"texApi/internal/dto"
+)
+
+const (
+	movingSpeedKMH  = 5.0 // same threshold as the ETA recent speed
+	stopRadiusM     = 100.0
+	minStopDuration = 5 * time.Minute
+)
+
+// Summarize computes distance, moving and idle time and stops of a cleaned
+// single vehicle track sorted by log_dt. DrivenKM is the haversine sum, the
+// repo replaces it with the PostGIS length when the summary is stored.
+func Summarize(track []dto.GPSLog) dto.TripSummary {
+	summary := dto.TripSummary{
+		PointCount: len(track),
+		Stops:      DetectStops(track),
+	}
+	if len(track) == 0 {
+		return summary
+	}
+
+	first, last := track[0].LogDt, track[len(track)-1].LogDt
+	summary.FirstLogDt, summary.LastLogDt = &first, &last
+
+	var distanceM, movingM float64
+	for i := 1; i < len(track); i++ {
+		d := Distance(track[i-1].Coordinates, track[i].Coordinates)
+		seconds := track[i].LogDt.Sub(track[i-1].LogDt).Seconds()
+		distanceM += d
+		if seconds <= 0 {
+			continue
+		}
+
+		if d/seconds*3.6 >= movingSpeedKMH {
+			summary.MovingSec += int(seconds)
+			movingM += d
+		} else {
+			summary.IdleSec += int(seconds)
+		}
+	}
+
+	summary.DrivenKM = distanceM / 1000
+	if summary.MovingSec > 0 {
+		summary.AvgMovingSpeed = movingM / float64(summary.MovingSec) * 3.6
+	}
+
+	return summary
+}
+
+// DetectStops finds places where the vehicle stayed within stopRadiusM for at
+// least minStopDuration, the location is the centroid of the points there
+func DetectStops(track []dto.GPSLog) []dto.TripStop {
+	stops := []dto.TripStop{}
+
+	for start := 0; start < len(track); {
+		end := start
+		for end+1 < len(track) && Distance(track[start].Coordinates, track[end+1].Coordinates) <= stopRadiusM {
+			end++
+		}
+
+		duration := track[end].LogDt.Sub(track[start].LogDt)
+		if end > start && duration >= minStopDuration {
+			var lat, lng float64
+			for _, log := range track[start : end+1] {
+				lat += log.Coordinates.Lat
+				lng += log.Coordinates.Lng
+			}
+			count := end - start + 1
+
+			stops = append(stops, dto.TripStop{
+				Location:    dto.Point{Lat: lat / float64(count), Lng: lng / float64(count)},
+				StartDt:     track[start].LogDt,
+				EndDt:       track[end].LogDt,
+				DurationSec: int(duration.Seconds()),
+				PointCount:  count,
+			})
+			start = end + 1
+			continue
+		}
+
+		start++
+	}
+
+	return stops
+}
@@ -0,0 +1,251 @@
+package gpsTrack
+
+import (
+	"math"
+	"sort"
+
+	"texApi/config"
+	"texApi/internal/dto"
+)
+
+const earthRadiusM = 6371000.0
+
+type Options struct {
+	MaxSpeedKMH  float64 // 0 disables the jump filter
+	MaxAccuracyM float64 // 0 disables the accuracy filter
+	ToleranceM   float64 // 0 disables simplification
+}
+
+// DefaultOptions reads the filter limits from config, simplification is left to the caller
+func DefaultOptions() Options {
+	return Options{
+		MaxSpeedKMH:  float64(config.ENV.GPS_MAX_SPEED_KMH),
+		MaxAccuracyM: float64(config.ENV.GPS_MAX_ACCURACY_M),
+	}
+}
+
+// Process cleans and simplifies the tracks in logs. Every vehicle is handled
+// as its own track in log_dt order, the kept points are returned in their
+// original order.
+func Process(logs []dto.GPSLog, opts Options) []dto.GPSLog {
+	if len(logs) == 0 {
+		return logs
+	}
+
+	keep := make([]bool, len(logs))
+	for _, track := range vehicleTracks(logs) {
+		track = clean(logs, track, opts)
+		if opts.ToleranceM > 0 {
+			track = simplify(logs, track, opts.ToleranceM)
+		}
+		for _, i := range track {
+			keep[i] = true
+		}
+	}
+
+	result := make([]dto.GPSLog, 0, len(logs))
+	for i, log := range logs {
+		if keep[i] {
+			result = append(result, log)
+		}
+	}
+	return result
+}
+
+// vehicleTracks groups the positions of logs by vehicle, sorted by log_dt
+func vehicleTracks(logs []dto.GPSLog) [][]int {
+	byVehicle := make(map[int][]int)
+	var order []int
+	for i, log := range logs {
+		if _, ok := byVehicle[log.VehicleID]; !ok {
+			order = append(order, log.VehicleID)
+		}
+		byVehicle[log.VehicleID] = append(byVehicle[log.VehicleID], i)
+	}
+
+	tracks := make([][]int, 0, len(order))
+	for _, vehicleID := range order {
+		track := byVehicle[vehicleID]
+		sort.SliceStable(track, func(a, b int) bool {
+			return logs[track[a]].LogDt.Before(logs[track[b]].LogDt)
+		})
+		tracks = append(tracks, track)
+	}
+	return tracks
+}
+
+// jumpRebaseRun is the number of consecutive jumps that agree with each other
+// after which the track continues from them, the anchor was the bad fix
+const jumpRebaseRun = 3
+
+func clean(logs []dto.GPSLog, track []int, opts Options) []int {
+	fixes := make([]int, 0, len(track))
+	for _, i := range track {
+		log := logs[i]
+
+		// devices send 0,0 and a zero accuracy when they have no fix
+		if log.Coordinates.Lat == 0 && log.Coordinates.Lng == 0 {
+			continue
+		}
+		if log.Accuracy != nil && (*log.Accuracy <= 0 ||
+			(opts.MaxAccuracyM > 0 && *log.Accuracy > opts.MaxAccuracyM)) {
+			continue
+		}
+		fixes = append(fixes, i)
+	}
+
+	if opts.MaxSpeedKMH > 0 {
+		fixes = dropJumps(logs, fixes, opts.MaxSpeedKMH)
+	}
+	return dropSpikes(logs, fixes, opts.MaxAccuracyM)
+}
+
+// dropJumps removes fixes that could only be reached faster than maxSpeedKMH
+// from the last kept one. The track starts at the first fix that agrees with
+// its successor, and a run of jumpRebaseRun agreeing jumps replaces the anchor.
+func dropJumps(logs []dto.GPSLog, fixes []int, maxSpeedKMH float64) []int {
+	agree := func(a, b int) bool {
+		return impliedSpeedKMH(logs[a], logs[b]) <= maxSpeedKMH
+	}
+
+	start := 0
+	for start < len(fixes)-1 && !agree(fixes[start], fixes[start+1]) {
+		start++
+	}
+	if start == len(fixes)-1 && len(fixes) > 1 {
+		// no two fixes agree, none of them can be trusted more than the others
+		start = 0
+	}
+
+	kept := make([]int, 0, len(fixes)-start)
+	var run []int
+	for _, i := range fixes[start:] {
+		if len(kept) == 0 || agree(kept[len(kept)-1], i) {
+			kept = append(kept, i)
+			run = run[:0]
+			continue
+		}
+
+		if len(run) > 0 && !agree(run[len(run)-1], i) {
+			run = run[:0]
+		}
+		run = append(run, i)
+		if len(run) == jumpRebaseRun {
+			kept = append(kept, run...)
+			run = run[:0]
+		}
+	}
+	return kept
+}
+
+func impliedSpeedKMH(from, to dto.GPSLog) float64 {
+	distanceM := Distance(from.Coordinates, to.Coordinates)
+	seconds := to.LogDt.Sub(from.LogDt).Seconds()
+	if seconds <= 0 {
+		// same timestamp, only a standing device is plausible
+		if distanceM > 1 {
+			return math.Inf(1)
+		}
+		return 0
+	}
+	return distanceM / seconds * 3.6
+}
+
+// dropSpikes removes single points that step away from the road and come
+// straight back, the neighbours are close to each other while the point is not
+func dropSpikes(logs []dto.GPSLog, track []int, maxAccuracyM float64) []int {
+	if len(track) < 3 {
+		return track
+	}
+
+	minSpikeM := 2 * maxAccuracyM
+	if minSpikeM <= 0 {
+		minSpikeM = 200
+	}
+
+	kept := []int{track[0]}
+	for k := 1; k < len(track)-1; k++ {
+		prev := logs[kept[len(kept)-1]].Coordinates
+		point := logs[track[k]].Coordinates
+		next := logs[track[k+1]].Coordinates
+
+		out := Distance(prev, point)
+		back := Distance(point, next)
+		direct := Distance(prev, next)
+		if out > minSpikeM && back > minSpikeM && direct < math.Min(out, back)/4 {
+			continue
+		}
+		kept = append(kept, track[k])
+	}
+	return append(kept, track[len(track)-1])
+}
+
+// simplify is Douglas-Peucker on a local equirectangular projection in meters
+func simplify(logs []dto.GPSLog, track []int, toleranceM float64) []int {
+	if len(track) < 3 {
+		return track
+	}
+
+	lat0 := logs[track[0]].Coordinates.Lat * math.Pi / 180
+	xy := make([][2]float64, len(track))
+	for k, i := range track {
+		p := logs[i].Coordinates
+		xy[k] = [2]float64{
+			p.Lng * math.Pi / 180 * math.Cos(lat0) * earthRadiusM,
+			p.Lat * math.Pi / 180 * earthRadiusM,
+		}
+	}
+
+	marked := make([]bool, len(track))
+	marked[0], marked[len(track)-1] = true, true
+
+	stack := [][2]int{{0, len(track) - 1}}
+	for len(stack) > 0 {
+		span := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		first, last := span[0], span[1]
+
+		maxDist, index := 0.0, 0
+		for k := first + 1; k < last; k++ {
+			if d := segmentDistance(xy[k], xy[first], xy[last]); d > maxDist {
+				maxDist, index = d, k
+			}
+		}
+
+		if maxDist > toleranceM {
+			marked[index] = true
+			stack = append(stack, [2]int{first, index}, [2]int{index, last})
+		}
+	}
+
+	kept := make([]int, 0, len(track))
+	for k, i := range track {
+		if marked[k] {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+func segmentDistance(p, a, b [2]float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p[0]-a[0], p[1]-a[1])
+	}
+
+	t := ((p[0]-a[0])*dx + (p[1]-a[1])*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p[0]-(a[0]+t*dx), p[1]-(a[1]+t*dy))
+}
+
+// Distance is the haversine distance between two points in meters
+func Distance(a, b dto.Point) float64 {
+	lat1 := a.Lat * math.Pi / 180
+	lat2 := b.Lat * math.Pi / 180
+	dLat := lat2 - lat1
+	dLng := (b.Lng - a.Lng) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusM * math.Asin(math.Min(1, math.Sqrt(h)))
+}
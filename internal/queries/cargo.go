@@ -18,8 +18,10 @@ const CreateCargo = `
 INSERT INTO tbl_cargo (
     company_id, name, description, info, qty, weight, meta, meta2, meta3, 
     vehicle_type_id, packaging_type_id, gps, photo1_url, photo2_url, photo3_url, 
-    docs1_url, docs2_url, docs3_url, note, weight_type
-) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
+    docs1_url, docs2_url, docs3_url, note, weight_type,
+    length_cm, width_cm, height_cm, max_stack, temp_min, temp_max, adr_class, un_number
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20,
+    $21, $22, $23, $24, $25, $26, $27, $28)
 RETURNING id;
 `
 
@@ -47,6 +49,14 @@ SET
     active = COALESCE($20, active),
     deleted = COALESCE($21, deleted),
     weight_type = COALESCE($22, weight_type),
+    length_cm = COALESCE($23, length_cm),
+    width_cm = COALESCE($24, width_cm),
+    height_cm = COALESCE($25, height_cm),
+    max_stack = COALESCE($26, max_stack),
+    temp_min = COALESCE($27, temp_min),
+    temp_max = COALESCE($28, temp_max),
+    adr_class = COALESCE($29, adr_class),
+    un_number = COALESCE($30, un_number),
     updated_at = NOW()
 WHERE id = $1 
 `
@@ -79,6 +79,18 @@ func UpdateCompanyPlanActive(ctx context.Context, conn *pgxpool.Pool, companyID
 	return ExecuteUpdate(ctx, conn, query, planActive, companyID)
 }
 
+// ActivateCompanyPlan activates the company's plan and restarts its billing
+// cycle, a non-zero planID also switches the company to that plan
+func ActivateCompanyPlan(ctx context.Context, conn *pgxpool.Pool, companyID int, planID int) (int64, error) {
+	query := `
+		UPDATE tbl_company
+		SET plan_active = 1, plan_id = COALESCE(NULLIF($1, 0), plan_id),
+			plan_started_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND deleted = 0
+	`
+	return ExecuteUpdate(ctx, conn, query, planID, companyID)
+}
+
 // CheckExpiredPlans checks for expired plans and updates company status
 func CheckExpiredPlans(ctx context.Context, conn *pgxpool.Pool) (int64, error) {
 	query := `
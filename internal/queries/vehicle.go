@@ -165,7 +165,8 @@ SELECT
     vd.photo3_url, vd.docs1_url, vd.docs2_url,
     vd.docs3_url, vd.view_count, vd.created_at,
     vd.updated_at, vd.active, vd.deleted, vd.total_count,
-    vd.meta, vd.meta2, vd.meta3, vd.available,
+    vd.meta, vd.meta2, vd.meta3, vd.available, vd.payload_kg,
+    vd.volume_m3, vd.loading_meters, vd.reefer, vd.adr,
     json_build_object(
         'id', c.id,
         'company_name', c.company_name,
@@ -196,7 +197,8 @@ GROUP BY
     vd.photo3_url, vd.docs1_url, vd.docs2_url,
     vd.docs3_url, vd.view_count, vd.created_at,
     vd.updated_at, vd.active, vd.deleted, vd.total_count,
-    vd.meta, vd.meta2, vd.meta3, vd.available,
+    vd.meta, vd.meta2, vd.meta3, vd.available, vd.payload_kg,
+    vd.volume_m3, vd.loading_meters, vd.reefer, vd.adr,
     c.id, c.company_name, c.country,
     vb.id, vb.name, vb.country, vb.founded_year,
     vm.id, vm.name, vm.year, t.title_en;
@@ -210,10 +212,12 @@ INSERT INTO tbl_vehicle (
     year_of_issue, mileage, numberplate, trailer_numberplate,
     gps, photo1_url, photo2_url, photo3_url,
     docs1_url, docs2_url, docs3_url,
-    view_count, meta, meta2, meta3, available
+    view_count, meta, meta2, meta3, available, payload_kg,
+    volume_m3, loading_meters, reefer, adr
 ) VALUES (
     $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12,
-    $13, $14, $15, $16, $17, $18, $19, $20
+    $13, $14, $15, $16, $17, $18, $19, $20, $21,
+    $22, $23, $24, $25
 )
 RETURNING id;
 `
@@ -243,6 +247,11 @@ SET
     meta2 = COALESCE($21, meta2),
     meta3 = COALESCE($22, meta3),
     available = COALESCE($23, available),
+    payload_kg = COALESCE($24, payload_kg),
+    volume_m3 = COALESCE($25, volume_m3),
+    loading_meters = COALESCE($26, loading_meters),
+    reefer = COALESCE($27, reefer),
+    adr = COALESCE($28, adr),
     updated_at = NOW()`
 
 const DeleteVehicle = `
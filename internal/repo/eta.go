@@ -0,0 +1,173 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	db "texApi/database"
+	"texApi/internal/dto"
+)
+
+const (
+	etaRoadFactor       = 1.25 // straight line distance to road distance
+	etaRecentWindow     = 2 * time.Hour
+	etaMinMovingSpeed   = 5.0 // km/h, slower points are treated as stops
+	etaMinRecentSamples = 3
+	etaMinLaneSamples   = 3
+	etaLaneHistory      = 50 // latest completed trips used for the lane average
+	etaDefaultSpread    = 0.25
+	etaArrivedKM        = 0.5
+)
+
+type tripETAScan struct {
+	ID            int64      `db:"id"`
+	Status        string     `db:"status"`
+	FromCountry   *string    `db:"from_country"`
+	ToCountry     *string    `db:"to_country"`
+	LastLogDt     *time.Time `db:"last_log_dt"`
+	DistanceLeft  *float64   `db:"distance_left_km"`
+	RecentSpeed   *float64   `db:"recent_speed_kmh"`
+	RecentSamples int        `db:"recent_samples"`
+}
+
+type laneSpeedScan struct {
+	Samples int      `db:"samples"`
+	AvgKMH  *float64 `db:"avg_kmh"`
+	StdKMH  *float64 `db:"std_kmh"`
+}
+
+// GetTripETA estimates the arrival of an active trip from the remaining
+// distance to to_location, the recent moving speed of the vehicle and the
+// historical door to door speed of completed trips on the same country lane.
+func GetTripETA(tripID int64) (dto.TripETA, error) {
+	ctx := context.Background()
+	var eta dto.TripETA
+
+	var trip tripETAScan
+	err := pgxscan.Get(ctx, db.DB, &trip,
+		`WITH last AS (
+			SELECT coordinates, log_dt FROM tbl_gps_log
+			WHERE trip_id = $1
+			ORDER BY log_dt DESC LIMIT 1
+		), recent AS (
+			SELECT AVG(l.speed)::float8 AS avg_speed, COUNT(*)::int AS samples
+			FROM tbl_gps_log l, last
+			WHERE l.trip_id = $1 AND l.log_dt >= last.log_dt - make_interval(secs => $2) AND l.speed >= $3
+		)
+		SELECT t.id, t.status, t.from_country, t.to_country,
+		       last.log_dt AS last_log_dt,
+		       ST_Distance(last.coordinates::geography, t.to_location::geography) / 1000.0 AS distance_left_km,
+		       recent.avg_speed AS recent_speed_kmh,
+		       COALESCE(recent.samples, 0) AS recent_samples
+		FROM tbl_trip t
+		LEFT JOIN last ON true
+		LEFT JOIN recent ON true
+		WHERE t.id = $1 AND t.deleted = 0`,
+		tripID, etaRecentWindow.Seconds(), etaMinMovingSpeed)
+	if err != nil {
+		return eta, fmt.Errorf("failed to get trip: %w", err)
+	}
+
+	if trip.Status != "active" {
+		return eta, fmt.Errorf("ETA is only available for active trips")
+	}
+	if trip.LastLogDt == nil {
+		return eta, fmt.Errorf("trip has no GPS logs yet")
+	}
+	if trip.DistanceLeft == nil {
+		return eta, fmt.Errorf("trip has no destination location")
+	}
+
+	var lane laneSpeedScan
+	if trip.FromCountry != nil && trip.ToCountry != nil {
+		err = pgxscan.Get(ctx, db.DB, &lane,
+			`SELECT COUNT(*)::int AS samples, AVG(kmh) AS avg_kmh, STDDEV_SAMP(kmh) AS std_kmh
+			 FROM (
+			     SELECT distance_km::float8 / (EXTRACT(EPOCH FROM end_date - start_date) / 3600.0) AS kmh
+			     FROM tbl_trip
+			     WHERE status = 'completed' AND deleted = 0 AND id <> $3
+			       AND from_country = $1 AND to_country = $2
+			       AND distance_km > 0 AND end_date > start_date
+			     ORDER BY end_date DESC
+			     LIMIT $4
+			 ) lane`,
+			*trip.FromCountry, *trip.ToCountry, tripID, etaLaneHistory)
+		if err != nil {
+			return eta, fmt.Errorf("failed to get lane history: %w", err)
+		}
+	}
+
+	eta = dto.TripETA{
+		TripID:         trip.ID,
+		RemainingKM:    math.Round(*trip.DistanceLeft*etaRoadFactor*100) / 100,
+		LaneSamples:    lane.Samples,
+		LastPositionDt: *trip.LastLogDt,
+	}
+	if trip.RecentSamples >= etaMinRecentSamples {
+		eta.RecentSpeedKMH = trip.RecentSpeed
+	}
+	if lane.Samples > 0 {
+		eta.LaneSpeedKMH = lane.AvgKMH
+	}
+
+	if *trip.DistanceLeft <= etaArrivedKM {
+		eta.ETA, eta.ETAEarliest, eta.ETALatest = eta.LastPositionDt, eta.LastPositionDt, eta.LastPositionDt
+		eta.Confidence = "high"
+		return eta, nil
+	}
+
+	speed, spread, confidence := blendETASpeed(eta.RecentSpeedKMH, eta.LaneSpeedKMH, lane, eta.RemainingKM)
+	if speed <= 0 {
+		return eta, fmt.Errorf("not enough speed data to estimate ETA")
+	}
+
+	eta.SpeedKMH = math.Round(speed*100) / 100
+	eta.Confidence = confidence
+	eta.ETA = eta.LastPositionDt.Add(hoursToDuration(eta.RemainingKM / speed))
+	eta.ETAEarliest = eta.LastPositionDt.Add(hoursToDuration(eta.RemainingKM / (speed * (1 + spread))))
+	eta.ETALatest = eta.LastPositionDt.Add(hoursToDuration(eta.RemainingKM / (speed * (1 - spread))))
+
+	return eta, nil
+}
+
+// blendETASpeed mixes the current pace with the lane average. Close to the
+// destination the current pace dominates, far away the lane average wins since
+// it already accounts for stops and border crossings.
+func blendETASpeed(recent, laneAvg *float64, lane laneSpeedScan, remainingKM float64) (speed, spread float64, confidence string) {
+	spread = etaDefaultSpread
+	if lane.Samples >= etaMinLaneSamples && laneAvg != nil && lane.StdKMH != nil && *laneAvg > 0 {
+		spread = math.Min(math.Max(*lane.StdKMH / *laneAvg, 0.1), 0.5)
+	}
+
+	switch {
+	case recent != nil && laneAvg != nil:
+		weight := 0.4
+		if remainingKM < 100 {
+			weight = 0.7
+		}
+		speed = *recent*weight + *laneAvg*(1-weight)
+		confidence = "medium"
+		if lane.Samples >= etaMinLaneSamples {
+			confidence = "high"
+		}
+	case laneAvg != nil:
+		speed = *laneAvg
+		confidence = "low"
+		if lane.Samples >= etaMinLaneSamples {
+			confidence = "medium"
+		}
+	case recent != nil:
+		speed = *recent
+		spread = math.Min(spread+0.1, 0.5)
+		confidence = "low"
+	}
+
+	return speed, spread, confidence
+}
+
+func hoursToDuration(hours float64) time.Duration {
+	return time.Duration(hours * float64(time.Hour))
+}
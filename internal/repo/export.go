@@ -0,0 +1,139 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	db "texApi/database"
+	"texApi/internal/dto"
+)
+
+var ErrExportJobNotFound = errors.New("export job not found")
+
+const exportJobColumns = `id, uuid::text AS uuid, user_id, company_id, list, format, lang,
+	state::text AS state, row_count, url, error, created_at, updated_at, finished_at,
+	query, args::text AS args, file_path`
+
+const exportJobSelect = `SELECT ` + exportJobColumns + ` FROM tbl_export_job`
+
+// CreateExportJob queues the job with its list query, it is picked up by
+// ClaimExportJob
+func CreateExportJob(job dto.ExportJob) (*dto.ExportJob, error) {
+	var created dto.ExportJob
+	err := pgxscan.Get(context.Background(), db.DB, &created,
+		`INSERT INTO tbl_export_job (user_id, company_id, list, format, lang, row_count, query, args)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		 RETURNING `+exportJobColumns,
+		job.UserID, job.CompanyID, job.List, job.Format, job.Lang, job.RowCount, job.Query, job.Args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export job: %w", err)
+	}
+	return &created, nil
+}
+
+func GetExportJobs(userID, page, perPage int) ([]dto.ExportJob, int, error) {
+	var jobs []dto.ExportJob
+	err := pgxscan.Select(context.Background(), db.DB, &jobs,
+		exportJobSelect+` WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3`,
+		userID, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get export jobs: %w", err)
+	}
+
+	var total int
+	err = db.DB.QueryRow(context.Background(),
+		`SELECT COUNT(*) FROM tbl_export_job WHERE user_id = $1`, userID).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count export jobs: %w", err)
+	}
+	return jobs, total, nil
+}
+
+// GetExportJob returns the job of the user, any job when userID is 0
+func GetExportJob(uuid string, userID int) (*dto.ExportJob, error) {
+	var jobs []dto.ExportJob
+	err := pgxscan.Select(context.Background(), db.DB, &jobs,
+		exportJobSelect+` WHERE uuid::text = $1 AND ($2 = 0 OR user_id = $2)`, uuid, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get export job: %w", err)
+	}
+	if len(jobs) == 0 {
+		return nil, ErrExportJobNotFound
+	}
+	return &jobs[0], nil
+}
+
+// RequeueExportJobs puts jobs that were cut off while running back in the
+// queue, those that were already started maxAttempts times fail
+func RequeueExportJobs(maxAttempts int) (int, error) {
+	ctx := context.Background()
+
+	_, err := db.DB.Exec(ctx,
+		`UPDATE tbl_export_job
+		 SET state = 'failed', error = 'export was interrupted too many times',
+		     updated_at = CURRENT_TIMESTAMP, finished_at = CURRENT_TIMESTAMP
+		 WHERE state = 'running' AND attempts >= $1`,
+		maxAttempts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail interrupted export jobs: %w", err)
+	}
+
+	result, err := db.DB.Exec(ctx,
+		`UPDATE tbl_export_job SET state = 'pending', updated_at = CURRENT_TIMESTAMP
+		 WHERE state = 'running'`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue export jobs: %w", err)
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// ClaimExportJob marks the oldest pending job as running and returns it, nil
+// when nothing is pending
+func ClaimExportJob() (*dto.ExportJob, error) {
+	var jobs []dto.ExportJob
+	err := pgxscan.Select(context.Background(), db.DB, &jobs,
+		`UPDATE tbl_export_job
+		 SET state = 'running', attempts = attempts + 1, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = (
+		     SELECT id FROM tbl_export_job
+		     WHERE state = 'pending'
+		     ORDER BY id
+		     LIMIT 1
+		     FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING `+exportJobColumns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim export job: %w", err)
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	return &jobs[0], nil
+}
+
+func FinishExportJob(id, rowCount int, filePath, url string) error {
+	_, err := db.DB.Exec(context.Background(),
+		`UPDATE tbl_export_job
+		 SET state = 'done', row_count = $2, file_path = $3, url = $4,
+		     updated_at = CURRENT_TIMESTAMP, finished_at = CURRENT_TIMESTAMP
+		 WHERE id = $1`,
+		id, rowCount, filePath, url)
+	if err != nil {
+		return fmt.Errorf("failed to finish export job: %w", err)
+	}
+	return nil
+}
+
+func FailExportJob(id int, reason string) error {
+	_, err := db.DB.Exec(context.Background(),
+		`UPDATE tbl_export_job
+		 SET state = 'failed', error = $2, updated_at = CURRENT_TIMESTAMP, finished_at = CURRENT_TIMESTAMP
+		 WHERE id = $1`,
+		id, reason)
+	if err != nil {
+		return fmt.Errorf("failed to fail export job: %w", err)
+	}
+	return nil
+}
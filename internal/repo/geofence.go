@@ -0,0 +1,452 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	db "texApi/database"
+	"texApi/internal/dto"
+)
+
+const DefaultGeofenceRadiusM = 500.0
+
+type GeofenceScan struct {
+	ID        int              `db:"id"`
+	UUID      string           `db:"uuid"`
+	OfferID   int              `db:"offer_id"`
+	CompanyID int              `db:"company_id"`
+	Kind      string           `db:"kind"`
+	Shape     string           `db:"shape"`
+	Title     string           `db:"title"`
+	CenterTxt *string          `db:"center_txt"` // ST_AsText result
+	RadiusM   float64          `db:"radius_m"`
+	Area      *json.RawMessage `db:"area"` // ST_AsGeoJSON result
+	Meta      string           `db:"meta"`
+	CreatedAt time.Time        `db:"created_at"`
+	UpdatedAt time.Time        `db:"updated_at"`
+	Active    int              `db:"active"`
+	Deleted   int              `db:"deleted"`
+}
+
+func (gs *GeofenceScan) ToGeofence() dto.Geofence {
+	geofence := dto.Geofence{
+		ID:        gs.ID,
+		UUID:      gs.UUID,
+		OfferID:   gs.OfferID,
+		CompanyID: gs.CompanyID,
+		Kind:      gs.Kind,
+		Shape:     gs.Shape,
+		Title:     gs.Title,
+		RadiusM:   gs.RadiusM,
+		Area:      gs.Area,
+		Meta:      gs.Meta,
+		CreatedAt: gs.CreatedAt,
+		UpdatedAt: gs.UpdatedAt,
+		Active:    gs.Active,
+		Deleted:   gs.Deleted,
+	}
+
+	if gs.CenterTxt != nil && *gs.CenterTxt != "" {
+		var point dto.Point
+		if err := point.Scan(*gs.CenterTxt); err == nil {
+			geofence.Center = &point
+		}
+	}
+
+	return geofence
+}
+
+type GeofenceEventScan struct {
+	ID             int64     `db:"id"`
+	GeofenceID     int       `db:"geofence_id"`
+	OfferID        int       `db:"offer_id"`
+	TripID         *int      `db:"trip_id"`
+	VehicleID      int       `db:"vehicle_id"`
+	DriverID       int       `db:"driver_id"`
+	GPSLogID       int64     `db:"gps_log_id"`
+	EventType      string    `db:"event_type"`
+	CoordinatesTxt string    `db:"coordinates_txt"` // ST_AsText result
+	EventDt        time.Time `db:"event_dt"`
+	CreatedAt      time.Time `db:"created_at"`
+}
+
+func (es *GeofenceEventScan) ToGeofenceEvent() dto.GeofenceEvent {
+	event := dto.GeofenceEvent{
+		ID:         es.ID,
+		GeofenceID: es.GeofenceID,
+		OfferID:    es.OfferID,
+		TripID:     es.TripID,
+		VehicleID:  es.VehicleID,
+		DriverID:   es.DriverID,
+		GPSLogID:   es.GPSLogID,
+		EventType:  es.EventType,
+		EventDt:    es.EventDt,
+		CreatedAt:  es.CreatedAt,
+	}
+
+	if es.CoordinatesTxt != "" {
+		_ = event.Coordinates.Scan(es.CoordinatesTxt)
+	}
+
+	return event
+}
+
+// polygonWKT builds a closed outer ring in WKT, PostGIS expects "lng lat" pairs
+func polygonWKT(points []dto.Point) string {
+	ring := make([]string, 0, len(points)+1)
+	for _, p := range points {
+		ring = append(ring, fmt.Sprintf("%f %f", p.Lng, p.Lat))
+	}
+	first, last := points[0], points[len(points)-1]
+	if first.Lat != last.Lat || first.Lng != last.Lng {
+		ring = append(ring, fmt.Sprintf("%f %f", first.Lng, first.Lat))
+	}
+	return fmt.Sprintf("POLYGON((%s))", strings.Join(ring, ", "))
+}
+
+func CreateGeofence(input dto.GeofenceInput, companyID int) (int, error) {
+	var area *string
+	if input.Shape == dto.GeofenceShapePolygon {
+		if len(input.Polygon) < 3 {
+			return 0, fmt.Errorf("polygon geofence requires at least 3 points")
+		}
+		wkt := polygonWKT(input.Polygon)
+		area = &wkt
+	} else if input.Center == nil || input.RadiusM <= 0 {
+		return 0, fmt.Errorf("circle geofence requires center and radius_m")
+	}
+
+	var id int
+	err := pgxscan.Get(context.Background(), db.DB, &id,
+		`INSERT INTO tbl_geofence (
+			offer_id, company_id, kind, shape, title, center, radius_m, area, meta
+		) VALUES ($1, $2, $3, $4, COALESCE($5, ''), $6, $7,
+		          CASE WHEN $8::text IS NULL THEN NULL ELSE ST_GeomFromText($8::text, 4326) END,
+		          COALESCE($9, ''))
+		RETURNING id`,
+		input.OfferID, companyID, input.Kind, input.Shape, input.Title,
+		input.Center, input.RadiusM, area, input.Meta)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create geofence: %w", err)
+	}
+
+	return id, nil
+}
+
+func GetGeofences(query dto.GeofenceQuery) ([]dto.Geofence, error) {
+	var conditions []string
+	var args []interface{}
+	argIndex := 1
+
+	conditions = append(conditions, "deleted = 0")
+
+	if query.OfferID != nil {
+		conditions = append(conditions, fmt.Sprintf("offer_id = $%d", argIndex))
+		args = append(args, *query.OfferID)
+		argIndex++
+	}
+
+	if query.TripID != nil {
+		conditions = append(conditions, fmt.Sprintf(`offer_id IN (
+			SELECT offer_id FROM tbl_offer_trip
+			WHERE trip_id = $%d AND deleted = 0
+		)`, argIndex))
+		args = append(args, *query.TripID)
+		argIndex++
+	}
+
+	if query.Kind != nil {
+		conditions = append(conditions, fmt.Sprintf("kind = $%d", argIndex))
+		args = append(args, *query.Kind)
+		argIndex++
+	}
+
+	queryStr := fmt.Sprintf(`
+		SELECT id, uuid, offer_id, company_id, kind, shape, title,
+		       ST_AsText(center) as center_txt, radius_m,
+		       ST_AsGeoJSON(area)::json as area,
+		       meta, created_at, updated_at, active, deleted
+		FROM tbl_geofence
+		WHERE %s
+		ORDER BY offer_id, kind, id`,
+		strings.Join(conditions, " AND "))
+
+	var scans []GeofenceScan
+	err := pgxscan.Select(context.Background(), db.DB, &scans, queryStr, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get geofences: %w", err)
+	}
+
+	geofences := make([]dto.Geofence, len(scans))
+	for i, scan := range scans {
+		geofences[i] = scan.ToGeofence()
+	}
+
+	return geofences, nil
+}
+
+func GetGeofenceOfferID(id int) (int, error) {
+	var offerID int
+	err := pgxscan.Get(context.Background(), db.DB, &offerID,
+		`SELECT offer_id FROM tbl_geofence WHERE id = $1 AND deleted = 0`, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get geofence: %w", err)
+	}
+	return offerID, nil
+}
+
+func DeleteGeofence(id int) error {
+	result, err := db.DB.Exec(context.Background(),
+		`UPDATE tbl_geofence SET deleted = 1, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 AND deleted = 0`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete geofence: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("geofence not found")
+	}
+	return nil
+}
+
+func GetGeofenceEvents(query dto.GeofenceEventQuery) ([]dto.GeofenceEvent, error) {
+	var conditions []string
+	var args []interface{}
+	argIndex := 1
+
+	if query.OfferID != nil {
+		conditions = append(conditions, fmt.Sprintf("offer_id = $%d", argIndex))
+		args = append(args, *query.OfferID)
+		argIndex++
+	}
+
+	if query.TripID != nil {
+		conditions = append(conditions, fmt.Sprintf("trip_id = $%d", argIndex))
+		args = append(args, *query.TripID)
+		argIndex++
+	}
+
+	if query.VehicleID != nil {
+		conditions = append(conditions, fmt.Sprintf("vehicle_id = $%d", argIndex))
+		args = append(args, *query.VehicleID)
+		argIndex++
+	}
+
+	if query.GeofenceID != nil {
+		conditions = append(conditions, fmt.Sprintf("geofence_id = $%d", argIndex))
+		args = append(args, *query.GeofenceID)
+		argIndex++
+	}
+
+	if query.EventType != nil {
+		conditions = append(conditions, fmt.Sprintf("event_type = $%d", argIndex))
+		args = append(args, *query.EventType)
+		argIndex++
+	}
+
+	if query.From != nil {
+		conditions = append(conditions, fmt.Sprintf("event_dt >= $%d", argIndex))
+		args = append(args, *query.From)
+		argIndex++
+	}
+
+	if query.To != nil {
+		conditions = append(conditions, fmt.Sprintf("event_dt <= $%d", argIndex))
+		args = append(args, *query.To)
+		argIndex++
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	queryStr := fmt.Sprintf(`
+		SELECT id, geofence_id, offer_id, trip_id, vehicle_id, driver_id, gps_log_id,
+		       event_type, ST_AsText(coordinates) as coordinates_txt, event_dt, created_at
+		FROM tbl_geofence_event
+		%s
+		ORDER BY event_dt DESC, id DESC
+		LIMIT $%d OFFSET $%d`,
+		whereClause, argIndex, argIndex+1)
+
+	args = append(args, limit, query.Offset)
+
+	var scans []GeofenceEventScan
+	err := pgxscan.Select(context.Background(), db.DB, &scans, queryStr, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get geofence events: %w", err)
+	}
+
+	events := make([]dto.GeofenceEvent, len(scans))
+	for i, scan := range scans {
+		events[i] = scan.ToGeofenceEvent()
+	}
+
+	return events, nil
+}
+
+// createDefaultGeofences seeds pickup/dropoff circles from the trip locations
+// for offers that have no geofences of their own yet.
+func createDefaultGeofences(ctx context.Context, tx pgx.Tx, offerID int, pickup, dropoff *dto.Point) error {
+	for kind, center := range map[string]*dto.Point{
+		dto.GeofenceKindPickup:  pickup,
+		dto.GeofenceKindDropoff: dropoff,
+	} {
+		if center == nil || (center.Lat == 0 && center.Lng == 0) {
+			continue
+		}
+		_, err := tx.Exec(ctx,
+			`INSERT INTO tbl_geofence (offer_id, company_id, kind, shape, center, radius_m)
+			 SELECT o.id, COALESCE(o.company_id, 0), $2, 'circle', $3, $4
+			 FROM tbl_offer o
+			 WHERE o.id = $1 AND NOT EXISTS (
+			     SELECT 1 FROM tbl_geofence g
+			     WHERE g.offer_id = o.id AND g.kind = $2 AND g.deleted = 0
+			 )`,
+			offerID, kind, *center, DefaultGeofenceRadiusM)
+		if err != nil {
+			return fmt.Errorf("failed to create default geofence: %w", err)
+		}
+	}
+	return nil
+}
+
+type geofenceHit struct {
+	GeofenceID     int       `db:"geofence_id"`
+	OfferID        int       `db:"offer_id"`
+	Kind           string    `db:"kind"`
+	GPSLogID       int64     `db:"gps_log_id"`
+	TripID         *int      `db:"trip_id"`
+	VehicleID      int       `db:"vehicle_id"`
+	DriverID       int       `db:"driver_id"`
+	CoordinatesTxt string    `db:"coordinates_txt"`
+	LogDt          time.Time `db:"log_dt"`
+	Inside         bool      `db:"inside"`
+}
+
+type geofenceState struct {
+	GeofenceID int    `db:"geofence_id"`
+	VehicleID  int    `db:"vehicle_id"`
+	EventType  string `db:"event_type"`
+}
+
+// evaluateGeofences checks the freshly inserted GPS logs against the geofences
+// of their offers (directly or through the trip) and stores an event every time
+// a vehicle crosses a boundary. The last stored event is the starting state.
+func evaluateGeofences(ctx context.Context, tx pgx.Tx, logIDs []int64) ([]dto.GeofenceEvent, error) {
+	if len(logIDs) == 0 {
+		return nil, nil
+	}
+
+	var hits []geofenceHit
+	err := pgxscan.Select(ctx, tx, &hits,
+		`SELECT g.id AS geofence_id, g.offer_id, g.kind,
+		        l.id AS gps_log_id, l.trip_id, l.vehicle_id, l.driver_id,
+		        ST_AsText(l.coordinates) AS coordinates_txt, l.log_dt,
+		        CASE WHEN g.shape = 'circle'
+		             THEN ST_DWithin(g.center::geography, l.coordinates::geography, g.radius_m::float8)
+		             ELSE ST_Contains(g.area, l.coordinates)
+		        END AS inside
+		 FROM tbl_gps_log l
+		 JOIN tbl_geofence g ON g.deleted = 0 AND g.active = 1 AND (
+		      g.offer_id = l.offer_id OR
+		      g.offer_id IN (SELECT ot.offer_id FROM tbl_offer_trip ot
+		                     WHERE ot.trip_id = l.trip_id AND ot.deleted = 0))
+		 WHERE l.id = ANY($1)
+		 ORDER BY g.id, l.vehicle_id, l.log_dt, l.id`,
+		logIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate geofences: %w", err)
+	}
+
+	if len(hits) == 0 {
+		return nil, nil
+	}
+
+	geofenceIDs := make([]int, 0, len(hits))
+	vehicleIDs := make([]int, 0, len(hits))
+	for _, hit := range hits {
+		geofenceIDs = append(geofenceIDs, hit.GeofenceID)
+		vehicleIDs = append(vehicleIDs, hit.VehicleID)
+	}
+
+	var states []geofenceState
+	err = pgxscan.Select(ctx, tx, &states,
+		`SELECT DISTINCT ON (geofence_id, vehicle_id) geofence_id, vehicle_id, event_type
+		 FROM tbl_geofence_event
+		 WHERE geofence_id = ANY($1) AND vehicle_id = ANY($2)
+		 ORDER BY geofence_id, vehicle_id, event_dt DESC, id DESC`,
+		geofenceIDs, vehicleIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get geofence state: %w", err)
+	}
+
+	type stateKey struct{ geofenceID, vehicleID int }
+	inside := make(map[stateKey]bool, len(states))
+	for _, s := range states {
+		inside[stateKey{s.GeofenceID, s.VehicleID}] =
+			s.EventType == dto.GeofenceEventArrivedPickup || s.EventType == dto.GeofenceEventArrivedDestination
+	}
+
+	var events []dto.GeofenceEvent
+	for _, hit := range hits {
+		key := stateKey{hit.GeofenceID, hit.VehicleID}
+		if inside[key] == hit.Inside {
+			continue
+		}
+		inside[key] = hit.Inside
+
+		eventType := geofenceEventType(hit.Kind, hit.Inside)
+		event := dto.GeofenceEvent{
+			GeofenceID: hit.GeofenceID,
+			OfferID:    hit.OfferID,
+			TripID:     hit.TripID,
+			VehicleID:  hit.VehicleID,
+			DriverID:   hit.DriverID,
+			GPSLogID:   hit.GPSLogID,
+			EventType:  eventType,
+			EventDt:    hit.LogDt,
+		}
+		_ = event.Coordinates.Scan(hit.CoordinatesTxt)
+
+		err = tx.QueryRow(ctx,
+			`INSERT INTO tbl_geofence_event (
+				geofence_id, offer_id, trip_id, vehicle_id, driver_id,
+				gps_log_id, event_type, coordinates, event_dt
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			RETURNING id, created_at`,
+			event.GeofenceID, event.OfferID, event.TripID, event.VehicleID, event.DriverID,
+			event.GPSLogID, event.EventType, event.Coordinates, event.EventDt,
+		).Scan(&event.ID, &event.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create geofence event: %w", err)
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+func geofenceEventType(kind string, inside bool) string {
+	if kind == dto.GeofenceKindPickup {
+		if inside {
+			return dto.GeofenceEventArrivedPickup
+		}
+		return dto.GeofenceEventLeftPickup
+	}
+	if inside {
+		return dto.GeofenceEventArrivedDestination
+	}
+	return dto.GeofenceEventLeftDestination
+}
@@ -3,14 +3,18 @@ package repo
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"texApi/pkg/utils"
 	"time"
 
 	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"texApi/config"
 	db "texApi/database"
 	"texApi/internal/dto"
+	"texApi/internal/gpsTrack"
 )
 
 const (
@@ -93,6 +97,37 @@ func CreateTrip(input dto.StartTripInput) (int64, error) {
 		}
 	}
 
+	waypoints, err := createTripWaypoints(ctx, tx, tripID, input)
+	if err != nil {
+		return 0, err
+	}
+
+	// multi-stop offers give the trip its locations when none were sent
+	fromLocation, toLocation := input.FromLocation, input.ToLocation
+	for i := range waypoints {
+		if fromLocation == nil && waypoints[i].Location != nil {
+			fromLocation = waypoints[i].Location
+		}
+		if input.ToLocation == nil && waypoints[i].Location != nil {
+			toLocation = waypoints[i].Location
+		}
+	}
+	if fromLocation != input.FromLocation || toLocation != input.ToLocation {
+		_, err = tx.Exec(ctx,
+			`UPDATE tbl_trip
+			 SET from_location = ST_GeomFromText($2, 4326), to_location = ST_GeomFromText($3, 4326)
+			 WHERE id = $1`,
+			tripID, fromLocation, toLocation)
+		if err != nil {
+			return 0, fmt.Errorf("failed to set trip locations: %w", err)
+		}
+	}
+
+	err = createDefaultGeofences(ctx, tx, mainOfferID, fromLocation, toLocation)
+	if err != nil {
+		return 0, err
+	}
+
 	err = tx.Commit(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to commit transaction: %w", err)
@@ -101,49 +136,94 @@ func CreateTrip(input dto.StartTripInput) (int64, error) {
 	return tripID, nil
 }
 
-func EndTrip(input dto.EndTripInput) error {
+func EndTrip(input dto.EndTripInput) (dto.TripSummary, error) {
 	ctx := context.Background()
 	tx, err := db.DB.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to start transaction: %w", err)
+		return dto.TripSummary{}, fmt.Errorf("failed to start transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
-	var logs []dto.GPSLog
-	err = pgxscan.Select(ctx, tx, &logs,
-		`SELECT * FROM tbl_gps_log 
+	var logScans []GPSLogScan
+	err = pgxscan.Select(ctx, tx, &logScans,
+		`SELECT id, vehicle_id, driver_id, trip_id, speed, accuracy,
+		        ST_AsText(coordinates) as coordinates_txt, log_dt
+		 FROM tbl_gps_log 
 		 WHERE trip_id = $1 
 		 ORDER BY log_dt ASC`,
 		input.ID)
 	if err != nil {
-		return fmt.Errorf("failed to get GPS logs: %w", err)
+		return dto.TripSummary{}, fmt.Errorf("failed to get GPS logs: %w", err)
 	}
 
-	logsJSON, err := json.Marshal(logs)
+	logs := make([]dto.GPSLog, len(logScans))
+	for i, scan := range logScans {
+		logs[i] = scan.ToGPSLog()
+	}
+
+	track := gpsTrack.Process(logs, gpsTrack.DefaultOptions())
+	summary := gpsTrack.Summarize(track)
+	summary.Polyline = gpsTrack.TrackPolyline(track, float64(config.ENV.GPS_TRACK_TOLERANCE_M))
+
+	if len(track) >= 2 {
+		ids := make([]int64, len(track))
+		for i, log := range track {
+			ids[i] = log.ID
+		}
+		err = tx.QueryRow(ctx,
+			`SELECT COALESCE(ST_Length(ST_MakeLine(coordinates ORDER BY log_dt)::geography), 0) / 1000
+			 FROM tbl_gps_log WHERE id = ANY($1)`,
+			ids).Scan(&summary.DrivenKM)
+		if err != nil {
+			return dto.TripSummary{}, fmt.Errorf("failed to measure trip distance: %w", err)
+		}
+	}
+
+	// the stored list is replaced by the summary, raw points stay in tbl_gps_log
+	summaryJSON, err := json.Marshal(summary)
 	if err != nil {
-		return fmt.Errorf("failed to marshal GPS logs: %w", err)
+		return dto.TripSummary{}, fmt.Errorf("failed to marshal trip summary: %w", err)
 	}
 
-	result, err := tx.Exec(ctx,
+	err = tx.QueryRow(ctx,
 		`UPDATE tbl_trip 
-		 SET status = 'completed', end_date = CURRENT_TIMESTAMP, 
+		 SET status = 'completed', end_date = CURRENT_TIMESTAMP,
+		     planned_distance_km = COALESCE(planned_distance_km, distance_km),
+		     distance_km = CASE WHEN $4 THEN ROUND($5::numeric, 2) ELSE distance_km END,
+		     moving_sec = $6, idle_sec = $7,
 		     gps_logs = $1, updated_at = CURRENT_TIMESTAMP
-		 WHERE id = $2 AND driver_id = $3 AND deleted = 0`,
-		string(logsJSON), input.ID, input.DriverID)
+		 WHERE id = $2 AND driver_id = $3 AND deleted = 0
+		 RETURNING planned_distance_km`,
+		string(summaryJSON), input.ID, input.DriverID,
+		len(track) >= 2, summary.DrivenKM, summary.MovingSec, summary.IdleSec).Scan(&summary.PlannedKM)
 	if err != nil {
-		return fmt.Errorf("failed to end trip: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return dto.TripSummary{}, fmt.Errorf("trip not found or access denied")
+		}
+		return dto.TripSummary{}, fmt.Errorf("failed to end trip: %w", err)
 	}
 
-	if result.RowsAffected() == 0 {
-		return fmt.Errorf("trip not found or access denied")
+	_, err = tx.Exec(ctx, `DELETE FROM tbl_trip_stop WHERE trip_id = $1`, input.ID)
+	if err != nil {
+		return dto.TripSummary{}, fmt.Errorf("failed to reset trip stops: %w", err)
+	}
+
+	for _, stop := range summary.Stops {
+		_, err = tx.Exec(ctx,
+			`INSERT INTO tbl_trip_stop (trip_id, location, start_dt, end_dt, duration_sec, point_count)
+			 VALUES ($1, ST_GeomFromText($2::text, 4326), $3, $4, $5, $6)`,
+			input.ID, stop.Location, stop.StartDt, stop.EndDt, stop.DurationSec, stop.PointCount)
+		if err != nil {
+			return dto.TripSummary{}, fmt.Errorf("failed to create trip stop: %w", err)
+		}
 	}
 
 	err = tx.Commit(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return dto.TripSummary{}, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return nil
+	return summary, nil
 }
 
 type TripScan struct {
@@ -259,6 +339,12 @@ func GetTrips(query dto.TripQuery) ([]dto.Trip, error) {
 
 	conditions = append(conditions, "deleted = 0")
 
+	if query.ScopeCompanyID != nil {
+		conditions = append(conditions, tripScopeCondition("", argIndex))
+		args = append(args, *query.ScopeCompanyID)
+		argIndex++
+	}
+
 	offerFiltersQuery := dto.OfferFiltersQuery{
 		OfferCompanyID:     query.OfferCompanyID,
 		OfferExecCompanyID: query.OfferExecCompanyID,
@@ -640,6 +726,12 @@ func GetGPSLogs(query dto.GPSLogQuery) ([]dto.GPSLog, error) {
 	var args []interface{}
 	argIndex := 1
 
+	if query.ScopeCompanyID != nil {
+		conditions = append(conditions, gpsLogScopeCondition(argIndex))
+		args = append(args, *query.ScopeCompanyID)
+		argIndex++
+	}
+
 	if query.TripID != nil {
 		conditions = append(conditions, fmt.Sprintf("trip_id = $%d", argIndex))
 		args = append(args, *query.TripID)
@@ -738,11 +830,81 @@ func GetGPSLogs(query dto.GPSLogQuery) ([]dto.GPSLog, error) {
 	return logs, nil
 }
 
+// GetTripTracks loads the points of every trip in log_dt order, keyed by trip id
+func GetTripTracks(tripIDs []int64) (map[int64][]dto.GPSLog, error) {
+	tracks := make(map[int64][]dto.GPSLog, len(tripIDs))
+	if len(tripIDs) == 0 {
+		return tracks, nil
+	}
+
+	var logScans []GPSLogScan
+	err := pgxscan.Select(context.Background(), db.DB, &logScans, `
+		SELECT id, vehicle_id, driver_id, trip_id, speed, accuracy,
+		       ST_AsText(coordinates) as coordinates_txt, log_dt
+		FROM tbl_gps_log
+		WHERE trip_id = ANY($1)
+		ORDER BY trip_id, log_dt`,
+		tripIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trip tracks: %w", err)
+	}
+
+	for _, scan := range logScans {
+		log := scan.ToGPSLog()
+		tripID := int64(*log.TripID)
+		tracks[tripID] = append(tracks[tripID], log)
+	}
+
+	return tracks, nil
+}
+
+// GetTripStops returns the stops detected when the trip ended
+func GetTripStops(tripID int64) ([]dto.TripStop, error) {
+	var stopScans []struct {
+		LocationTxt string    `db:"location_txt"`
+		StartDt     time.Time `db:"start_dt"`
+		EndDt       time.Time `db:"end_dt"`
+		DurationSec int       `db:"duration_sec"`
+		PointCount  int       `db:"point_count"`
+	}
+	err := pgxscan.Select(context.Background(), db.DB, &stopScans, `
+		SELECT ST_AsText(location) as location_txt, start_dt, end_dt, duration_sec, point_count
+		FROM tbl_trip_stop
+		WHERE trip_id = $1
+		ORDER BY start_dt`,
+		tripID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trip stops: %w", err)
+	}
+
+	stops := make([]dto.TripStop, 0, len(stopScans))
+	for _, scan := range stopScans {
+		stop := dto.TripStop{
+			StartDt:     scan.StartDt,
+			EndDt:       scan.EndDt,
+			DurationSec: scan.DurationSec,
+			PointCount:  scan.PointCount,
+		}
+		if err := stop.Location.Scan(scan.LocationTxt); err != nil {
+			return nil, fmt.Errorf("failed to parse trip stop location: %w", err)
+		}
+		stops = append(stops, stop)
+	}
+
+	return stops, nil
+}
+
 func GetLastPositions(query dto.PositionQuery) ([]dto.GPSLog, error) {
 	var conditions []string
 	var args []interface{}
 	argIndex := 1
 
+	if query.ScopeCompanyID != nil {
+		conditions = append(conditions, gpsLogScopeCondition(argIndex))
+		args = append(args, *query.ScopeCompanyID)
+		argIndex++
+	}
+
 	offerFiltersQuery := dto.OfferFiltersQuery{
 		OfferCompanyID:     query.OfferCompanyID,
 		OfferExecCompanyID: query.OfferExecCompanyID,
@@ -848,39 +1010,149 @@ func GetLastPositions(query dto.PositionQuery) ([]dto.GPSLog, error) {
 	return logs, nil
 }
 
-func CreateGPSLogs(logs []dto.GPSLogInput) error {
+const (
+	gpsLogDtKeyLayout  = "2006-01-02 15:04:05.999999"
+	gpsDuplicateReason = "duplicate point for vehicle_id and log_dt"
+)
+
+func gpsLogKey(vehicleID int, logDt time.Time) string {
+	return fmt.Sprintf("%d|%s", vehicleID, logDt.Format(gpsLogDtKeyLayout))
+}
+
+// CreateGPSLogs copies the batch into a staging table and moves it into
+// tbl_gps_log in one statement, points already stored for the same
+// (vehicle_id, log_dt) are skipped. Geofences are evaluated in the same
+// transaction. Returned duplicates are positions in logs.
+func CreateGPSLogs(logs []dto.GPSLogInput) ([]dto.GPSLog, []int, []dto.GeofenceEvent, error) {
 	if len(logs) == 0 {
-		return nil
+		return nil, nil, nil, nil
 	}
 
 	ctx := context.Background()
 	tx, err := db.DB.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to start transaction: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to start transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
-	for _, log := range logs {
-		_, err = tx.Exec(ctx,
-			`INSERT INTO tbl_gps_log (
-				company_id, vehicle_id, driver_id, offer_id, trip_id,
-				battery_level, speed, heading, accuracy, coordinates,
-				status, log_dt, created_at
-			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, 'active', $11, CURRENT_TIMESTAMP)`,
-			log.CompanyID, log.VehicleID, log.DriverID, log.OfferID, log.TripID,
-			log.BatteryLevel, log.Speed, log.Heading, log.Accuracy, log.Coordinates,
-			log.LogDt)
-		if err != nil {
-			return fmt.Errorf("failed to create GPS log: %w", err)
+	_, err = tx.Exec(ctx,
+		`CREATE TEMP TABLE tmp_gps_log (
+			idx           INT,
+			company_id    INT,
+			vehicle_id    INT,
+			driver_id     INT,
+			offer_id      INT,
+			trip_id       INT,
+			battery_level SMALLINT,
+			speed         DECIMAL(5, 2),
+			heading       DECIMAL(5, 2),
+			accuracy      DECIMAL(7, 2),
+			lng           DOUBLE PRECISION,
+			lat           DOUBLE PRECISION,
+			log_dt        TIMESTAMP WITHOUT TIME ZONE
+		) ON COMMIT DROP`)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create staging table: %w", err)
+	}
+
+	// timestamps are stored with microsecond precision
+	for i := range logs {
+		logs[i].LogDt = logs[i].LogDt.Truncate(time.Microsecond)
+	}
+
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"tmp_gps_log"},
+		[]string{"idx", "company_id", "vehicle_id", "driver_id", "offer_id", "trip_id",
+			"battery_level", "speed", "heading", "accuracy", "lng", "lat", "log_dt"},
+		pgx.CopyFromSlice(len(logs), func(i int) ([]interface{}, error) {
+			log := logs[i]
+			return []interface{}{
+				i, log.CompanyID, log.VehicleID, log.DriverID, log.OfferID, log.TripID,
+				log.BatteryLevel, log.Speed, log.Heading, log.Accuracy,
+				log.Coordinates.Lng, log.Coordinates.Lat, log.LogDt,
+			}, nil
+		}))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to copy GPS logs: %w", err)
+	}
+
+	var inserted []struct {
+		ID        int64     `db:"id"`
+		VehicleID int       `db:"vehicle_id"`
+		LogDt     time.Time `db:"log_dt"`
+		CreatedAt time.Time `db:"created_at"`
+	}
+	err = pgxscan.Select(ctx, tx, &inserted,
+		`INSERT INTO tbl_gps_log (
+			company_id, vehicle_id, driver_id, offer_id, trip_id,
+			battery_level, speed, heading, accuracy, coordinates,
+			status, log_dt, created_at
+		)
+		SELECT DISTINCT ON (vehicle_id, log_dt)
+		       company_id, vehicle_id, driver_id, offer_id, trip_id,
+		       battery_level, speed, heading, accuracy,
+		       ST_SetSRID(ST_MakePoint(lng, lat), 4326),
+		       'active', log_dt, CURRENT_TIMESTAMP
+		FROM tmp_gps_log
+		ORDER BY vehicle_id, log_dt, idx
+		ON CONFLICT (vehicle_id, log_dt) DO NOTHING
+		RETURNING id, vehicle_id, log_dt, created_at`)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create GPS logs: %w", err)
+	}
+
+	type storedRow struct {
+		id        int64
+		createdAt time.Time
+	}
+	stored := make(map[string]storedRow, len(inserted))
+	for _, row := range inserted {
+		stored[gpsLogKey(row.VehicleID, row.LogDt)] = storedRow{row.ID, row.CreatedAt}
+	}
+
+	created := make([]dto.GPSLog, 0, len(inserted))
+	logIDs := make([]int64, 0, len(inserted))
+	var duplicates []int
+	for i, log := range logs {
+		key := gpsLogKey(log.VehicleID, log.LogDt)
+		row, ok := stored[key]
+		if !ok {
+			duplicates = append(duplicates, i)
+			continue
 		}
+		// the first point of an in-batch duplicate wins, later ones are reported
+		delete(stored, key)
+
+		created = append(created, dto.GPSLog{
+			ID:           row.id,
+			CompanyID:    log.CompanyID,
+			VehicleID:    log.VehicleID,
+			DriverID:     log.DriverID,
+			OfferID:      log.OfferID,
+			TripID:       log.TripID,
+			BatteryLevel: log.BatteryLevel,
+			Speed:        log.Speed,
+			Heading:      log.Heading,
+			Accuracy:     log.Accuracy,
+			Coordinates:  log.Coordinates,
+			Status:       "active",
+			LogDt:        log.LogDt,
+			CreatedAt:    row.createdAt,
+		})
+		logIDs = append(logIDs, row.id)
+	}
+
+	events, err := evaluateGeofences(ctx, tx, logIDs)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
 	err = tx.Commit(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return nil
+	return created, duplicates, events, nil
 }
 
 func getIntValue(input *int, fallback int) int {
@@ -910,11 +1182,14 @@ type TripDetailedScan struct {
 	FromLocationTxt *string          `db:"from_location_txt"`
 	ToLocationTxt   *string          `db:"to_location_txt"`
 	DistanceKM      *float64         `db:"distance_km"`
+	PlannedKM       *float64         `db:"planned_distance_km"`
+	MovingSec       int              `db:"moving_sec"`
+	IdleSec         int              `db:"idle_sec"`
+	Stops           *json.RawMessage `db:"stops"`
 	Status          string           `db:"status"`
 	Meta            string           `db:"meta"`
 	Meta2           string           `db:"meta2"`
 	Meta3           string           `db:"meta3"`
-	GPSLogs         string           `db:"gps_logs"`
 	CreatedAt       time.Time        `db:"created_at"`
 	UpdatedAt       time.Time        `db:"updated_at"`
 	Deleted         int              `db:"deleted"`
@@ -936,11 +1211,14 @@ func (ts *TripDetailedScan) ToTripDetailed() dto.TripDetailed {
 		StartDate:   ts.StartDate,
 		EndDate:     ts.EndDate,
 		DistanceKM:  ts.DistanceKM,
+		PlannedKM:   ts.PlannedKM,
+		MovingSec:   ts.MovingSec,
+		IdleSec:     ts.IdleSec,
+		Stops:       ts.Stops,
 		Status:      ts.Status,
 		Meta:        ts.Meta,
 		Meta2:       ts.Meta2,
 		Meta3:       ts.Meta3,
-		GPSLogs:     ts.GPSLogs,
 		CreatedAt:   ts.CreatedAt,
 		UpdatedAt:   ts.UpdatedAt,
 		Deleted:     ts.Deleted,
@@ -974,6 +1252,12 @@ func GetTripsDetailed(query dto.TripQuery) ([]dto.TripDetailed, error) {
 
 	conditions = append(conditions, "t.deleted = 0")
 
+	if query.ScopeCompanyID != nil {
+		conditions = append(conditions, tripScopeCondition("t.", argIndex))
+		args = append(args, *query.ScopeCompanyID)
+		argIndex++
+	}
+
 	offerFiltersQuery := dto.OfferFiltersQuery{
 		OfferCompanyID:     query.OfferCompanyID,
 		OfferExecCompanyID: query.OfferExecCompanyID,
@@ -1023,6 +1307,12 @@ func GetTripsDetailed(query dto.TripQuery) ([]dto.TripDetailed, error) {
 		)`, strings.Join(placeholders, ",")))
 	}
 
+	if query.ID != nil {
+		conditions = append(conditions, fmt.Sprintf("t.id = $%d", argIndex))
+		args = append(args, *query.ID)
+		argIndex++
+	}
+
 	if query.DriverID != nil {
 		conditions = append(conditions, fmt.Sprintf("t.driver_id = $%d", argIndex))
 		args = append(args, *query.DriverID)
@@ -1330,9 +1620,23 @@ func GetTripsDetailed(query dto.TripQuery) ([]dto.TripDetailed, error) {
             t.from_country, t.to_country, t.start_date, t.end_date,
             ST_AsText(t.from_location) as from_location_txt,
             ST_AsText(t.to_location) as to_location_txt,
-            t.distance_km, t.status, t.meta, t.meta2, t.meta3, t.gps_logs,
+            t.distance_km, t.planned_distance_km, t.moving_sec, t.idle_sec,
+            t.status, t.meta, t.meta2, t.meta3,
             t.created_at, t.updated_at, t.deleted,
             COUNT(*) OVER() as total_count,
+            COALESCE((
+                SELECT json_agg(
+                    json_build_object(
+                        'location', json_build_object('lat', ST_Y(ts.location), 'lng', ST_X(ts.location)),
+                        'start_dt', ts.start_dt,
+                        'end_dt', ts.end_dt,
+                        'duration_sec', ts.duration_sec,
+                        'point_count', ts.point_count
+                    ) ORDER BY ts.start_dt
+                )
+                FROM tbl_trip_stop ts
+                WHERE ts.trip_id = t.id
+            ), '[]') as stops,
             CASE 
                 WHEN t.driver_id > 0 THEN 
                     json_build_object(
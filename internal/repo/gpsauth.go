@@ -0,0 +1,479 @@
+package repo
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	db "texApi/database"
+	"texApi/internal/dto"
+)
+
+const gpsTokenPrefix = "gps_"
+
+func HashGPSToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateGPSToken stores a new device token, the plain token is returned once
+func CreateGPSToken(input dto.GPSTokenInput, companyID int) (int, string, error) {
+	ctx := context.Background()
+
+	if input.DriverID != 0 {
+		var exists bool
+		err := db.DB.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM tbl_driver WHERE id = $1 AND company_id = $2 AND deleted = 0)`,
+			input.DriverID, companyID).Scan(&exists)
+		if err != nil || !exists {
+			return 0, "", fmt.Errorf("driver not found")
+		}
+	}
+	if input.VehicleID != 0 {
+		var exists bool
+		err := db.DB.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM tbl_vehicle WHERE id = $1 AND company_id = $2 AND deleted = 0)`,
+			input.VehicleID, companyID).Scan(&exists)
+		if err != nil || !exists {
+			return 0, "", fmt.Errorf("vehicle not found")
+		}
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return 0, "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := gpsTokenPrefix + hex.EncodeToString(raw)
+
+	var id int
+	err := db.DB.QueryRow(ctx,
+		`INSERT INTO tbl_gps_token (company_id, driver_id, vehicle_id, token_hash, title, expires_at)
+		 VALUES ($1, $2, $3, $4, COALESCE($5, ''), $6)
+		 RETURNING id`,
+		companyID, input.DriverID, input.VehicleID, HashGPSToken(token), input.Title, input.ExpiresAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create GPS token: %w", err)
+	}
+
+	return id, token, nil
+}
+
+func GetGPSTokens(companyID *int) ([]dto.GPSToken, error) {
+	queryStr := `
+		SELECT id, uuid, company_id, driver_id, vehicle_id, title, last_used_at, expires_at,
+		       meta, created_at, updated_at, active, deleted
+		FROM tbl_gps_token
+		WHERE deleted = 0`
+	var args []interface{}
+	if companyID != nil {
+		queryStr += " AND company_id = $1"
+		args = append(args, *companyID)
+	}
+	queryStr += " ORDER BY id DESC"
+
+	var tokens []dto.GPSToken
+	err := pgxscan.Select(context.Background(), db.DB, &tokens, queryStr, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GPS tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// DeleteGPSToken revokes a token, companyID nil skips the ownership check
+func DeleteGPSToken(id int, companyID *int) error {
+	queryStr := `UPDATE tbl_gps_token SET deleted = 1, active = 0, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 AND deleted = 0`
+	args := []interface{}{id}
+	if companyID != nil {
+		queryStr += " AND company_id = $2"
+		args = append(args, *companyID)
+	}
+
+	result, err := db.DB.Exec(context.Background(), queryStr, args...)
+	if err != nil {
+		return fmt.Errorf("failed to delete GPS token: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("GPS token not found")
+	}
+	return nil
+}
+
+// GetGPSTokenByValue resolves an active, unexpired device token and marks it used
+func GetGPSTokenByValue(token string) (dto.GPSToken, error) {
+	var gpsToken dto.GPSToken
+	if !strings.HasPrefix(token, gpsTokenPrefix) {
+		return gpsToken, fmt.Errorf("invalid GPS token")
+	}
+
+	err := pgxscan.Get(context.Background(), db.DB, &gpsToken,
+		`UPDATE tbl_gps_token SET last_used_at = CURRENT_TIMESTAMP
+		 WHERE token_hash = $1 AND active = 1 AND deleted = 0
+		   AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+		 RETURNING id, uuid, company_id, driver_id, vehicle_id, title, last_used_at, expires_at,
+		           meta, created_at, updated_at, active, deleted`,
+		HashGPSToken(token))
+	if err != nil {
+		return gpsToken, fmt.Errorf("invalid GPS token")
+	}
+	return gpsToken, nil
+}
+
+type gpsTripRef struct {
+	ID        int    `db:"id"`
+	DriverID  int    `db:"driver_id"`
+	VehicleID int    `db:"vehicle_id"`
+	Status    string `db:"status"`
+}
+
+type gpsOfferRef struct {
+	ID            int `db:"id"`
+	CompanyID     int `db:"company_id"`
+	ExecCompanyID int `db:"exec_company_id"`
+	DriverID      int `db:"driver_id"`
+	VehicleID     int `db:"vehicle_id"`
+}
+
+type gpsOwnerRef struct {
+	ID        int `db:"id"`
+	CompanyID int `db:"company_id"`
+}
+
+// ValidateGPSLogs checks that the ids of every point belong together and to
+// the posting company. Non admin points get their company_id forced to the scope.
+func ValidateGPSLogs(logs []dto.GPSLogInput, scope dto.GPSIngestScope) ([]dto.GPSLogInput, []dto.GPSLogRejection, error) {
+	ctx := context.Background()
+
+	var vehicleIDs, driverIDs, tripIDs, offerIDs []int
+	for _, log := range logs {
+		vehicleIDs = append(vehicleIDs, log.VehicleID)
+		driverIDs = append(driverIDs, log.DriverID)
+		if log.TripID != nil {
+			tripIDs = append(tripIDs, *log.TripID)
+		}
+		if log.OfferID != nil {
+			offerIDs = append(offerIDs, *log.OfferID)
+		}
+	}
+
+	var vehicleRows, driverRows []gpsOwnerRef
+	if err := pgxscan.Select(ctx, db.DB, &vehicleRows,
+		`SELECT id, company_id FROM tbl_vehicle WHERE id = ANY($1) AND deleted = 0`, vehicleIDs); err != nil {
+		return nil, nil, fmt.Errorf("failed to get vehicles: %w", err)
+	}
+	if err := pgxscan.Select(ctx, db.DB, &driverRows,
+		`SELECT id, company_id FROM tbl_driver WHERE id = ANY($1) AND deleted = 0`, driverIDs); err != nil {
+		return nil, nil, fmt.Errorf("failed to get drivers: %w", err)
+	}
+
+	var tripRows []gpsTripRef
+	if len(tripIDs) > 0 {
+		if err := pgxscan.Select(ctx, db.DB, &tripRows,
+			`SELECT id, driver_id, vehicle_id, status FROM tbl_trip WHERE id = ANY($1) AND deleted = 0`, tripIDs); err != nil {
+			return nil, nil, fmt.Errorf("failed to get trips: %w", err)
+		}
+	}
+
+	var offerRows []gpsOfferRef
+	if len(offerIDs) > 0 {
+		if err := pgxscan.Select(ctx, db.DB, &offerRows,
+			`SELECT id, COALESCE(company_id, 0) AS company_id, exec_company_id, driver_id, vehicle_id
+			 FROM tbl_offer WHERE id = ANY($1) AND deleted = 0`, offerIDs); err != nil {
+			return nil, nil, fmt.Errorf("failed to get offers: %w", err)
+		}
+	}
+
+	tripOffers := map[int][]int{}
+	if len(tripIDs) > 0 {
+		var err error
+		tripOffers, err = GetTripOfferIDs(tripIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	vehicles := make(map[int]int, len(vehicleRows))
+	for _, v := range vehicleRows {
+		vehicles[v.ID] = v.CompanyID
+	}
+	drivers := make(map[int]int, len(driverRows))
+	for _, d := range driverRows {
+		drivers[d.ID] = d.CompanyID
+	}
+	trips := make(map[int]gpsTripRef, len(tripRows))
+	for _, t := range tripRows {
+		trips[t.ID] = t
+	}
+	offers := make(map[int]gpsOfferRef, len(offerRows))
+	for _, o := range offerRows {
+		offers[o.ID] = o
+	}
+
+	var accepted []dto.GPSLogInput
+	var rejected []dto.GPSLogRejection
+	for i, log := range logs {
+		reason := validateGPSLog(&log, scope, vehicles, drivers, trips, offers, tripOffers)
+		if reason != "" {
+			rejected = append(rejected, dto.GPSLogRejection{Index: i, Reason: reason, Log: log})
+			continue
+		}
+		accepted = append(accepted, log)
+	}
+
+	return accepted, rejected, nil
+}
+
+func validateGPSLog(
+	log *dto.GPSLogInput,
+	scope dto.GPSIngestScope,
+	vehicles, drivers map[int]int,
+	trips map[int]gpsTripRef,
+	offers map[int]gpsOfferRef,
+	tripOffers map[int][]int,
+) string {
+	if scope.VehicleID != 0 && log.VehicleID != scope.VehicleID {
+		return "vehicle_id does not match the device token"
+	}
+	if scope.DriverID != 0 && log.DriverID != scope.DriverID {
+		return "driver_id does not match the device token"
+	}
+
+	vehicleCompany, ok := vehicles[log.VehicleID]
+	if !ok {
+		return "vehicle not found"
+	}
+	driverCompany, ok := drivers[log.DriverID]
+	if !ok {
+		return "driver not found"
+	}
+	if vehicleCompany != driverCompany {
+		return "driver and vehicle belong to different companies"
+	}
+	if !scope.IsAdmin {
+		if vehicleCompany != scope.CompanyID {
+			return "vehicle does not belong to your company"
+		}
+		companyID := scope.CompanyID
+		log.CompanyID = &companyID
+	}
+
+	if log.TripID != nil {
+		trip, ok := trips[*log.TripID]
+		if !ok {
+			return "trip not found"
+		}
+		if trip.Status != "active" {
+			return "trip is not active"
+		}
+		if trip.VehicleID != 0 && trip.VehicleID != log.VehicleID {
+			return "vehicle is not assigned to the trip"
+		}
+		if trip.DriverID != 0 && trip.DriverID != log.DriverID {
+			return "driver is not assigned to the trip"
+		}
+	}
+
+	if log.OfferID != nil {
+		offer, ok := offers[*log.OfferID]
+		if !ok {
+			return "offer not found"
+		}
+		if !scope.IsAdmin && offer.CompanyID != scope.CompanyID && offer.ExecCompanyID != scope.CompanyID {
+			return "offer does not belong to your company"
+		}
+		if offer.VehicleID != 0 && offer.VehicleID != log.VehicleID {
+			return "vehicle is not assigned to the offer"
+		}
+		if offer.DriverID != 0 && offer.DriverID != log.DriverID {
+			return "driver is not assigned to the offer"
+		}
+		if log.TripID != nil && !containsInt(tripOffers[*log.TripID], *log.OfferID) {
+			return "offer is not linked to the trip"
+		}
+	}
+
+	return ""
+}
+
+func containsInt(list []int, value int) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func CreateRejectedGPSLogs(rejections []dto.GPSLogRejection, scope dto.GPSIngestScope) error {
+	if len(rejections) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, rejection := range rejections {
+		log := rejection.Log
+		payload, _ := json.Marshal(log)
+
+		var logDt *time.Time
+		if !log.LogDt.IsZero() {
+			logDt = &log.LogDt
+		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO tbl_gps_log_rejected (
+				token_id, company_id, vehicle_id, driver_id, offer_id, trip_id,
+				coordinates, log_dt, reason, payload
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			scope.TokenID, scope.CompanyID, log.VehicleID, log.DriverID, log.OfferID, log.TripID,
+			log.Coordinates, logDt, rejection.Reason, string(payload))
+		if err != nil {
+			return fmt.Errorf("failed to record rejected GPS log: %w", err)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+type GPSLogRejectedScan struct {
+	ID             int64      `db:"id"`
+	TokenID        int        `db:"token_id"`
+	CompanyID      int        `db:"company_id"`
+	VehicleID      int        `db:"vehicle_id"`
+	DriverID       int        `db:"driver_id"`
+	OfferID        *int       `db:"offer_id"`
+	TripID         *int       `db:"trip_id"`
+	CoordinatesTxt *string    `db:"coordinates_txt"` // ST_AsText result
+	LogDt          *time.Time `db:"log_dt"`
+	Reason         string     `db:"reason"`
+	CreatedAt      time.Time  `db:"created_at"`
+}
+
+func GetRejectedGPSLogs(query dto.GPSLogRejectedQuery) ([]dto.GPSLogRejected, error) {
+	var conditions []string
+	var args []interface{}
+	argIndex := 1
+
+	if query.CompanyID != nil {
+		conditions = append(conditions, fmt.Sprintf("company_id = $%d", argIndex))
+		args = append(args, *query.CompanyID)
+		argIndex++
+	}
+
+	if query.VehicleID != nil {
+		conditions = append(conditions, fmt.Sprintf("vehicle_id = $%d", argIndex))
+		args = append(args, *query.VehicleID)
+		argIndex++
+	}
+
+	if query.DriverID != nil {
+		conditions = append(conditions, fmt.Sprintf("driver_id = $%d", argIndex))
+		args = append(args, *query.DriverID)
+		argIndex++
+	}
+
+	if query.TokenID != nil {
+		conditions = append(conditions, fmt.Sprintf("token_id = $%d", argIndex))
+		args = append(args, *query.TokenID)
+		argIndex++
+	}
+
+	if query.From != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", argIndex))
+		args = append(args, *query.From)
+		argIndex++
+	}
+
+	if query.To != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at <= $%d", argIndex))
+		args = append(args, *query.To)
+		argIndex++
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	queryStr := fmt.Sprintf(`
+		SELECT id, token_id, company_id, vehicle_id, driver_id, offer_id, trip_id,
+		       ST_AsText(coordinates) as coordinates_txt, log_dt, reason, created_at
+		FROM tbl_gps_log_rejected
+		%s
+		ORDER BY id DESC
+		LIMIT $%d OFFSET $%d`,
+		whereClause, argIndex, argIndex+1)
+
+	args = append(args, limit, query.Offset)
+
+	var scans []GPSLogRejectedScan
+	err := pgxscan.Select(context.Background(), db.DB, &scans, queryStr, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rejected GPS logs: %w", err)
+	}
+
+	result := make([]dto.GPSLogRejected, len(scans))
+	for i, scan := range scans {
+		result[i] = dto.GPSLogRejected{
+			ID:        scan.ID,
+			TokenID:   scan.TokenID,
+			CompanyID: scan.CompanyID,
+			VehicleID: scan.VehicleID,
+			DriverID:  scan.DriverID,
+			OfferID:   scan.OfferID,
+			TripID:    scan.TripID,
+			LogDt:     scan.LogDt,
+			Reason:    scan.Reason,
+			CreatedAt: scan.CreatedAt,
+		}
+		if scan.CoordinatesTxt != nil && *scan.CoordinatesTxt != "" {
+			var point dto.Point
+			if err := point.Scan(*scan.CoordinatesTxt); err == nil {
+				result[i].Coordinates = &point
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// tripScopeCondition limits trips (column prefix p, e.g. "t.") to the ones a
+// company takes part in through an offer, its drivers or its vehicles. It is
+// also the access check of single trips, see CanCompanyAccessTrip.
+func tripScopeCondition(p string, argIndex int) string {
+	return fmt.Sprintf(`(%[1]sid IN (
+			SELECT ot.trip_id FROM tbl_offer_trip ot
+			JOIN tbl_offer o ON o.id = ot.offer_id
+			WHERE ot.deleted = 0 AND (o.company_id = $%[2]d OR o.exec_company_id = $%[2]d)
+		) OR %[1]svehicle_id IN (SELECT id FROM tbl_vehicle WHERE company_id = $%[2]d)
+		  OR %[1]sdriver_id IN (SELECT id FROM tbl_driver WHERE company_id = $%[2]d))`, p, argIndex)
+}
+
+// gpsLogScopeCondition limits GPS logs to the posting company and the
+// companies owning or executing the offer the logs belong to
+func gpsLogScopeCondition(argIndex int) string {
+	return fmt.Sprintf(`(company_id = $%[1]d
+		OR offer_id IN (SELECT id FROM tbl_offer WHERE company_id = $%[1]d OR exec_company_id = $%[1]d)
+		OR trip_id IN (
+			SELECT ot.trip_id FROM tbl_offer_trip ot
+			JOIN tbl_offer o ON o.id = ot.offer_id
+			WHERE ot.deleted = 0 AND (o.company_id = $%[1]d OR o.exec_company_id = $%[1]d)
+		))`, argIndex)
+}
@@ -0,0 +1,158 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	db "texApi/database"
+	"texApi/internal/dto"
+)
+
+// CreateGPSImport queues a background import, the batch is kept in the row
+// so the import survives a restart
+func CreateGPSImport(scope dto.GPSIngestScope, logs []dto.GPSLogInput) (int, error) {
+	payload, err := json.Marshal(dto.GPSImportPayload{Logs: logs, Scope: scope})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal GPS import: %w", err)
+	}
+
+	var id int
+	err = db.DB.QueryRow(context.Background(),
+		`INSERT INTO tbl_gps_import (company_id, token_id, total, payload)
+		 VALUES ($1, $2, $3, $4) RETURNING id`,
+		scope.CompanyID, scope.TokenID, len(logs), string(payload)).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create GPS import: %w", err)
+	}
+	return id, nil
+}
+
+func CountQueuedGPSImports() (int, error) {
+	var count int
+	err := db.DB.QueryRow(context.Background(),
+		`SELECT COUNT(*) FROM tbl_gps_import WHERE status = 'queued'`).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count queued GPS imports: %w", err)
+	}
+	return count, nil
+}
+
+// RequeueGPSImports puts imports that were cut off while processing back in
+// the queue, those that were already tried maxAttempts times fail
+func RequeueGPSImports(maxAttempts int) (int, error) {
+	ctx := context.Background()
+
+	_, err := db.DB.Exec(ctx,
+		`UPDATE tbl_gps_import
+		 SET status = 'failed', error = 'import was interrupted too many times', payload = NULL,
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE status = 'processing' AND attempts >= $1`,
+		maxAttempts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail interrupted GPS imports: %w", err)
+	}
+
+	tag, err := db.DB.Exec(ctx,
+		`UPDATE tbl_gps_import SET status = 'queued', updated_at = CURRENT_TIMESTAMP
+		 WHERE status = 'processing'`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue GPS imports: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// ClaimGPSImport marks the oldest queued import as processing and returns it,
+// the ID is 0 when nothing is queued
+func ClaimGPSImport() (int, dto.GPSImportPayload, error) {
+	var id int
+	var payloadJSON string
+	var payload dto.GPSImportPayload
+
+	err := db.DB.QueryRow(context.Background(),
+		`UPDATE tbl_gps_import
+		 SET status = 'processing', attempts = attempts + 1, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = (
+		     SELECT id FROM tbl_gps_import
+		     WHERE status = 'queued'
+		     ORDER BY id
+		     LIMIT 1
+		     FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING id, COALESCE(payload::text, '{}')`).Scan(&id, &payloadJSON)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, payload, nil
+		}
+		return 0, payload, fmt.Errorf("failed to claim GPS import: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(payloadJSON), &payload); err != nil {
+		return id, payload, fmt.Errorf("failed to read GPS import %d: %w", id, err)
+	}
+	return id, payload, nil
+}
+
+func FailGPSImport(id int, errorText string) error {
+	_, err := db.DB.Exec(context.Background(),
+		`UPDATE tbl_gps_import
+		 SET status = 'failed', error = $2, payload = NULL, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1`,
+		id, errorText)
+	if err != nil {
+		return fmt.Errorf("failed to update GPS import: %w", err)
+	}
+	return nil
+}
+
+// CompleteGPSImport stores the outcome, rejected counts only the invalid
+// points while the report lists the duplicates too
+func CompleteGPSImport(id int, report dto.GPSIngestReport) error {
+	reportJSON, err := json.Marshal(report.Rejected)
+	if err != nil {
+		return fmt.Errorf("failed to marshal GPS import report: %w", err)
+	}
+
+	_, err = db.DB.Exec(context.Background(),
+		`UPDATE tbl_gps_import
+		 SET status = 'completed', accepted = $2, duplicates = $3, rejected = $4,
+		     report = $5, payload = NULL, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1`,
+		id, report.Accepted, report.Duplicates, len(report.Rejected)-report.Duplicates, string(reportJSON))
+	if err != nil {
+		return fmt.Errorf("failed to complete GPS import: %w", err)
+	}
+	return nil
+}
+
+func GetGPSImport(id int, companyID *int) (dto.GPSImport, error) {
+	var result struct {
+		dto.GPSImport
+		ReportJSON string `db:"report_json"`
+	}
+
+	queryStr := `
+		SELECT id, uuid, company_id, token_id, status, total, accepted, duplicates, rejected,
+		       report::text AS report_json, error, created_at, updated_at
+		FROM tbl_gps_import
+		WHERE id = $1`
+	args := []interface{}{id}
+	if companyID != nil {
+		queryStr += " AND company_id = $2"
+		args = append(args, *companyID)
+	}
+
+	err := pgxscan.Get(context.Background(), db.DB, &result, queryStr, args...)
+	if err != nil {
+		return dto.GPSImport{}, fmt.Errorf("failed to get GPS import: %w", err)
+	}
+
+	gpsImport := result.GPSImport
+	if err := json.Unmarshal([]byte(result.ReportJSON), &gpsImport.Report); err != nil {
+		gpsImport.Report = []dto.GPSLogRejection{}
+	}
+	return gpsImport, nil
+}
@@ -0,0 +1,245 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	db "texApi/database"
+	"texApi/internal/dto"
+)
+
+// unarchivedTripCondition keeps the points of every trip whose archive is not
+// written yet, whatever its status, g is the tbl_gps_log alias
+const unarchivedTripCondition = `NOT EXISTS (
+	SELECT 1 FROM tbl_trip t
+	WHERE t.id = g.trip_id AND t.archived_at IS NULL
+)`
+
+func GetGPSRetentionPolicies() ([]dto.GPSRetentionPolicy, error) {
+	var policies []dto.GPSRetentionPolicy
+	err := pgxscan.Select(context.Background(), db.DB, &policies,
+		`SELECT level::text AS level, raw_days, downsample_sec, keep_days, updated_at
+		 FROM tbl_gps_retention
+		 ORDER BY level`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GPS retention policies: %w", err)
+	}
+	return policies, nil
+}
+
+func UpdateGPSRetentionPolicy(level string, input dto.GPSRetentionPolicyInput) error {
+	result, err := db.DB.Exec(context.Background(),
+		`UPDATE tbl_gps_retention
+		 SET raw_days = $2, downsample_sec = $3, keep_days = $4, updated_at = CURRENT_TIMESTAMP
+		 WHERE level = $1`,
+		level, input.RawDays, input.DownsampleSec, input.KeepDays)
+	if err != nil {
+		return fmt.Errorf("failed to update GPS retention policy: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("GPS retention policy not found")
+	}
+	return nil
+}
+
+// EnsureGPSLogPartitions creates the monthly partitions from the current month
+// up to monthsAhead months in advance
+func EnsureGPSLogPartitions(monthsAhead int) error {
+	_, err := db.DB.Exec(context.Background(),
+		`SELECT gps_log_create_partition((date_trunc('month', CURRENT_DATE) + i * INTERVAL '1 month')::date)
+		 FROM generate_series(0, $1) i`,
+		monthsAhead)
+	if err != nil {
+		return fmt.Errorf("failed to create GPS log partitions: %w", err)
+	}
+	return nil
+}
+
+// GetTripsToArchive returns completed trips whose track was not exported yet
+func GetTripsToArchive(limit int) ([]dto.Trip, error) {
+	var tripScans []TripScan
+	err := pgxscan.Select(context.Background(), db.DB, &tripScans,
+		`SELECT id, driver_id, vehicle_id, from_address, to_address, from_country, to_country,
+		        start_date, end_date,
+		        ST_AsText(from_location) as from_location_txt,
+		        ST_AsText(to_location) as to_location_txt,
+		        distance_km, status, meta, meta2, meta3, gps_logs,
+		        created_at, updated_at, deleted
+		 FROM tbl_trip
+		 WHERE status = 'completed' AND archived_at IS NULL
+		 ORDER BY end_date NULLS FIRST, id
+		 LIMIT $1`,
+		limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trips to archive: %w", err)
+	}
+
+	trips := make([]dto.Trip, len(tripScans))
+	for i, scan := range tripScans {
+		trips[i] = scan.ToTrip()
+	}
+	return trips, nil
+}
+
+// GetTripGPSLogs returns every stored point of the trip in log_dt order
+func GetTripGPSLogs(tripID int64) ([]dto.GPSLog, error) {
+	var logScans []GPSLogScan
+	err := pgxscan.Select(context.Background(), db.DB, &logScans,
+		`SELECT id, company_id, vehicle_id, driver_id, offer_id, trip_id,
+		        battery_level, speed, heading, accuracy,
+		        ST_AsText(coordinates) as coordinates_txt,
+		        status, log_dt, created_at
+		 FROM tbl_gps_log
+		 WHERE trip_id = $1
+		 ORDER BY log_dt, id`,
+		tripID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trip GPS logs: %w", err)
+	}
+
+	logs := make([]dto.GPSLog, len(logScans))
+	for i, scan := range logScans {
+		logs[i] = scan.ToGPSLog()
+	}
+	return logs, nil
+}
+
+func MarkTripArchived(tripID int64, archivePath string) error {
+	_, err := db.DB.Exec(context.Background(),
+		`UPDATE tbl_trip SET archive_path = $2, archived_at = CURRENT_TIMESTAMP WHERE id = $1`,
+		tripID, archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to mark trip archived: %w", err)
+	}
+	return nil
+}
+
+// companyLevelCondition matches the GPS logs (alias g) of companies whose
+// active plan has the tracking level. Logs without a plan fall under 'none'.
+func companyLevelCondition(argIndex int) string {
+	return fmt.Sprintf(`COALESCE((
+		SELECT p.gps_tracking_level::text
+		FROM tbl_company c
+		`+companyPlanJoinSQL+`
+		WHERE c.id = g.company_id AND c.plan_active = 1 AND c.deleted = 0
+	), 'none') = $%d`, argIndex)
+}
+
+// ApplyGPSRetention thins the points of the policy level that got older than
+// raw_days to one point per vehicle and downsample_sec, then deletes the
+// points older than keep_days. Every vehicle continues after the newest point
+// thinned so far, points stored since its last run are thinned even when they
+// are older, so late uploads are not skipped.
+func ApplyGPSRetention(policy dto.GPSRetentionPolicy, now time.Time) (downsampled, deleted int64, err error) {
+	ctx := context.Background()
+
+	// checked_at trails the run by a margin, so uploads that were still being
+	// stored when the run started are looked at again next time
+	err = db.DB.QueryRow(ctx, fmt.Sprintf(`
+		WITH candidates AS MATERIALIZED (
+			SELECT g.id, g.vehicle_id, g.log_dt
+			FROM tbl_gps_log g
+			LEFT JOIN tbl_gps_downsample_state s ON s.level::text = $1 AND s.vehicle_id = g.vehicle_id
+			WHERE g.log_dt < $2
+			  AND (s.vehicle_id IS NULL OR g.log_dt > s.downsampled_until OR g.created_at >= s.checked_at)
+			  AND %[1]s
+			  AND %[2]s
+		),
+		buckets AS (
+			SELECT DISTINCT vehicle_id, floor(extract(epoch FROM log_dt) / $3) AS bucket
+			FROM candidates
+		),
+		ranked AS (
+			SELECT g.id, g.log_dt, ROW_NUMBER() OVER (
+				PARTITION BY g.vehicle_id, b.bucket
+				ORDER BY g.log_dt, g.id
+			) AS rn
+			FROM buckets b
+			JOIN tbl_gps_log g ON g.vehicle_id = b.vehicle_id
+				AND g.log_dt >= to_timestamp(b.bucket * $3) AT TIME ZONE 'UTC'
+				AND g.log_dt < to_timestamp((b.bucket + 1) * $3) AT TIME ZONE 'UTC'
+			WHERE g.log_dt < $2
+			  AND %[1]s
+			  AND %[2]s
+		),
+		thinned AS (
+			DELETE FROM tbl_gps_log l
+			USING ranked r
+			WHERE r.rn > 1 AND l.id = r.id AND l.log_dt = r.log_dt
+			RETURNING l.id
+		),
+		progress AS (
+			INSERT INTO tbl_gps_downsample_state (level, vehicle_id, downsampled_until, checked_at)
+			SELECT $1::text::plan_level_t, vehicle_id, MAX(log_dt), CURRENT_TIMESTAMP - INTERVAL '10 minutes'
+			FROM candidates
+			GROUP BY vehicle_id
+			ON CONFLICT (level, vehicle_id) DO UPDATE
+			SET downsampled_until = GREATEST(tbl_gps_downsample_state.downsampled_until, EXCLUDED.downsampled_until),
+			    checked_at = EXCLUDED.checked_at
+		)
+		SELECT COUNT(*) FROM thinned`,
+		companyLevelCondition(1), unarchivedTripCondition),
+		policy.Level, now.AddDate(0, 0, -policy.RawDays), policy.DownsampleSec).Scan(&downsampled)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to downsample GPS logs: %w", err)
+	}
+
+	if policy.KeepDays > 0 {
+		result, err := db.DB.Exec(ctx, fmt.Sprintf(`
+			DELETE FROM tbl_gps_log g
+			WHERE g.log_dt < $1
+			  AND %s
+			  AND %s`,
+			companyLevelCondition(2), unarchivedTripCondition),
+			now.AddDate(0, 0, -policy.KeepDays), policy.Level)
+		if err != nil {
+			return downsampled, 0, fmt.Errorf("failed to delete expired GPS logs: %w", err)
+		}
+		deleted = result.RowsAffected()
+	}
+
+	return downsampled, deleted, nil
+}
+
+// DropEmptyGPSLogPartitions drops the monthly partitions that ended before the
+// cutoff and have no points left, which is cheaper than vacuuming them
+func DropEmptyGPSLogPartitions(before time.Time) ([]string, error) {
+	ctx := context.Background()
+
+	var partitions []string
+	err := pgxscan.Select(ctx, db.DB, &partitions,
+		`SELECT c.relname::text
+		 FROM pg_inherits i
+		 JOIN pg_class c ON c.oid = i.inhrelid
+		 WHERE i.inhparent = 'tbl_gps_log'::regclass
+		   AND c.relname ~ '^tbl_gps_log_y[0-9]{4}m[0-9]{2}$'
+		   AND to_date(substring(c.relname from 13), '"y"YYYY"m"MM') + INTERVAL '1 month' <= $1
+		 ORDER BY c.relname`,
+		before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GPS log partitions: %w", err)
+	}
+
+	var dropped []string
+	for _, partition := range partitions {
+		var hasRows bool
+		err := db.DB.QueryRow(ctx,
+			fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s)`, partition)).Scan(&hasRows)
+		if err != nil {
+			return dropped, fmt.Errorf("failed to check GPS log partition %s: %w", partition, err)
+		}
+		if hasRows {
+			continue
+		}
+
+		_, err = db.DB.Exec(ctx, fmt.Sprintf(`DROP TABLE %s`, partition))
+		if err != nil {
+			return dropped, fmt.Errorf("failed to drop GPS log partition %s: %w", partition, err)
+		}
+		dropped = append(dropped, partition)
+	}
+
+	return dropped, nil
+}
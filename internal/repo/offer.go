@@ -0,0 +1,99 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	db "texApi/database"
+)
+
+type OfferOwner struct {
+	ID            int `db:"id"`
+	UserID        int `db:"user_id"`
+	CompanyID     int `db:"company_id"`
+	ExecCompanyID int `db:"exec_company_id"`
+}
+
+// CanAccess reports whether the company owns or executes the offer
+func (o OfferOwner) CanAccess(companyID int) bool {
+	return companyID != 0 && (o.CompanyID == companyID || o.ExecCompanyID == companyID)
+}
+
+func GetOfferOwner(offerID int) (OfferOwner, error) {
+	var owner OfferOwner
+	err := pgxscan.Get(context.Background(), db.DB, &owner,
+		`SELECT id, COALESCE(user_id, 0) AS user_id, COALESCE(company_id, 0) AS company_id, exec_company_id
+		 FROM tbl_offer WHERE id = $1 AND deleted = 0`,
+		offerID)
+	if err != nil {
+		return owner, fmt.Errorf("failed to get offer: %w", err)
+	}
+	return owner, nil
+}
+
+func GetOfferOwners(offerIDs []int) (map[int]OfferOwner, error) {
+	var rows []OfferOwner
+	err := pgxscan.Select(context.Background(), db.DB, &rows,
+		`SELECT id, COALESCE(user_id, 0) AS user_id, COALESCE(company_id, 0) AS company_id, exec_company_id
+		 FROM tbl_offer WHERE id = ANY($1)`,
+		offerIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get offer owners: %w", err)
+	}
+
+	owners := make(map[int]OfferOwner, len(rows))
+	for _, row := range rows {
+		owners[row.ID] = row
+	}
+	return owners, nil
+}
+
+// CanCompanyAccessTrip reports whether the company takes part in the trip, by
+// the same rule as the trip lists
+func CanCompanyAccessTrip(tripID, companyID int) bool {
+	var exists bool
+	err := db.DB.QueryRow(context.Background(),
+		`SELECT EXISTS (
+			SELECT 1 FROM tbl_trip t WHERE t.id = $1 AND t.deleted = 0 AND `+tripScopeCondition("t.", 2)+`
+		)`, tripID, companyID).Scan(&exists)
+	return err == nil && exists
+}
+
+// CanCompanyAccessVehicle allows the vehicle's own company and the companies
+// owning or executing an offer the vehicle is assigned to, while that offer
+// is assigned, in transit or delivered
+func CanCompanyAccessVehicle(vehicleID, companyID int) bool {
+	var exists bool
+	err := db.DB.QueryRow(context.Background(),
+		`SELECT EXISTS (
+			SELECT 1 FROM tbl_vehicle WHERE id = $1 AND company_id = $2 AND deleted = 0
+		) OR EXISTS (
+			SELECT 1 FROM tbl_offer
+			WHERE vehicle_id = $1 AND deleted = 0
+			  AND offer_state IN ('assigned', 'in_transit', 'delivered')
+			  AND (company_id = $2 OR exec_company_id = $2)
+		)`, vehicleID, companyID).Scan(&exists)
+	return err == nil && exists
+}
+
+// GetTripOfferIDs maps every given trip to the offers linked to it
+func GetTripOfferIDs(tripIDs []int) (map[int][]int, error) {
+	var rows []struct {
+		TripID  int `db:"trip_id"`
+		OfferID int `db:"offer_id"`
+	}
+	err := pgxscan.Select(context.Background(), db.DB, &rows,
+		`SELECT trip_id, offer_id FROM tbl_offer_trip
+		 WHERE trip_id = ANY($1) AND deleted = 0`,
+		tripIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trip offers: %w", err)
+	}
+
+	result := make(map[int][]int, len(tripIDs))
+	for _, row := range rows {
+		result[row.TripID] = append(result[row.TripID], row.OfferID)
+	}
+	return result, nil
+}
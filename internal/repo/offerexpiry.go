@@ -0,0 +1,118 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	db "texApi/database"
+	"texApi/internal/dto"
+)
+
+const offerExpiryBatch = 500
+
+// validity_end and delivery_end are dates, an offer is valid through the whole day
+const offerExpiredSQL = `(o.validity_end + INTERVAL '1 day' + make_interval(hours => $1) <= $3::timestamptz
+	OR o.delivery_end + INTERVAL '1 day' + make_interval(hours => $2) <= $3::timestamptz)`
+
+// an open tender is closed by the tender job, the offer expires after that
+const offerNoOpenTenderSQL = `NOT EXISTS (
+	SELECT 1 FROM tbl_offer_tender t WHERE t.offer_id = o.id AND t.state = 'open'
+)`
+
+type ExpiredOfferResponse struct {
+	ID        int `db:"id"`
+	CompanyID int `db:"company_id"`
+	UserID    int `db:"user_id"` // user of the responding company
+}
+
+type ExpiredOffer struct {
+	ID        int
+	UserID    int
+	CompanyID int
+	Reason    string
+	Responses []ExpiredOfferResponse
+}
+
+// GetExpiredOfferIDs returns pending and active offers past their validity or
+// delivery end plus the grace periods, offers with an open tender are skipped
+func GetExpiredOfferIDs(validityGrace, deliveryGrace int, now time.Time) ([]int, error) {
+	var ids []int
+	err := pgxscan.Select(context.Background(), db.DB, &ids,
+		`SELECT o.id FROM tbl_offer o
+		 WHERE o.offer_state IN ('pending', 'active') AND o.deleted = 0 AND `+offerExpiredSQL+`
+		   AND `+offerNoOpenTenderSQL+`
+		 ORDER BY o.id
+		 LIMIT $4`,
+		validityGrace, deliveryGrace, now, offerExpiryBatch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get expired offers: %w", err)
+	}
+	return ids, nil
+}
+
+// ExpireOffer archives the offer and declines its pending responses. It
+// returns nil when the offer is no longer expired, runs an open tender or is
+// locked by another change. Tenders are opened and closed with the offer row
+// locked, so the tender can't open once the offer is locked here.
+func ExpireOffer(offerID, validityGrace, deliveryGrace int, now time.Time) (*ExpiredOffer, error) {
+	ctx := context.Background()
+
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	offer := ExpiredOffer{ID: offerID}
+	err = tx.QueryRow(ctx,
+		`SELECT COALESCE(o.user_id, 0), COALESCE(o.company_id, 0),
+		        CASE WHEN o.validity_end + INTERVAL '1 day' + make_interval(hours => $1) <= $3::timestamptz
+		             THEN 'validity ended ' || o.validity_end::text
+		             ELSE 'delivery ended ' || o.delivery_end::text END
+		 FROM tbl_offer o
+		 WHERE o.id = $4 AND o.offer_state IN ('pending', 'active') AND o.deleted = 0 AND `+offerExpiredSQL+`
+		   AND `+offerNoOpenTenderSQL+`
+		 FOR UPDATE SKIP LOCKED`,
+		validityGrace, deliveryGrace, now, offerID,
+	).Scan(&offer.UserID, &offer.CompanyID, &offer.Reason)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get expired offer: %w", err)
+	}
+
+	actor := dto.OfferActor{Role: "system"}
+	if _, err := TransitionOfferTx(ctx, tx, offerID, dto.OfferStateArchived, actor, "expired: "+offer.Reason); err != nil {
+		return nil, err
+	}
+
+	err = pgxscan.Select(ctx, tx, &offer.Responses,
+		`WITH declined AS (
+			UPDATE tbl_offer_response
+			SET state = 'declined', reason = $2, updated_at = CURRENT_TIMESTAMP
+			WHERE offer_id = $1 AND state = 'pending' AND deleted = 0
+			RETURNING id, company_id
+		)
+		SELECT d.id, COALESCE(d.company_id, 0) AS company_id, COALESCE(c.user_id, 0) AS user_id
+		FROM declined d
+		LEFT JOIN tbl_company c ON c.id = d.company_id`,
+		offerID, "offer expired: "+offer.Reason)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decline offer responses: %w", err)
+	}
+	for _, response := range offer.Responses {
+		if _, err := RecordOfferResponseRound(ctx, tx, response.ID, dto.NegotiationDecline, actor, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &offer, nil
+}
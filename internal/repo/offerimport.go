@@ -0,0 +1,54 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	db "texApi/database"
+)
+
+type lookupName struct {
+	ID   int    `db:"id"`
+	Name string `db:"name"`
+}
+
+// lookupIDsByName maps the lowercased names of every language to their id
+func lookupIDsByName(query string) (map[string]int, error) {
+	var names []lookupName
+	if err := pgxscan.Select(context.Background(), db.DB, &names, query); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]int, len(names))
+	for _, name := range names {
+		key := strings.ToLower(strings.TrimSpace(name.Name))
+		if _, ok := ids[key]; key != "" && !ok {
+			ids[key] = name.ID
+		}
+	}
+	return ids, nil
+}
+
+// GetVehicleTypeIDsByName maps the English, Russian and Turkmen vehicle type
+// titles to their id
+func GetVehicleTypeIDsByName() (map[string]int, error) {
+	ids, err := lookupIDsByName(`SELECT id, unnest(ARRAY[title_en, title_ru, title_tk]) AS name
+		FROM tbl_vehicle_type WHERE COALESCE(deleted, 0) = 0 ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vehicle types: %w", err)
+	}
+	return ids, nil
+}
+
+// GetPackagingTypeIDsByName maps the English, Russian and Turkmen packaging
+// type names to their id
+func GetPackagingTypeIDsByName() (map[string]int, error) {
+	ids, err := lookupIDsByName(`SELECT id, unnest(ARRAY[name_en, name_ru, name_tk]) AS name
+		FROM tbl_packaging_type WHERE deleted = 0 ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get packaging types: %w", err)
+	}
+	return ids, nil
+}
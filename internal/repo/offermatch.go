@@ -0,0 +1,455 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	db "texApi/database"
+	"texApi/internal/dto"
+)
+
+var ErrOfferAccess = errors.New("you don't have access to this offer")
+var ErrOfferMatchRole = errors.New("only sender and carrier offers can be matched")
+
+const (
+	matchCandidateLimit     = 500 // vehicles or loads scored per request
+	matchVehiclesPerCarrier = 5
+	matchPositionMaxAge     = 7 * 24 * time.Hour
+	matchProximityKM        = 1000.0 // farther positions get no proximity score
+	matchSameCountryScore   = 0.3    // proximity without a known position, same country
+	matchOpsSaturation      = 100    // successful operations for the full score
+	matchLaneSaturation     = 5      // delivered offers on the lane for the full score
+)
+
+// matchWeights are the points of every score part, they add up to 100
+var matchWeights = dto.MatchScores{
+	VehicleType:   25,
+	Weight:        15,
+	Proximity:     25,
+	Rating:        15,
+	SuccessfulOps: 10,
+	Lane:          10,
+}
+
+// weightUnitKG converts the weight_type_t units to kilograms
+var weightUnitKG = map[string]float64{
+	"kg":  1,
+	"g":   0.001,
+	"lbs": 0.45359237,
+	"oz":  0.028349523125,
+	"st":  6.35029318,
+	"t":   1000,
+	"tn":  907.18474, // short ton
+}
+
+// WeightUnitKG returns the kilograms of one unit of the weight_type_t unit
+func WeightUnitKG(unit string) (float64, bool) {
+	factor, ok := weightUnitKG[unit]
+	return factor, ok
+}
+
+func cargoWeightKG(weight int, unit string) *float64 {
+	factor, ok := weightUnitKG[unit]
+	if weight <= 0 || !ok {
+		return nil
+	}
+	kg := float64(weight) * factor
+	return &kg
+}
+
+// offerPickupSQL is the pickup point of the offer: its pickup geofence, or the
+// centre of the trips that started in the offer's country
+func offerPickupSQL(offer string) string {
+	return fmt.Sprintf(`COALESCE(
+		(SELECT COALESCE(g.center, ST_Centroid(g.area)) FROM tbl_geofence g
+		 WHERE g.offer_id = %[1]s.id AND g.kind = 'pickup' AND g.deleted = 0
+		 ORDER BY g.id LIMIT 1),
+		(SELECT ST_Centroid(ST_Collect(t.from_location)) FROM tbl_trip t
+		 WHERE %[1]s.from_country <> '' AND LOWER(t.from_country) = LOWER(%[1]s.from_country)
+		   AND t.from_location IS NOT NULL AND t.deleted = 0))`, offer)
+}
+
+// offerLaneCountSQL counts the offers the company delivered on the lane
+func offerLaneCountSQL(companyID, lane string) string {
+	return fmt.Sprintf(`(SELECT COUNT(*)::int FROM tbl_offer p
+		 WHERE p.exec_company_id = %[1]s AND p.offer_state IN ('delivered', 'completed') AND p.deleted = 0
+		   AND LOWER(p.from_country) = LOWER(%[2]s.from_country)
+		   AND LOWER(p.to_country) = LOWER(%[2]s.to_country))`, companyID, lane)
+}
+
+type offerMatchSubject struct {
+	ID              int    `db:"id"`
+	CompanyID       int    `db:"company_id"`
+	OfferRole       string `db:"offer_role"`
+	VehicleTypeID   int    `db:"vehicle_type_id"`
+	PayloadKG       int    `db:"payload_kg"`
+	CargoWeight     int    `db:"cargo_weight"`
+	CargoWeightType string `db:"cargo_weight_type"`
+	cargoMatchSpace
+	VolumeM3      float64 `db:"volume_m3"`
+	LoadingMeters float64 `db:"loading_meters"`
+	Reefer        bool    `db:"reefer"`
+	ADR           bool    `db:"adr"`
+}
+
+// cargoMatchSpace is the space and equipment the cargo of an offer needs,
+// 0 when unknown
+type cargoMatchSpace struct {
+	CargoVolumeM3      float64 `db:"cargo_volume_m3"`
+	CargoLoadingMeters float64 `db:"cargo_loading_meters"`
+	CargoReefer        bool    `db:"cargo_reefer"` // temperature controlled
+	CargoADR           bool    `db:"cargo_adr"`    // dangerous goods
+}
+
+// cargoMatchSpaceSQL reads cargoMatchSpace from the cargo cg
+const cargoMatchSpaceSQL = `COALESCE(cg.volume_m3, 0) AS cargo_volume_m3,
+	COALESCE(cg.loading_meters, 0) AS cargo_loading_meters,
+	COALESCE(cg.temp_min IS NOT NULL OR cg.temp_max IS NOT NULL, false) AS cargo_reefer,
+	COALESCE(cg.adr_class <> '', false) AS cargo_adr`
+
+// fits tells whether the cargo fits a vehicle, unknown measures of either
+// side fit
+func (cargo cargoMatchSpace) fits(volumeM3, loadingMeters float64, reefer, adr bool) bool {
+	if cargo.CargoVolumeM3 > 0 && volumeM3 > 0 && cargo.CargoVolumeM3 > volumeM3 {
+		return false
+	}
+	if cargo.CargoLoadingMeters > 0 && loadingMeters > 0 && cargo.CargoLoadingMeters > loadingMeters {
+		return false
+	}
+	return (!cargo.CargoReefer || reefer) && (!cargo.CargoADR || adr)
+}
+
+type vehicleMatchScan struct {
+	VehicleID      int        `db:"vehicle_id"`
+	CompanyID      int        `db:"company_id"`
+	CompanyName    string     `db:"company_name"`
+	VehicleTypeID  int        `db:"vehicle_type_id"`
+	Numberplate    string     `db:"numberplate"`
+	PayloadKG      int        `db:"payload_kg"`
+	Rating         int        `db:"rating"`
+	SuccessfulOps  int        `db:"successful_ops"`
+	SameCountry    bool       `db:"same_country"`
+	LastPositionDt *time.Time `db:"last_position_dt"`
+	DistanceKM     *float64   `db:"distance_km"`
+	LaneCount      int        `db:"lane_count"`
+}
+
+type loadMatchScan struct {
+	OfferID         int    `db:"offer_id"`
+	CompanyID       int    `db:"company_id"`
+	CompanyName     string `db:"company_name"`
+	Rating          int    `db:"rating"`
+	SuccessfulOps   int    `db:"successful_ops"`
+	VehicleTypeID   int    `db:"vehicle_type_id"`
+	CargoID         int    `db:"cargo_id"`
+	CargoWeight     int    `db:"cargo_weight"`
+	CargoWeightType string `db:"cargo_weight_type"`
+	cargoMatchSpace
+	FromCountry   string    `db:"from_country"`
+	FromRegion    string    `db:"from_region"`
+	ToCountry     string    `db:"to_country"`
+	ToRegion      string    `db:"to_region"`
+	OfferPrice    float64   `db:"offer_price"`
+	Currency      string    `db:"currency"`
+	DeliveryStart time.Time `db:"delivery_start"`
+	DeliveryEnd   time.Time `db:"delivery_end"`
+	SameCountry   bool      `db:"same_country"`
+	DistanceKM    *float64  `db:"distance_km"`
+	LaneCount     int       `db:"lane_count"`
+}
+
+// GetOfferMatches ranks carriers and their vehicles for a sender offer, or
+// open loads for a carrier offer. Companies only see matches of their offers.
+func GetOfferMatches(offerID int, scopeCompanyID *int, limit int) (dto.OfferMatches, error) {
+	ctx := context.Background()
+	matches := dto.OfferMatches{OfferID: offerID}
+
+	var subject offerMatchSubject
+	err := pgxscan.Get(ctx, db.DB, &subject,
+		`SELECT o.id, COALESCE(o.company_id, 0) AS company_id, o.offer_role::text AS offer_role,
+		        COALESCE(NULLIF(o.vehicle_type_id, 0), v.vehicle_type_id, 0) AS vehicle_type_id,
+		        COALESCE(v.payload_kg, 0) AS payload_kg,
+		        COALESCE(cg.weight, 0) AS cargo_weight,
+		        COALESCE(cg.weight_type::text, 'kg') AS cargo_weight_type,
+		        `+cargoMatchSpaceSQL+`,
+		        COALESCE(v.volume_m3, 0) AS volume_m3, COALESCE(v.loading_meters, 0) AS loading_meters,
+		        COALESCE(v.reefer, 0) = 1 AS reefer, COALESCE(v.adr, 0) = 1 AS adr
+		 FROM tbl_offer o
+		 LEFT JOIN tbl_vehicle v ON v.id = o.vehicle_id AND v.deleted = 0
+		 LEFT JOIN tbl_cargo cg ON cg.id = o.cargo_id AND cg.deleted = 0
+		 WHERE o.id = $1 AND o.deleted = 0`,
+		offerID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return matches, ErrOfferNotFound
+		}
+		return matches, fmt.Errorf("failed to get offer: %w", err)
+	}
+	if scopeCompanyID != nil && subject.CompanyID != *scopeCompanyID {
+		return matches, ErrOfferAccess
+	}
+	matches.OfferRole = subject.OfferRole
+
+	switch subject.OfferRole {
+	case "sender":
+		matches.Carriers, err = matchCarriers(ctx, subject, limit)
+	case "carrier":
+		matches.Loads, err = matchLoads(ctx, subject, limit)
+	default:
+		err = ErrOfferMatchRole
+	}
+	return matches, err
+}
+
+func matchCarriers(ctx context.Context, subject offerMatchSubject, limit int) ([]dto.CarrierMatch, error) {
+	weightKG := cargoWeightKG(subject.CargoWeight, subject.CargoWeightType)
+
+	var scans []vehicleMatchScan
+	err := pgxscan.Select(ctx, db.DB, &scans, fmt.Sprintf(
+		`WITH src AS (
+			SELECT o.id, COALESCE(o.company_id, 0) AS company_id, o.from_country, o.to_country,
+			       %s AS pickup
+			FROM tbl_offer o WHERE o.id = $1
+		)
+		SELECT v.id AS vehicle_id, v.company_id, c.company_name,
+		       COALESCE(v.vehicle_type_id, 0) AS vehicle_type_id, v.numberplate, v.payload_kg,
+		       c.rating, c.successful_ops,
+		       (src.from_country <> '' AND LOWER(c.country) = LOWER(src.from_country)) AS same_country,
+		       pos.log_dt AS last_position_dt,
+		       ST_Distance(pos.coordinates::geography, src.pickup::geography) / 1000.0 AS distance_km,
+		       %s AS lane_count
+		FROM src
+		JOIN tbl_vehicle v ON v.company_id <> src.company_id
+		    AND v.active = 1 AND v.available = 1 AND v.deleted = 0
+		JOIN tbl_company c ON c.id = v.company_id AND c.role = 'carrier' AND c.active = 1 AND c.deleted = 0
+		LEFT JOIN LATERAL (
+			SELECT l.coordinates, l.log_dt FROM tbl_gps_log l
+			WHERE l.vehicle_id = v.id AND l.log_dt >= $2
+			ORDER BY l.log_dt DESC LIMIT 1
+		) pos ON true
+		WHERE (v.payload_kg = 0 OR $3::float8 IS NULL OR v.payload_kg >= $3::float8)
+		  AND (v.volume_m3 = 0 OR v.volume_m3 >= $6::float8)
+		  AND (v.loading_meters = 0 OR v.loading_meters >= $7::float8)
+		  AND (NOT $8::bool OR v.reefer = 1)
+		  AND (NOT $9::bool OR v.adr = 1)
+		ORDER BY ($4 = 0 OR v.vehicle_type_id = $4) DESC, distance_km NULLS LAST, v.id
+		LIMIT $5`,
+		offerPickupSQL("o"), offerLaneCountSQL("c.id", "src")),
+		subject.ID, time.Now().Add(-matchPositionMaxAge), weightKG, subject.VehicleTypeID, matchCandidateLimit,
+		subject.CargoVolumeM3, subject.CargoLoadingMeters, subject.CargoReefer, subject.CargoADR)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get matching vehicles: %w", err)
+	}
+
+	carriers := map[int]*dto.CarrierMatch{}
+	for _, scan := range scans {
+		scores := dto.MatchScores{
+			VehicleType:   vehicleTypeScore(subject.VehicleTypeID, scan.VehicleTypeID),
+			Weight:        weightScore(weightKG, scan.PayloadKG),
+			Proximity:     proximityScore(scan.DistanceKM, scan.SameCountry),
+			Rating:        ratingScore(scan.Rating),
+			SuccessfulOps: successfulOpsScore(scan.SuccessfulOps),
+			Lane:          laneScore(scan.LaneCount),
+		}
+
+		carrier, ok := carriers[scan.CompanyID]
+		if !ok {
+			carrier = &dto.CarrierMatch{
+				CompanyID:     scan.CompanyID,
+				CompanyName:   scan.CompanyName,
+				Rating:        scan.Rating,
+				SuccessfulOps: scan.SuccessfulOps,
+				LaneCount:     scan.LaneCount,
+			}
+			carriers[scan.CompanyID] = carrier
+		}
+		carrier.Vehicles = append(carrier.Vehicles, dto.VehicleMatch{
+			VehicleID:      scan.VehicleID,
+			VehicleTypeID:  scan.VehicleTypeID,
+			Numberplate:    scan.Numberplate,
+			PayloadKG:      scan.PayloadKG,
+			DistanceKM:     roundKM(scan.DistanceKM),
+			LastPositionDt: scan.LastPositionDt,
+			Score:          matchScore(scores),
+			Scores:         scores,
+		})
+	}
+
+	result := make([]dto.CarrierMatch, 0, len(carriers))
+	for _, carrier := range carriers {
+		sort.SliceStable(carrier.Vehicles, func(i, j int) bool {
+			return carrier.Vehicles[i].Score > carrier.Vehicles[j].Score
+		})
+		if len(carrier.Vehicles) > matchVehiclesPerCarrier {
+			carrier.Vehicles = carrier.Vehicles[:matchVehiclesPerCarrier]
+		}
+		carrier.Score = carrier.Vehicles[0].Score
+		result = append(result, *carrier)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+		return result[i].CompanyID < result[j].CompanyID
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result, nil
+}
+
+func matchLoads(ctx context.Context, subject offerMatchSubject, limit int) ([]dto.LoadMatch, error) {
+	var scans []loadMatchScan
+	err := pgxscan.Select(ctx, db.DB, &scans, fmt.Sprintf(
+		`WITH src AS (
+			SELECT o.id, COALESCE(o.company_id, 0) AS company_id, o.from_country,
+			       COALESCE(
+			           (SELECT l.coordinates FROM tbl_gps_log l
+			            WHERE o.vehicle_id > 0 AND l.vehicle_id = o.vehicle_id AND l.log_dt >= $2
+			            ORDER BY l.log_dt DESC LIMIT 1),
+			           %s) AS position
+			FROM tbl_offer o WHERE o.id = $1
+		)
+		SELECT ld.id AS offer_id, COALESCE(ld.company_id, 0) AS company_id, c.company_name,
+		       c.rating, c.successful_ops, ld.vehicle_type_id, ld.cargo_id,
+		       COALESCE(cg.weight, 0) AS cargo_weight, COALESCE(cg.weight_type::text, 'kg') AS cargo_weight_type,
+		       `+cargoMatchSpaceSQL+`,
+		       ld.from_country, ld.from_region, ld.to_country, ld.to_region,
+		       ld.offer_price, ld.currency::text AS currency, ld.delivery_start, ld.delivery_end,
+		       (src.from_country <> '' AND LOWER(ld.from_country) = LOWER(src.from_country)) AS same_country,
+		       ST_Distance(src.position::geography, (%s)::geography) / 1000.0 AS distance_km,
+		       %s AS lane_count
+		FROM src
+		JOIN tbl_offer ld ON ld.offer_role = 'sender' AND ld.offer_state = 'active' AND ld.deleted = 0
+		    AND ld.validity_end >= CURRENT_DATE AND COALESCE(ld.company_id, 0) <> src.company_id
+		JOIN tbl_company c ON c.id = ld.company_id
+		LEFT JOIN tbl_cargo cg ON cg.id = ld.cargo_id AND cg.deleted = 0
+		ORDER BY ($3 = 0 OR ld.vehicle_type_id IN (0, $3)) DESC, distance_km NULLS LAST, ld.created_at DESC
+		LIMIT $4`,
+		offerPickupSQL("o"), offerPickupSQL("ld"), offerLaneCountSQL("src.company_id", "ld")),
+		subject.ID, time.Now().Add(-matchPositionMaxAge), subject.VehicleTypeID, matchCandidateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get matching loads: %w", err)
+	}
+
+	loads := make([]dto.LoadMatch, 0, len(scans))
+	for _, scan := range scans {
+		weightKG := cargoWeightKG(scan.CargoWeight, scan.CargoWeightType)
+		if weightKG != nil && subject.PayloadKG > 0 && *weightKG > float64(subject.PayloadKG) {
+			continue
+		}
+		if !scan.fits(subject.VolumeM3, subject.LoadingMeters, subject.Reefer, subject.ADR) {
+			continue
+		}
+
+		scores := dto.MatchScores{
+			VehicleType:   vehicleTypeScore(scan.VehicleTypeID, subject.VehicleTypeID),
+			Weight:        weightScore(weightKG, subject.PayloadKG),
+			Proximity:     proximityScore(scan.DistanceKM, scan.SameCountry),
+			Rating:        ratingScore(scan.Rating),
+			SuccessfulOps: successfulOpsScore(scan.SuccessfulOps),
+			Lane:          laneScore(scan.LaneCount),
+		}
+		loads = append(loads, dto.LoadMatch{
+			OfferID:       scan.OfferID,
+			CompanyID:     scan.CompanyID,
+			CompanyName:   scan.CompanyName,
+			VehicleTypeID: scan.VehicleTypeID,
+			CargoID:       scan.CargoID,
+			CargoWeightKG: weightKG,
+			FromCountry:   scan.FromCountry,
+			FromRegion:    scan.FromRegion,
+			ToCountry:     scan.ToCountry,
+			ToRegion:      scan.ToRegion,
+			OfferPrice:    scan.OfferPrice,
+			Currency:      scan.Currency,
+			DeliveryStart: scan.DeliveryStart,
+			DeliveryEnd:   scan.DeliveryEnd,
+			DistanceKM:    roundKM(scan.DistanceKM),
+			LaneCount:     scan.LaneCount,
+			Score:         matchScore(scores),
+			Scores:        scores,
+		})
+	}
+
+	sort.SliceStable(loads, func(i, j int) bool {
+		return loads[i].Score > loads[j].Score
+	})
+	if len(loads) > limit {
+		loads = loads[:limit]
+	}
+
+	return loads, nil
+}
+
+// vehicleTypeScore is full for the required type and half when either side
+// does not name a type
+func vehicleTypeScore(required, actual int) float64 {
+	switch {
+	case required == 0 || actual == 0:
+		return 0.5
+	case required == actual:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// weightScore prefers vehicles the cargo fills well, vehicles too small for
+// the cargo are filtered out before scoring
+func weightScore(weightKG *float64, payloadKG int) float64 {
+	if weightKG == nil || payloadKG <= 0 {
+		return 0.5
+	}
+	return 0.6 + 0.4*math.Min(*weightKG/float64(payloadKG), 1)
+}
+
+func proximityScore(distanceKM *float64, sameCountry bool) float64 {
+	if distanceKM != nil {
+		return math.Max(0, 1-*distanceKM/matchProximityKM)
+	}
+	if sameCountry {
+		return matchSameCountryScore
+	}
+	return 0
+}
+
+func ratingScore(rating int) float64 {
+	return math.Min(math.Max(float64(rating)/5, 0), 1)
+}
+
+func successfulOpsScore(ops int) float64 {
+	if ops <= 0 {
+		return 0
+	}
+	return math.Min(math.Log1p(float64(ops))/math.Log1p(matchOpsSaturation), 1)
+}
+
+func laneScore(count int) float64 {
+	return math.Min(float64(count)/matchLaneSaturation, 1)
+}
+
+func matchScore(s dto.MatchScores) float64 {
+	score := s.VehicleType*matchWeights.VehicleType +
+		s.Weight*matchWeights.Weight +
+		s.Proximity*matchWeights.Proximity +
+		s.Rating*matchWeights.Rating +
+		s.SuccessfulOps*matchWeights.SuccessfulOps +
+		s.Lane*matchWeights.Lane
+	return math.Round(score*100) / 100
+}
+
+func roundKM(km *float64) *float64 {
+	if km == nil {
+		return nil
+	}
+	rounded := math.Round(*km*100) / 100
+	return &rounded
+}
@@ -0,0 +1,216 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	db "texApi/database"
+	"texApi/internal/dto"
+)
+
+var ErrOfferResponseNotFound = errors.New("offer response not found")
+var ErrNegotiationClosed = errors.New("offer response is no longer pending")
+var ErrNegotiationForbidden = errors.New("only the companies of the response can negotiate it")
+var ErrNegotiationTurn = errors.New("the other side has to answer your latest terms first")
+var ErrCounterExpired = errors.New("the latest terms of the response have expired")
+
+const offerResponseRoundColumns = `id, response_id, round, action::text AS action, company_id, user_id,
+	bid_price::float8 AS bid_price, payment_method::text AS payment_method, payment_term,
+	delivery_start, delivery_end, note, expires_at, created_at`
+
+// OfferNegotiation is the negotiation state of a response
+type OfferNegotiation struct {
+	ID            int
+	OfferID       int
+	CompanyID     int // responding company
+	ToCompanyID   int // company of the offer
+	LastCompanyID int
+	State         string
+	Round         int
+	ExpiresAt     *time.Time
+}
+
+// Party reports whether the company is one side of the response
+func (n OfferNegotiation) Party(companyID int) bool {
+	return companyID != 0 && (companyID == n.CompanyID || companyID == n.ToCompanyID)
+}
+
+// Answering returns the company that answers the latest terms
+func (n OfferNegotiation) Answering() int {
+	if n.LastCompanyID == n.ToCompanyID {
+		return n.CompanyID
+	}
+	return n.ToCompanyID
+}
+
+func (n OfferNegotiation) Expired(now time.Time) bool {
+	return n.ExpiresAt != nil && !now.Before(*n.ExpiresAt)
+}
+
+const offerNegotiationQuery = `SELECT COALESCE(offer_id, 0), COALESCE(company_id, 0), to_company_id,
+	last_company_id, state::text, round, expires_at
+	FROM tbl_offer_response WHERE id = $1 AND deleted = 0`
+
+func getOfferNegotiation(ctx context.Context, q offerStateQuerier, query string, responseID int) (OfferNegotiation, error) {
+	n := OfferNegotiation{ID: responseID}
+	err := q.QueryRow(ctx, query, responseID).
+		Scan(&n.OfferID, &n.CompanyID, &n.ToCompanyID, &n.LastCompanyID, &n.State, &n.Round, &n.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return n, ErrOfferResponseNotFound
+		}
+		return n, fmt.Errorf("failed to get offer response: %w", err)
+	}
+	return n, nil
+}
+
+// GetOfferNegotiation returns the negotiation state of the response
+func GetOfferNegotiation(responseID int) (OfferNegotiation, error) {
+	return getOfferNegotiation(context.Background(), db.DB, offerNegotiationQuery, responseID)
+}
+
+// LockOfferNegotiation is GetOfferNegotiation inside the caller's
+// transaction, the response stays locked until it ends
+func LockOfferNegotiation(ctx context.Context, tx pgx.Tx, responseID int) (OfferNegotiation, error) {
+	return getOfferNegotiation(ctx, tx, offerNegotiationQuery+" FOR UPDATE", responseID)
+}
+
+// RecordOfferResponseRound adds the action to the history of the response
+// with its current terms
+func RecordOfferResponseRound(ctx context.Context, q pgxscan.Querier, responseID int, action string, actor dto.OfferActor, note *string) (dto.OfferResponseRound, error) {
+	var round dto.OfferResponseRound
+	err := pgxscan.Get(ctx, q, &round,
+		`INSERT INTO tbl_offer_response_round
+		    (response_id, round, action, company_id, user_id, bid_price, payment_method, payment_term,
+		     delivery_start, delivery_end, note, expires_at)
+		 SELECT id, round, $2::negotiation_action_t, $3, $4, bid_price, payment_method, payment_term,
+		        delivery_start, delivery_end, $5, expires_at
+		 FROM tbl_offer_response WHERE id = $1
+		 RETURNING `+offerResponseRoundColumns,
+		responseID, action, actor.CompanyID, actor.UserID, note)
+	if err != nil {
+		return round, fmt.Errorf("failed to record offer response round: %w", err)
+	}
+	return round, nil
+}
+
+// CounterOfferResponse answers the latest terms of the response with new
+// ones. Only the side that didn't make the latest terms may counter them.
+func CounterOfferResponse(responseID int, counter dto.OfferResponseCounter, expiresAt time.Time, actor dto.OfferActor) (dto.OfferResponseRound, OfferNegotiation, error) {
+	ctx := context.Background()
+
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return dto.OfferResponseRound{}, OfferNegotiation{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	n, err := LockOfferNegotiation(ctx, tx, responseID)
+	if err != nil {
+		return dto.OfferResponseRound{}, n, err
+	}
+	switch {
+	case !n.Party(actor.CompanyID):
+		return dto.OfferResponseRound{}, n, ErrNegotiationForbidden
+	case n.State != "pending":
+		return dto.OfferResponseRound{}, n, ErrNegotiationClosed
+	case n.Answering() != actor.CompanyID:
+		return dto.OfferResponseRound{}, n, ErrNegotiationTurn
+	case n.Expired(time.Now()):
+		return dto.OfferResponseRound{}, n, ErrCounterExpired
+	}
+	if open, err := tenderOpen(ctx, tx, n.OfferID); err != nil {
+		return dto.OfferResponseRound{}, n, err
+	} else if open {
+		return dto.OfferResponseRound{}, n, ErrTenderOpen
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE tbl_offer_response SET
+		    bid_price = COALESCE($2, bid_price),
+		    payment_method = COALESCE($3::payment_method_t, payment_method),
+		    payment_term = COALESCE($4, payment_term),
+		    delivery_start = COALESCE($5::date, delivery_start),
+		    delivery_end = COALESCE($6::date, delivery_end),
+		    round = round + 1,
+		    last_company_id = $7,
+		    expires_at = $8,
+		    updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1`,
+		responseID, counter.BidPrice, counter.PaymentMethod, counter.PaymentTerm,
+		counter.DeliveryStart, counter.DeliveryEnd, actor.CompanyID, expiresAt.UTC())
+	if err != nil {
+		return dto.OfferResponseRound{}, n, fmt.Errorf("failed to update offer response: %w", err)
+	}
+
+	round, err := RecordOfferResponseRound(ctx, tx, responseID, dto.NegotiationCounter, actor, counter.Note)
+	if err != nil {
+		return round, n, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return round, n, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	n.Round, n.LastCompanyID, n.ExpiresAt = round.Round, actor.CompanyID, round.ExpiresAt
+	return round, n, nil
+}
+
+// GetOfferResponseRounds returns the negotiation history of the response,
+// oldest first
+func GetOfferResponseRounds(responseID int) ([]dto.OfferResponseRound, error) {
+	rounds := []dto.OfferResponseRound{}
+	err := pgxscan.Select(context.Background(), db.DB, &rounds,
+		`SELECT `+offerResponseRoundColumns+`
+		 FROM tbl_offer_response_round WHERE response_id = $1
+		 ORDER BY id`,
+		responseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get offer response rounds: %w", err)
+	}
+	return rounds, nil
+}
+
+// ExpireOfferResponseCounters declines the pending responses whose latest
+// terms expired before now and returns them
+func ExpireOfferResponseCounters(now time.Time) ([]OfferNegotiation, error) {
+	ctx := context.Background()
+
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var expired []OfferNegotiation
+	err = pgxscan.Select(ctx, tx, &expired,
+		`UPDATE tbl_offer_response
+		 SET state = 'declined', reason = 'terms expired', updated_at = CURRENT_TIMESTAMP
+		 WHERE id IN (
+			SELECT id FROM tbl_offer_response
+			WHERE state = 'pending' AND deleted = 0 AND expires_at <= $1
+			ORDER BY id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING id, COALESCE(offer_id, 0) AS offer_id, COALESCE(company_id, 0) AS company_id,
+		           to_company_id, last_company_id, state::text AS state, round, expires_at`,
+		now.UTC(), offerExpiryBatch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire offer responses: %w", err)
+	}
+
+	for _, n := range expired {
+		if _, err := RecordOfferResponseRound(ctx, tx, n.ID, dto.NegotiationExpire, dto.OfferActor{Role: "system"}, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return expired, nil
+}
@@ -0,0 +1,128 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"texApi/internal/dto"
+)
+
+var ErrOfferAlreadyAssigned = errors.New("offer already has an executor company")
+
+// AcceptedOfferResponse is the outcome of accepting a response
+type AcceptedOfferResponse struct {
+	ID          int
+	OfferID     int
+	CompanyID   int
+	BidPrice    *float64
+	DeclinedIDs []int // other pending responses to the offer
+}
+
+// LockResponseOffer locks the offer of the response for its acceptance and
+// fails when the offer already has an executor. Accepting locks the offer
+// before the response, so concurrent accepts on one offer run one by one.
+func LockResponseOffer(ctx context.Context, tx pgx.Tx, responseID int) (int, error) {
+	var offerID, executorID int
+	err := tx.QueryRow(ctx,
+		`SELECT o.id, o.exec_company_id
+		 FROM tbl_offer_response ofr
+		 JOIN tbl_offer o ON o.id = ofr.offer_id AND o.deleted = 0
+		 WHERE ofr.id = $1 AND ofr.deleted = 0
+		 FOR UPDATE OF o`,
+		responseID).Scan(&offerID, &executorID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrOfferResponseNotFound
+		}
+		return 0, fmt.Errorf("failed to lock offer of response: %w", err)
+	}
+	if executorID != 0 {
+		return offerID, ErrOfferAlreadyAssigned
+	}
+	return offerID, nil
+}
+
+// AcceptOfferResponseTx accepts the pending response inside the caller's
+// transaction. The responding company executes the offer with the terms of
+// the response, the other pending responses are declined and the offer
+// becomes assigned. The caller must have checked that the actor may accept,
+// the history records the actor, the bidder when it accepts a counter.
+func AcceptOfferResponseTx(ctx context.Context, tx pgx.Tx, responseID int, actor dto.OfferActor, reason string) (AcceptedOfferResponse, error) {
+	accepted := AcceptedOfferResponse{ID: responseID}
+	if _, err := LockResponseOffer(ctx, tx, responseID); err != nil {
+		return accepted, err
+	}
+
+	var paymentMethod, paymentTerm *string
+	var deliveryStart, deliveryEnd *time.Time
+	err := tx.QueryRow(ctx,
+		`UPDATE tbl_offer_response SET state = 'accepted', updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 AND deleted = 0 AND state = 'pending'
+		 RETURNING COALESCE(offer_id, 0), COALESCE(company_id, 0), bid_price,
+		           payment_method::text, payment_term, delivery_start, delivery_end`,
+		responseID,
+	).Scan(&accepted.OfferID, &accepted.CompanyID, &accepted.BidPrice,
+		&paymentMethod, &paymentTerm, &deliveryStart, &deliveryEnd)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return accepted, ErrNegotiationClosed
+		}
+		return accepted, fmt.Errorf("failed to accept offer response: %w", err)
+	}
+	if open, err := tenderOpen(ctx, tx, accepted.OfferID); err != nil {
+		return accepted, err
+	} else if open {
+		return accepted, ErrTenderOpen
+	}
+
+	err = pgxscan.Select(ctx, tx, &accepted.DeclinedIDs,
+		`UPDATE tbl_offer_response
+		 SET state = 'declined', updated_at = CURRENT_TIMESTAMP
+		 WHERE offer_id = $1 AND id != $2 AND state = 'pending'
+		 RETURNING id`,
+		accepted.OfferID, responseID)
+	if err != nil {
+		return accepted, fmt.Errorf("failed to decline other offer responses: %w", err)
+	}
+	for _, id := range accepted.DeclinedIDs {
+		if _, err := RecordOfferResponseRound(ctx, tx, id, dto.NegotiationDecline, actor, nil); err != nil {
+			return accepted, err
+		}
+	}
+
+	// the negotiated terms replace the ones of the offer, the price with its tax
+	_, err = tx.Exec(ctx,
+		`UPDATE tbl_offer
+		 SET exec_company_id = $1,
+		     offer_price = COALESCE($2::numeric, offer_price),
+		     total_price = CASE
+		         WHEN $2::numeric IS NULL THEN total_price
+		         WHEN tax > 0 THEN $2::numeric + ($2::numeric * tax / 100)
+		         ELSE $2::numeric
+		     END,
+		     payment_method = COALESCE($3::payment_method_t, payment_method),
+		     payment_term = COALESCE($4, payment_term),
+		     delivery_start = COALESCE($5::date, delivery_start),
+		     delivery_end = COALESCE($6::date, delivery_end),
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $7 AND deleted = 0`,
+		accepted.CompanyID, accepted.BidPrice, paymentMethod, paymentTerm, deliveryStart, deliveryEnd, accepted.OfferID)
+	if err != nil {
+		return accepted, fmt.Errorf("failed to update offer: %w", err)
+	}
+
+	// either side of the negotiation may accept, the caller has checked that
+	// the actor answers the latest terms, so the owner's part is not required
+	if _, err := transitionOfferTx(ctx, tx, accepted.OfferID, dto.OfferStateAssigned, actor, reason, false); err != nil {
+		return accepted, err
+	}
+
+	if _, err := RecordOfferResponseRound(ctx, tx, responseID, dto.NegotiationAccept, actor, nil); err != nil {
+		return accepted, err
+	}
+	return accepted, nil
+}
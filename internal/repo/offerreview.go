@@ -0,0 +1,318 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	db "texApi/database"
+	"texApi/internal/dto"
+)
+
+var ErrReviewNotFound = errors.New("review not found")
+var ErrReviewOfferState = errors.New("only completed offers can be reviewed")
+var ErrReviewForbidden = errors.New("only the parties of the offer can review it")
+var ErrReviewTarget = errors.New("you can not review this party of the offer")
+var ErrReviewDuplicate = errors.New("you already reviewed this party of the offer")
+
+const offerReviewSelect = `SELECT r.id, r.offer_id, r.reviewer_user_id, r.reviewer_company_id, r.reviewer_driver_id,
+	CASE WHEN r.reviewer_driver_id != 0 THEN TRIM(COALESCE(d.first_name, '') || ' ' || COALESCE(d.last_name, ''))
+	     ELSE COALESCE(c.company_name, '') END AS reviewer_name,
+	r.target_company_id, r.target_driver_id, r.rating, r.review, r.state::text AS state,
+	r.moderation_note, r.moderated_by, r.moderated_at, r.created_at, r.updated_at,
+	COUNT(*) OVER() AS total_count
+	FROM tbl_offer_review r
+	LEFT JOIN tbl_company c ON c.id = r.reviewer_company_id
+	LEFT JOIN tbl_driver d ON d.id = r.reviewer_driver_id`
+
+// CreateOfferReview rates a party of the completed offer. The owner reviews
+// the executor company or the driver of the offer, the executor and the
+// driver review the owner. Published reviews update the target's rating, the
+// owner's review of the executor is also kept on the accepted response.
+func CreateOfferReview(offerID int, input dto.OfferReviewInput, actor dto.OfferActor, state string) (dto.OfferReview, error) {
+	ctx := context.Background()
+
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return dto.OfferReview{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var offerState string
+	var ownerID, executorID, driverID int
+	err = tx.QueryRow(ctx,
+		`SELECT offer_state::text, COALESCE(company_id, 0), exec_company_id, driver_id
+		 FROM tbl_offer WHERE id = $1 AND deleted = 0`,
+		offerID).Scan(&offerState, &ownerID, &executorID, &driverID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return dto.OfferReview{}, ErrOfferNotFound
+		}
+		return dto.OfferReview{}, fmt.Errorf("failed to get offer: %w", err)
+	}
+	if offerState != dto.OfferStateCompleted {
+		return dto.OfferReview{}, ErrReviewOfferState
+	}
+
+	review := dto.OfferReview{
+		OfferID:           offerID,
+		ReviewerUserID:    actor.UserID,
+		ReviewerCompanyID: actor.CompanyID,
+		Rating:            input.Rating,
+		Review:            strings.TrimSpace(input.Review),
+	}
+	switch {
+	case actor.Role == "driver":
+		var userDriverID int
+		err = tx.QueryRow(ctx, `SELECT driver_id FROM tbl_user WHERE id = $1`, actor.UserID).Scan(&userDriverID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return dto.OfferReview{}, fmt.Errorf("failed to get driver of user: %w", err)
+		}
+		if userDriverID == 0 || userDriverID != driverID {
+			return dto.OfferReview{}, ErrReviewForbidden
+		}
+		if input.Target != dto.ReviewTargetCompany {
+			return dto.OfferReview{}, ErrReviewTarget
+		}
+		review.ReviewerDriverID = userDriverID
+		review.TargetCompanyID = ownerID
+	case actor.CompanyID != 0 && actor.CompanyID == ownerID:
+		if input.Target == dto.ReviewTargetDriver {
+			review.TargetDriverID = driverID
+		} else {
+			review.TargetCompanyID = executorID
+		}
+	case actor.CompanyID != 0 && actor.CompanyID == executorID:
+		if input.Target != dto.ReviewTargetCompany {
+			return dto.OfferReview{}, ErrReviewTarget
+		}
+		review.TargetCompanyID = ownerID
+	default:
+		return dto.OfferReview{}, ErrReviewForbidden
+	}
+	if review.TargetCompanyID == 0 && review.TargetDriverID == 0 ||
+		review.TargetCompanyID == actor.CompanyID && review.TargetDriverID == 0 {
+		return dto.OfferReview{}, ErrReviewTarget
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO tbl_offer_review (
+			offer_id, reviewer_user_id, reviewer_company_id, reviewer_driver_id,
+			target_company_id, target_driver_id, rating, review, state
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9::review_state_t)
+		ON CONFLICT (offer_id, reviewer_company_id, reviewer_driver_id, target_company_id, target_driver_id)
+		    WHERE deleted = 0 DO NOTHING
+		RETURNING id`,
+		review.OfferID, review.ReviewerUserID, review.ReviewerCompanyID, review.ReviewerDriverID,
+		review.TargetCompanyID, review.TargetDriverID, review.Rating, review.Review, state,
+	).Scan(&review.ID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return dto.OfferReview{}, ErrReviewDuplicate
+		}
+		return dto.OfferReview{}, fmt.Errorf("failed to create review: %w", err)
+	}
+
+	if state == dto.ReviewStatePublished {
+		if err := refreshReviewRating(ctx, tx, review.TargetCompanyID, review.TargetDriverID); err != nil {
+			return dto.OfferReview{}, err
+		}
+	}
+	if actor.CompanyID == ownerID && review.TargetCompanyID == executorID {
+		_, err = tx.Exec(ctx,
+			`UPDATE tbl_offer_response SET rating = $3, updated_at = CURRENT_TIMESTAMP
+			 WHERE offer_id = $1 AND company_id = $2 AND state = 'accepted' AND deleted = 0`,
+			offerID, executorID, review.Rating)
+		if err != nil {
+			return dto.OfferReview{}, fmt.Errorf("failed to rate offer response: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return dto.OfferReview{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return GetOfferReview(review.ID)
+}
+
+// refreshReviewRating sets the rating of the reviewed company or driver to the
+// rounded average of its published reviews, 0 without any
+func refreshReviewRating(ctx context.Context, tx pgx.Tx, companyID, driverID int) error {
+	var err error
+	if driverID != 0 {
+		_, err = tx.Exec(ctx,
+			`UPDATE tbl_driver SET rating = COALESCE((
+			     SELECT ROUND(AVG(rating))::int FROM tbl_offer_review
+			     WHERE target_driver_id = $1 AND state = 'published' AND deleted = 0
+			 ), 0), updated_at = CURRENT_TIMESTAMP
+			 WHERE id = $1`,
+			driverID)
+	} else {
+		_, err = tx.Exec(ctx,
+			`UPDATE tbl_company SET rating = COALESCE((
+			     SELECT ROUND(AVG(rating))::int FROM tbl_offer_review
+			     WHERE target_company_id = $1 AND target_driver_id = 0 AND state = 'published' AND deleted = 0
+			 ), 0), updated_at = CURRENT_TIMESTAMP
+			 WHERE id = $1`,
+			companyID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update rating: %w", err)
+	}
+	return nil
+}
+
+// countSuccessfulOps adds the completed offer to the successful_ops of its
+// owner, executor and driver
+func countSuccessfulOps(ctx context.Context, tx pgx.Tx, offerID int) error {
+	_, err := tx.Exec(ctx,
+		`UPDATE tbl_company SET successful_ops = successful_ops + 1
+		 WHERE id IN (SELECT company_id FROM tbl_offer WHERE id = $1
+		              UNION SELECT exec_company_id FROM tbl_offer WHERE id = $1)`,
+		offerID)
+	if err != nil {
+		return fmt.Errorf("failed to count company operations: %w", err)
+	}
+	_, err = tx.Exec(ctx,
+		`UPDATE tbl_driver SET successful_ops = successful_ops + 1
+		 WHERE id = (SELECT driver_id FROM tbl_offer WHERE id = $1)`,
+		offerID)
+	if err != nil {
+		return fmt.Errorf("failed to count driver operations: %w", err)
+	}
+	return nil
+}
+
+// GetDriverCompanyID returns the company the driver works for
+func GetDriverCompanyID(driverID int) (int, error) {
+	var companyID int
+	err := db.DB.QueryRow(context.Background(),
+		`SELECT company_id FROM tbl_driver WHERE id = $1 AND deleted = 0`, driverID).Scan(&companyID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get company of driver: %w", err)
+	}
+	return companyID, nil
+}
+
+func GetOfferReview(id int) (dto.OfferReview, error) {
+	var review dto.OfferReview
+	err := pgxscan.Get(context.Background(), db.DB, &review,
+		offerReviewSelect+` WHERE r.id = $1 AND r.deleted = 0`, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return review, ErrReviewNotFound
+		}
+		return review, fmt.Errorf("failed to get review: %w", err)
+	}
+	return review, nil
+}
+
+// ListOfferReviews returns a page of reviews, newest first, and their total
+func ListOfferReviews(params dto.OfferReviewListParams) ([]dto.OfferReview, int, error) {
+	conditions := []string{"r.deleted = 0"}
+	args := []interface{}{}
+	if params.OfferID != 0 {
+		args = append(args, params.OfferID)
+		conditions = append(conditions, fmt.Sprintf("r.offer_id = $%d", len(args)))
+	}
+	if params.TargetCompanyID != 0 {
+		args = append(args, params.TargetCompanyID)
+		conditions = append(conditions, fmt.Sprintf("r.target_company_id = $%d AND r.target_driver_id = 0", len(args)))
+	}
+	if params.TargetDriverID != 0 {
+		args = append(args, params.TargetDriverID)
+		conditions = append(conditions, fmt.Sprintf("r.target_driver_id = $%d", len(args)))
+	}
+	if len(params.States) > 0 {
+		args = append(args, params.States)
+		conditions = append(conditions, fmt.Sprintf("r.state::text = ANY($%d)", len(args)))
+	}
+
+	query := offerReviewSelect + " WHERE " + strings.Join(conditions, " AND ") +
+		fmt.Sprintf(" ORDER BY r.created_at DESC, r.id DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, params.PerPage, (params.Page-1)*params.PerPage)
+
+	var reviews []dto.OfferReview
+	if err := pgxscan.Select(context.Background(), db.DB, &reviews, query, args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to get reviews: %w", err)
+	}
+
+	total := 0
+	if len(reviews) > 0 {
+		total = reviews[0].TotalCount
+	}
+	return reviews, total, nil
+}
+
+// ModerateOfferReview sets the state of the review and updates the rating of
+// its target, only published reviews count
+func ModerateOfferReview(id int, input dto.OfferReviewModeration, actor dto.OfferActor) (dto.OfferReview, error) {
+	ctx := context.Background()
+
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return dto.OfferReview{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var companyID, driverID int
+	err = tx.QueryRow(ctx,
+		`UPDATE tbl_offer_review
+		 SET state = $2::review_state_t, moderation_note = $3, moderated_by = $4,
+		     moderated_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 AND deleted = 0
+		 RETURNING target_company_id, target_driver_id`,
+		id, input.State, strings.TrimSpace(input.Note), actor.UserID,
+	).Scan(&companyID, &driverID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return dto.OfferReview{}, ErrReviewNotFound
+		}
+		return dto.OfferReview{}, fmt.Errorf("failed to moderate review: %w", err)
+	}
+	if err := refreshReviewRating(ctx, tx, companyID, driverID); err != nil {
+		return dto.OfferReview{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return dto.OfferReview{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return GetOfferReview(id)
+}
+
+// DeleteOfferReview removes the review and updates the rating of its target
+func DeleteOfferReview(id int, actor dto.OfferActor) error {
+	ctx := context.Background()
+
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var companyID, driverID int
+	err = tx.QueryRow(ctx,
+		`UPDATE tbl_offer_review
+		 SET deleted = 1, moderated_by = $2, moderated_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 AND deleted = 0
+		 RETURNING target_company_id, target_driver_id`,
+		id, actor.UserID,
+	).Scan(&companyID, &driverID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrReviewNotFound
+		}
+		return fmt.Errorf("failed to delete review: %w", err)
+	}
+	if err := refreshReviewRating(ctx, tx, companyID, driverID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
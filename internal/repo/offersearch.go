@@ -0,0 +1,141 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	db "texApi/database"
+	"texApi/internal/dto"
+	"texApi/pkg/sqlsafety"
+)
+
+// OfferSearchSort is the sort whitelist of SearchOffers
+var OfferSearchSort = sqlsafety.NewSQLSafetyChecker([]string{
+	"relevance", "id", "created_at", "offer_price", "total_price", "validity_end",
+	"delivery_start", "view_count", "pickup_distance_km", "dropoff_distance_km",
+})
+
+// offerPointsSQL lists the points of the offer's pickup or dropoff side: stop
+// locations and geofence centers
+func offerPointsSQL(offer, kind string) string {
+	return fmt.Sprintf(`SELECT s.location AS pt FROM tbl_offer_stop s
+		 WHERE s.offer_id = %[1]s.id AND s.kind = '%[2]s' AND s.location IS NOT NULL
+		 UNION ALL
+		 SELECT COALESCE(g.center, ST_Centroid(g.area)) FROM tbl_geofence g
+		 WHERE g.offer_id = %[1]s.id AND g.kind = '%[2]s' AND g.deleted = 0`, offer, kind)
+}
+
+type offerSearchBuilder struct {
+	where  []string
+	args   []interface{}
+	fields []string
+}
+
+func (b *offerSearchBuilder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// radius adds the distance column of the side and keeps the offers with a
+// point within the radius
+func (b *offerSearchBuilder) radius(kind string, lat, lng *float64, radiusKM float64) {
+	column := kind + "_distance_km"
+	if lat == nil || lng == nil {
+		b.fields = append(b.fields, "NULL::float8 AS "+column)
+		return
+	}
+
+	point := fmt.Sprintf("ST_SetSRID(ST_MakePoint(%s, %s), 4326)::geography", b.arg(*lng), b.arg(*lat))
+	b.fields = append(b.fields, fmt.Sprintf(
+		"(SELECT MIN(ST_Distance(p.pt::geography, %s)) / 1000 FROM (%s) p) AS %s",
+		point, offerPointsSQL("o", kind), column))
+	if radiusKM > 0 {
+		b.where = append(b.where, fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM (%s) p WHERE ST_DWithin(p.pt::geography, %s, %s))",
+			offerPointsSQL("o", kind), point, b.arg(radiusKM*1000)))
+	}
+}
+
+// SearchOffers runs a full-text and radius search over the offers. Only
+// active offers are searched unless admin is set. Sorting must be checked
+// against OfferSearchSort.
+func SearchOffers(query dto.OfferSearchQuery, admin bool) ([]dto.OfferSearchResult, int, error) {
+	b := &offerSearchBuilder{}
+	b.where = append(b.where, "o.deleted = 0",
+		"o.validity_end > CURRENT_TIMESTAMP", "o.delivery_end > CURRENT_TIMESTAMP")
+	if !admin {
+		b.where = append(b.where, "o.offer_state = 'active'")
+	}
+
+	// the filters of saved searches, read through their JSON form
+	var filters map[string]interface{}
+	raw, err := json.Marshal(query.OfferSearchFilters)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to encode filters: %w", err)
+	}
+	if err := json.Unmarshal(raw, &filters); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode filters: %w", err)
+	}
+	for _, key := range savedSearchIntFilters {
+		if value, ok := filters[key].(float64); ok {
+			b.where = append(b.where, fmt.Sprintf("o.%s = %s", key, b.arg(int(value))))
+		}
+	}
+	for _, key := range savedSearchTextFilters {
+		if value, ok := filters[key]; ok {
+			b.where = append(b.where, fmt.Sprintf("o.%s::text = %s", key, b.arg(value)))
+		}
+	}
+	for _, filter := range savedSearchDateFilters {
+		if value, ok := filters[filter[0]]; ok {
+			b.where = append(b.where, fmt.Sprintf("o.%s %s %s::timestamptz", filter[0], filter[1], b.arg(value)))
+		}
+	}
+	for _, filter := range OfferCargoFilters {
+		if value, ok := filters[filter[0]].(float64); ok {
+			b.where = append(b.where, OfferCargoCondition(filter[1], b.arg(value)))
+		}
+	}
+
+	if q := strings.TrimSpace(query.Q); q != "" {
+		term := fmt.Sprintf("f_unaccent(LOWER(%s))", b.arg(q))
+		tsQuery := fmt.Sprintf("plainto_tsquery('simple', %s)", term)
+		b.where = append(b.where, fmt.Sprintf(
+			"(fs.search_vector @@ %s OR %s <%% fs.search_text)", tsQuery, term))
+		b.fields = append(b.fields, fmt.Sprintf(
+			"(ts_rank_cd(fs.search_vector, %s) + word_similarity(%s, fs.search_text))::float8 AS relevance",
+			tsQuery, term))
+	} else {
+		b.fields = append(b.fields, "0::float8 AS relevance")
+	}
+
+	b.radius(dto.OfferStopPickup, query.PickupLat, query.PickupLng, query.PickupRadiusKM)
+	b.radius(dto.OfferStopDropoff, query.DropoffLat, query.DropoffLng, query.DropoffRadiusKM)
+
+	stmt := fmt.Sprintf(`SELECT r.*, COUNT(*) OVER() AS total_count
+		FROM (
+			SELECT o.*, %s
+			FROM tbl_offer o
+			LEFT JOIN tbl_offer_search fs ON fs.offer_id = o.id
+			WHERE %s
+		) r
+		ORDER BY r.%s %s NULLS LAST, r.id DESC
+		LIMIT %s OFFSET %s`,
+		strings.Join(b.fields, ", "), strings.Join(b.where, " AND "),
+		query.OrderBy, strings.ToUpper(query.OrderDir),
+		b.arg(query.PerPage), b.arg((query.Page-1)*query.PerPage))
+
+	var results []dto.OfferSearchResult
+	if err := pgxscan.Select(context.Background(), db.DB, &results, stmt, b.args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to search offers: %w", err)
+	}
+
+	total := 0
+	if len(results) > 0 {
+		total = results[0].TotalCount
+	}
+	return results, total, nil
+}
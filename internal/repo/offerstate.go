@@ -0,0 +1,220 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	db "texApi/database"
+	"texApi/internal/dto"
+)
+
+var ErrOfferNotFound = errors.New("offer not found")
+var ErrOfferStateTransition = errors.New("offer state transition is not allowed")
+var ErrOfferStateForbidden = errors.New("you are not allowed to make this state change")
+
+const (
+	offerPartyOwner    = "owner"    // tbl_offer.company_id
+	offerPartyExecutor = "executor" // tbl_offer.exec_company_id
+)
+
+// offerTransitions lists the allowed state changes and the parties that may
+// make them. Admins may make every allowed change, an empty list means admins only.
+var offerTransitions = map[string]map[string][]string{
+	dto.OfferStateDraft: {
+		dto.OfferStatePending:   {offerPartyOwner},
+		dto.OfferStateCancelled: {offerPartyOwner},
+	},
+	dto.OfferStatePending: {
+		dto.OfferStateDraft:     {offerPartyOwner},
+		dto.OfferStateActive:    {}, // moderation
+		dto.OfferStateCancelled: {offerPartyOwner},
+		dto.OfferStateArchived:  {}, // expiry job
+	},
+	dto.OfferStateActive: {
+		dto.OfferStateAssigned:  {offerPartyOwner},
+		dto.OfferStateCancelled: {offerPartyOwner},
+		dto.OfferStateArchived:  {}, // expiry job
+	},
+	dto.OfferStateArchived: {
+		dto.OfferStateDraft: {offerPartyOwner}, // renewed with new dates
+	},
+	dto.OfferStateAssigned: {
+		dto.OfferStateActive:    {offerPartyOwner}, // executor released
+		dto.OfferStateInTransit: {offerPartyOwner, offerPartyExecutor},
+		dto.OfferStateCancelled: {offerPartyOwner, offerPartyExecutor},
+	},
+	dto.OfferStateInTransit: {
+		dto.OfferStateDelivered: {offerPartyExecutor},
+		dto.OfferStateCancelled: {},
+	},
+	dto.OfferStateDelivered: {
+		dto.OfferStateCompleted: {offerPartyOwner},
+		dto.OfferStateInTransit: {offerPartyOwner}, // delivery disputed
+	},
+}
+
+// OfferStateTransitions returns the states the offer may move to from the state
+func OfferStateTransitions(from string) []string {
+	states := make([]string, 0, len(offerTransitions[from]))
+	for to := range offerTransitions[from] {
+		states = append(states, to)
+	}
+	sort.Strings(states)
+	return states
+}
+
+func offerPartyAllowed(parties []string, companyID, ownerID, executorID int) bool {
+	if companyID == 0 {
+		return false
+	}
+	for _, party := range parties {
+		if party == offerPartyOwner && companyID == ownerID {
+			return true
+		}
+		if party == offerPartyExecutor && companyID == executorID {
+			return true
+		}
+	}
+	return false
+}
+
+type offerStateQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func insertOfferStateChange(ctx context.Context, q offerStateQuerier, change *dto.OfferStateChange) error {
+	err := q.QueryRow(ctx,
+		`INSERT INTO tbl_offer_state_history
+		    (offer_id, from_state, to_state, actor_user_id, actor_company_id, actor_role, reason)
+		 VALUES ($1, $2::offer_state_t, $3::offer_state_t, $4, $5, $6, $7)
+		 RETURNING id, created_at`,
+		change.OfferID, change.FromState, change.ToState, change.ActorUserID,
+		change.ActorCompanyID, change.ActorRole, change.Reason,
+	).Scan(&change.ID, &change.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record offer state change: %w", err)
+	}
+	return nil
+}
+
+// RecordOfferCreatedTx stores the initial state of a new offer in the history
+// inside the transaction that creates the offer
+func RecordOfferCreatedTx(ctx context.Context, tx pgx.Tx, offerID int, state string, actor dto.OfferActor) error {
+	return insertOfferStateChange(ctx, tx, &dto.OfferStateChange{
+		OfferID:        offerID,
+		ToState:        state,
+		ActorUserID:    actor.UserID,
+		ActorCompanyID: actor.CompanyID,
+		ActorRole:      actor.Role,
+		Reason:         "created",
+	})
+}
+
+// TransitionOffer moves the offer to the state if the lifecycle and the
+// actor's part in the offer allow it
+func TransitionOffer(offerID int, to string, actor dto.OfferActor, reason string) (dto.OfferStateChange, error) {
+	ctx := context.Background()
+
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return dto.OfferStateChange{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	change, err := TransitionOfferTx(ctx, tx, offerID, to, actor, reason)
+	if err != nil {
+		return change, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return change, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return change, nil
+}
+
+// TransitionOfferTx is TransitionOffer inside the caller's transaction, the
+// offer row stays locked until it ends
+func TransitionOfferTx(ctx context.Context, tx pgx.Tx, offerID int, to string, actor dto.OfferActor, reason string) (dto.OfferStateChange, error) {
+	return transitionOfferTx(ctx, tx, offerID, to, actor, reason, true)
+}
+
+// transitionOfferTx checks the actor's part in the offer when checkParty is
+// set. Without it the caller has authorized the actor already, the lifecycle
+// still applies and the actor is recorded in the history.
+func transitionOfferTx(ctx context.Context, tx pgx.Tx, offerID int, to string, actor dto.OfferActor, reason string, checkParty bool) (dto.OfferStateChange, error) {
+	var from string
+	var ownerID, executorID int
+	err := tx.QueryRow(ctx,
+		`SELECT offer_state::text, COALESCE(company_id, 0), exec_company_id
+		 FROM tbl_offer WHERE id = $1 AND deleted = 0
+		 FOR UPDATE`,
+		offerID).Scan(&from, &ownerID, &executorID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return dto.OfferStateChange{}, ErrOfferNotFound
+		}
+		return dto.OfferStateChange{}, fmt.Errorf("failed to get offer state: %w", err)
+	}
+
+	parties, ok := offerTransitions[from][to]
+	if !ok {
+		return dto.OfferStateChange{}, fmt.Errorf("%w: %s -> %s", ErrOfferStateTransition, from, to)
+	}
+	if checkParty && !actor.IsAdmin() && !offerPartyAllowed(parties, actor.CompanyID, ownerID, executorID) {
+		return dto.OfferStateChange{}, fmt.Errorf("%w: %s -> %s", ErrOfferStateForbidden, from, to)
+	}
+	if to == dto.OfferStateAssigned && executorID == 0 {
+		return dto.OfferStateChange{}, fmt.Errorf("%w: offer has no executor company", ErrOfferStateTransition)
+	}
+
+	releaseExecutor := from == dto.OfferStateAssigned && to == dto.OfferStateActive
+	_, err = tx.Exec(ctx,
+		`UPDATE tbl_offer
+		 SET offer_state = $2::offer_state_t,
+		     exec_company_id = CASE WHEN $3 THEN 0 ELSE exec_company_id END,
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1`,
+		offerID, to, releaseExecutor)
+	if err != nil {
+		return dto.OfferStateChange{}, fmt.Errorf("failed to update offer state: %w", err)
+	}
+	if to == dto.OfferStateCompleted {
+		if err := countSuccessfulOps(ctx, tx, offerID); err != nil {
+			return dto.OfferStateChange{}, err
+		}
+	}
+
+	change := dto.OfferStateChange{
+		OfferID:        offerID,
+		FromState:      &from,
+		ToState:        to,
+		ActorUserID:    actor.UserID,
+		ActorCompanyID: actor.CompanyID,
+		ActorRole:      actor.Role,
+		Reason:         reason,
+	}
+	if err := insertOfferStateChange(ctx, tx, &change); err != nil {
+		return dto.OfferStateChange{}, err
+	}
+
+	return change, nil
+}
+
+func GetOfferStateHistory(offerID int) ([]dto.OfferStateChange, error) {
+	history := []dto.OfferStateChange{}
+	err := pgxscan.Select(context.Background(), db.DB, &history,
+		`SELECT id, offer_id, from_state::text AS from_state, to_state::text AS to_state,
+		        actor_user_id, actor_company_id, actor_role, reason, created_at
+		 FROM tbl_offer_state_history
+		 WHERE offer_id = $1
+		 ORDER BY created_at, id`,
+		offerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get offer state history: %w", err)
+	}
+	return history, nil
+}
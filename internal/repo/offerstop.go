@@ -0,0 +1,300 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	db "texApi/database"
+	"texApi/internal/dto"
+)
+
+var ErrOfferStops = errors.New("invalid offer stops")
+
+type OfferStopScan struct {
+	ID              int        `db:"id"`
+	OfferID         int        `db:"offer_id"`
+	Seq             int        `db:"seq"`
+	Kind            string     `db:"kind"`
+	Country         string     `db:"country"`
+	CountryID       int        `db:"country_id"`
+	Region          string     `db:"region"`
+	CityID          int        `db:"city_id"`
+	Address         string     `db:"address"`
+	LocationTxt     *string    `db:"location_txt"` // ST_AsText result
+	WindowStart     *time.Time `db:"window_start"`
+	WindowEnd       *time.Time `db:"window_end"`
+	ContactName     string     `db:"contact_name"`
+	ContactPhone    string     `db:"contact_phone"`
+	CargoID         int        `db:"cargo_id"`
+	CargoQty        int        `db:"cargo_qty"`
+	CargoWeight     float64    `db:"cargo_weight"`
+	CargoWeightType string     `db:"cargo_weight_type"`
+	Note            string     `db:"note"`
+	CreatedAt       time.Time  `db:"created_at"`
+}
+
+func (ss *OfferStopScan) ToOfferStop() dto.OfferStop {
+	return dto.OfferStop{
+		ID:              ss.ID,
+		OfferID:         ss.OfferID,
+		Seq:             ss.Seq,
+		Kind:            ss.Kind,
+		Country:         ss.Country,
+		CountryID:       ss.CountryID,
+		Region:          ss.Region,
+		CityID:          ss.CityID,
+		Address:         ss.Address,
+		Location:        scanPointTxt(ss.LocationTxt),
+		WindowStart:     ss.WindowStart,
+		WindowEnd:       ss.WindowEnd,
+		ContactName:     ss.ContactName,
+		ContactPhone:    ss.ContactPhone,
+		CargoID:         ss.CargoID,
+		CargoQty:        ss.CargoQty,
+		CargoWeight:     ss.CargoWeight,
+		CargoWeightType: ss.CargoWeightType,
+		Note:            ss.Note,
+		CreatedAt:       ss.CreatedAt,
+	}
+}
+
+type TripWaypointScan struct {
+	ID          int64      `db:"id"`
+	TripID      int64      `db:"trip_id"`
+	OfferID     int        `db:"offer_id"`
+	OfferStopID *int       `db:"offer_stop_id"`
+	Seq         int        `db:"seq"`
+	Kind        string     `db:"kind"`
+	Address     string     `db:"address"`
+	LocationTxt *string    `db:"location_txt"`
+	WindowStart *time.Time `db:"window_start"`
+	WindowEnd   *time.Time `db:"window_end"`
+	CreatedAt   time.Time  `db:"created_at"`
+}
+
+func (ws *TripWaypointScan) ToTripWaypoint() dto.TripWaypoint {
+	return dto.TripWaypoint{
+		ID:          ws.ID,
+		TripID:      ws.TripID,
+		OfferID:     ws.OfferID,
+		OfferStopID: ws.OfferStopID,
+		Seq:         ws.Seq,
+		Kind:        ws.Kind,
+		Address:     ws.Address,
+		Location:    scanPointTxt(ws.LocationTxt),
+		WindowStart: ws.WindowStart,
+		WindowEnd:   ws.WindowEnd,
+		CreatedAt:   ws.CreatedAt,
+	}
+}
+
+func scanPointTxt(txt *string) *dto.Point {
+	if txt == nil || *txt == "" {
+		return nil
+	}
+	var point dto.Point
+	if err := point.Scan(*txt); err != nil {
+		return nil
+	}
+	return &point
+}
+
+// ValidateOfferStops checks that a stop list starts with a pickup, ends with a
+// dropoff and has consistent time windows. An empty list removes the stops.
+func ValidateOfferStops(stops []dto.OfferStop) error {
+	if len(stops) == 0 {
+		return nil
+	}
+	if len(stops) < 2 {
+		return fmt.Errorf("%w: at least one pickup and one dropoff are required", ErrOfferStops)
+	}
+	if len(stops) > dto.MaxOfferStops {
+		return fmt.Errorf("%w: at most %d stops are allowed", ErrOfferStops, dto.MaxOfferStops)
+	}
+	if stops[0].Kind != dto.OfferStopPickup {
+		return fmt.Errorf("%w: the first stop must be a pickup", ErrOfferStops)
+	}
+	if stops[len(stops)-1].Kind != dto.OfferStopDropoff {
+		return fmt.Errorf("%w: the last stop must be a dropoff", ErrOfferStops)
+	}
+	for i, stop := range stops {
+		if stop.WindowStart != nil && stop.WindowEnd != nil && stop.WindowEnd.Before(*stop.WindowStart) {
+			return fmt.Errorf("%w: stop %d ends before it starts", ErrOfferStops, i+1)
+		}
+	}
+	return nil
+}
+
+// ReplaceOfferStopsTx stores the stops of the offer in the given order and
+// drops the previous ones. Waypoints of started trips keep their copy.
+func ReplaceOfferStopsTx(ctx context.Context, tx pgx.Tx, offerID int, stops []dto.OfferStop) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM tbl_offer_stop WHERE offer_id = $1`, offerID); err != nil {
+		return fmt.Errorf("failed to remove offer stops: %w", err)
+	}
+
+	for i, stop := range stops {
+		weightType := stop.CargoWeightType
+		if weightType == "" {
+			weightType = "kg"
+		}
+		var location interface{}
+		if stop.Location != nil {
+			location = *stop.Location
+		}
+
+		_, err := tx.Exec(ctx,
+			`INSERT INTO tbl_offer_stop (
+				offer_id, seq, kind, country, country_id, region, city_id, address, location,
+				window_start, window_end, contact_name, contact_phone,
+				cargo_id, cargo_qty, cargo_weight, cargo_weight_type, note
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, ST_GeomFromText($9, 4326),
+				$10, $11, $12, $13, $14, $15, $16, $17, $18)`,
+			offerID, i+1, stop.Kind, stop.Country, stop.CountryID, stop.Region, stop.CityID, stop.Address, location,
+			stop.WindowStart, stop.WindowEnd, stop.ContactName, stop.ContactPhone,
+			stop.CargoID, stop.CargoQty, stop.CargoWeight, weightType, stop.Note)
+		if err != nil {
+			return fmt.Errorf("failed to create offer stop %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+const offerStopColumns = `id, offer_id, seq, kind::text AS kind, country, country_id, region, city_id, address,
+	ST_AsText(location) AS location_txt, window_start, window_end, contact_name, contact_phone,
+	cargo_id, cargo_qty, cargo_weight::float8 AS cargo_weight, cargo_weight_type::text AS cargo_weight_type,
+	note, created_at`
+
+// GetOfferStops returns the ordered stops of the offers by offer ID
+func GetOfferStops(offerIDs []int) (map[int][]dto.OfferStop, error) {
+	stops := make(map[int][]dto.OfferStop)
+	if len(offerIDs) == 0 {
+		return stops, nil
+	}
+
+	var scans []OfferStopScan
+	err := pgxscan.Select(context.Background(), db.DB, &scans,
+		`SELECT `+offerStopColumns+`
+		 FROM tbl_offer_stop
+		 WHERE offer_id = ANY($1)
+		 ORDER BY offer_id, seq`,
+		offerIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get offer stops: %w", err)
+	}
+
+	for _, scan := range scans {
+		stops[scan.OfferID] = append(stops[scan.OfferID], scan.ToOfferStop())
+	}
+	return stops, nil
+}
+
+// createTripWaypoints copies the stops of the trip offers, in the order of the
+// offers, to the trip. Offers without stops add their from/to pair, the main
+// offer with the trip locations.
+func createTripWaypoints(ctx context.Context, tx pgx.Tx, tripID int64, input dto.StartTripInput) ([]dto.TripWaypoint, error) {
+	var waypoints []dto.TripWaypoint
+
+	for _, offer := range input.Offers {
+		var scans []OfferStopScan
+		err := pgxscan.Select(ctx, tx, &scans,
+			`SELECT `+offerStopColumns+`
+			 FROM tbl_offer_stop
+			 WHERE offer_id = $1
+			 ORDER BY seq`,
+			offer.OfferID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get offer stops: %w", err)
+		}
+
+		if len(scans) == 0 {
+			var from, to string
+			err := tx.QueryRow(ctx,
+				`SELECT CONCAT_WS(', ', NULLIF(from_address, ''), NULLIF(from_region, ''), NULLIF(from_country, '')),
+				        CONCAT_WS(', ', NULLIF(to_address, ''), NULLIF(to_region, ''), NULLIF(to_country, ''))
+				 FROM tbl_offer WHERE id = $1`,
+				offer.OfferID).Scan(&from, &to)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get offer route: %w", err)
+			}
+
+			pickup := dto.TripWaypoint{OfferID: offer.OfferID, Kind: dto.OfferStopPickup, Address: from}
+			dropoff := dto.TripWaypoint{OfferID: offer.OfferID, Kind: dto.OfferStopDropoff, Address: to}
+			if offer.OfferID == input.Offers[0].OfferID {
+				pickup.Location, dropoff.Location = input.FromLocation, input.ToLocation
+			}
+			waypoints = append(waypoints, pickup, dropoff)
+			continue
+		}
+
+		for _, scan := range scans {
+			stop := scan.ToOfferStop()
+			stopID := stop.ID
+			address := stop.Address
+			for _, part := range []string{stop.Region, stop.Country} {
+				if part != "" {
+					if address != "" {
+						address += ", "
+					}
+					address += part
+				}
+			}
+			waypoints = append(waypoints, dto.TripWaypoint{
+				OfferID:     offer.OfferID,
+				OfferStopID: &stopID,
+				Kind:        stop.Kind,
+				Address:     address,
+				Location:    stop.Location,
+				WindowStart: stop.WindowStart,
+				WindowEnd:   stop.WindowEnd,
+			})
+		}
+	}
+
+	for i := range waypoints {
+		waypoints[i].TripID = tripID
+		waypoints[i].Seq = i + 1
+
+		var location interface{}
+		if waypoints[i].Location != nil {
+			location = *waypoints[i].Location
+		}
+		err := tx.QueryRow(ctx,
+			`INSERT INTO tbl_trip_waypoint (
+				trip_id, offer_id, offer_stop_id, seq, kind, address, location, window_start, window_end
+			) VALUES ($1, $2, $3, $4, $5, $6, ST_GeomFromText($7, 4326), $8, $9)
+			RETURNING id, created_at`,
+			tripID, waypoints[i].OfferID, waypoints[i].OfferStopID, waypoints[i].Seq, waypoints[i].Kind,
+			waypoints[i].Address, location, waypoints[i].WindowStart, waypoints[i].WindowEnd,
+		).Scan(&waypoints[i].ID, &waypoints[i].CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create trip waypoint: %w", err)
+		}
+	}
+
+	return waypoints, nil
+}
+
+func GetTripWaypoints(tripID int64) ([]dto.TripWaypoint, error) {
+	var scans []TripWaypointScan
+	err := pgxscan.Select(context.Background(), db.DB, &scans,
+		`SELECT id, trip_id, offer_id, offer_stop_id, seq, kind::text AS kind, address,
+		        ST_AsText(location) AS location_txt, window_start, window_end, created_at
+		 FROM tbl_trip_waypoint
+		 WHERE trip_id = $1
+		 ORDER BY seq`,
+		tripID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trip waypoints: %w", err)
+	}
+
+	waypoints := make([]dto.TripWaypoint, len(scans))
+	for i, scan := range scans {
+		waypoints[i] = scan.ToTripWaypoint()
+	}
+	return waypoints, nil
+}
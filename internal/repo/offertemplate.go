@@ -0,0 +1,424 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	db "texApi/database"
+	"texApi/internal/dto"
+	"texApi/pkg/recurrence"
+)
+
+var ErrOfferTemplateNotFound = errors.New("offer template not found")
+
+// offer columns copied from the template snapshot to new offers, the dates are
+// shifted and the state is set by the template
+var offerTemplateColumns = []string{
+	"user_id", "company_id", "driver_id", "vehicle_id", "trailer_id", "vehicle_type_id", "cargo_id",
+	"packaging_type_id", "offer_role", "cost_per_km", "currency", "from_country_id", "from_city_id",
+	"to_country_id", "to_city_id", "distance", "from_country", "from_region", "to_country", "to_region",
+	"from_address", "to_address", "map_url", "sender_contact", "recipient_contact", "deliver_contact",
+	"note", "tax", "tax_price", "trade", "discount", "payment_method", "payment_term",
+	"meta", "meta2", "meta3", "offer_price", "total_price",
+}
+
+var offerTemplateDates = []string{"validity_start", "validity_end", "delivery_start", "delivery_end"}
+
+const offerTemplateSelect = `SELECT t.id, t.uuid::text AS uuid, t.user_id, t.company_id, t.source_offer_id, t.name,
+	t.offer, t.stops, t.anchor_date, t.offer_state::text AS offer_state, t.recurrence::text AS recurrence,
+	t.weekdays, t.month_day, t.cron, t.starts_on, t.ends_on, t.lead_days, t.last_occurrence,
+	t.created_at, t.updated_at, t.active
+	FROM tbl_offer_template t`
+
+type OfferTemplateScan struct {
+	ID             int        `db:"id"`
+	UUID           string     `db:"uuid"`
+	UserID         int        `db:"user_id"`
+	CompanyID      int        `db:"company_id"`
+	SourceOfferID  int        `db:"source_offer_id"`
+	Name           string     `db:"name"`
+	Offer          []byte     `db:"offer"`
+	Stops          []byte     `db:"stops"`
+	AnchorDate     time.Time  `db:"anchor_date"`
+	OfferState     string     `db:"offer_state"`
+	Recurrence     string     `db:"recurrence"`
+	Weekdays       []int32    `db:"weekdays"`
+	MonthDay       int        `db:"month_day"`
+	Cron           string     `db:"cron"`
+	StartsOn       *time.Time `db:"starts_on"`
+	EndsOn         *time.Time `db:"ends_on"`
+	LeadDays       int        `db:"lead_days"`
+	LastOccurrence *time.Time `db:"last_occurrence"`
+	CreatedAt      time.Time  `db:"created_at"`
+	UpdatedAt      time.Time  `db:"updated_at"`
+	Active         int        `db:"active"`
+}
+
+func (ts *OfferTemplateScan) ToOfferTemplate() dto.OfferTemplate {
+	offer := json.RawMessage(ts.Offer)
+	template := dto.OfferTemplate{
+		ID:             ts.ID,
+		UUID:           ts.UUID,
+		UserID:         ts.UserID,
+		CompanyID:      ts.CompanyID,
+		SourceOfferID:  ts.SourceOfferID,
+		Name:           ts.Name,
+		Offer:          &offer,
+		AnchorDate:     ts.AnchorDate,
+		OfferState:     ts.OfferState,
+		Recurrence:     ts.Recurrence,
+		Weekdays:       ts.weekdays(),
+		MonthDay:       ts.MonthDay,
+		Cron:           ts.Cron,
+		StartsOn:       ts.StartsOn,
+		EndsOn:         ts.EndsOn,
+		LeadDays:       ts.LeadDays,
+		LastOccurrence: ts.LastOccurrence,
+		CreatedAt:      ts.CreatedAt,
+		UpdatedAt:      ts.UpdatedAt,
+		Active:         ts.Active,
+	}
+	_ = json.Unmarshal(ts.Stops, &template.Stops)
+
+	if next := ts.Upcoming(time.Now(), 366); len(next) > 0 {
+		template.NextOccurrence = &next[0]
+	}
+	return template
+}
+
+func (ts *OfferTemplateScan) weekdays() []int {
+	days := make([]int, len(ts.Weekdays))
+	for i, day := range ts.Weekdays {
+		days[i] = int(day)
+	}
+	return days
+}
+
+func (ts *OfferTemplateScan) Rule() recurrence.Rule {
+	return recurrence.Rule{
+		Kind:     ts.Recurrence,
+		Weekdays: ts.weekdays(),
+		MonthDay: ts.MonthDay,
+		Cron:     ts.Cron,
+	}
+}
+
+// Upcoming returns the occurrences from today on, for the next days days,
+// within starts_on and ends_on and after the last created one
+func (ts *OfferTemplateScan) Upcoming(now time.Time, days int) []time.Time {
+	if ts.Active != 1 || ts.Recurrence == recurrence.None {
+		return nil
+	}
+
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, days)
+	if ts.StartsOn != nil && ts.StartsOn.After(from) {
+		from = *ts.StartsOn
+	}
+	if ts.LastOccurrence != nil && !ts.LastOccurrence.Before(from) {
+		from = ts.LastOccurrence.AddDate(0, 0, 1)
+	}
+	if ts.EndsOn != nil && ts.EndsOn.Before(to) {
+		to = *ts.EndsOn
+	}
+	if from.After(to) {
+		return nil
+	}
+
+	occurrences, err := ts.Rule().Between(from, to)
+	if err != nil {
+		return nil
+	}
+	return occurrences
+}
+
+func offerTemplateScope(scopeCompanyID *int, argIndex int) (string, []interface{}) {
+	if scopeCompanyID == nil {
+		return "", nil
+	}
+	return fmt.Sprintf(" AND t.company_id = $%d", argIndex), []interface{}{*scopeCompanyID}
+}
+
+// CreateOfferTemplate snapshots the offer and its stops as a new template
+func CreateOfferTemplate(input dto.OfferTemplateInput, userID int, scopeCompanyID *int) (int, error) {
+	ctx := context.Background()
+
+	stops, err := GetOfferStops([]int{input.OfferID})
+	if err != nil {
+		return 0, err
+	}
+	stopsJSON, err := json.Marshal(stops[input.OfferID])
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode offer stops: %w", err)
+	}
+	if stops[input.OfferID] == nil {
+		stopsJSON = []byte("[]")
+	}
+
+	state := input.OfferState
+	if state == "" {
+		state = dto.OfferStatePending
+	}
+	kind := input.Recurrence
+	if kind == "" {
+		kind = recurrence.None
+	}
+	leadDays := 7
+	if input.LeadDays != nil {
+		leadDays = *input.LeadDays
+	}
+	weekdays := input.Weekdays
+	if weekdays == nil {
+		weekdays = []int{}
+	}
+
+	var id int
+	err = db.DB.QueryRow(ctx,
+		`INSERT INTO tbl_offer_template (
+			user_id, company_id, source_offer_id, name, offer, stops, anchor_date, offer_state,
+			recurrence, weekdays, month_day, cron, starts_on, ends_on, lead_days
+		)
+		SELECT $1, COALESCE(o.company_id, 0), o.id, $3,
+		       to_jsonb(o) - 'id' - 'uuid' - 'exec_company_id' - 'offer_state' - 'view_count'
+		                   - 'featured' - 'partner' - 'created_at' - 'updated_at' - 'active' - 'deleted',
+		       $4, o.delivery_start, $5::offer_state_t,
+		       $6::recurrence_t, $7, $8, $9, $10, $11, $12
+		FROM tbl_offer o
+		WHERE o.id = $2 AND o.deleted = 0 AND ($13::int IS NULL OR o.company_id = $13)
+		RETURNING id`,
+		userID, input.OfferID, input.Name, stopsJSON, state,
+		kind, weekdays, input.MonthDay, input.Cron, input.StartsOn, input.EndsOn, leadDays,
+		scopeCompanyID,
+	).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrOfferNotFound
+		}
+		return 0, fmt.Errorf("failed to create offer template: %w", err)
+	}
+	return id, nil
+}
+
+func GetOfferTemplates(scopeCompanyID *int) ([]dto.OfferTemplate, error) {
+	scope, args := offerTemplateScope(scopeCompanyID, 1)
+
+	var scans []OfferTemplateScan
+	err := pgxscan.Select(context.Background(), db.DB, &scans,
+		offerTemplateSelect+` WHERE t.deleted = 0`+scope+` ORDER BY t.id DESC`,
+		args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get offer templates: %w", err)
+	}
+
+	templates := make([]dto.OfferTemplate, len(scans))
+	for i, scan := range scans {
+		templates[i] = scan.ToOfferTemplate()
+	}
+	return templates, nil
+}
+
+func getOfferTemplateScan(ctx context.Context, q pgxscan.Querier, id int, scopeCompanyID *int, lock bool) (OfferTemplateScan, error) {
+	scope, args := offerTemplateScope(scopeCompanyID, 2)
+	query := offerTemplateSelect + ` WHERE t.id = $1 AND t.deleted = 0` + scope
+	if lock {
+		query += ` FOR UPDATE`
+	}
+
+	var scan OfferTemplateScan
+	err := pgxscan.Get(ctx, q, &scan, query, append([]interface{}{id}, args...)...)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return scan, ErrOfferTemplateNotFound
+		}
+		return scan, fmt.Errorf("failed to get offer template: %w", err)
+	}
+	return scan, nil
+}
+
+func GetOfferTemplate(id int, scopeCompanyID *int) (dto.OfferTemplate, error) {
+	scan, err := getOfferTemplateScan(context.Background(), db.DB, id, scopeCompanyID, false)
+	if err != nil {
+		return dto.OfferTemplate{}, err
+	}
+	return scan.ToOfferTemplate(), nil
+}
+
+// UpdateOfferTemplate changes the name, the state of new offers and the
+// recurrence. A recurrence change replaces the whole rule.
+func UpdateOfferTemplate(id int, scopeCompanyID *int, input dto.OfferTemplateUpdate) error {
+	var weekdays []int
+	if input.Recurrence != nil {
+		weekdays = input.Weekdays
+		if weekdays == nil {
+			weekdays = []int{}
+		}
+	}
+
+	scope, args := offerTemplateScope(scopeCompanyID, 12)
+	result, err := db.DB.Exec(context.Background(),
+		`UPDATE tbl_offer_template t SET
+		     name = COALESCE($2, name),
+		     offer_state = COALESCE($3::offer_state_t, offer_state),
+		     recurrence = COALESCE($4::recurrence_t, recurrence),
+		     weekdays = CASE WHEN $4::text IS NULL THEN weekdays ELSE $5 END,
+		     month_day = CASE WHEN $4::text IS NULL THEN month_day ELSE $6 END,
+		     cron = CASE WHEN $4::text IS NULL THEN cron ELSE $7 END,
+		     starts_on = CASE WHEN $4::text IS NULL THEN starts_on ELSE $8 END,
+		     ends_on = CASE WHEN $4::text IS NULL THEN ends_on ELSE $9 END,
+		     lead_days = COALESCE($10, lead_days),
+		     active = COALESCE($11, active),
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE t.id = $1 AND t.deleted = 0`+scope,
+		append([]interface{}{id, input.Name, input.OfferState, input.Recurrence, weekdays, input.MonthDay,
+			input.Cron, input.StartsOn, input.EndsOn, input.LeadDays, input.Active}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to update offer template: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrOfferTemplateNotFound
+	}
+	return nil
+}
+
+func DeleteOfferTemplate(id int, scopeCompanyID *int) error {
+	scope, args := offerTemplateScope(scopeCompanyID, 2)
+	result, err := db.DB.Exec(context.Background(),
+		`UPDATE tbl_offer_template t SET deleted = 1, updated_at = CURRENT_TIMESTAMP
+		 WHERE t.id = $1 AND t.deleted = 0`+scope,
+		append([]interface{}{id}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to delete offer template: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrOfferTemplateNotFound
+	}
+	return nil
+}
+
+// GetRecurringOfferTemplates returns the active templates with a recurrence
+func GetRecurringOfferTemplates() ([]OfferTemplateScan, error) {
+	var scans []OfferTemplateScan
+	err := pgxscan.Select(context.Background(), db.DB, &scans,
+		offerTemplateSelect+` WHERE t.recurrence <> 'none' AND t.active = 1 AND t.deleted = 0 ORDER BY t.id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recurring offer templates: %w", err)
+	}
+	return scans, nil
+}
+
+// CreateOfferFromTemplate creates the offer of the template for the day, with
+// all dates shifted by day - anchor_date. It returns false when the template
+// already has an offer for the day.
+func CreateOfferFromTemplate(templateID int, day time.Time, scheduled bool, actor dto.OfferActor) (int, bool, error) {
+	ctx := context.Background()
+
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	template, err := getOfferTemplateScan(ctx, tx, templateID, nil, true)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var exists bool
+	err = tx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM tbl_offer_template_run WHERE template_id = $1 AND occurrence_date = $2::date)`,
+		templateID, day).Scan(&exists)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to check template runs: %w", err)
+	}
+	if exists {
+		return 0, false, nil
+	}
+
+	// scheduled runs count like offers the company creates itself
+	if scheduled || !actor.IsAdmin() {
+		if err := ConsumePlanQuota(ctx, tx, template.CompanyID, dto.PlanFeatureLoadPosts, 1); err != nil {
+			return 0, false, err
+		}
+	}
+
+	columns := append(append([]string{}, offerTemplateColumns...), offerTemplateDates...)
+	values := make([]string, 0, len(columns))
+	for _, column := range offerTemplateColumns {
+		values = append(values, "r."+column)
+	}
+	for _, column := range offerTemplateDates {
+		values = append(values, fmt.Sprintf("r.%s + ($2::date - $3::date)", column))
+	}
+
+	var offerID int
+	err = tx.QueryRow(ctx, fmt.Sprintf(
+		`INSERT INTO tbl_offer (%s, offer_state)
+		 SELECT %s, $4::offer_state_t
+		 FROM jsonb_populate_record(NULL::tbl_offer, $1) r
+		 RETURNING id`,
+		strings.Join(columns, ", "), strings.Join(values, ", ")),
+		template.Offer, day, template.AnchorDate, template.OfferState,
+	).Scan(&offerID)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to create offer from template: %w", err)
+	}
+
+	var stops []dto.OfferStop
+	_ = json.Unmarshal(template.Stops, &stops)
+	shiftDays := int(day.Sub(template.AnchorDate).Hours() / 24)
+	for i := range stops {
+		if stops[i].WindowStart != nil {
+			start := stops[i].WindowStart.AddDate(0, 0, shiftDays)
+			stops[i].WindowStart = &start
+		}
+		if stops[i].WindowEnd != nil {
+			end := stops[i].WindowEnd.AddDate(0, 0, shiftDays)
+			stops[i].WindowEnd = &end
+		}
+	}
+	if err := ReplaceOfferStopsTx(ctx, tx, offerID, stops); err != nil {
+		return 0, false, err
+	}
+
+	err = insertOfferStateChange(ctx, tx, &dto.OfferStateChange{
+		OfferID:        offerID,
+		ToState:        template.OfferState,
+		ActorUserID:    actor.UserID,
+		ActorCompanyID: actor.CompanyID,
+		ActorRole:      actor.Role,
+		Reason:         fmt.Sprintf("created from template #%d", templateID),
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO tbl_offer_template_run (template_id, offer_id, occurrence_date, scheduled)
+		 VALUES ($1, $2, $3::date, $4)`,
+		templateID, offerID, day, scheduled)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to record template run: %w", err)
+	}
+
+	if scheduled {
+		_, err = tx.Exec(ctx,
+			`UPDATE tbl_offer_template
+			 SET last_occurrence = GREATEST(COALESCE(last_occurrence, $2::date), $2::date)
+			 WHERE id = $1`,
+			templateID, day)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to update template: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return offerID, true, nil
+}
@@ -0,0 +1,365 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	db "texApi/database"
+	"texApi/internal/dto"
+)
+
+var ErrTenderNotFound = errors.New("offer has no tender")
+var ErrTenderForbidden = errors.New("only the offer owner can manage its tender")
+var ErrTenderOffer = errors.New("tenders run on draft, pending and active offers only")
+var ErrTenderOpen = errors.New("the tender is open until its deadline")
+var ErrTenderClosed = errors.New("the tender is closed")
+var ErrTenderHasBids = errors.New("the tender has bids, only a later deadline can be set")
+var ErrTenderDuplicateBid = errors.New("your company already bids on this tender")
+var ErrTenderWeights = errors.New("score tenders need a price or a rating weight")
+
+const offerTenderColumns = `id, offer_id, mode::text AS mode, award_by::text AS award_by,
+	price_weight::float8 AS price_weight, rating_weight::float8 AS rating_weight, deadline,
+	state::text AS state, winner_response_id, note, closed_at, created_at, updated_at`
+
+// ClosedTender is the outcome of closing a tender at its deadline
+type ClosedTender struct {
+	dto.OfferTender
+	OwnerUserID int
+	Winner      *dto.TenderBid
+	Bids        []dto.TenderBid // pending bids at the close, best first
+}
+
+func getOfferTender(ctx context.Context, q pgxscan.Querier, offerID int, lock bool) (dto.OfferTender, error) {
+	query := `SELECT ` + offerTenderColumns + ` FROM tbl_offer_tender WHERE offer_id = $1`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+
+	var tender dto.OfferTender
+	err := pgxscan.Get(ctx, q, &tender, query, offerID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return tender, ErrTenderNotFound
+		}
+		return tender, fmt.Errorf("failed to get offer tender: %w", err)
+	}
+	return tender, nil
+}
+
+func GetOfferTender(offerID int) (dto.OfferTender, error) {
+	return getOfferTender(context.Background(), db.DB, offerID, false)
+}
+
+// GetTenderBids returns the responses with a bid on the offer, pending ones
+// first
+func GetTenderBids(offerID int) ([]dto.TenderBid, error) {
+	return getTenderBids(context.Background(), db.DB, offerID, false)
+}
+
+func getTenderBids(ctx context.Context, q pgxscan.Querier, offerID int, pendingOnly bool) ([]dto.TenderBid, error) {
+	bids := []dto.TenderBid{}
+	err := pgxscan.Select(ctx, q, &bids,
+		`SELECT r.id AS response_id, COALESCE(r.company_id, 0) AS company_id, COALESCE(c.user_id, 0) AS user_id,
+		        COALESCE(c.company_name, '') AS company_name, COALESCE(c.rating, 0) AS rating,
+		        r.bid_price::float8 AS bid_price, r.state::text AS state, r.created_at
+		 FROM tbl_offer_response r
+		 LEFT JOIN tbl_company c ON c.id = r.company_id
+		 WHERE r.offer_id = $1 AND r.deleted = 0 AND r.bid_price IS NOT NULL
+		   AND (NOT $2 OR r.state = 'pending')
+		 ORDER BY r.state = 'pending' DESC, r.bid_price, r.id`,
+		offerID, pendingOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tender bids: %w", err)
+	}
+	return bids, nil
+}
+
+// SaveOfferTender opens a tender on the offer or changes the open one
+func SaveOfferTender(offerID int, input dto.OfferTenderInput, actor dto.OfferActor) (dto.OfferTender, error) {
+	ctx := context.Background()
+
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return dto.OfferTender{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var ownerID int
+	var state string
+	err = tx.QueryRow(ctx,
+		`SELECT COALESCE(company_id, 0), offer_state::text FROM tbl_offer WHERE id = $1 AND deleted = 0 FOR UPDATE`,
+		offerID).Scan(&ownerID, &state)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return dto.OfferTender{}, ErrOfferNotFound
+		}
+		return dto.OfferTender{}, fmt.Errorf("failed to get offer: %w", err)
+	}
+	if !actor.IsAdmin() && (actor.CompanyID == 0 || actor.CompanyID != ownerID) {
+		return dto.OfferTender{}, ErrTenderForbidden
+	}
+	if state != dto.OfferStateDraft && state != dto.OfferStatePending && state != dto.OfferStateActive {
+		return dto.OfferTender{}, ErrTenderOffer
+	}
+
+	// omitted fields keep the values of the open tender
+	current, err := getOfferTender(ctx, tx, offerID, true)
+	if err != nil && !errors.Is(err, ErrTenderNotFound) {
+		return current, err
+	}
+	defaults := current
+	if errors.Is(err, ErrTenderNotFound) {
+		defaults = dto.OfferTender{Mode: dto.TenderModeOpen, AwardBy: dto.TenderAwardManual, PriceWeight: 0.7, RatingWeight: 0.3}
+	}
+	if input.Mode == "" {
+		input.Mode = defaults.Mode
+	}
+	if input.AwardBy == "" {
+		input.AwardBy = defaults.AwardBy
+	}
+	priceWeight, ratingWeight := defaults.PriceWeight, defaults.RatingWeight
+	if input.PriceWeight != nil {
+		priceWeight = math.Round(*input.PriceWeight*1000) / 1000
+	}
+	if input.RatingWeight != nil {
+		ratingWeight = math.Round(*input.RatingWeight*1000) / 1000
+	}
+	if input.AwardBy == dto.TenderAwardScore && priceWeight+ratingWeight == 0 {
+		return current, ErrTenderWeights
+	}
+
+	switch {
+	case errors.Is(err, ErrTenderNotFound):
+	case current.State != dto.TenderStateOpen:
+		return current, ErrTenderClosed
+	default:
+		bids, err := getTenderBids(ctx, tx, offerID, true)
+		if err != nil {
+			return current, err
+		}
+		if len(bids) > 0 && (input.Mode != current.Mode || input.AwardBy != current.AwardBy ||
+			priceWeight != current.PriceWeight || ratingWeight != current.RatingWeight ||
+			input.Deadline.Before(current.Deadline)) {
+			return current, ErrTenderHasBids
+		}
+	}
+
+	var tender dto.OfferTender
+	err = pgxscan.Get(ctx, tx, &tender,
+		`INSERT INTO tbl_offer_tender (offer_id, mode, award_by, price_weight, rating_weight, deadline)
+		 VALUES ($1, $2::tender_mode_t, $3::tender_award_t, $4, $5, $6)
+		 ON CONFLICT (offer_id) DO UPDATE
+		 SET mode = EXCLUDED.mode, award_by = EXCLUDED.award_by, price_weight = EXCLUDED.price_weight,
+		     rating_weight = EXCLUDED.rating_weight, deadline = EXCLUDED.deadline,
+		     updated_at = CURRENT_TIMESTAMP
+		 RETURNING `+offerTenderColumns,
+		offerID, input.Mode, input.AwardBy, priceWeight, ratingWeight, input.Deadline.UTC())
+	if err != nil {
+		return tender, fmt.Errorf("failed to save offer tender: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return tender, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return tender, nil
+}
+
+// DeleteOfferTender cancels the open tender, its bids stay as responses
+func DeleteOfferTender(offerID int, actor dto.OfferActor) error {
+	ctx := context.Background()
+
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tender, err := getOfferTender(ctx, tx, offerID, true)
+	if err != nil {
+		return err
+	}
+	var ownerID int
+	err = tx.QueryRow(ctx, `SELECT COALESCE(company_id, 0) FROM tbl_offer WHERE id = $1`, offerID).Scan(&ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to get offer: %w", err)
+	}
+	if !actor.IsAdmin() && (actor.CompanyID == 0 || actor.CompanyID != ownerID) {
+		return ErrTenderForbidden
+	}
+	if tender.State != dto.TenderStateOpen {
+		return ErrTenderClosed
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM tbl_offer_tender WHERE id = $1`, tender.ID); err != nil {
+		return fmt.Errorf("failed to delete offer tender: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// CheckTenderBidTx returns whether the offer runs a tender and fails when the
+// company can't bid on it now. The tender row stays share locked until the
+// transaction ends, so it can't be closed or cancelled under the new bid.
+// The offer is locked first, as the bid's insert would, to keep the lock
+// order of CloseTender.
+func CheckTenderBidTx(ctx context.Context, tx pgx.Tx, offerID, companyID int, now time.Time) (bool, error) {
+	_, err := tx.Exec(ctx, `SELECT 1 FROM tbl_offer WHERE id = $1 FOR KEY SHARE`, offerID)
+	if err != nil {
+		return false, fmt.Errorf("failed to lock offer: %w", err)
+	}
+
+	var tender dto.OfferTender
+	err = pgxscan.Get(ctx, tx, &tender,
+		`SELECT `+offerTenderColumns+` FROM tbl_offer_tender WHERE offer_id = $1 FOR SHARE`, offerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get offer tender: %w", err)
+	}
+	if tender.State != dto.TenderStateOpen || !now.Before(tender.Deadline) {
+		return true, ErrTenderClosed
+	}
+
+	var bids int
+	err = tx.QueryRow(ctx,
+		`SELECT COUNT(*) FROM tbl_offer_response
+		 WHERE offer_id = $1 AND company_id = $2 AND state = 'pending' AND deleted = 0`,
+		offerID, companyID).Scan(&bids)
+	if err != nil {
+		return true, fmt.Errorf("failed to check tender bids: %w", err)
+	}
+	if bids > 0 {
+		return true, ErrTenderDuplicateBid
+	}
+	return true, nil
+}
+
+// tenderOpen reports whether the offer runs a tender that takes bids, its
+// responses can't be countered or accepted then
+func tenderOpen(ctx context.Context, q offerStateQuerier, offerID int) (bool, error) {
+	var open bool
+	err := q.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM tbl_offer_tender WHERE offer_id = $1 AND state = 'open')`,
+		offerID).Scan(&open)
+	if err != nil {
+		return false, fmt.Errorf("failed to check offer tender: %w", err)
+	}
+	return open, nil
+}
+
+// GetDueTenderOfferIDs returns the offers whose open tender passed its deadline
+func GetDueTenderOfferIDs(now time.Time) ([]int, error) {
+	var ids []int
+	err := pgxscan.Select(context.Background(), db.DB, &ids,
+		`SELECT offer_id FROM tbl_offer_tender
+		 WHERE state = 'open' AND deadline <= $1
+		 ORDER BY deadline
+		 LIMIT $2`,
+		now.UTC(), offerExpiryBatch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due tenders: %w", err)
+	}
+	return ids, nil
+}
+
+// CloseTender closes the tender of the offer past its deadline. Tenders with
+// an award rule accept the best pending bid, when that fails the tender is
+// closed with the reason in its note and the owner chooses. It returns nil
+// when the tender is not due or is locked by another change.
+func CloseTender(offerID int, now time.Time) (*ClosedTender, error) {
+	ctx := context.Background()
+
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// the offer is locked before its tender, in the order of SaveOfferTender
+	// and the accept path
+	var closed ClosedTender
+	err = tx.QueryRow(ctx,
+		`SELECT COALESCE(o.user_id, 0) FROM tbl_offer o
+		 JOIN tbl_offer_tender t ON t.offer_id = o.id AND t.state = 'open' AND t.deadline <= $2
+		 WHERE o.id = $1
+		 FOR UPDATE OF o SKIP LOCKED`,
+		offerID, now.UTC()).Scan(&closed.OwnerUserID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get offer: %w", err)
+	}
+	err = pgxscan.Get(ctx, tx, &closed.OfferTender,
+		`SELECT `+offerTenderColumns+` FROM tbl_offer_tender
+		 WHERE offer_id = $1 AND state = 'open' AND deadline <= $2
+		 FOR UPDATE`,
+		offerID, now.UTC())
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get due tender: %w", err)
+	}
+
+	bids, err := getTenderBids(ctx, tx, offerID, true)
+	if err != nil {
+		return nil, err
+	}
+	closed.Bids = closed.Rank(bids)
+
+	closed.State = dto.TenderStateClosed
+	switch {
+	case len(closed.Bids) == 0:
+		closed.State = dto.TenderStateNoBids
+	case closed.AwardBy != dto.TenderAwardManual:
+		closed.State = dto.TenderStateAwarded
+		closed.Winner = &closed.Bids[0]
+		closed.WinnerResponseID = closed.Winner.ResponseID
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE tbl_offer_tender
+		 SET state = $2::tender_state_t, winner_response_id = $3, closed_at = CURRENT_TIMESTAMP,
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1`,
+		closed.ID, closed.State, closed.WinnerResponseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to close tender: %w", err)
+	}
+
+	if closed.Winner != nil {
+		award, err := tx.Begin(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to begin savepoint: %w", err)
+		}
+		actor := dto.OfferActor{Role: "system"}
+		reason := fmt.Sprintf("tender awarded to response #%d by %s", closed.WinnerResponseID, closed.AwardBy)
+		if _, err := AcceptOfferResponseTx(ctx, award, closed.WinnerResponseID, actor, reason); err != nil {
+			award.Rollback(ctx)
+			closed.State, closed.WinnerResponseID, closed.Winner = dto.TenderStateClosed, 0, nil
+			closed.Note = "award failed: " + err.Error()
+			_, err = tx.Exec(ctx,
+				`UPDATE tbl_offer_tender SET state = 'closed', winner_response_id = 0, note = $2 WHERE id = $1`,
+				closed.ID, closed.Note)
+			if err != nil {
+				return nil, fmt.Errorf("failed to close tender: %w", err)
+			}
+		} else if err := award.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("failed to release savepoint: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &closed, nil
+}
@@ -0,0 +1,245 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"texApi/config"
+	db "texApi/database"
+	"texApi/internal/dto"
+)
+
+var (
+	ErrPlanFeatureUnavailable = errors.New("not available on your plan")
+	ErrPlanQuotaExceeded      = errors.New("plan quota exhausted")
+)
+
+const planColumns = `p.id, p.uuid, p.name, p.code, p.provider, p.region, p.price_usd, p.price_local,
+	p.local_currency, p.billing_cycle, p.load_posts_limit, p.load_posts_unlimited,
+	p.gps_tracking_level, p.gps_has_eta, p.rate_tools_level, p.rate_tools_features,
+	p.edocs_available, p.edocs_limit, p.edocs_has_archiving, p.support_level,
+	p.payment_guarantee, p.api_access, p.display_order, p.is_popular, p.is_recommended,
+	p.description, p.features_summary, p.available_from, p.available_until,
+	p.meta, p.meta2, p.meta3, p.created_at, p.updated_at`
+
+// companyPlanJoinSQL joins the plan p of the company c: the tbl_plan row the
+// company is linked to, or the row of its plan enum while it has no link
+const companyPlanJoinSQL = `JOIN tbl_plan p ON p.active = 1 AND p.deleted = 0 AND (
+	p.id = c.plan_id OR (c.plan_id = 0 AND p.code = CASE c.plan
+		WHEN 'start' THEN 'TEX_START'
+		WHEN 'standard' THEN 'TEX_PRO'
+		WHEN 'premium' THEN 'TEX_ENTERPRISE'
+	END))`
+
+// GetCompanyPlan returns the active plan assigned to the company
+func GetCompanyPlan(companyID int) (dto.Plan, error) {
+	var plan dto.Plan
+	err := pgxscan.Get(context.Background(), db.DB, &plan,
+		`SELECT `+planColumns+`
+		 FROM tbl_company c
+		 `+companyPlanJoinSQL+`
+		 WHERE c.id = $1 AND c.plan_active = 1 AND c.deleted = 0`,
+		companyID)
+	if err != nil {
+		return plan, fmt.Errorf("failed to get company plan: %w", err)
+	}
+	return plan, nil
+}
+
+func getPlanByCode(code string) (*dto.Plan, error) {
+	var plans []dto.Plan
+	err := pgxscan.Select(context.Background(), db.DB, &plans,
+		`SELECT `+planColumns+` FROM tbl_plan p WHERE p.code = $1 AND p.active = 1 AND p.deleted = 0`,
+		code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan %s: %w", code, err)
+	}
+	if len(plans) == 0 {
+		return nil, nil
+	}
+	return &plans[0], nil
+}
+
+// billingCycle returns the cycle of the given length in months that holds now,
+// cycles follow each other from the anchor
+func billingCycle(anchor, now time.Time, months int) (time.Time, time.Time) {
+	if anchor.IsZero() || anchor.After(now) {
+		anchor = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	}
+	n := (now.Year()-anchor.Year())*12 + int(now.Month()-anchor.Month())
+	n -= n % months
+	start := anchor.AddDate(0, n, 0)
+	if start.After(now) {
+		start = anchor.AddDate(0, n-months, 0)
+	}
+	return start, start.AddDate(0, months, 0)
+}
+
+func billingCycleMonths(cycle string) int {
+	switch cycle {
+	case "quarterly":
+		return 3
+	case "yearly":
+		return 12
+	default:
+		return 1
+	}
+}
+
+// GetCompanyEntitlement returns the plan the company works under and the
+// current billing cycle. Companies without an active plan get the plan of
+// PLAN_DEFAULT_CODE, if any.
+func GetCompanyEntitlement(companyID int, now time.Time) (dto.PlanEntitlement, error) {
+	entitlement := dto.PlanEntitlement{CompanyID: companyID}
+
+	var anchor *time.Time
+	err := db.DB.QueryRow(context.Background(),
+		`SELECT plan_started_at FROM tbl_company WHERE id = $1 AND deleted = 0`, companyID,
+	).Scan(&anchor)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return entitlement, fmt.Errorf("failed to get company: %w", err)
+	}
+
+	plan, err := GetCompanyPlan(companyID)
+	switch {
+	case err == nil:
+		entitlement.Plan = &plan
+	case errors.Is(err, pgx.ErrNoRows):
+		if config.ENV.PLAN_DEFAULT_CODE != "" {
+			entitlement.Plan, err = getPlanByCode(config.ENV.PLAN_DEFAULT_CODE)
+			if err != nil {
+				return entitlement, err
+			}
+			entitlement.Default = entitlement.Plan != nil
+		}
+	default:
+		return entitlement, err
+	}
+
+	months := 1
+	if entitlement.Plan != nil {
+		months = billingCycleMonths(entitlement.Plan.BillingCycle)
+	}
+	var from time.Time
+	if anchor != nil {
+		from = *anchor
+	}
+	entitlement.CycleStart, entitlement.CycleEnd = billingCycle(from, now, months)
+	return entitlement, nil
+}
+
+func CompanyHasGPSETA(companyID int) bool {
+	entitlement, err := GetCompanyEntitlement(companyID, time.Now())
+	return err == nil && entitlement.Plan != nil && entitlement.Plan.GPSHasETA
+}
+
+type planUsageQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// ConsumePlanQuota counts n uses of the feature in the company's current
+// cycle. It fails with ErrPlanFeatureUnavailable or ErrPlanQuotaExceeded and
+// counts nothing then. Run it in the transaction of the counted change so a
+// rollback gives the uses back.
+func ConsumePlanQuota(ctx context.Context, q planUsageQuerier, companyID int, feature string, n int) error {
+	if !config.ENV.PLAN_QUOTAS_ENABLED {
+		return nil
+	}
+	entitlement, err := GetCompanyEntitlement(companyID, time.Now())
+	if err != nil {
+		return err
+	}
+	available, limit := entitlement.Quota(feature)
+	if !available {
+		return fmt.Errorf("%w: %s", ErrPlanFeatureUnavailable, feature)
+	}
+	exceeded := func(used int) error {
+		return fmt.Errorf("%w: %s limit of %d per billing cycle reached (%d used), the cycle renews on %s",
+			ErrPlanQuotaExceeded, feature, *limit, used, entitlement.CycleEnd.Format("2006-01-02"))
+	}
+	if limit != nil && n > *limit {
+		return exceeded(0)
+	}
+
+	var used int
+	err = q.QueryRow(ctx,
+		`INSERT INTO tbl_plan_usage (company_id, feature, cycle_start, cycle_end, used)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (company_id, feature, cycle_start) DO UPDATE
+		 SET used = tbl_plan_usage.used + EXCLUDED.used, updated_at = CURRENT_TIMESTAMP
+		 WHERE $6::int IS NULL OR tbl_plan_usage.used + EXCLUDED.used <= $6::int
+		 RETURNING used`,
+		companyID, feature, entitlement.CycleStart, entitlement.CycleEnd, n, limit,
+	).Scan(&used)
+	if errors.Is(err, pgx.ErrNoRows) {
+		current, _ := getPlanUsed(ctx, q, companyID, feature, entitlement.CycleStart)
+		return exceeded(current)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to count plan usage: %w", err)
+	}
+	return nil
+}
+
+// ReleasePlanQuota gives back n uses counted outside a transaction whose
+// change failed afterwards
+func ReleasePlanQuota(companyID int, feature string, n int) error {
+	if !config.ENV.PLAN_QUOTAS_ENABLED {
+		return nil
+	}
+	entitlement, err := GetCompanyEntitlement(companyID, time.Now())
+	if err != nil {
+		return err
+	}
+	_, err = db.DB.Exec(context.Background(),
+		`UPDATE tbl_plan_usage SET used = GREATEST(used - $4, 0), updated_at = CURRENT_TIMESTAMP
+		 WHERE company_id = $1 AND feature = $2 AND cycle_start = $3`,
+		companyID, feature, entitlement.CycleStart, n)
+	if err != nil {
+		return fmt.Errorf("failed to release plan usage: %w", err)
+	}
+	return nil
+}
+
+func getPlanUsed(ctx context.Context, q planUsageQuerier, companyID int, feature string, cycleStart time.Time) (int, error) {
+	var used int
+	err := q.QueryRow(ctx,
+		`SELECT COALESCE((SELECT used FROM tbl_plan_usage
+		 WHERE company_id = $1 AND feature = $2 AND cycle_start = $3), 0)`,
+		companyID, feature, cycleStart).Scan(&used)
+	return used, err
+}
+
+// GetPlanUsage returns the company's plan and its usage in the current cycle
+func GetPlanUsage(companyID int, now time.Time) (dto.PlanUsage, error) {
+	entitlement, err := GetCompanyEntitlement(companyID, now)
+	if err != nil {
+		return dto.PlanUsage{}, err
+	}
+
+	usage := dto.PlanUsage{
+		PlanEntitlement:  entitlement,
+		GPSTrackingLevel: entitlement.GPSLevel(),
+		GPSHasETA:        entitlement.Plan != nil && entitlement.Plan.GPSHasETA,
+		APIAccess:        entitlement.APIAccess(),
+	}
+	for _, feature := range []string{dto.PlanFeatureLoadPosts, dto.PlanFeatureEdocs} {
+		used, err := getPlanUsed(context.Background(), db.DB, companyID, feature, entitlement.CycleStart)
+		if err != nil {
+			return usage, fmt.Errorf("failed to get plan usage: %w", err)
+		}
+
+		quota := dto.PlanQuotaUsage{Feature: feature, Used: used}
+		quota.Available, quota.Limit = entitlement.Quota(feature)
+		if quota.Available && quota.Limit != nil {
+			remaining := max(*quota.Limit-used, 0)
+			quota.Remaining = &remaining
+		}
+		usage.Quotas = append(usage.Quotas, quota)
+	}
+	return usage, nil
+}
@@ -0,0 +1,352 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	db "texApi/database"
+	"texApi/internal/dto"
+)
+
+// offer columns a saved search filters on, compared with = unless listed in
+// savedSearchDateFilters
+var savedSearchIntFilters = []string{
+	"company_id", "vehicle_type_id", "cargo_id", "from_country_id", "from_city_id",
+	"to_country_id", "to_city_id", "tax", "trade", "discount", "featured", "partner",
+}
+
+var savedSearchTextFilters = []string{"offer_role", "payment_method"}
+
+// same bounds as GET /offer/
+var savedSearchDateFilters = [][2]string{
+	{"validity_start", ">="},
+	{"validity_end", "<="},
+	{"delivery_start", ">="},
+	{"delivery_end", "<="},
+}
+
+// OfferCargoFilters are the filters on the cargo measures of an offer, %s is
+// the float8 value of the filter. The 0/1 filters pick offers without or with
+// the property.
+var OfferCargoFilters = [][2]string{
+	{"max_weight_kg", "cg.weight_kg <= %s"},
+	{"max_volume_m3", "cg.volume_m3 <= %s"},
+	{"max_loading_meters", "cg.loading_meters <= %s"},
+	{"adr", "(cg.adr_class != '') = (%s = 1)"},
+	{"temperature_controlled", "(cg.temp_min IS NOT NULL OR cg.temp_max IS NOT NULL) = (%s = 1)"},
+	{"stackable", "(cg.max_stack > 1) = (%s = 1)"},
+}
+
+// OfferCargoCondition checks the cargo of the offer o against the filter
+// condition, value is an SQL expression of the filter value
+func OfferCargoCondition(condition, value string) string {
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM tbl_cargo cg WHERE cg.id = o.cargo_id AND cg.deleted = 0 AND %s)",
+		fmt.Sprintf(condition, "("+value+")::float8"))
+}
+
+const savedSearchColumns = `s.id, s.uuid::text AS uuid, s.user_id, s.company_id, s.name, s.filters,
+	s.frequency::text AS frequency, s.notify_push, s.notify_email, s.notify_chat, s.last_digest_at,
+	(SELECT COUNT(*) FROM tbl_saved_search_match m WHERE m.search_id = s.id AND m.notified_at IS NULL) AS pending_count,
+	s.created_at, s.updated_at, s.active`
+
+type SavedSearchScan struct {
+	ID           int        `db:"id"`
+	UUID         string     `db:"uuid"`
+	UserID       int        `db:"user_id"`
+	CompanyID    int        `db:"company_id"`
+	Name         string     `db:"name"`
+	Filters      []byte     `db:"filters"`
+	Frequency    string     `db:"frequency"`
+	NotifyPush   int        `db:"notify_push"`
+	NotifyEmail  int        `db:"notify_email"`
+	NotifyChat   int        `db:"notify_chat"`
+	LastDigestAt *time.Time `db:"last_digest_at"`
+	PendingCount int        `db:"pending_count"`
+	CreatedAt    time.Time  `db:"created_at"`
+	UpdatedAt    time.Time  `db:"updated_at"`
+	Active       int        `db:"active"`
+}
+
+func (ss *SavedSearchScan) ToSavedSearch() dto.SavedSearch {
+	search := dto.SavedSearch{
+		ID:           ss.ID,
+		UUID:         ss.UUID,
+		UserID:       ss.UserID,
+		CompanyID:    ss.CompanyID,
+		Name:         ss.Name,
+		Frequency:    ss.Frequency,
+		NotifyPush:   ss.NotifyPush,
+		NotifyEmail:  ss.NotifyEmail,
+		NotifyChat:   ss.NotifyChat,
+		LastDigestAt: ss.LastDigestAt,
+		PendingCount: ss.PendingCount,
+		CreatedAt:    ss.CreatedAt,
+		UpdatedAt:    ss.UpdatedAt,
+		Active:       ss.Active,
+	}
+	_ = json.Unmarshal(ss.Filters, &search.Filters)
+	return search
+}
+
+func CountSavedSearches(userID int) (int, error) {
+	var count int
+	err := db.DB.QueryRow(context.Background(),
+		`SELECT COUNT(*) FROM tbl_saved_search WHERE user_id = $1 AND deleted = 0`,
+		userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count saved searches: %w", err)
+	}
+	return count, nil
+}
+
+func CreateSavedSearch(userID, companyID int, input dto.SavedSearchInput) (int, error) {
+	filters, err := json.Marshal(input.Filters)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode search filters: %w", err)
+	}
+
+	frequency := input.Frequency
+	if frequency == "" {
+		frequency = dto.SearchFrequencyInstant
+	}
+
+	var id int
+	err = db.DB.QueryRow(context.Background(),
+		`INSERT INTO tbl_saved_search (user_id, company_id, name, filters, frequency,
+		                               notify_push, notify_email, notify_chat, active)
+		 VALUES ($1, $2, $3, $4, $5::search_frequency_t,
+		         COALESCE($6, 1), COALESCE($7, 0), COALESCE($8, 0), COALESCE($9, 1))
+		 RETURNING id`,
+		userID, companyID, input.Name, filters, frequency,
+		input.NotifyPush, input.NotifyEmail, input.NotifyChat, input.Active,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create saved search: %w", err)
+	}
+	return id, nil
+}
+
+func GetSavedSearches(userID int) ([]dto.SavedSearch, error) {
+	var scans []SavedSearchScan
+	err := pgxscan.Select(context.Background(), db.DB, &scans,
+		`SELECT `+savedSearchColumns+`
+		 FROM tbl_saved_search s
+		 WHERE s.user_id = $1 AND s.deleted = 0
+		 ORDER BY s.id DESC`,
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saved searches: %w", err)
+	}
+
+	searches := make([]dto.SavedSearch, len(scans))
+	for i, scan := range scans {
+		searches[i] = scan.ToSavedSearch()
+	}
+	return searches, nil
+}
+
+func GetSavedSearch(id, userID int) (dto.SavedSearch, error) {
+	var scan SavedSearchScan
+	err := pgxscan.Get(context.Background(), db.DB, &scan,
+		`SELECT `+savedSearchColumns+`
+		 FROM tbl_saved_search s
+		 WHERE s.id = $1 AND s.user_id = $2 AND s.deleted = 0`,
+		id, userID)
+	if err != nil {
+		return dto.SavedSearch{}, fmt.Errorf("failed to get saved search: %w", err)
+	}
+	return scan.ToSavedSearch(), nil
+}
+
+func UpdateSavedSearch(id, userID int, input dto.SavedSearchInput) error {
+	var filters []byte
+	if input.Filters != nil {
+		var err error
+		if filters, err = json.Marshal(input.Filters); err != nil {
+			return fmt.Errorf("failed to encode search filters: %w", err)
+		}
+	}
+
+	var frequency *string
+	if input.Frequency != "" {
+		frequency = &input.Frequency
+	}
+
+	result, err := db.DB.Exec(context.Background(),
+		`UPDATE tbl_saved_search SET
+		     name = $3,
+		     filters = COALESCE($4, filters),
+		     frequency = COALESCE($5::search_frequency_t, frequency),
+		     notify_push = COALESCE($6, notify_push),
+		     notify_email = COALESCE($7, notify_email),
+		     notify_chat = COALESCE($8, notify_chat),
+		     active = COALESCE($9, active),
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 AND user_id = $2 AND deleted = 0`,
+		id, userID, input.Name, filters, frequency,
+		input.NotifyPush, input.NotifyEmail, input.NotifyChat, input.Active)
+	if err != nil {
+		return fmt.Errorf("failed to update saved search: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("saved search not found")
+	}
+	return nil
+}
+
+func DeleteSavedSearch(id, userID int) error {
+	result, err := db.DB.Exec(context.Background(),
+		`UPDATE tbl_saved_search SET deleted = 1, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 AND user_id = $2 AND deleted = 0`,
+		id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete saved search: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("saved search not found")
+	}
+	return nil
+}
+
+// savedSearchMatchConditions compares the filters of s with the offer o
+func savedSearchMatchConditions() string {
+	var conditions []string
+	for _, key := range savedSearchIntFilters {
+		conditions = append(conditions, fmt.Sprintf(
+			"(s.filters->>'%[1]s' IS NULL OR (s.filters->>'%[1]s')::int = o.%[1]s)", key))
+	}
+	for _, key := range savedSearchTextFilters {
+		conditions = append(conditions, fmt.Sprintf(
+			"(s.filters->>'%[1]s' IS NULL OR s.filters->>'%[1]s' = o.%[1]s::text)", key))
+	}
+	for _, filter := range savedSearchDateFilters {
+		conditions = append(conditions, fmt.Sprintf(
+			"(s.filters->>'%[1]s' IS NULL OR o.%[1]s %[2]s (s.filters->>'%[1]s')::timestamptz)", filter[0], filter[1]))
+	}
+	for _, filter := range OfferCargoFilters {
+		conditions = append(conditions, fmt.Sprintf("(s.filters->>'%s' IS NULL OR %s)",
+			filter[0], OfferCargoCondition(filter[1], fmt.Sprintf("s.filters->>'%s'", filter[0]))))
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// MatchSavedSearches stores a match for every active search of other companies
+// the offer fits and returns them with the contact of their owner. Offers are
+// matched once per search.
+func MatchSavedSearches(offerID int) ([]dto.SavedSearchRecipient, error) {
+	var rows []struct {
+		SavedSearchScan
+		MatchID int    `db:"match_id"`
+		Email   string `db:"email"`
+	}
+	err := pgxscan.Select(context.Background(), db.DB, &rows, `
+		WITH matched AS (
+			INSERT INTO tbl_saved_search_match (search_id, offer_id)
+			SELECT s.id, o.id
+			FROM tbl_saved_search s
+			JOIN tbl_offer o ON o.id = $1
+			WHERE s.active = 1 AND s.deleted = 0
+			  AND o.deleted = 0 AND o.offer_state = 'active'
+			  AND s.company_id <> COALESCE(o.company_id, 0)
+			  AND `+savedSearchMatchConditions()+`
+			ON CONFLICT (search_id, offer_id) DO NOTHING
+			RETURNING id, search_id
+		)
+		SELECT `+savedSearchColumns+`, m.id AS match_id, u.email
+		FROM matched m
+		JOIN tbl_saved_search s ON s.id = m.search_id
+		JOIN tbl_user u ON u.id = s.user_id`,
+		offerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to match saved searches: %w", err)
+	}
+
+	recipients := make([]dto.SavedSearchRecipient, len(rows))
+	for i, row := range rows {
+		recipients[i] = dto.SavedSearchRecipient{
+			SavedSearch: row.ToSavedSearch(),
+			Email:       row.Email,
+			MatchIDs:    []int{row.MatchID},
+		}
+	}
+	return recipients, nil
+}
+
+// GetDueSavedSearchDigests returns the daily searches with pending matches
+// whose last digest was sent before the cutoff
+func GetDueSavedSearchDigests(cutoff time.Time) ([]dto.SavedSearchRecipient, error) {
+	var rows []struct {
+		SavedSearchScan
+		Email    string `db:"email"`
+		MatchIDs []int  `db:"match_ids"`
+	}
+	err := pgxscan.Select(context.Background(), db.DB, &rows, `
+		SELECT `+savedSearchColumns+`, u.email,
+		       ARRAY(SELECT m.id FROM tbl_saved_search_match m
+		             WHERE m.search_id = s.id AND m.notified_at IS NULL
+		             ORDER BY m.id) AS match_ids
+		FROM tbl_saved_search s
+		JOIN tbl_user u ON u.id = s.user_id
+		WHERE s.frequency = 'daily' AND s.active = 1 AND s.deleted = 0
+		  AND (s.last_digest_at IS NULL OR s.last_digest_at < $1)
+		  AND EXISTS (SELECT 1 FROM tbl_saved_search_match m
+		              WHERE m.search_id = s.id AND m.notified_at IS NULL)`,
+		cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saved search digests: %w", err)
+	}
+
+	recipients := make([]dto.SavedSearchRecipient, len(rows))
+	for i, row := range rows {
+		recipients[i] = dto.SavedSearchRecipient{
+			SavedSearch: row.ToSavedSearch(),
+			Email:       row.Email,
+			MatchIDs:    row.MatchIDs,
+		}
+	}
+	return recipients, nil
+}
+
+// GetSavedSearchMatchOffers returns the matched offers that are still active
+func GetSavedSearchMatchOffers(matchIDs []int) ([]dto.OfferBrief, error) {
+	var offers []dto.OfferBrief
+	err := pgxscan.Select(context.Background(), db.DB, &offers, `
+		SELECT o.id, o.from_country, o.from_region, o.to_country, o.to_region,
+		       o.offer_price, o.currency::text AS currency, o.delivery_start
+		FROM tbl_saved_search_match m
+		JOIN tbl_offer o ON o.id = m.offer_id
+		WHERE m.id = ANY($1) AND o.deleted = 0 AND o.offer_state = 'active'
+		ORDER BY o.id`,
+		matchIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get matched offers: %w", err)
+	}
+	return offers, nil
+}
+
+// MarkSavedSearchNotified sets the matches sent, a digest also moves
+// last_digest_at of the search
+func MarkSavedSearchNotified(searchID int, matchIDs []int, digest bool) error {
+	ctx := context.Background()
+
+	_, err := db.DB.Exec(ctx,
+		`UPDATE tbl_saved_search_match SET notified_at = CURRENT_TIMESTAMP WHERE id = ANY($1)`,
+		matchIDs)
+	if err != nil {
+		return fmt.Errorf("failed to mark saved search matches: %w", err)
+	}
+
+	if digest {
+		_, err = db.DB.Exec(ctx,
+			`UPDATE tbl_saved_search SET last_digest_at = CURRENT_TIMESTAMP WHERE id = $1`,
+			searchID)
+		if err != nil {
+			return fmt.Errorf("failed to update saved search digest time: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,447 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	db "texApi/database"
+	"texApi/internal/dto"
+)
+
+// idleRadiusM is how far a vehicle may drift while it is considered standing
+const idleRadiusM = 100.0
+
+type TripRuleScan struct {
+	ID             int       `db:"id"`
+	TripID         int       `db:"trip_id"`
+	CompanyID      int       `db:"company_id"`
+	MaxDeviationKM *float64  `db:"max_deviation_km"`
+	RouteJSON      *string   `db:"route_json"` // ST_AsGeoJSON result
+	MaxIdleMin     *int      `db:"max_idle_min"`
+	MaxSpeedKMH    *float64  `db:"max_speed_kmh"`
+	CreatedAt      time.Time `db:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at"`
+	Active         int       `db:"active"`
+}
+
+func (rs *TripRuleScan) ToTripRule() dto.TripRule {
+	rule := dto.TripRule{
+		ID:             rs.ID,
+		TripID:         rs.TripID,
+		CompanyID:      rs.CompanyID,
+		MaxDeviationKM: rs.MaxDeviationKM,
+		Route:          []dto.Point{},
+		MaxIdleMin:     rs.MaxIdleMin,
+		MaxSpeedKMH:    rs.MaxSpeedKMH,
+		CreatedAt:      rs.CreatedAt,
+		UpdatedAt:      rs.UpdatedAt,
+		Active:         rs.Active,
+	}
+
+	if rs.RouteJSON != nil {
+		var line struct {
+			Coordinates [][2]float64 `json:"coordinates"`
+		}
+		if err := json.Unmarshal([]byte(*rs.RouteJSON), &line); err == nil {
+			for _, c := range line.Coordinates {
+				rule.Route = append(rule.Route, dto.Point{Lng: c[0], Lat: c[1]})
+			}
+		}
+	}
+
+	return rule
+}
+
+type TripAlertScan struct {
+	ID             int64      `db:"id"`
+	UUID           string     `db:"uuid"`
+	TripID         int        `db:"trip_id"`
+	VehicleID      int        `db:"vehicle_id"`
+	DriverID       int        `db:"driver_id"`
+	GPSLogID       int64      `db:"gps_log_id"`
+	AlertType      string     `db:"alert_type"`
+	Value          float64    `db:"value"`
+	LimitValue     float64    `db:"limit_value"`
+	CoordinatesTxt string     `db:"coordinates_txt"` // ST_AsText result
+	AlertDt        time.Time  `db:"alert_dt"`
+	ResolvedDt     *time.Time `db:"resolved_dt"`
+	CreatedAt      time.Time  `db:"created_at"`
+}
+
+func (as *TripAlertScan) ToTripAlert() dto.TripAlert {
+	alert := dto.TripAlert{
+		ID:         as.ID,
+		UUID:       as.UUID,
+		TripID:     as.TripID,
+		VehicleID:  as.VehicleID,
+		DriverID:   as.DriverID,
+		GPSLogID:   as.GPSLogID,
+		AlertType:  as.AlertType,
+		Value:      as.Value,
+		LimitValue: as.LimitValue,
+		AlertDt:    as.AlertDt,
+		ResolvedDt: as.ResolvedDt,
+		CreatedAt:  as.CreatedAt,
+	}
+
+	if as.CoordinatesTxt != "" {
+		_ = alert.Coordinates.Scan(as.CoordinatesTxt)
+	}
+
+	return alert
+}
+
+// lineWKT builds a linestring in WKT, PostGIS expects "lng lat" pairs
+func lineWKT(points []dto.Point) string {
+	coords := make([]string, 0, len(points))
+	for _, p := range points {
+		coords = append(coords, fmt.Sprintf("%f %f", p.Lng, p.Lat))
+	}
+	return fmt.Sprintf("LINESTRING(%s)", strings.Join(coords, ", "))
+}
+
+func SaveTripRule(tripID, companyID int, input dto.TripRuleInput) (int, error) {
+	var route *string
+	if len(input.Route) > 0 {
+		if len(input.Route) < 2 {
+			return 0, fmt.Errorf("route requires at least 2 points")
+		}
+		wkt := lineWKT(input.Route)
+		route = &wkt
+	}
+
+	var id int
+	err := pgxscan.Get(context.Background(), db.DB, &id,
+		`INSERT INTO tbl_trip_rule (
+			trip_id, company_id, max_deviation_km, route, max_idle_min, max_speed_kmh, active
+		) VALUES ($1, $2, $3,
+		          CASE WHEN $4::text IS NULL THEN NULL ELSE ST_GeomFromText($4::text, 4326) END,
+		          $5, $6, COALESCE($7, 1))
+		ON CONFLICT (trip_id) DO UPDATE SET
+			company_id = EXCLUDED.company_id,
+			max_deviation_km = EXCLUDED.max_deviation_km,
+			route = EXCLUDED.route,
+			max_idle_min = EXCLUDED.max_idle_min,
+			max_speed_kmh = EXCLUDED.max_speed_kmh,
+			active = EXCLUDED.active,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING id`,
+		tripID, companyID, input.MaxDeviationKM, route, input.MaxIdleMin, input.MaxSpeedKMH, input.Active)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save trip rule: %w", err)
+	}
+
+	return id, nil
+}
+
+func GetTripRule(tripID int) (dto.TripRule, error) {
+	var scan TripRuleScan
+	err := pgxscan.Get(context.Background(), db.DB, &scan,
+		`SELECT id, trip_id, company_id, max_deviation_km, ST_AsGeoJSON(route) as route_json,
+		        max_idle_min, max_speed_kmh, created_at, updated_at, active
+		 FROM tbl_trip_rule WHERE trip_id = $1`,
+		tripID)
+	if err != nil {
+		return dto.TripRule{}, fmt.Errorf("failed to get trip rule: %w", err)
+	}
+	return scan.ToTripRule(), nil
+}
+
+func DeleteTripRule(tripID int) error {
+	result, err := db.DB.Exec(context.Background(),
+		`DELETE FROM tbl_trip_rule WHERE trip_id = $1`, tripID)
+	if err != nil {
+		return fmt.Errorf("failed to delete trip rule: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("trip rule not found")
+	}
+	return nil
+}
+
+func GetTripAlerts(query dto.TripAlertQuery) ([]dto.TripAlert, error) {
+	var conditions []string
+	var args []interface{}
+	argIndex := 1
+
+	if query.ScopeCompanyID != nil {
+		conditions = append(conditions, fmt.Sprintf("trip_id IN (SELECT t.id FROM tbl_trip t WHERE %s)",
+			tripScopeCondition("t.", argIndex)))
+		args = append(args, *query.ScopeCompanyID)
+		argIndex++
+	}
+
+	if query.TripID != nil {
+		conditions = append(conditions, fmt.Sprintf("trip_id = $%d", argIndex))
+		args = append(args, *query.TripID)
+		argIndex++
+	}
+
+	if query.OfferID != nil {
+		conditions = append(conditions, fmt.Sprintf(`trip_id IN (
+			SELECT trip_id FROM tbl_offer_trip
+			WHERE offer_id = $%d AND deleted = 0
+		)`, argIndex))
+		args = append(args, *query.OfferID)
+		argIndex++
+	}
+
+	if query.VehicleID != nil {
+		conditions = append(conditions, fmt.Sprintf("vehicle_id = $%d", argIndex))
+		args = append(args, *query.VehicleID)
+		argIndex++
+	}
+
+	if query.AlertType != nil {
+		conditions = append(conditions, fmt.Sprintf("alert_type = $%d", argIndex))
+		args = append(args, *query.AlertType)
+		argIndex++
+	}
+
+	if query.Open != nil {
+		if *query.Open {
+			conditions = append(conditions, "resolved_dt IS NULL")
+		} else {
+			conditions = append(conditions, "resolved_dt IS NOT NULL")
+		}
+	}
+
+	if query.From != nil {
+		conditions = append(conditions, fmt.Sprintf("alert_dt >= $%d", argIndex))
+		args = append(args, *query.From)
+		argIndex++
+	}
+
+	if query.To != nil {
+		conditions = append(conditions, fmt.Sprintf("alert_dt <= $%d", argIndex))
+		args = append(args, *query.To)
+		argIndex++
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	queryStr := fmt.Sprintf(`
+		SELECT id, uuid, trip_id, vehicle_id, driver_id, gps_log_id, alert_type,
+		       value, limit_value, ST_AsText(coordinates) as coordinates_txt,
+		       alert_dt, resolved_dt, created_at
+		FROM tbl_trip_alert
+		%s
+		ORDER BY alert_dt DESC, id DESC
+		LIMIT $%d OFFSET $%d`,
+		whereClause, argIndex, argIndex+1)
+
+	args = append(args, limit, query.Offset)
+
+	var scans []TripAlertScan
+	err := pgxscan.Select(context.Background(), db.DB, &scans, queryStr, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trip alerts: %w", err)
+	}
+
+	alerts := make([]dto.TripAlert, len(scans))
+	for i, scan := range scans {
+		alerts[i] = scan.ToTripAlert()
+	}
+
+	return alerts, nil
+}
+
+type tripRuleCheck struct {
+	TripID         int       `db:"trip_id"`
+	GPSLogID       int64     `db:"gps_log_id"`
+	VehicleID      int       `db:"vehicle_id"`
+	DriverID       int       `db:"driver_id"`
+	Speed          *float64  `db:"speed"`
+	CoordinatesTxt string    `db:"coordinates_txt"`
+	LogDt          time.Time `db:"log_dt"`
+	DeviationKM    *float64  `db:"deviation_km"`
+	MaxDeviationKM *float64  `db:"max_deviation_km"`
+	MaxIdleMin     *int      `db:"max_idle_min"`
+	MaxSpeedKMH    *float64  `db:"max_speed_kmh"`
+}
+
+// EvaluateTripRules checks freshly stored points against the rules of their
+// trips. An alert is raised when a rule is first broken and resolved by the
+// first point that satisfies it again, so a long violation is a single alert.
+func EvaluateTripRules(logIDs []int64) ([]dto.TripAlert, error) {
+	if len(logIDs) == 0 {
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var checks []tripRuleCheck
+	err = pgxscan.Select(ctx, tx, &checks,
+		`SELECT r.trip_id, l.id AS gps_log_id, l.vehicle_id, l.driver_id, l.speed::float8 AS speed,
+		        ST_AsText(l.coordinates) AS coordinates_txt, l.log_dt,
+		        CASE WHEN r.max_deviation_km IS NULL THEN NULL
+		             ELSE ST_Distance(l.coordinates::geography,
+		                  COALESCE(r.route, ST_MakeLine(t.from_location, t.to_location))::geography) / 1000
+		        END AS deviation_km,
+		        r.max_deviation_km::float8 AS max_deviation_km, r.max_idle_min, r.max_speed_kmh::float8 AS max_speed_kmh
+		 FROM tbl_gps_log l
+		 JOIN tbl_trip t ON t.id = l.trip_id AND t.status = 'active' AND t.deleted = 0
+		 JOIN tbl_trip_rule r ON r.trip_id = t.id AND r.active = 1
+		 WHERE l.id = ANY($1)
+		 ORDER BY r.trip_id, l.log_dt, l.id`,
+		logIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate trip rules: %w", err)
+	}
+
+	if len(checks) == 0 {
+		return nil, nil
+	}
+
+	tripIDs := make([]int, 0, len(checks))
+	for _, check := range checks {
+		tripIDs = append(tripIDs, check.TripID)
+	}
+
+	var openAlerts []struct {
+		ID        int64  `db:"id"`
+		TripID    int    `db:"trip_id"`
+		AlertType string `db:"alert_type"`
+	}
+	err = pgxscan.Select(ctx, tx, &openAlerts,
+		`SELECT id, trip_id, alert_type FROM tbl_trip_alert
+		 WHERE trip_id = ANY($1) AND resolved_dt IS NULL`,
+		tripIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open trip alerts: %w", err)
+	}
+
+	type alertKey struct {
+		tripID    int
+		alertType string
+	}
+	open := make(map[alertKey]int64, len(openAlerts))
+	for _, a := range openAlerts {
+		open[alertKey{a.TripID, a.AlertType}] = a.ID
+	}
+
+	var alerts []dto.TripAlert
+	apply := func(check tripRuleCheck, alertType string, broken bool, value, limit float64) error {
+		key := alertKey{check.TripID, alertType}
+		openID, isOpen := open[key]
+
+		if !broken {
+			if isOpen {
+				_, err := tx.Exec(ctx,
+					`UPDATE tbl_trip_alert SET resolved_dt = $2 WHERE id = $1`, openID, check.LogDt)
+				if err != nil {
+					return fmt.Errorf("failed to resolve trip alert: %w", err)
+				}
+				delete(open, key)
+			}
+			return nil
+		}
+		if isOpen {
+			return nil
+		}
+
+		alert := dto.TripAlert{
+			TripID:     check.TripID,
+			VehicleID:  check.VehicleID,
+			DriverID:   check.DriverID,
+			GPSLogID:   check.GPSLogID,
+			AlertType:  alertType,
+			Value:      value,
+			LimitValue: limit,
+			AlertDt:    check.LogDt,
+		}
+		_ = alert.Coordinates.Scan(check.CoordinatesTxt)
+
+		err := tx.QueryRow(ctx,
+			`INSERT INTO tbl_trip_alert (
+				trip_id, vehicle_id, driver_id, gps_log_id, alert_type,
+				value, limit_value, coordinates, alert_dt
+			) VALUES ($1, $2, $3, $4, $5, ROUND($6::numeric, 2), $7, $8, $9)
+			RETURNING id, uuid, created_at`,
+			alert.TripID, alert.VehicleID, alert.DriverID, alert.GPSLogID, alert.AlertType,
+			alert.Value, alert.LimitValue, alert.Coordinates, alert.AlertDt,
+		).Scan(&alert.ID, &alert.UUID, &alert.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create trip alert: %w", err)
+		}
+
+		open[key] = alert.ID
+		alerts = append(alerts, alert)
+		return nil
+	}
+
+	for i, check := range checks {
+		if check.MaxDeviationKM != nil && check.DeviationKM != nil {
+			err = apply(check, dto.TripAlertDeviation,
+				*check.DeviationKM > *check.MaxDeviationKM, *check.DeviationKM, *check.MaxDeviationKM)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if check.MaxSpeedKMH != nil && check.Speed != nil {
+			err = apply(check, dto.TripAlertSpeed,
+				*check.Speed > *check.MaxSpeedKMH, *check.Speed, *check.MaxSpeedKMH)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// idle time only needs the latest point of the trip in the batch
+		last := i == len(checks)-1 || checks[i+1].TripID != check.TripID
+		if check.MaxIdleMin != nil && last {
+			idleMin, err := tripIdleMinutes(ctx, tx, check)
+			if err != nil {
+				return nil, err
+			}
+			err = apply(check, dto.TripAlertIdle,
+				idleMin > float64(*check.MaxIdleMin), idleMin, float64(*check.MaxIdleMin))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return alerts, nil
+}
+
+// tripIdleMinutes is how long the vehicle has stayed within idleRadiusM of the
+// point, counted from the first fix after it last moved away
+func tripIdleMinutes(ctx context.Context, tx pgxscan.Querier, check tripRuleCheck) (float64, error) {
+	var idleSince time.Time
+	err := pgxscan.Get(ctx, tx, &idleSince,
+		`SELECT COALESCE(MIN(log_dt), $2) FROM tbl_gps_log
+		 WHERE trip_id = $1 AND log_dt <= $2
+		   AND log_dt > COALESCE((
+		       SELECT MAX(log_dt) FROM tbl_gps_log
+		       WHERE trip_id = $1 AND log_dt < $2
+		         AND ST_DistanceSphere(coordinates, ST_GeomFromText($3::text, 4326)) > $4
+		   ), '-infinity'::timestamp)`,
+		check.TripID, check.LogDt, check.CoordinatesTxt, idleRadiusM)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get trip idle time: %w", err)
+	}
+	return check.LogDt.Sub(idleSince).Minutes(), nil
+}
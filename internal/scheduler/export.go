@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"texApi/internal/services"
+)
+
+// ExportScheduler resumes the queued list exports at startup and picks up
+// any the workers missed
+type ExportScheduler struct {
+	ticker   *time.Ticker
+	quit     chan bool
+	interval time.Duration
+}
+
+func NewExportScheduler() *ExportScheduler {
+	return &ExportScheduler{
+		quit:     make(chan bool),
+		interval: time.Minute,
+	}
+}
+
+func (s *ExportScheduler) Start() error {
+	s.ticker = time.NewTicker(s.interval)
+
+	go func() {
+		// the first run requeues jobs that a restart cut off
+		services.RunExportJobs()
+		for {
+			select {
+			case <-s.ticker.C:
+				services.RunExportJobs()
+			case <-s.quit:
+				log.Println("Export scheduler stopped")
+				return
+			}
+		}
+	}()
+
+	log.Printf("Export scheduler started with interval: %v", s.interval)
+	return nil
+}
+
+func (s *ExportScheduler) Stop() {
+	log.Println("Stopping Export Scheduler...")
+	if s.ticker != nil {
+		s.ticker.Stop()
+	}
+	s.quit <- true
+}
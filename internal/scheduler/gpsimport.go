@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"texApi/internal/services"
+)
+
+// GPSImportScheduler resumes the queued background GPS imports at startup and
+// picks up any the importers missed
+type GPSImportScheduler struct {
+	ticker   *time.Ticker
+	quit     chan bool
+	interval time.Duration
+}
+
+func NewGPSImportScheduler() *GPSImportScheduler {
+	return &GPSImportScheduler{
+		quit:     make(chan bool),
+		interval: time.Minute,
+	}
+}
+
+func (s *GPSImportScheduler) Start() error {
+	s.ticker = time.NewTicker(s.interval)
+
+	go func() {
+		// the first run requeues imports that a restart cut off
+		services.RunGPSImports()
+		for {
+			select {
+			case <-s.ticker.C:
+				services.RunGPSImports()
+			case <-s.quit:
+				log.Println("GPS import scheduler stopped")
+				return
+			}
+		}
+	}()
+
+	log.Printf("GPS import scheduler started with interval: %v", s.interval)
+	return nil
+}
+
+func (s *GPSImportScheduler) Stop() {
+	log.Println("Stopping GPS Import Scheduler...")
+	if s.ticker != nil {
+		s.ticker.Stop()
+	}
+	s.quit <- true
+}
@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"texApi/config"
+	"texApi/internal/services"
+)
+
+type GPSRetentionScheduler struct {
+	ticker   *time.Ticker
+	quit     chan bool
+	interval time.Duration
+}
+
+func NewGPSRetentionScheduler() *GPSRetentionScheduler {
+	return &GPSRetentionScheduler{
+		quit: make(chan bool),
+	}
+}
+
+func (s *GPSRetentionScheduler) Start() error {
+	if !config.ENV.GPS_RETENTION_ENABLED {
+		log.Println("GPS retention scheduler is disabled")
+		return nil
+	}
+
+	s.interval = time.Duration(config.ENV.GPS_RETENTION_INTERVAL_HOURS) * time.Hour
+	if s.interval <= 0 {
+		s.interval = 24 * time.Hour
+	}
+
+	s.ticker = time.NewTicker(s.interval)
+
+	go func() {
+		// the first run also creates partitions for the coming months
+		s.run()
+		for {
+			select {
+			case <-s.ticker.C:
+				s.run()
+			case <-s.quit:
+				log.Println("GPS retention scheduler stopped")
+				return
+			}
+		}
+	}()
+
+	log.Printf("GPS retention scheduler started with interval: %v", s.interval)
+	return nil
+}
+
+func (s *GPSRetentionScheduler) Stop() {
+	if s.ticker == nil {
+		return
+	}
+	log.Println("Stopping GPS Retention Scheduler...")
+	s.ticker.Stop()
+	s.quit <- true
+}
+
+func (s *GPSRetentionScheduler) run() {
+	if _, err := services.RunGPSRetention(); err != nil {
+		log.Printf("Error in GPS retention: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"texApi/config"
+	"texApi/internal/services"
+)
+
+// OfferExpiryScheduler archives expired offers and declines responses with
+// expired terms hourly
+type OfferExpiryScheduler struct {
+	ticker   *time.Ticker
+	quit     chan bool
+	interval time.Duration
+}
+
+func NewOfferExpiryScheduler() *OfferExpiryScheduler {
+	return &OfferExpiryScheduler{
+		quit:     make(chan bool),
+		interval: time.Hour,
+	}
+}
+
+func (s *OfferExpiryScheduler) Start() error {
+	if !config.ENV.OFFER_EXPIRY_ENABLED {
+		log.Println("Offer expiry scheduler is disabled")
+		return nil
+	}
+
+	s.ticker = time.NewTicker(s.interval)
+
+	go func() {
+		s.run()
+		for {
+			select {
+			case <-s.ticker.C:
+				s.run()
+			case <-s.quit:
+				log.Println("Offer expiry scheduler stopped")
+				return
+			}
+		}
+	}()
+
+	log.Printf("Offer expiry scheduler started with interval: %v", s.interval)
+	return nil
+}
+
+func (s *OfferExpiryScheduler) Stop() {
+	if s.ticker == nil {
+		return
+	}
+	log.Println("Stopping Offer Expiry Scheduler...")
+	s.ticker.Stop()
+	s.quit <- true
+}
+
+func (s *OfferExpiryScheduler) run() {
+	if err := services.RunOfferExpiry(time.Now()); err != nil {
+		log.Printf("Error in offer expiry: %v", err)
+	}
+	if err := services.RunOfferCounterExpiry(time.Now()); err != nil {
+		log.Printf("Error in offer counter expiry: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"texApi/config"
+	"texApi/internal/services"
+)
+
+// OfferRecurrenceScheduler creates the offers of recurring templates hourly
+type OfferRecurrenceScheduler struct {
+	ticker   *time.Ticker
+	quit     chan bool
+	interval time.Duration
+}
+
+func NewOfferRecurrenceScheduler() *OfferRecurrenceScheduler {
+	return &OfferRecurrenceScheduler{
+		quit:     make(chan bool),
+		interval: time.Hour,
+	}
+}
+
+func (s *OfferRecurrenceScheduler) Start() error {
+	if !config.ENV.OFFER_RECURRENCE_ENABLED {
+		log.Println("Offer recurrence scheduler is disabled")
+		return nil
+	}
+
+	s.ticker = time.NewTicker(s.interval)
+
+	go func() {
+		s.run()
+		for {
+			select {
+			case <-s.ticker.C:
+				s.run()
+			case <-s.quit:
+				log.Println("Offer recurrence scheduler stopped")
+				return
+			}
+		}
+	}()
+
+	log.Printf("Offer recurrence scheduler started with interval: %v", s.interval)
+	return nil
+}
+
+func (s *OfferRecurrenceScheduler) Stop() {
+	if s.ticker == nil {
+		return
+	}
+	log.Println("Stopping Offer Recurrence Scheduler...")
+	s.ticker.Stop()
+	s.quit <- true
+}
+
+func (s *OfferRecurrenceScheduler) run() {
+	if err := services.RunOfferRecurrence(time.Now()); err != nil {
+		log.Printf("Error in offer recurrence: %v", err)
+	}
+}
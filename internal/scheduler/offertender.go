@@ -0,0 +1,63 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"texApi/config"
+	"texApi/internal/services"
+)
+
+// OfferTenderScheduler closes and awards tenders past their deadline every minute
+type OfferTenderScheduler struct {
+	ticker   *time.Ticker
+	quit     chan bool
+	interval time.Duration
+}
+
+func NewOfferTenderScheduler() *OfferTenderScheduler {
+	return &OfferTenderScheduler{
+		quit:     make(chan bool),
+		interval: time.Minute,
+	}
+}
+
+func (s *OfferTenderScheduler) Start() error {
+	if !config.ENV.OFFER_TENDER_ENABLED {
+		log.Println("Offer tender scheduler is disabled")
+		return nil
+	}
+
+	s.ticker = time.NewTicker(s.interval)
+
+	go func() {
+		s.run()
+		for {
+			select {
+			case <-s.ticker.C:
+				s.run()
+			case <-s.quit:
+				log.Println("Offer tender scheduler stopped")
+				return
+			}
+		}
+	}()
+
+	log.Printf("Offer tender scheduler started with interval: %v", s.interval)
+	return nil
+}
+
+func (s *OfferTenderScheduler) Stop() {
+	if s.ticker == nil {
+		return
+	}
+	log.Println("Stopping Offer Tender Scheduler...")
+	s.ticker.Stop()
+	s.quit <- true
+}
+
+func (s *OfferTenderScheduler) run() {
+	if err := services.RunTenderClose(time.Now()); err != nil {
+		log.Printf("Error in tender close: %v", err)
+	}
+}
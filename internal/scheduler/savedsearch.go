@@ -0,0 +1,63 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"texApi/config"
+	"texApi/internal/services"
+)
+
+// SavedSearchDigestScheduler checks hourly for daily saved search digests
+type SavedSearchDigestScheduler struct {
+	ticker   *time.Ticker
+	quit     chan bool
+	interval time.Duration
+}
+
+func NewSavedSearchDigestScheduler() *SavedSearchDigestScheduler {
+	return &SavedSearchDigestScheduler{
+		quit:     make(chan bool),
+		interval: time.Hour,
+	}
+}
+
+func (s *SavedSearchDigestScheduler) Start() error {
+	if !config.ENV.SAVED_SEARCH_DIGEST_ENABLED {
+		log.Println("Saved search digest scheduler is disabled")
+		return nil
+	}
+
+	s.ticker = time.NewTicker(s.interval)
+
+	go func() {
+		s.run()
+		for {
+			select {
+			case <-s.ticker.C:
+				s.run()
+			case <-s.quit:
+				log.Println("Saved search digest scheduler stopped")
+				return
+			}
+		}
+	}()
+
+	log.Printf("Saved search digest scheduler started with interval: %v", s.interval)
+	return nil
+}
+
+func (s *SavedSearchDigestScheduler) Stop() {
+	if s.ticker == nil {
+		return
+	}
+	log.Println("Stopping Saved Search Digest Scheduler...")
+	s.ticker.Stop()
+	s.quit <- true
+}
+
+func (s *SavedSearchDigestScheduler) run() {
+	if err := services.RunSavedSearchDigest(time.Now()); err != nil {
+		log.Printf("Error in saved search digest: %v", err)
+	}
+}
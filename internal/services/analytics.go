@@ -307,9 +307,9 @@ func GenerateAnalytics() error {
 	analytics.LastOfferID = getLastOfferID()
 	analytics.LastCompletedOfferID = getLastCompletedOfferID()
 	analytics.OfferAll, summary.OfferAllIDs = getOfferCount("active") // adjust exclude state if needed
-	analytics.OfferActive, summary.OfferActiveIDs = getOfferCountByState("active", "enabled", "working")
+	analytics.OfferActive, summary.OfferActiveIDs = getOfferCountByState("active", "assigned", "in_transit", "delivered")
 	analytics.OfferPending, summary.OfferPendingIDs = getOfferCountByState("pending")
-	analytics.OfferCompleted, summary.OfferCompletedIDs = getOfferCountByState("completed", "archived")
+	analytics.OfferCompleted, summary.OfferCompletedIDs = getOfferCountByState("completed")
 	analytics.OfferNoResponse, summary.OfferNoResponseIDs = getOffersWithoutResponse()
 
 	// Additional metrics
@@ -436,7 +436,7 @@ func getOfferCount(excludeState string) (int, []int) {
 		SELECT id
 		FROM tbl_offer 
 		WHERE deleted = 0 
-		AND offer_state NOT IN ('deleted', 'pending', 'disabled')
+		AND offer_state NOT IN ('draft', 'pending', 'cancelled')
 	`
 	rows, _ := database.DB.Query(context.Background(), query)
 	defer rows.Close()
@@ -489,7 +489,7 @@ func getOffersWithoutResponse() (int, []int) {
 
 func getLastCompletedOfferID() int {
 	var id int
-	query := "SELECT COALESCE(MAX(id), 0) FROM tbl_offer WHERE deleted = 0 AND offer_state IN ('completed', 'archived')"
+	query := "SELECT COALESCE(MAX(id), 0) FROM tbl_offer WHERE deleted = 0 AND offer_state = 'completed'"
 	database.DB.QueryRow(context.Background(), query).Scan(&id)
 	return id
 }
@@ -520,7 +520,7 @@ func getActiveCompanies() (int, []int) {
 	query := `
         SELECT DISTINCT company_id
         FROM tbl_offer
-        WHERE deleted = 0 AND offer_state IN ('active','working')`
+        WHERE deleted = 0 AND offer_state IN ('active', 'assigned', 'in_transit', 'delivered')`
 	rows, _ := database.DB.Query(context.Background(), query)
 	defer rows.Close()
 
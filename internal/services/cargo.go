@@ -2,19 +2,124 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	db "texApi/database"
 	"texApi/internal/dto"
 	"texApi/internal/queries"
+	"texApi/internal/repo"
 	"texApi/pkg/utils"
 
 	"github.com/georgysavva/scany/v2/pgxscan"
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	cargoMaxDimensionCM = 5000 // 50 m, oversized cargo included
+	cargoMaxStack       = 10
+	cargoMinTemp        = -40.0
+	cargoMaxTemp        = 40.0
+)
+
+// adrClasses are the dangerous goods classes and divisions of ADR
+var adrClasses = map[string]bool{
+	"1": true, "1.1": true, "1.2": true, "1.3": true, "1.4": true, "1.5": true, "1.6": true,
+	"2": true, "2.1": true, "2.2": true, "2.3": true, "3": true,
+	"4.1": true, "4.2": true, "4.3": true, "5.1": true, "5.2": true,
+	"6.1": true, "6.2": true, "7": true, "8": true, "9": true,
+}
+
+var unNumberPattern = regexp.MustCompile(`^[0-9]{4}$`)
+
+// cargoMeasures are the cargo fields checked by validateCargo, nil fields are
+// not changed by the request and are skipped
+type cargoMeasures struct {
+	Qty, Weight                 *int
+	WeightType                  *string
+	LengthCM, WidthCM, HeightCM *float64
+	MaxStack                    *int
+	TempMin, TempMax            *float64
+	ADRClass, UNNumber          *string
+}
+
+func validateCargo(m cargoMeasures) error {
+	if m.Qty != nil && *m.Qty < 0 {
+		return errors.New("qty can not be negative")
+	}
+	if m.Weight != nil && *m.Weight < 0 {
+		return errors.New("weight can not be negative")
+	}
+	if m.WeightType != nil {
+		if _, ok := repo.WeightUnitKG(*m.WeightType); !ok {
+			return fmt.Errorf("unknown weight_type %q", *m.WeightType)
+		}
+	}
+
+	dimensions := map[string]*float64{"length_cm": m.LengthCM, "width_cm": m.WidthCM, "height_cm": m.HeightCM}
+	set := 0
+	for name, value := range dimensions {
+		if value == nil {
+			continue
+		}
+		if *value < 0 || *value > cargoMaxDimensionCM {
+			return fmt.Errorf("%s must be between 0 and %d", name, cargoMaxDimensionCM)
+		}
+		if *value > 0 {
+			set++
+		}
+	}
+	// the volume and loading meters need all three dimensions
+	if m.LengthCM != nil && m.WidthCM != nil && m.HeightCM != nil && set != 0 && set != 3 {
+		return errors.New("length_cm, width_cm and height_cm must be given together")
+	}
+
+	if m.MaxStack != nil && (*m.MaxStack < 1 || *m.MaxStack > cargoMaxStack) {
+		return fmt.Errorf("max_stack must be between 1 and %d", cargoMaxStack)
+	}
+
+	for name, value := range map[string]*float64{"temp_min": m.TempMin, "temp_max": m.TempMax} {
+		if value != nil && (*value < cargoMinTemp || *value > cargoMaxTemp) {
+			return fmt.Errorf("%s must be between %.0f and %.0f", name, cargoMinTemp, cargoMaxTemp)
+		}
+	}
+	if m.TempMin != nil && m.TempMax != nil && *m.TempMin > *m.TempMax {
+		return errors.New("temp_min can not be above temp_max")
+	}
+
+	if m.ADRClass != nil && *m.ADRClass != "" && !adrClasses[*m.ADRClass] {
+		return fmt.Errorf("unknown adr_class %q", *m.ADRClass)
+	}
+	if m.UNNumber != nil && *m.UNNumber != "" {
+		if !unNumberPattern.MatchString(*m.UNNumber) {
+			return errors.New("un_number must be 4 digits")
+		}
+		if m.ADRClass != nil && *m.ADRClass == "" {
+			return errors.New("un_number needs an adr_class")
+		}
+	}
+	return nil
+}
+
+// prepareCargo fills the defaults of a new cargo and validates it
+func prepareCargo(cargo *dto.Cargo) error {
+	if cargo.WeightType == "" {
+		cargo.WeightType = "kg"
+	}
+	if cargo.MaxStack == 0 {
+		cargo.MaxStack = 1
+	}
+	return validateCargo(cargoMeasures{
+		Qty: &cargo.Qty, Weight: &cargo.Weight, WeightType: &cargo.WeightType,
+		LengthCM: &cargo.LengthCM, WidthCM: &cargo.WidthCM, HeightCM: &cargo.HeightCM,
+		MaxStack: &cargo.MaxStack, TempMin: cargo.TempMin, TempMax: cargo.TempMax,
+		ADRClass: &cargo.ADRClass, UNNumber: &cargo.UNNumber,
+	})
+}
+
 func GetCargoList(ctx *gin.Context) {
 	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
 	perPage, _ := strconv.Atoi(ctx.DefaultQuery("per_page", "10"))
@@ -83,7 +188,9 @@ func GetCargo(ctx *gin.Context) {
 		&cargo.VehicleTypeID, &cargo.PackagingTypeID, &cargo.GPS, &cargo.Photo1URL,
 		&cargo.Photo2URL, &cargo.Photo3URL, &cargo.Docs1URL, &cargo.Docs2URL,
 		&cargo.Docs3URL, &cargo.Note, &cargo.CreatedAt, &cargo.UpdatedAt,
-		&cargo.Active, &cargo.Deleted,
+		&cargo.Active, &cargo.Deleted, &cargo.LengthCM, &cargo.WidthCM, &cargo.HeightCM,
+		&cargo.MaxStack, &cargo.TempMin, &cargo.TempMax, &cargo.ADRClass, &cargo.UNNumber,
+		&cargo.VolumeM3, &cargo.LoadingMeters, &cargo.WeightKG,
 	)
 
 	if err != nil {
@@ -107,6 +214,11 @@ func CreateCargo(ctx *gin.Context) {
 		cargo.CompanyID = ctx.MustGet("companyID").(int)
 	}
 
+	if err := prepareCargo(&cargo); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid cargo", err.Error()))
+		return
+	}
+
 	var id int
 	err := db.DB.QueryRow(
 		context.Background(),
@@ -115,6 +227,8 @@ func CreateCargo(ctx *gin.Context) {
 		cargo.Weight, cargo.Meta, cargo.Meta2, cargo.Meta3, cargo.VehicleTypeID,
 		cargo.PackagingTypeID, cargo.GPS, cargo.Photo1URL, cargo.Photo2URL,
 		cargo.Photo3URL, cargo.Docs1URL, cargo.Docs2URL, cargo.Docs3URL, cargo.Note, cargo.WeightType,
+		cargo.LengthCM, cargo.WidthCM, cargo.HeightCM, cargo.MaxStack, cargo.TempMin, cargo.TempMax,
+		cargo.ADRClass, cargo.UNNumber,
 	).Scan(&id)
 
 	if err != nil {
@@ -134,6 +248,17 @@ func UpdateCargo(ctx *gin.Context) {
 		return
 	}
 
+	err := validateCargo(cargoMeasures{
+		Qty: cargo.Qty, Weight: cargo.Weight, WeightType: cargo.WeightType,
+		LengthCM: cargo.LengthCM, WidthCM: cargo.WidthCM, HeightCM: cargo.HeightCM,
+		MaxStack: cargo.MaxStack, TempMin: cargo.TempMin, TempMax: cargo.TempMax,
+		ADRClass: cargo.ADRClass, UNNumber: cargo.UNNumber,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid cargo", err.Error()))
+		return
+	}
+
 	stmt := queries.UpdateCargo
 
 	// TODO: only admin can make active or restore from deleted
@@ -150,6 +275,8 @@ func UpdateCargo(ctx *gin.Context) {
 		cargo.PackagingTypeID, cargo.GPS, cargo.Photo1URL, cargo.Photo2URL,
 		cargo.Photo3URL, cargo.Docs1URL, cargo.Docs2URL, cargo.Docs3URL, cargo.Note,
 		cargo.Active, cargo.Deleted, cargo.WeightType,
+		cargo.LengthCM, cargo.WidthCM, cargo.HeightCM, cargo.MaxStack, cargo.TempMin, cargo.TempMax,
+		cargo.ADRClass, cargo.UNNumber,
 	)
 
 	if err != nil {
@@ -204,6 +331,7 @@ func GetDetailedCargoList(ctx *gin.Context) {
 
 	validOrderColumns := map[string]bool{
 		"id": true, "name": true, "qty": true, "weight": true,
+		"weight_kg": true, "volume_m3": true, "loading_meters": true,
 		"created_at": true, "updated_at": true,
 	}
 
@@ -271,6 +399,8 @@ func GetDetailedCargoList(ctx *gin.Context) {
 		"packaging_type_id": ctx.Query("packaging_type_id"),
 		"weight_type":       ctx.Query("weight_type"),
 		"gps":               ctx.Query("gps"),
+		"adr_class":         ctx.Query("adr_class"),
+		"un_number":         ctx.Query("un_number"),
 	}
 
 	for key, value := range filters {
@@ -304,6 +434,50 @@ func GetDetailedCargoList(ctx *gin.Context) {
 		}
 	}
 
+	// the measures are decimals, weight_kg is the weight in any weight_type
+	measureRanges := map[string]struct {
+		min string
+		max string
+	}{
+		"weight_kg":      {ctx.Query("min_weight_kg"), ctx.Query("max_weight_kg")},
+		"volume_m3":      {ctx.Query("min_volume_m3"), ctx.Query("max_volume_m3")},
+		"loading_meters": {ctx.Query("min_loading_meters"), ctx.Query("max_loading_meters")},
+	}
+
+	for field, ranges := range measureRanges {
+		if ranges.min != "" {
+			whereClauses = append(whereClauses, fmt.Sprintf("c.%s >= $%d", field, argCounter))
+			minVal, _ := strconv.ParseFloat(ranges.min, 64)
+			args = append(args, minVal)
+			argCounter++
+		}
+		if ranges.max != "" {
+			whereClauses = append(whereClauses, fmt.Sprintf("c.%s <= $%d", field, argCounter))
+			maxVal, _ := strconv.ParseFloat(ranges.max, 64)
+			args = append(args, maxVal)
+			argCounter++
+		}
+	}
+
+	switch ctx.Query("adr") {
+	case "1":
+		whereClauses = append(whereClauses, "c.adr_class != ''")
+	case "0":
+		whereClauses = append(whereClauses, "c.adr_class = ''")
+	}
+	switch ctx.Query("temperature_controlled") {
+	case "1":
+		whereClauses = append(whereClauses, "(c.temp_min IS NOT NULL OR c.temp_max IS NOT NULL)")
+	case "0":
+		whereClauses = append(whereClauses, "c.temp_min IS NULL AND c.temp_max IS NULL")
+	}
+	switch ctx.Query("stackable") {
+	case "1":
+		whereClauses = append(whereClauses, "c.max_stack > 1")
+	case "0":
+		whereClauses = append(whereClauses, "c.max_stack = 1")
+	}
+
 	searchTerm := ctx.Query("search")
 	if searchTerm != "" {
 		searchClause := fmt.Sprintf(`(
@@ -321,8 +495,14 @@ func GetDetailedCargoList(ctx *gin.Context) {
 		query += " WHERE " + strings.Join(whereClauses, " AND ")
 	}
 
-	query += fmt.Sprintf(" ORDER BY c.%s %s LIMIT $%d OFFSET $%d",
-		orderBy, orderDir, argCounter, argCounter+1)
+	query += fmt.Sprintf(" ORDER BY c.%s %s", orderBy, orderDir)
+
+	if ctx.Query("format") != "" {
+		exportList(ctx, exportCargo, query, args)
+		return
+	}
+
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argCounter, argCounter+1)
 	args = append(args, perPage, offset)
 
 	var cargos []dto.CargoDetailed
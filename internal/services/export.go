@@ -0,0 +1,588 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"texApi/config"
+	db "texApi/database"
+	"texApi/internal/dto"
+	"texApi/internal/firebasePush"
+	"texApi/internal/repo"
+	"texApi/pkg/spreadsheet"
+	"texApi/pkg/utils"
+)
+
+const (
+	exportOffers         = "offers"
+	exportMyOffers       = "my_offers"
+	exportCargo          = "cargo"
+	exportOfferResponses = "offer_responses"
+)
+
+var exportLangs = []string{"en", "ru", "tk"}
+
+// exportColumn is a column of an exported list. expr reads the row x of the
+// list query, {lang} is replaced by the export language.
+type exportColumn struct {
+	label   string
+	expr    string
+	numeric bool
+}
+
+func exportDate(column string) string {
+	return fmt.Sprintf("to_char(x.%s, 'YYYY-MM-DD')", column)
+}
+
+func exportPlace(side string) string {
+	return fmt.Sprintf("concat_ws(', ', NULLIF(x.%[1]s_country, ''), NULLIF(x.%[1]s_region, ''), NULLIF(x.%[1]s_address, ''))", side)
+}
+
+var offerExportColumns = []exportColumn{
+	{label: "id", expr: "x.id", numeric: true},
+	{label: "offer_state", expr: "x.offer_state"},
+	{label: "offer_role", expr: "x.offer_role"},
+	{label: "from", expr: exportPlace("from")},
+	{label: "to", expr: exportPlace("to")},
+	{label: "distance", expr: "x.distance", numeric: true},
+	{label: "validity_start", expr: exportDate("validity_start")},
+	{label: "validity_end", expr: exportDate("validity_end")},
+	{label: "delivery_start", expr: exportDate("delivery_start")},
+	{label: "delivery_end", expr: exportDate("delivery_end")},
+	{label: "cost_per_km", expr: "x.cost_per_km", numeric: true},
+	{label: "offer_price", expr: "x.offer_price", numeric: true},
+	{label: "total_price", expr: "x.total_price", numeric: true},
+	{label: "currency", expr: "x.currency"},
+	{label: "payment_method", expr: "x.payment_method"},
+	{label: "note", expr: "x.note"},
+	{label: "created_at", expr: "to_char(x.created_at, 'YYYY-MM-DD HH24:MI')"},
+}
+
+var exportLists = map[string][]exportColumn{
+	exportOffers: offerExportColumns,
+	exportMyOffers: append(append([]exportColumn{}, offerExportColumns...),
+		exportColumn{label: "cargo_name", expr: "x.cargo_json->>'name'"},
+		exportColumn{label: "driver", expr: "concat_ws(' ', x.driver_json->>'first_name', x.driver_json->>'last_name')"},
+		exportColumn{label: "vehicle", expr: "x.vehicle_json->>'numberplate'"},
+		exportColumn{label: "response_count", expr: "x.response_count", numeric: true},
+	),
+	exportCargo: {
+		{label: "id", expr: "x.id", numeric: true},
+		{label: "name", expr: "x.name"},
+		{label: "company", expr: "x.company->>'company_name'"},
+		{label: "description", expr: "x.description"},
+		{label: "qty", expr: "x.qty", numeric: true},
+		{label: "weight", expr: "x.weight", numeric: true},
+		{label: "weight_type", expr: "x.weight_type"},
+		{label: "weight_kg", expr: "x.weight_kg", numeric: true},
+		{label: "volume_m3", expr: "x.volume_m3", numeric: true},
+		{label: "loading_meters", expr: "x.loading_meters", numeric: true},
+		{label: "adr_class", expr: "x.adr_class"},
+		{label: "un_number", expr: "x.un_number"},
+		{label: "vehicle_type", expr: "x.vehicle_type->>'title_{lang}'"},
+		{label: "packaging_type", expr: "x.packaging_type->>'name_{lang}'"},
+		{label: "note", expr: "x.note"},
+		{label: "created_at", expr: "to_char(x.created_at, 'YYYY-MM-DD HH24:MI')"},
+	},
+	exportOfferResponses: {
+		{label: "id", expr: "x.id", numeric: true},
+		{label: "offer_id", expr: "x.offer_id", numeric: true},
+		{label: "route", expr: "concat_ws(' - ', x.offer->>'from_country', x.offer->>'to_country')"},
+		{label: "company", expr: "x.company->>'company_name'"},
+		{label: "to_company", expr: "x.to_company->>'company_name'"},
+		{label: "state", expr: "x.state"},
+		{label: "bid_price", expr: "x.bid_price", numeric: true},
+		{label: "title", expr: "x.title"},
+		{label: "note", expr: "x.note"},
+		{label: "reason", expr: "x.reason"},
+		{label: "created_at", expr: "to_char(x.created_at, 'YYYY-MM-DD HH24:MI')"},
+	},
+}
+
+// exportLabels are the list titles and column headers in en, ru and tk
+var exportLabels = map[string]map[string]string{
+	exportOffers:         {"en": "Offers", "ru": "Заявки", "tk": "Teklipler"},
+	exportMyOffers:       {"en": "My offers", "ru": "Мои заявки", "tk": "Meniň tekliplerim"},
+	exportCargo:          {"en": "Cargo", "ru": "Грузы", "tk": "Ýükler"},
+	exportOfferResponses: {"en": "Offer responses", "ru": "Отклики на заявки", "tk": "Teklip jogaplary"},
+
+	"id":             {"en": "ID", "ru": "ID", "tk": "ID"},
+	"offer_id":       {"en": "Offer ID", "ru": "ID заявки", "tk": "Teklip ID"},
+	"offer_state":    {"en": "State", "ru": "Статус", "tk": "Ýagdaýy"},
+	"offer_role":     {"en": "Role", "ru": "Роль", "tk": "Roly"},
+	"from":           {"en": "From", "ru": "Откуда", "tk": "Nireden"},
+	"to":             {"en": "To", "ru": "Куда", "tk": "Nirä"},
+	"route":          {"en": "Route", "ru": "Маршрут", "tk": "Ugur"},
+	"distance":       {"en": "Distance, km", "ru": "Расстояние, км", "tk": "Aralyk, km"},
+	"validity_start": {"en": "Valid from", "ru": "Действует с", "tk": "Möhletiň başy"},
+	"validity_end":   {"en": "Valid until", "ru": "Действует до", "tk": "Möhletiň soňy"},
+	"delivery_start": {"en": "Delivery from", "ru": "Доставка с", "tk": "Eltip bermegiň başy"},
+	"delivery_end":   {"en": "Delivery until", "ru": "Доставка до", "tk": "Eltip bermegiň soňy"},
+	"cost_per_km":    {"en": "Cost per km", "ru": "Цена за км", "tk": "1 km bahasy"},
+	"offer_price":    {"en": "Price", "ru": "Цена", "tk": "Bahasy"},
+	"total_price":    {"en": "Total price", "ru": "Итоговая цена", "tk": "Jemi bahasy"},
+	"bid_price":      {"en": "Bid price", "ru": "Ставка", "tk": "Teklip edilen baha"},
+	"currency":       {"en": "Currency", "ru": "Валюта", "tk": "Walýuta"},
+	"payment_method": {"en": "Payment method", "ru": "Способ оплаты", "tk": "Töleg usuly"},
+	"note":           {"en": "Note", "ru": "Примечание", "tk": "Bellik"},
+	"created_at":     {"en": "Created", "ru": "Создано", "tk": "Döredilen wagty"},
+	"cargo_name":     {"en": "Cargo", "ru": "Груз", "tk": "Ýük"},
+	"driver":         {"en": "Driver", "ru": "Водитель", "tk": "Sürüji"},
+	"vehicle":        {"en": "Vehicle", "ru": "Транспорт", "tk": "Ulag"},
+	"response_count": {"en": "Responses", "ru": "Отклики", "tk": "Jogaplar"},
+	"name":           {"en": "Name", "ru": "Название", "tk": "Ady"},
+	"company":        {"en": "Company", "ru": "Компания", "tk": "Kompaniýa"},
+	"to_company":     {"en": "To company", "ru": "Кому", "tk": "Kime"},
+	"description":    {"en": "Description", "ru": "Описание", "tk": "Beýany"},
+	"qty":            {"en": "Quantity", "ru": "Количество", "tk": "Mukdary"},
+	"weight":         {"en": "Weight", "ru": "Вес", "tk": "Agramy"},
+	"weight_type":    {"en": "Weight unit", "ru": "Ед. веса", "tk": "Agram birligi"},
+	"vehicle_type":   {"en": "Vehicle type", "ru": "Тип транспорта", "tk": "Ulag görnüşi"},
+	"packaging_type": {"en": "Packaging", "ru": "Упаковка", "tk": "Gaplama"},
+	"state":          {"en": "State", "ru": "Статус", "tk": "Ýagdaýy"},
+	"title":          {"en": "Title", "ru": "Заголовок", "tk": "Ady"},
+	"reason":         {"en": "Reason", "ru": "Причина", "tk": "Sebäbi"},
+}
+
+// exportLang reads the lang parameter, then Accept-Language, en by default
+func exportLang(ctx *gin.Context) string {
+	candidates := []string{ctx.Query("lang")}
+	for _, part := range strings.Split(ctx.GetHeader("Accept-Language"), ",") {
+		candidates = append(candidates, strings.TrimSpace(strings.SplitN(part, ";", 2)[0]))
+	}
+	for _, candidate := range candidates {
+		candidate = strings.ToLower(candidate)
+		if len(candidate) > 2 {
+			candidate = candidate[:2]
+		}
+		for _, lang := range exportLangs {
+			if candidate == lang {
+				return lang
+			}
+		}
+	}
+	return "en"
+}
+
+// exportQuery selects the export columns over the list query, the order of the
+// list query is kept
+func exportQuery(list, lang, query string) string {
+	fields := make([]string, len(exportLists[list]))
+	for i, column := range exportLists[list] {
+		cast := "text"
+		if column.numeric {
+			cast = "float8"
+		}
+		fields[i] = fmt.Sprintf("(%s)::%s", strings.ReplaceAll(column.expr, "{lang}", lang), cast)
+	}
+	return fmt.Sprintf("SELECT %s FROM (%s) x", strings.Join(fields, ", "), query)
+}
+
+func exportFileName(list, format string) string {
+	return fmt.Sprintf("%s_%s.%s", list, time.Now().Format("20060102_150405"), format)
+}
+
+// writeExport writes the rows of the export query as a table with localized headers
+func writeExport(w io.Writer, rows pgx.Rows, list, format, lang string) (int, error) {
+	header := make([]string, len(exportLists[list]))
+	for i, column := range exportLists[list] {
+		header[i] = exportLabels[column.label][lang]
+	}
+
+	writer, err := spreadsheet.NewWriter(w, format, exportLabels[list][lang], header)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return count, err
+		}
+		if err := writer.WriteRow(values); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	return count, writer.Close()
+}
+
+// exportList answers a list request with format set: the whole filtered list
+// query (without LIMIT) is streamed, lists longer than EXPORT_SYNC_MAX_ROWS are
+// queued as a job with the query and the link is sent when the file is ready
+func exportList(ctx *gin.Context, list, query string, args []interface{}) {
+	format := ctx.Query("format")
+	if _, ok := spreadsheet.ContentTypes[format]; !ok {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid export format", "format must be one of csv, xlsx, pdf"))
+		return
+	}
+	lang := exportLang(ctx)
+
+	var count int
+	err := db.DB.QueryRow(context.Background(), fmt.Sprintf("SELECT COUNT(*) FROM (%s) x", query), args...).Scan(&count)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Couldn't export data", err.Error()))
+		return
+	}
+
+	if count > config.ENV.EXPORT_SYNC_MAX_ROWS {
+		encodedArgs, err := encodeExportArgs(args)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Couldn't start export", err.Error()))
+			return
+		}
+		job, err := repo.CreateExportJob(dto.ExportJob{
+			UserID:    ctx.MustGet("id").(int),
+			CompanyID: ctx.MustGet("companyID").(int),
+			List:      list,
+			Format:    format,
+			Lang:      lang,
+			RowCount:  count,
+			Query:     query,
+			Args:      encodedArgs,
+		})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Couldn't start export", err.Error()))
+			return
+		}
+		RunExportJobs()
+
+		ctx.JSON(http.StatusAccepted, utils.FormatResponse("Export started, the download link is sent when the file is ready", job))
+		return
+	}
+
+	rows, err := db.DB.Query(context.Background(), exportQuery(list, lang, query), args...)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Couldn't export data", err.Error()))
+		return
+	}
+	defer rows.Close()
+
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, exportFileName(list, format)))
+	ctx.Header("Content-Type", spreadsheet.ContentTypes[format])
+	ctx.Status(http.StatusOK)
+	if _, err := writeExport(ctx.Writer, rows, list, format, lang); err != nil {
+		// the response has started, the client gets a cut file
+		log.Printf("Error exporting %s as %s: %v", list, format, err)
+	}
+}
+
+// exportArg is a list query argument with its Go type, the arguments are
+// kept with the job as JSON and must come back with the same types
+type exportArg struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+func encodeExportArgs(args []interface{}) (string, error) {
+	encoded := make([]exportArg, len(args))
+	for i, arg := range args {
+		var kind string
+		switch arg.(type) {
+		case nil:
+			kind = "nil"
+		case string:
+			kind = "string"
+		case int:
+			kind = "int"
+		case float64:
+			kind = "float64"
+		case bool:
+			kind = "bool"
+		case time.Time:
+			kind = "time"
+		default:
+			return "", fmt.Errorf("unsupported export argument %d of type %T", i+1, arg)
+		}
+		value, err := json.Marshal(arg)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode export argument %d: %w", i+1, err)
+		}
+		encoded[i] = exportArg{Type: kind, Value: value}
+	}
+
+	data, err := json.Marshal(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode export arguments: %w", err)
+	}
+	return string(data), nil
+}
+
+func decodeExportArgs(data string) ([]interface{}, error) {
+	var encoded []exportArg
+	if err := json.Unmarshal([]byte(data), &encoded); err != nil {
+		return nil, fmt.Errorf("failed to decode export arguments: %w", err)
+	}
+
+	args := make([]interface{}, len(encoded))
+	for i, arg := range encoded {
+		var err error
+		switch arg.Type {
+		case "nil":
+		case "string":
+			var v string
+			err = json.Unmarshal(arg.Value, &v)
+			args[i] = v
+		case "int":
+			var v int
+			err = json.Unmarshal(arg.Value, &v)
+			args[i] = v
+		case "float64":
+			var v float64
+			err = json.Unmarshal(arg.Value, &v)
+			args[i] = v
+		case "bool":
+			var v bool
+			err = json.Unmarshal(arg.Value, &v)
+			args[i] = v
+		case "time":
+			var v time.Time
+			err = json.Unmarshal(arg.Value, &v)
+			args[i] = v
+		default:
+			err = fmt.Errorf("unsupported type %s", arg.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode export argument %d: %w", i+1, err)
+		}
+	}
+	return args, nil
+}
+
+// a job that keeps getting cut off is given up after exportMaxAttempts starts
+const (
+	exportWorkers     = 2
+	exportMaxAttempts = 3
+)
+
+var (
+	exportWake chan struct{}
+	exportOnce sync.Once
+)
+
+// RunExportJobs starts the export workers on the first call, which puts jobs
+// cut off by a restart back in the queue, and lets them run the pending jobs
+// (called by scheduler and after a job is queued)
+func RunExportJobs() {
+	exportOnce.Do(func() {
+		requeued, err := repo.RequeueExportJobs(exportMaxAttempts)
+		if err != nil {
+			log.Printf("Failed to requeue export jobs: %v", err)
+		} else if requeued > 0 {
+			log.Printf("Requeued %d interrupted export jobs", requeued)
+		}
+
+		exportWake = make(chan struct{}, exportWorkers)
+		for i := 0; i < exportWorkers; i++ {
+			go runExportWorker()
+		}
+	})
+
+	for i := 0; i < exportWorkers; i++ {
+		select {
+		case exportWake <- struct{}{}:
+		default:
+			return
+		}
+	}
+}
+
+// runExportWorker claims pending jobs from the table until none is left
+func runExportWorker() {
+	for range exportWake {
+		for {
+			job, err := repo.ClaimExportJob()
+			if err != nil {
+				log.Printf("Error claiming export job: %v", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			runExportJob(*job)
+		}
+	}
+}
+
+func runExportJob(job dto.ExportJob) {
+	filePath, count, err := saveExport(job)
+	if err != nil {
+		log.Printf("Error running export job %d: %v", job.ID, err)
+		if err := repo.FailExportJob(job.ID, err.Error()); err != nil {
+			log.Printf("Error failing export job %d: %v", job.ID, err)
+		}
+		job.State = dto.ExportStateFailed
+		job.Error = err.Error()
+		notifyExportJob(job)
+		return
+	}
+
+	job.State = dto.ExportStateDone
+	job.RowCount = count
+	job.FilePath = filePath
+	job.URL = fmt.Sprintf("%s/%s/export/%s/file", config.ENV.API_SERVER_URL, config.ENV.API_PREFIX, job.UUID)
+	if err := repo.FinishExportJob(job.ID, job.RowCount, job.FilePath, job.URL); err != nil {
+		log.Printf("Error finishing export job %d: %v", job.ID, err)
+	}
+	notifyExportJob(job)
+}
+
+// saveExport writes the export file to PRIVATE_PATH/exports/, outside the
+// public uploads, and returns its path relative to PRIVATE_PATH
+func saveExport(job dto.ExportJob) (string, int, error) {
+	args, err := decodeExportArgs(job.Args)
+	if err != nil {
+		return "", 0, err
+	}
+
+	dir := filepath.Join("exports", time.Now().Format("2006-01"))
+	if err := os.MkdirAll(filepath.Join(config.ENV.PRIVATE_PATH, dir), 0755); err != nil {
+		return "", 0, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	filePath := filepath.Join(dir, fmt.Sprintf("%s.%s", job.UUID, job.Format))
+	storagePath := filepath.Join(config.ENV.PRIVATE_PATH, filePath)
+
+	file, err := os.Create(storagePath)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer file.Close()
+
+	rows, err := db.DB.Query(context.Background(), exportQuery(job.List, job.Lang, job.Query), args...)
+	if err != nil {
+		os.Remove(storagePath)
+		return "", 0, fmt.Errorf("failed to query export rows: %w", err)
+	}
+	count, err := writeExport(file, rows, job.List, job.Format, job.Lang)
+	rows.Close()
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		os.Remove(storagePath)
+		return "", 0, fmt.Errorf("failed to write export file: %w", err)
+	}
+	return filePath, count, nil
+}
+
+func notifyExportJob(job dto.ExportJob) {
+	list := exportLabels[job.List][job.Lang]
+	title := fmt.Sprintf("%s export is ready", list)
+	content := fmt.Sprintf("%s export (%d rows, %s) is ready: %s", list, job.RowCount, strings.ToUpper(job.Format), job.URL)
+	if job.State == dto.ExportStateFailed {
+		title = fmt.Sprintf("%s export failed", list)
+		content = fmt.Sprintf("%s export (%s) failed: %s", list, strings.ToUpper(job.Format), job.Error)
+	}
+
+	payload := firebasePush.NotificationPayload{
+		SenderName: "Exports",
+		UserID:     job.UserID,
+		Content:    content,
+		Title:      &title,
+		CreatedAt:  time.Now().Format(time.RFC3339),
+		Type:       "export",
+	}
+	if err := firebasePush.SendNotificationToUser(job.UserID, payload); err != nil {
+		log.Printf("Error sending export notification to user %d: %v", job.UserID, err)
+	}
+
+	sendSystemMessage(job.UserID, title+"\n"+content, map[string]interface{}{
+		"type":       "export",
+		"export_id":  job.UUID,
+		"export_url": job.URL,
+	})
+}
+
+func GetExportJobs(ctx *gin.Context) {
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(ctx.DefaultQuery("per_page", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 10
+	}
+
+	jobs, total, err := repo.GetExportJobs(ctx.MustGet("id").(int), page, perPage)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve exports", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Exports retrieved successfully", utils.PaginatedResponse{
+		Total:   total,
+		Page:    page,
+		PerPage: perPage,
+		Data:    jobs,
+	}))
+}
+
+func GetExportJob(ctx *gin.Context) {
+	userID := ctx.MustGet("id").(int)
+	if role := ctx.MustGet("role").(string); role == "admin" || role == "system" {
+		userID = 0
+	}
+
+	job, err := repo.GetExportJob(ctx.Param("uuid"), userID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, repo.ErrExportJobNotFound) {
+			status = http.StatusNotFound
+		}
+		ctx.JSON(status, utils.FormatErrorResponse("Export not found", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Export retrieved successfully", job))
+}
+
+// DownloadExportJob serves the file of a finished job to the user who
+// requested it while in the same company, admins can download any file
+func DownloadExportJob(ctx *gin.Context) {
+	userID := ctx.MustGet("id").(int)
+	isAdmin := false
+	if role := ctx.MustGet("role").(string); role == "admin" || role == "system" {
+		userID = 0
+		isAdmin = true
+	}
+
+	job, err := repo.GetExportJob(ctx.Param("uuid"), userID)
+	if err == nil && !isAdmin && job.CompanyID != ctx.MustGet("companyID").(int) {
+		err = repo.ErrExportJobNotFound
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, repo.ErrExportJobNotFound) {
+			status = http.StatusNotFound
+		}
+		ctx.JSON(status, utils.FormatErrorResponse("Export not found", err.Error()))
+		return
+	}
+
+	if job.State != dto.ExportStateDone || job.FilePath == "" {
+		ctx.JSON(http.StatusConflict, utils.FormatErrorResponse("Export file is not ready", "state is "+job.State))
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s_%s.%s"`,
+		job.List, job.CreatedAt.Format("20060102_150405"), job.Format))
+	ctx.Header("Content-Type", spreadsheet.ContentTypes[job.Format])
+	ctx.File(filepath.Join(config.ENV.PRIVATE_PATH, job.FilePath))
+}
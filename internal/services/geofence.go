@@ -0,0 +1,185 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"texApi/internal/dto"
+	"texApi/internal/firebasePush"
+	"texApi/internal/repo"
+	"texApi/pkg/utils"
+)
+
+var geofenceEventTitles = map[string]string{
+	dto.GeofenceEventArrivedPickup:      "Vehicle arrived at pickup",
+	dto.GeofenceEventLeftPickup:         "Vehicle left pickup",
+	dto.GeofenceEventArrivedDestination: "Vehicle arrived at destination",
+	dto.GeofenceEventLeftDestination:    "Vehicle left destination",
+}
+
+// canAccessOffer allows admins and the companies that own or execute the offer
+func canAccessOffer(ctx *gin.Context, offerID int) (bool, error) {
+	role := ctx.MustGet("role").(string)
+	if role == "admin" || role == "system" {
+		return true, nil
+	}
+
+	owner, err := repo.GetOfferOwner(offerID)
+	if err != nil {
+		return false, err
+	}
+	return owner.CanAccess(ctx.MustGet("companyID").(int)), nil
+}
+
+func CreateGeofence(ctx *gin.Context) {
+	var input dto.GeofenceInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid input data", err.Error()))
+		return
+	}
+
+	allowed, err := canAccessOffer(ctx, input.OfferID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, utils.FormatErrorResponse("Offer not found", err.Error()))
+		return
+	}
+	if !allowed {
+		ctx.JSON(http.StatusForbidden, utils.FormatErrorResponse("Access denied", "You don't have access to this offer"))
+		return
+	}
+
+	id, err := repo.CreateGeofence(input, ctx.MustGet("companyID").(int))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Failed to create geofence", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, utils.FormatResponse("Geofence created successfully", gin.H{"id": id}))
+}
+
+func GetGeofences(ctx *gin.Context) {
+	var query dto.GeofenceQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid query parameters", err.Error()))
+		return
+	}
+
+	role := ctx.MustGet("role").(string)
+	if role != "admin" && role != "system" {
+		if query.OfferID == nil {
+			ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("offer_id is required", ""))
+			return
+		}
+		allowed, err := canAccessOffer(ctx, *query.OfferID)
+		if err != nil || !allowed {
+			ctx.JSON(http.StatusForbidden, utils.FormatErrorResponse("Access denied", "You don't have access to this offer"))
+			return
+		}
+	}
+
+	geofences, err := repo.GetGeofences(query)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve geofences", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Geofences retrieved successfully", geofences))
+}
+
+func DeleteGeofence(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid geofence ID", err.Error()))
+		return
+	}
+
+	offerID, err := repo.GetGeofenceOfferID(id)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, utils.FormatErrorResponse("Geofence not found", err.Error()))
+		return
+	}
+
+	allowed, err := canAccessOffer(ctx, offerID)
+	if err != nil || !allowed {
+		ctx.JSON(http.StatusForbidden, utils.FormatErrorResponse("Access denied", "You don't have access to this geofence"))
+		return
+	}
+
+	if err := repo.DeleteGeofence(id); err != nil {
+		ctx.JSON(http.StatusNotFound, utils.FormatErrorResponse("Geofence not found", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Geofence deleted successfully", gin.H{"id": id}))
+}
+
+func GetGeofenceEvents(ctx *gin.Context) {
+	var query dto.GeofenceEventQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid query parameters", err.Error()))
+		return
+	}
+
+	role := ctx.MustGet("role").(string)
+	if role != "admin" && role != "system" {
+		if query.OfferID == nil {
+			ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("offer_id is required", ""))
+			return
+		}
+		allowed, err := canAccessOffer(ctx, *query.OfferID)
+		if err != nil || !allowed {
+			ctx.JSON(http.StatusForbidden, utils.FormatErrorResponse("Access denied", "You don't have access to this offer"))
+			return
+		}
+	}
+
+	events, err := repo.GetGeofenceEvents(query)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve geofence events", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Geofence events retrieved successfully", events))
+}
+
+// notifyGeofenceEvents pushes every crossing to the owner of the offer
+func notifyGeofenceEvents(events []dto.GeofenceEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	offerIDs := make([]int, 0, len(events))
+	for _, event := range events {
+		offerIDs = append(offerIDs, event.OfferID)
+	}
+
+	owners, err := repo.GetOfferOwners(offerIDs)
+	if err != nil {
+		log.Printf("Failed to get geofence event recipients: %v", err)
+		return
+	}
+
+	for _, event := range events {
+		owner, ok := owners[event.OfferID]
+		if !ok || owner.UserID == 0 {
+			continue
+		}
+
+		title := geofenceEventTitles[event.EventType]
+		payload := firebasePush.NotificationPayload{
+			SenderName: "GPS",
+			UserID:     owner.UserID,
+			Content:    fmt.Sprintf("%s (offer #%d, vehicle #%d)", title, event.OfferID, event.VehicleID),
+			Title:      &title,
+			CreatedAt:  event.EventDt.Format(time.RFC3339),
+			Type:       "geofence",
+		}
+		if err := firebasePush.SendNotificationToUser(owner.UserID, payload); err != nil {
+			log.Printf("Error sending geofence notification to user %d: %v", owner.UserID, err)
+		}
+	}
+}
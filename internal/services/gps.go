@@ -1,12 +1,16 @@
 package services
 
 import (
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"texApi/config"
 	"texApi/internal/dto"
+	"texApi/internal/gpsTrack"
 	"texApi/internal/repo"
 	"texApi/pkg/utils"
 )
@@ -23,6 +27,16 @@ func StartTrip(ctx *gin.Context) {
 		return
 	}
 
+	if scope := gpsScopeCompanyID(ctx); scope != nil {
+		for _, offer := range input.Offers {
+			owner, err := repo.GetOfferOwner(offer.OfferID)
+			if err != nil || !owner.CanAccess(*scope) {
+				ctx.JSON(http.StatusForbidden, utils.FormatErrorResponse("Access denied", fmt.Sprintf("You don't have access to offer %d", offer.OfferID)))
+				return
+			}
+		}
+	}
+
 	tripID, err := repo.CreateTrip(input)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to start trip", err.Error()))
@@ -41,7 +55,12 @@ func EndTrip(ctx *gin.Context) {
 		return
 	}
 
-	err := repo.EndTrip(input)
+	if scope := gpsScopeCompanyID(ctx); scope != nil && !repo.CanCompanyAccessTrip(int(input.ID), *scope) {
+		ctx.JSON(http.StatusNotFound, utils.FormatErrorResponse("Trip not found or access denied", ""))
+		return
+	}
+
+	summary, err := repo.EndTrip(input)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "access denied") {
 			ctx.JSON(http.StatusNotFound, utils.FormatErrorResponse("Trip not found or access denied", err.Error()))
@@ -51,7 +70,7 @@ func EndTrip(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, utils.FormatResponse("Trip ended successfully", nil))
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Trip ended successfully", summary))
 }
 
 func GetTrips(ctx *gin.Context) {
@@ -61,6 +80,8 @@ func GetTrips(ctx *gin.Context) {
 		return
 	}
 
+	query.ScopeCompanyID = gpsScopeCompanyID(ctx)
+
 	trips, err := repo.GetTrips(query)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve trips", err.Error()))
@@ -82,15 +103,44 @@ func CreateGPSLogs(ctx *gin.Context) {
 		return
 	}
 
-	err := repo.CreateGPSLogs(logs)
+	if len(logs) > config.ENV.GPS_MAX_BATCH_SIZE {
+		ctx.JSON(http.StatusRequestEntityTooLarge, utils.FormatErrorResponse("Too many GPS logs",
+			fmt.Sprintf("at most %d points per request", config.ENV.GPS_MAX_BATCH_SIZE)))
+		return
+	}
+
+	scope := gpsIngestScope(ctx)
+
+	// offline buffers are imported in the background
+	if len(logs) > config.ENV.GPS_SYNC_BATCH_SIZE {
+		importID, queued, err := enqueueGPSImport(logs, scope)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to queue GPS import", err.Error()))
+			return
+		}
+		if !queued {
+			ctx.JSON(http.StatusServiceUnavailable, utils.FormatErrorResponse("GPS import queue is full, retry later", ""))
+			return
+		}
+		ctx.JSON(http.StatusAccepted, utils.FormatResponse("GPS logs queued for import", gin.H{
+			"import_id": importID,
+			"total":     len(logs),
+		}))
+		return
+	}
+
+	report, err := ingestGPSLogs(logs, scope)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to create GPS logs", err.Error()))
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, utils.FormatResponse("GPS logs created successfully", map[string]interface{}{
-		"count": len(logs),
-	}))
+	if report.Accepted == 0 && report.Duplicates < report.Total {
+		ctx.JSON(http.StatusUnprocessableEntity, utils.FormatErrorResponse("All GPS logs were rejected", rejectionSummary(report.Rejected)))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, utils.FormatResponse("GPS logs created successfully", report))
 }
 
 func GetGPSLogs(ctx *gin.Context) {
@@ -100,12 +150,22 @@ func GetGPSLogs(ctx *gin.Context) {
 		return
 	}
 
+	query.ScopeCompanyID = gpsScopeCompanyID(ctx)
+
 	logs, err := repo.GetGPSLogs(query)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve GPS logs", err.Error()))
 		return
 	}
 
+	if query.Clean || query.Simplify != nil {
+		opts := gpsTrack.DefaultOptions()
+		if query.Simplify != nil {
+			opts.ToleranceM = *query.Simplify
+		}
+		logs = gpsTrack.Process(logs, opts)
+	}
+
 	ctx.JSON(http.StatusOK, utils.FormatResponse("GPS logs retrieved successfully", logs))
 }
 
@@ -128,6 +188,8 @@ func GetLastPositions(ctx *gin.Context) {
 		query.VehicleIDs = parseIntArray(vehicleIDs)
 	}
 
+	query.ScopeCompanyID = gpsScopeCompanyID(ctx)
+
 	positions, err := repo.GetLastPositions(query)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve last positions", err.Error()))
@@ -154,11 +216,233 @@ func GetTripsDetailed(ctx *gin.Context) {
 		return
 	}
 
+	query.ScopeCompanyID = gpsScopeCompanyID(ctx)
+
 	trips, err := repo.GetTripsDetailed(query)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve detailed trips", err.Error()))
 		return
 	}
 
+	tripIDs := make([]int64, len(trips))
+	for i := range trips {
+		tripIDs[i] = trips[i].ID
+	}
+	tracks, err := repo.GetTripTracks(tripIDs)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve trip tracks", err.Error()))
+		return
+	}
+	for i := range trips {
+		trips[i].Polyline = gpsTrack.TrackPolyline(tracks[trips[i].ID], float64(config.ENV.GPS_TRACK_TOLERANCE_M))
+	}
+
+	// ETA is a paid feature, only attached for companies whose plan has it
+	if scope := gpsScopeCompanyID(ctx); scope == nil || repo.CompanyHasGPSETA(*scope) {
+		for i := range trips {
+			if trips[i].Status != "active" {
+				continue
+			}
+			if eta, err := repo.GetTripETA(trips[i].ID); err == nil {
+				trips[i].ETA = &eta
+			}
+		}
+	}
+
 	ctx.JSON(http.StatusOK, utils.FormatResponse("Detailed trips retrieved successfully", trips))
 }
+
+func GetTripETA(ctx *gin.Context) {
+	tripID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid trip ID", err.Error()))
+		return
+	}
+
+	role := ctx.MustGet("role").(string)
+	companyID := ctx.MustGet("companyID").(int)
+	if !(role == "admin" || role == "system") {
+		if !repo.CompanyHasGPSETA(companyID) {
+			ctx.JSON(http.StatusForbidden, utils.FormatErrorResponse("ETA is not available on your plan", ""))
+			return
+		}
+		if !repo.CanCompanyAccessTrip(int(tripID), companyID) {
+			ctx.JSON(http.StatusForbidden, utils.FormatErrorResponse("Access denied", "You don't have access to this trip"))
+			return
+		}
+	}
+
+	eta, err := repo.GetTripETA(tripID)
+	if err != nil {
+		ctx.JSON(http.StatusUnprocessableEntity, utils.FormatErrorResponse("Failed to estimate ETA", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Trip ETA retrieved successfully", eta))
+}
+
+// GetTripWaypoints lists the stops of the trip in route order
+func GetTripWaypoints(ctx *gin.Context) {
+	tripID, ok := tripIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	waypoints, err := repo.GetTripWaypoints(int64(tripID))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve trip waypoints", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Trip waypoints retrieved successfully", waypoints))
+}
+
+// ExportTrip streams the trip track with its stops as GPX, KML or GeoJSON
+func ExportTrip(ctx *gin.Context) {
+	tripID, ok := tripIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	var query dto.TripExportQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid query parameters", err.Error()))
+		return
+	}
+
+	trips, err := repo.GetTripsDetailed(dto.TripQuery{ID: &tripID, Limit: 1})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve trip", err.Error()))
+		return
+	}
+	if len(trips) == 0 {
+		ctx.JSON(http.StatusNotFound, utils.FormatErrorResponse("Trip not found", ""))
+		return
+	}
+
+	points, err := repo.GetTripGPSLogs(int64(tripID))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve trip track", err.Error()))
+		return
+	}
+
+	if query.Clean || query.Simplify != nil {
+		opts := gpsTrack.DefaultOptions()
+		if query.Simplify != nil {
+			opts.ToleranceM = *query.Simplify
+		}
+		points = gpsTrack.Process(points, opts)
+	}
+
+	stops, err := repo.GetTripStops(int64(tripID))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve trip stops", err.Error()))
+		return
+	}
+
+	contentType, ext := gpsTrack.ContentType(query.Format)
+	ctx.Header("Content-Type", contentType)
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="trip_%d.%s"`, tripID, ext))
+	ctx.Status(http.StatusOK)
+
+	track := gpsTrack.ExportTrack{Trip: trips[0], Points: points, Stops: stops}
+	if err := gpsTrack.WriteTrack(ctx.Writer, query.Format, track); err != nil {
+		// headers are already sent, the client gets a truncated file
+		log.Printf("Error exporting trip %d: %v", tripID, err)
+	}
+}
+
+// gpsScopeCompanyID returns the company reads must be limited to, nil for admins
+func gpsScopeCompanyID(ctx *gin.Context) *int {
+	role, _ := ctx.Get("role")
+	if role == "admin" || role == "system" {
+		return nil
+	}
+	companyID := ctx.MustGet("companyID").(int)
+	return &companyID
+}
+
+func gpsIngestScope(ctx *gin.Context) dto.GPSIngestScope {
+	if token, ok := ctx.Get("gpsToken"); ok {
+		gpsToken := token.(dto.GPSToken)
+		return dto.GPSIngestScope{
+			CompanyID: gpsToken.CompanyID,
+			TokenID:   gpsToken.ID,
+			DriverID:  gpsToken.DriverID,
+			VehicleID: gpsToken.VehicleID,
+		}
+	}
+	return dto.GPSIngestScope{
+		CompanyID: ctx.MustGet("companyID").(int),
+		IsAdmin:   gpsScopeCompanyID(ctx) == nil,
+	}
+}
+
+func rejectionSummary(rejected []dto.GPSLogRejection) string {
+	reasons := make([]string, 0, len(rejected))
+	for _, r := range rejected {
+		reasons = append(reasons, fmt.Sprintf("#%d: %s", r.Index, r.Reason))
+	}
+	return strings.Join(reasons, "; ")
+}
+
+func CreateGPSToken(ctx *gin.Context) {
+	var input dto.GPSTokenInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid input data", err.Error()))
+		return
+	}
+
+	id, token, err := repo.CreateGPSToken(input, ctx.MustGet("companyID").(int))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Failed to create GPS token", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, utils.FormatResponse("GPS token created successfully, it will not be shown again", gin.H{
+		"id":    id,
+		"token": token,
+	}))
+}
+
+func GetGPSTokens(ctx *gin.Context) {
+	tokens, err := repo.GetGPSTokens(gpsScopeCompanyID(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve GPS tokens", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("GPS tokens retrieved successfully", tokens))
+}
+
+func DeleteGPSToken(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid token ID", err.Error()))
+		return
+	}
+
+	if err := repo.DeleteGPSToken(id, gpsScopeCompanyID(ctx)); err != nil {
+		ctx.JSON(http.StatusNotFound, utils.FormatErrorResponse("GPS token not found", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("GPS token revoked successfully", gin.H{"id": id}))
+}
+
+func GetRejectedGPSLogs(ctx *gin.Context) {
+	var query dto.GPSLogRejectedQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid query parameters", err.Error()))
+		return
+	}
+	query.CompanyID = gpsScopeCompanyID(ctx)
+
+	logs, err := repo.GetRejectedGPSLogs(query)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve rejected GPS logs", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Rejected GPS logs retrieved successfully", logs))
+}
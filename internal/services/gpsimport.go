@@ -0,0 +1,210 @@
+package services
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"texApi/config"
+	"texApi/internal/dto"
+	"texApi/internal/gpsStream"
+	"texApi/internal/repo"
+	"texApi/pkg/utils"
+)
+
+// gpsImportMaxAttempts is how often an import is started before an import
+// that keeps getting cut off is given up
+const gpsImportMaxAttempts = 3
+
+var (
+	gpsImportWake chan struct{}
+	gpsImportOnce sync.Once
+)
+
+// startGPSImportWorkers lazily starts the background importers, config is
+// only available after InitConfig so this can't run at package init. Imports
+// that were processing when the server stopped go back to the queue first.
+func startGPSImportWorkers() {
+	gpsImportOnce.Do(func() {
+		requeued, err := repo.RequeueGPSImports(gpsImportMaxAttempts)
+		if err != nil {
+			log.Printf("Failed to requeue GPS imports: %v", err)
+		} else if requeued > 0 {
+			log.Printf("Requeued %d interrupted GPS imports", requeued)
+		}
+
+		workers := config.ENV.GPS_IMPORT_WORKERS
+		if workers < 1 {
+			workers = 1
+		}
+		gpsImportWake = make(chan struct{}, workers)
+		for i := 0; i < workers; i++ {
+			go runGPSImportWorker()
+		}
+	})
+}
+
+// RunGPSImports starts the importers and lets them work off the queued imports
+func RunGPSImports() {
+	startGPSImportWorkers()
+	wakeGPSImportWorkers()
+}
+
+func wakeGPSImportWorkers() {
+	for i := 0; i < cap(gpsImportWake); i++ {
+		select {
+		case gpsImportWake <- struct{}{}:
+		default:
+			return
+		}
+	}
+}
+
+// runGPSImportWorker claims queued imports from the table until none is left
+func runGPSImportWorker() {
+	for range gpsImportWake {
+		for {
+			id, payload, err := repo.ClaimGPSImport()
+			if err != nil && id == 0 {
+				log.Printf("Failed to claim GPS import: %v", err)
+				break
+			}
+			if err != nil {
+				log.Printf("GPS import %d: %v", id, err)
+				if err := repo.FailGPSImport(id, err.Error()); err != nil {
+					log.Printf("GPS import %d: %v", id, err)
+				}
+				continue
+			}
+			if id == 0 {
+				break
+			}
+
+			report, err := ingestGPSLogs(payload.Logs, payload.Scope)
+			if err != nil {
+				log.Printf("GPS import %d failed: %v", id, err)
+				if err := repo.FailGPSImport(id, err.Error()); err != nil {
+					log.Printf("GPS import %d: %v", id, err)
+				}
+				continue
+			}
+
+			if err := repo.CompleteGPSImport(id, report); err != nil {
+				log.Printf("GPS import %d: %v", id, err)
+			}
+		}
+	}
+}
+
+// enqueueGPSImport registers a background import, false when the queue is full
+func enqueueGPSImport(logs []dto.GPSLogInput, scope dto.GPSIngestScope) (int, bool, error) {
+	startGPSImportWorkers()
+
+	queued, err := repo.CountQueuedGPSImports()
+	if err != nil {
+		return 0, false, err
+	}
+	if queued >= config.ENV.GPS_IMPORT_QUEUE_SIZE {
+		return 0, false, nil
+	}
+
+	id, err := repo.CreateGPSImport(scope, logs)
+	if err != nil {
+		return 0, false, err
+	}
+
+	wakeGPSImportWorkers()
+	return id, true, nil
+}
+
+// ingestGPSLogs validates, stores and fans out a batch, the report lists
+// refused and duplicate points by their index in the batch
+func ingestGPSLogs(logs []dto.GPSLogInput, scope dto.GPSIngestScope) (dto.GPSIngestReport, error) {
+	report := dto.GPSIngestReport{Total: len(logs), Rejected: []dto.GPSLogRejection{}}
+
+	accepted, rejected, err := repo.ValidateGPSLogs(logs, scope)
+	if err != nil {
+		return report, err
+	}
+
+	if err := repo.CreateRejectedGPSLogs(rejected, scope); err != nil {
+		log.Printf("Failed to record rejected GPS logs: %v", err)
+	}
+	report.Rejected = append(report.Rejected, rejected...)
+
+	if len(accepted) == 0 {
+		return report, nil
+	}
+
+	// positions of accepted points in the original batch
+	refused := make(map[int]bool, len(rejected))
+	for _, r := range rejected {
+		refused[r.Index] = true
+	}
+	acceptedIndex := make([]int, 0, len(accepted))
+	for i := range logs {
+		if !refused[i] {
+			acceptedIndex = append(acceptedIndex, i)
+		}
+	}
+
+	created, duplicates, events, err := repo.CreateGPSLogs(accepted)
+	if err != nil {
+		return report, err
+	}
+
+	for _, i := range duplicates {
+		report.Rejected = append(report.Rejected, dto.GPSLogRejection{
+			Index:  acceptedIndex[i],
+			Reason: "duplicate point for vehicle_id and log_dt",
+			Log:    accepted[i],
+		})
+	}
+
+	report.Accepted = len(created)
+	report.Duplicates = len(duplicates)
+	report.GeofenceEvents = len(events)
+
+	go gpsStream.Publish(created)
+	go notifyGeofenceEvents(events)
+
+	logIDs := make([]int64, len(created))
+	for i, point := range created {
+		logIDs[i] = point.ID
+	}
+	alerts, err := repo.EvaluateTripRules(logIDs)
+	if err != nil {
+		// points are stored already, a failed check must not fail the upload
+		log.Printf("Failed to evaluate trip rules: %v", err)
+	}
+	report.Alerts = len(alerts)
+	go notifyTripAlerts(alerts)
+
+	return report, nil
+}
+
+func GetGPSImport(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid import ID", err.Error()))
+		return
+	}
+
+	var companyID *int
+	if _, ok := ctx.Get("gpsToken"); ok {
+		scope := gpsIngestScope(ctx)
+		companyID = &scope.CompanyID
+	} else {
+		companyID = gpsScopeCompanyID(ctx)
+	}
+
+	gpsImport, err := repo.GetGPSImport(id, companyID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, utils.FormatErrorResponse("GPS import not found", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("GPS import retrieved successfully", gpsImport))
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"texApi/config"
+	"texApi/internal/dto"
+	"texApi/internal/repo"
+	"texApi/pkg/utils"
+)
+
+const (
+	gpsArchiveDir         = "gps_archive"
+	gpsArchiveBatchSize   = 200
+	gpsPartitionsAhead    = 2 // months
+	gpsPartitionDropAfter = 1 // months, only empty partitions are dropped
+)
+
+var gpsRetentionMu sync.Mutex
+
+type gpsTripArchive struct {
+	Trip       dto.Trip     `json:"trip"`
+	Points     []dto.GPSLog `json:"points"`
+	ArchivedAt time.Time    `json:"archived_at"`
+}
+
+// RunGPSRetention creates the upcoming partitions, exports closed trips and
+// applies the retention policy of every plan level (called by scheduler)
+func RunGPSRetention() (dto.GPSRetentionReport, error) {
+	if !gpsRetentionMu.TryLock() {
+		return dto.GPSRetentionReport{}, fmt.Errorf("GPS retention is already running")
+	}
+	defer gpsRetentionMu.Unlock()
+
+	report := dto.GPSRetentionReport{StartedAt: time.Now(), DroppedPartitions: []string{}}
+
+	if err := repo.EnsureGPSLogPartitions(gpsPartitionsAhead); err != nil {
+		return report, err
+	}
+
+	// tracks must be exported before any of their points are thinned
+	for {
+		trips, err := repo.GetTripsToArchive(gpsArchiveBatchSize)
+		if err != nil {
+			return report, err
+		}
+		for _, trip := range trips {
+			if err := archiveTrip(trip); err != nil {
+				return report, err
+			}
+			report.ArchivedTrips++
+		}
+		if len(trips) < gpsArchiveBatchSize {
+			break
+		}
+	}
+
+	policies, err := repo.GetGPSRetentionPolicies()
+	if err != nil {
+		return report, err
+	}
+	for _, policy := range policies {
+		downsampled, deleted, err := repo.ApplyGPSRetention(policy, report.StartedAt)
+		report.DownsampledPoints += downsampled
+		report.DeletedPoints += deleted
+		if err != nil {
+			return report, fmt.Errorf("retention level %s: %w", policy.Level, err)
+		}
+	}
+
+	dropped, err := repo.DropEmptyGPSLogPartitions(report.StartedAt.AddDate(0, -gpsPartitionDropAfter, 0))
+	report.DroppedPartitions = append(report.DroppedPartitions, dropped...)
+	if err != nil {
+		return report, err
+	}
+
+	report.FinishedAt = time.Now()
+	log.Printf("GPS retention finished: %d trips archived, %d points downsampled, %d deleted, %d partitions dropped",
+		report.ArchivedTrips, report.DownsampledPoints, report.DeletedPoints, len(report.DroppedPartitions))
+
+	return report, nil
+}
+
+// archiveTrip writes the raw track as gzipped JSON to
+// PRIVATE_PATH/gps_archive/YYYY/MM/, outside the public uploads
+func archiveTrip(trip dto.Trip) error {
+	points, err := repo.GetTripGPSLogs(trip.ID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	relDir := filepath.Join(gpsArchiveDir, now.Format("2006"), now.Format("01"))
+	relPath := filepath.Join(relDir, fmt.Sprintf("trip_%d.json.gz", trip.ID))
+
+	if err := os.MkdirAll(filepath.Join(config.ENV.PRIVATE_PATH, relDir), 0755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	file, err := os.Create(filepath.Join(config.ENV.PRIVATE_PATH, relPath))
+	if err != nil {
+		return fmt.Errorf("failed to create archive file: %w", err)
+	}
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	if err := json.NewEncoder(gz).Encode(gpsTripArchive{Trip: trip, Points: points, ArchivedAt: now}); err != nil {
+		return fmt.Errorf("failed to write trip archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write trip archive: %w", err)
+	}
+
+	return repo.MarkTripArchived(trip.ID, relPath)
+}
+
+func GetGPSRetentionPolicies(ctx *gin.Context) {
+	policies, err := repo.GetGPSRetentionPolicies()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve GPS retention policies", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("GPS retention policies retrieved successfully", policies))
+}
+
+func UpdateGPSRetentionPolicy(ctx *gin.Context) {
+	level := ctx.Param("level")
+	if level != "none" && level != "basic" && level != "advanced" && level != "full" {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid level", "level must be one of none, basic, advanced, full"))
+		return
+	}
+
+	var input dto.GPSRetentionPolicyInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid input data", err.Error()))
+		return
+	}
+
+	if input.KeepDays > 0 && input.KeepDays < input.RawDays {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid input data", "keep_days must not be less than raw_days"))
+		return
+	}
+
+	if err := repo.UpdateGPSRetentionPolicy(level, input); err != nil {
+		ctx.JSON(http.StatusNotFound, utils.FormatErrorResponse("GPS retention policy not found", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("GPS retention policy updated successfully", gin.H{"level": level}))
+}
+
+// StartGPSRetention runs the retention job in the background on demand
+func StartGPSRetention(ctx *gin.Context) {
+	go func() {
+		if _, err := RunGPSRetention(); err != nil {
+			log.Printf("Error in GPS retention: %v", err)
+		}
+	}()
+
+	ctx.JSON(http.StatusAccepted, utils.FormatResponse("GPS retention started", nil))
+}
@@ -493,6 +493,21 @@ func CreatePlanMove(ctx *gin.Context) {
 		return
 	}
 
+	if planMove.PlanID != 0 {
+		var exists bool
+		err = db.DB.QueryRow(context.Background(),
+			`SELECT EXISTS(SELECT 1 FROM tbl_plan WHERE id = $1 AND active = 1 AND deleted = 0)`,
+			planMove.PlanID).Scan(&exists)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Database error", err.Error()))
+			return
+		}
+		if !exists {
+			ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Plan not found", ""))
+			return
+		}
+	}
+
 	// Default status is 'pending' if not provided
 	status := planMove.Status
 	if status == "" {
@@ -501,9 +516,9 @@ func CreatePlanMove(ctx *gin.Context) {
 
 	query := `
 		INSERT INTO tbl_plan_moves (
-			user_id, company_id, status
+			user_id, company_id, plan_id, status
 		) VALUES (
-			$1, $2, $3::status_type_t
+			$1, $2, $3, $4::status_type_t
 		) RETURNING id
 	`
 
@@ -511,7 +526,7 @@ func CreatePlanMove(ctx *gin.Context) {
 	err = db.DB.QueryRow(
 		context.Background(),
 		query,
-		planMove.UserID, planMove.CompanyID, status,
+		planMove.UserID, planMove.CompanyID, planMove.PlanID, status,
 	).Scan(&planMoveID)
 
 	if err != nil {
@@ -546,13 +561,13 @@ func UpdatePlanMove(ctx *gin.Context) {
 
 	// First, get the current plan move details
 	getQuery := `
-		SELECT company_id, user_id, status
+		SELECT company_id, user_id, plan_id, status
 		FROM tbl_plan_moves
 		WHERE id = $1 AND deleted = 0
 	`
-	var companyID, userID int
+	var companyID, userID, planID int
 	var currentStatus string
-	err := db.DB.QueryRow(context.Background(), getQuery, id).Scan(&companyID, &userID, &currentStatus)
+	err := db.DB.QueryRow(context.Background(), getQuery, id).Scan(&companyID, &userID, &planID, &currentStatus)
 	if err != nil {
 		ctx.JSON(http.StatusNotFound, utils.FormatErrorResponse("Plan move not found", err.Error()))
 		return
@@ -573,8 +588,8 @@ func UpdatePlanMove(ctx *gin.Context) {
 			return
 		}
 
-		// Update the company's plan_active status
-		_, err = queries.UpdateCompanyPlanActive(context.Background(), db.DB, companyID, 1)
+		// Activate the company's plan, its billing cycle starts now
+		_, err = queries.ActivateCompanyPlan(context.Background(), db.DB, companyID, planID)
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Error updating company plan status", err.Error()))
 			return
@@ -8,6 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -16,14 +17,36 @@ import (
 	"texApi/config"
 	db "texApi/database"
 	"texApi/internal/dto"
+	"texApi/internal/repo"
 	"texApi/pkg/fileUtils"
 	"texApi/pkg/utils"
 )
 
 func UploadFile(ctx *gin.Context) {
+	// documents count against the e-docs of the company's plan
+	documents := 0
+	scope := gpsScopeCompanyID(ctx)
+	if scope != nil {
+		var err error
+		if documents, err = countDocumentFiles(ctx); err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Error saving file", err.Error()))
+			return
+		}
+		if documents > 0 {
+			if err := repo.ConsumePlanQuota(context.Background(), db.DB, *scope, dto.PlanFeatureEdocs, documents); err != nil {
+				ctx.JSON(planErrorStatus(err), utils.FormatErrorResponse("Document upload is limited by your plan", err.Error()))
+				return
+			}
+		}
+	}
 
 	filePaths, err := utils.SaveFiles(ctx)
 	if err != nil {
+		if documents > 0 {
+			if err := repo.ReleasePlanQuota(*scope, dto.PlanFeatureEdocs, documents); err != nil {
+				log.Printf("Error releasing e-docs of company %d: %v", *scope, err)
+			}
+		}
 		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Error saving file", err.Error()))
 		return
 	}
@@ -35,6 +58,29 @@ func UploadFile(ctx *gin.Context) {
 	ctx.JSON(http.StatusCreated, utils.FormatResponse("Successfully uploaded", filePaths))
 }
 
+// countDocumentFiles counts the uploaded files whose content is a document
+func countDocumentFiles(ctx *gin.Context) (int, error) {
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		return 0, errors.New("failed to parse multipart form")
+	}
+
+	count := 0
+	buffer := make([]byte, 512)
+	for _, fileHeader := range form.File["files"] {
+		file, err := fileHeader.Open()
+		if err != nil {
+			return 0, fmt.Errorf("cannot open file %s", fileHeader.Filename)
+		}
+		n, _ := file.Read(buffer)
+		file.Close()
+		if fileUtils.DetermineMediaType(fileUtils.DetectMimeType(buffer[:n])) == "document" {
+			count++
+		}
+	}
+	return count, nil
+}
+
 func ValidateAndProcessFiles(ctx *gin.Context, categoryFN, fileForm string) ([]fileUtils.FileValidationResult, error) {
 	form, err := ctx.MultipartForm()
 	if err != nil {
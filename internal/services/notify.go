@@ -0,0 +1,14 @@
+package services
+
+// SystemMessageSender stores a chat system message in the user's system
+// conversation and delivers it to the user's connections, true when the user
+// was connected. It is set by the chat package once its hub runs, messages are
+// dropped until then.
+var SystemMessageSender func(userID int, content string, extras map[string]interface{}) bool
+
+func sendSystemMessage(userID int, content string, extras map[string]interface{}) bool {
+	if SystemMessageSender == nil {
+		return false
+	}
+	return SystemMessageSender(userID, content, extras)
+}
@@ -14,6 +14,7 @@ import (
 	db "texApi/database"
 	"texApi/internal/dto"
 	"texApi/internal/queries"
+	"texApi/internal/repo"
 	"texApi/pkg/utils"
 	"time"
 )
@@ -192,9 +193,14 @@ func GetMyOfferListUpdate(ctx *gin.Context) {
 		LEFT JOIN tbl_cargo cr ON o.cargo_id = cr.id
 		%s
 		ORDER BY o.%s %s
-		LIMIT $%d OFFSET $%d
-	`, whereClause, orderBy, orderDir, argCounter, argCounter+1)
+	`, whereClause, orderBy, orderDir)
 
+	if ctx.Query("format") != "" {
+		exportList(ctx, exportMyOffers, query, args)
+		return
+	}
+
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argCounter, argCounter+1)
 	args = append(args, perPage, offset)
 
 	rows, err := db.DB.Query(context.Background(), query, args...)
@@ -305,6 +311,21 @@ func GetMyOfferListUpdate(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, utils.FormatResponse("Offer list", response))
 }
 
+// offerCargoFilters adds the cargo measure filters of the query, see
+// repo.OfferCargoFilters, to the where clauses of an offer list
+func offerCargoFilters(ctx *gin.Context, whereClauses []string, args []interface{}, argCounter int) ([]string, []interface{}, int) {
+	for _, filter := range repo.OfferCargoFilters {
+		value, err := strconv.ParseFloat(ctx.Query(filter[0]), 64)
+		if err != nil {
+			continue
+		}
+		whereClauses = append(whereClauses, repo.OfferCargoCondition(filter[1], fmt.Sprintf("$%d", argCounter)))
+		args = append(args, value)
+		argCounter++
+	}
+	return whereClauses, args, argCounter
+}
+
 func GetOfferListUpdate(ctx *gin.Context) {
 
 	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
@@ -317,6 +338,7 @@ func GetOfferListUpdate(ctx *gin.Context) {
 		"driver_id":       ctx.Query("driver_id"),
 		"vehicle_id":      ctx.Query("vehicle_id"),
 		"trailer_id":      ctx.Query("trailer_id"),
+		"vehicle_type_id": ctx.Query("vehicle_type_id"),
 		"cargo_id":        ctx.Query("cargo_id"),
 		"offer_state":     ctx.Query("offer_state"),
 		"offer_role":      ctx.Query("offer_role"),
@@ -358,7 +380,7 @@ func GetOfferListUpdate(ctx *gin.Context) {
 	argCounter := 1
 
 	if !(role == "admin" || role == "system") {
-		whereClauses = append(whereClauses, "o.offer_state = 'enabled' AND o.deleted = 0")
+		whereClauses = append(whereClauses, "o.offer_state = 'active' AND o.deleted = 0")
 	}
 
 	for key, value := range filters {
@@ -368,6 +390,7 @@ func GetOfferListUpdate(ctx *gin.Context) {
 			argCounter++
 		}
 	}
+	whereClauses, args, argCounter = offerCargoFilters(ctx, whereClauses, args, argCounter)
 
 	if validityStart != "" {
 		whereClauses = append(whereClauses, fmt.Sprintf("o.validity_start >= $%d", argCounter))
@@ -400,6 +423,12 @@ func GetOfferListUpdate(ctx *gin.Context) {
 	}
 
 	stmt += fmt.Sprintf(" ORDER BY %s %s", orderBy, orderDir)
+
+	if ctx.Query("format") != "" {
+		exportList(ctx, exportOffers, stmt, args)
+		return
+	}
+
 	stmt += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argCounter, argCounter+1)
 	args = append(args, perPage, offset)
 
@@ -439,13 +468,55 @@ func CreateOffer(ctx *gin.Context) {
 		return
 	}
 
-	companyID := ctx.MustGet("companyID").(int)
-	userID := ctx.MustGet("id").(int)
-	role := ctx.MustGet("role").(string)
-	if !(role == "admin" || role == "system") {
-		offer.CompanyID = companyID
-		offer.UserID = userID
+	if err := prepareOffer(&offer, offerActor(ctx)); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid offer stops", err.Error()))
+		return
+	}
+
+	tx, err := db.DB.Begin(context.Background())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Error creating offer", err.Error()))
+		return
 	}
+	defer tx.Rollback(context.Background())
+
+	id, err := insertOfferTx(context.Background(), tx, offer, offerActor(ctx))
+	if err != nil {
+		ctx.JSON(planErrorStatus(err), utils.FormatErrorResponse("Error creating offer", err.Error()))
+		return
+	}
+	if err := tx.Commit(context.Background()); err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Error creating offer", err.Error()))
+		return
+	}
+
+	if offer.OfferState == dto.OfferStateActive {
+		go notifySavedSearches(id)
+	}
+
+	ctx.JSON(http.StatusCreated, utils.FormatResponse("Successfully created offer!", gin.H{"id": id}))
+}
+
+// prepareOffer applies the create rules: ownership, the initial state, the
+// stops and the prices
+func prepareOffer(offer *dto.Offer, actor dto.OfferActor) error {
+	if !actor.IsAdmin() {
+		offer.CompanyID = actor.CompanyID
+		offer.UserID = actor.UserID
+		// the executor is assigned by accepting a response
+		offer.ExecCompanyID = 0
+	}
+
+	// new offers start as pending (sent to moderation) or as a draft, admins may
+	// create them in any state
+	if offer.OfferState == "" || (!actor.IsAdmin() && offer.OfferState != dto.OfferStateDraft) {
+		offer.OfferState = dto.OfferStatePending
+	}
+
+	if err := repo.ValidateOfferStops(offer.Stops); err != nil {
+		return err
+	}
+	fillOfferRouteFromStops(offer)
 
 	if offer.OfferPrice == 0.0 {
 		offer.OfferPrice = offer.CostPerKm * float64(offer.Distance)
@@ -454,10 +525,22 @@ func CreateOffer(ctx *gin.Context) {
 		discountAmount := offer.OfferPrice * float64(offer.Discount) / 100
 		offer.TotalPrice = offer.OfferPrice - discountAmount + offer.TaxPrice
 	}
+	return nil
+}
+
+// insertOfferTx inserts a prepared offer with its stops and its initial state
+// history, the offer counts against the load posts of the company's plan
+// unless an admin creates it
+func insertOfferTx(ctx context.Context, tx pgx.Tx, offer dto.Offer, actor dto.OfferActor) (int, error) {
+	if !actor.IsAdmin() {
+		if err := repo.ConsumePlanQuota(ctx, tx, offer.CompanyID, dto.PlanFeatureLoadPosts, 1); err != nil {
+			return 0, err
+		}
+	}
 
 	var id int
-	err := db.DB.QueryRow(
-		context.Background(),
+	err := tx.QueryRow(
+		ctx,
 		queries.CreateOffer,
 		offer.UserID, offer.CompanyID, offer.DriverID, offer.VehicleID, offer.TrailerID, offer.CargoID, offer.CostPerKm, offer.Currency,
 		offer.FromCountryID, offer.FromCityID, offer.ToCountryID, offer.ToCityID,
@@ -466,15 +549,19 @@ func CreateOffer(ctx *gin.Context) {
 		offer.DeliveryStart, offer.DeliveryEnd, offer.Note, offer.Tax, offer.TaxPrice, offer.Trade, offer.Discount,
 		offer.PaymentMethod, offer.Meta, offer.Meta2, offer.Meta3, offer.OfferRole, offer.ExecCompanyID,
 		offer.VehicleTypeID, offer.PackagingTypeID, offer.Distance, offer.MapURL, offer.PaymentTerm,
-		offer.OfferPrice, offer.TotalPrice,
+		offer.OfferPrice, offer.TotalPrice, offer.OfferState,
 	).Scan(&id)
-
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Error creating offer", err.Error()))
-		return
+		return 0, err
 	}
 
-	ctx.JSON(http.StatusCreated, utils.FormatResponse("Successfully created offer!", gin.H{"id": id}))
+	if err := repo.ReplaceOfferStopsTx(ctx, tx, id, offer.Stops); err != nil {
+		return 0, fmt.Errorf("failed to create offer stops: %w", err)
+	}
+	if err := repo.RecordOfferCreatedTx(ctx, tx, id, offer.OfferState, actor); err != nil {
+		return 0, err
+	}
+	return id, nil
 }
 
 func UpdateOffer(ctx *gin.Context) {
@@ -487,6 +574,25 @@ func UpdateOffer(ctx *gin.Context) {
 		return
 	}
 
+	if offer.OfferState != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("offer_state can not be updated directly",
+			"use POST /offer/:id/state to change the offer state"))
+		return
+	}
+	// the executor is set by accepting a response and released by assigned -> active
+	if offer.ExecCompanyID != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("exec_company_id can not be updated directly",
+			"accept an offer response to assign the executor"))
+		return
+	}
+	if offer.Stops != nil {
+		if err := repo.ValidateOfferStops(*offer.Stops); err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid offer stops", err.Error()))
+			return
+		}
+		fillOfferUpdateRouteFromStops(&offer)
+	}
+
 	role := ctx.MustGet("role").(string)
 	companyID := ctx.MustGet("companyID").(int)
 	isAdminOrSystem := (role == "admin" || role == "system")
@@ -530,7 +636,6 @@ func UpdateOffer(ctx *gin.Context) {
 		}
 
 		offer.CompanyID = nil
-		offer.OfferState = nil
 		stmt += ` AND deleted = 0`
 	}
 
@@ -586,8 +691,15 @@ func UpdateOffer(ctx *gin.Context) {
 
 	stmt += ` RETURNING id;`
 
+	tx, err := db.DB.Begin(context.Background())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Error updating offer", err.Error()))
+		return
+	}
+	defer tx.Rollback(context.Background())
+
 	var updatedID int
-	err := db.DB.QueryRow(
+	err = tx.QueryRow(
 		context.Background(),
 		stmt,
 		offerID,
@@ -646,6 +758,17 @@ func UpdateOffer(ctx *gin.Context) {
 		return
 	}
 
+	if offer.Stops != nil {
+		if err := repo.ReplaceOfferStopsTx(context.Background(), tx, updatedID, *offer.Stops); err != nil {
+			ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Error updating offer stops", err.Error()))
+			return
+		}
+	}
+	if err := tx.Commit(context.Background()); err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Error updating offer", err.Error()))
+		return
+	}
+
 	ctx.JSON(http.StatusCreated, utils.FormatResponse("Successfully updated offer!", gin.H{"id": updatedID}))
 }
 
@@ -843,7 +966,18 @@ func GetOffer(ctx *gin.Context) {
 				'docs3_url', cg.docs3_url,
 				'note', cg.note,
 				'active', cg.active,
-				'deleted', cg.deleted
+				'deleted', cg.deleted,
+				'length_cm', cg.length_cm,
+				'width_cm', cg.width_cm,
+				'height_cm', cg.height_cm,
+				'max_stack', cg.max_stack,
+				'temp_min', cg.temp_min,
+				'temp_max', cg.temp_max,
+				'adr_class', cg.adr_class,
+				'un_number', cg.un_number,
+				'volume_m3', cg.volume_m3,
+				'loading_meters', cg.loading_meters,
+				'weight_kg', cg.weight_kg
             ) as cargo,
             json_build_object(
                 'id', pt.id,
@@ -912,6 +1046,19 @@ func GetOffer(ctx *gin.Context) {
 		offer.OfferResponses = offerResponses
 	}
 
+	offer.StateHistory, err = repo.GetOfferStateHistory(offer.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Error fetching offer state history", err.Error()))
+		return
+	}
+
+	stops, err := repo.GetOfferStops([]int{offer.ID})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Error fetching offer stops", err.Error()))
+		return
+	}
+	offer.Stops = stops[offer.ID]
+
 	ctx.JSON(http.StatusOK, utils.FormatResponse("Offer details", offer))
 }
 func DeleteOffer(ctx *gin.Context) {
@@ -1168,7 +1315,18 @@ func GetDetailedOfferList(ctx *gin.Context) {
 				'docs3_url', cg.docs3_url,
 				'note', cg.note,
 				'active', cg.active,
-				'deleted', cg.deleted
+				'deleted', cg.deleted,
+				'length_cm', cg.length_cm,
+				'width_cm', cg.width_cm,
+				'height_cm', cg.height_cm,
+				'max_stack', cg.max_stack,
+				'temp_min', cg.temp_min,
+				'temp_max', cg.temp_max,
+				'adr_class', cg.adr_class,
+				'un_number', cg.un_number,
+				'volume_m3', cg.volume_m3,
+				'loading_meters', cg.loading_meters,
+				'weight_kg', cg.weight_kg
             ) as cargo,
             
             -- Packaging type fields
@@ -1265,6 +1423,8 @@ func GetDetailedOfferList(ctx *gin.Context) {
 		}
 	}
 
+	whereClauses, args, argCounter = offerCargoFilters(ctx, whereClauses, args, argCounter)
+
 	dateRanges := map[string]struct {
 		start string
 		end   string
@@ -1396,6 +1556,12 @@ func GetDetailedOfferList(ctx *gin.Context) {
 		return
 	}
 
+	if err := attachOfferStops(offers); err != nil {
+		ctx.JSON(http.StatusInternalServerError,
+			utils.FormatErrorResponse("Couldn't retrieve offer stops", err.Error()))
+		return
+	}
+
 	var totalCount int
 	if len(offers) > 0 {
 		totalCount = offers[0].TotalCount
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"texApi/config"
+	"texApi/internal/firebasePush"
+	"texApi/internal/repo"
+)
+
+// RunOfferExpiry archives pending and active offers past validity_end or
+// delivery_end plus their grace periods, declines their pending responses and
+// notifies both sides (called by scheduler)
+func RunOfferExpiry(now time.Time) error {
+	validityGrace := config.ENV.OFFER_EXPIRY_VALIDITY_GRACE_HOURS
+	deliveryGrace := config.ENV.OFFER_EXPIRY_DELIVERY_GRACE_HOURS
+
+	ids, err := repo.GetExpiredOfferIDs(validityGrace, deliveryGrace, now)
+	if err != nil {
+		return err
+	}
+
+	archived := 0
+	for _, id := range ids {
+		offer, err := repo.ExpireOffer(id, validityGrace, deliveryGrace, now)
+		if err != nil {
+			log.Printf("Error archiving expired offer %d: %v", id, err)
+			continue
+		}
+		if offer == nil {
+			continue
+		}
+		archived++
+		notifyOfferExpired(*offer)
+	}
+
+	if archived > 0 {
+		log.Printf("Archived %d expired offers", archived)
+	}
+	return nil
+}
+
+func notifyOfferExpired(offer repo.ExpiredOffer) {
+	if offer.UserID != 0 {
+		title := fmt.Sprintf("Offer #%d archived", offer.ID)
+		content := fmt.Sprintf("Offer #%d was archived, %s.", offer.ID, offer.Reason)
+		if len(offer.Responses) > 0 {
+			content += fmt.Sprintf(" %d pending responses were declined.", len(offer.Responses))
+		}
+		sendOfferExpiryNotification(offer.UserID, title, content, map[string]interface{}{
+			"type":     "offer_expired",
+			"offer_id": offer.ID,
+		})
+	}
+
+	title := fmt.Sprintf("Response to offer #%d declined", offer.ID)
+	content := fmt.Sprintf("Offer #%d expired (%s), your response was declined.", offer.ID, offer.Reason)
+	for _, response := range offer.Responses {
+		if response.UserID == 0 {
+			continue
+		}
+		sendOfferExpiryNotification(response.UserID, title, content, map[string]interface{}{
+			"type":        "offer_expired",
+			"offer_id":    offer.ID,
+			"response_id": response.ID,
+		})
+	}
+}
+
+func sendOfferExpiryNotification(userID int, title, content string, extras map[string]interface{}) {
+	payload := firebasePush.NotificationPayload{
+		SenderName: "Offers",
+		UserID:     userID,
+		Content:    content,
+		Title:      &title,
+		CreatedAt:  time.Now().Format(time.RFC3339),
+		Type:       "offer_expired",
+	}
+	if err := firebasePush.SendNotificationToUser(userID, payload); err != nil {
+		log.Printf("Error sending offer expiry notification to user %d: %v", userID, err)
+	}
+
+	sendSystemMessage(userID, title+"\n"+content, extras)
+}
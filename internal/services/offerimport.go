@@ -0,0 +1,369 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/jackc/pgx/v5"
+	db "texApi/database"
+	"texApi/internal/dto"
+	"texApi/internal/queries"
+	"texApi/internal/repo"
+	"texApi/pkg/spreadsheet"
+	"texApi/pkg/utils"
+)
+
+const maxOfferImportSize = 5 << 20 // 5 MB
+
+// offer columns that can not be imported, the others are matched by their
+// json name
+var offerImportSkip = map[string]bool{
+	"id": true, "uuid": true, "exec_company_id": true, "view_count": true, "featured": true,
+	"partner": true, "created_at": true, "updated_at": true, "active": true, "deleted": true,
+	"total_count": true, "stops": true,
+}
+
+// cargo columns, a row with any of them creates a cargo for the offer
+var offerImportCargo = map[string]bool{
+	"name": true, "description": true, "info": true, "qty": true, "weight": true,
+	"weight_type": true, "note": true, "length_cm": true, "width_cm": true, "height_cm": true,
+	"max_stack": true, "temp_min": true, "temp_max": true, "adr_class": true, "un_number": true,
+}
+
+// offerImportRow holds the parsed values of a row
+type offerImportRow struct {
+	offer         dto.Offer
+	cargo         *dto.Cargo
+	vehicleType   string
+	packagingType string
+}
+
+// importColumn sets one column of a row
+type importColumn func(row *offerImportRow, value string) error
+
+// jsonFieldIndex maps the json names of a struct's fields, embedded structs
+// included, to their index path
+func jsonFieldIndex(t reflect.Type) map[string][]int {
+	fields := make(map[string][]int)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for name, index := range jsonFieldIndex(field.Type) {
+				fields[name] = append([]int{i}, index...)
+			}
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = []int{i}
+		}
+	}
+	return fields
+}
+
+func setImportValue(field reflect.Value, value string) error {
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(value)
+	case int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		field.SetInt(int64(n))
+	case float64:
+		f, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		field.SetFloat(f)
+	case *float64:
+		f, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		field.Set(reflect.ValueOf(&f))
+	case time.Time:
+		t, err := spreadsheet.ParseDate(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+	default:
+		return fmt.Errorf("column can not be imported")
+	}
+	return nil
+}
+
+// offerImportColumns maps the header to column setters. Offer fields use their
+// json name, cargo fields a cargo_ prefix, and vehicle_type / packaging_type
+// take a name.
+func offerImportColumns(header []string) ([]importColumn, []string, error) {
+	offerFields := jsonFieldIndex(reflect.TypeOf(dto.Offer{}))
+	cargoFields := jsonFieldIndex(reflect.TypeOf(dto.Cargo{}))
+
+	columns := make([]importColumn, len(header))
+	names := make([]string, len(header))
+	var unknown []string
+	for i, title := range header {
+		name := strings.ToLower(strings.Join(strings.Fields(strings.TrimSpace(title)), "_"))
+		names[i] = name
+
+		switch {
+		case name == "":
+			continue
+		case name == "vehicle_type":
+			columns[i] = func(row *offerImportRow, value string) error { row.vehicleType = value; return nil }
+		case name == "packaging_type":
+			columns[i] = func(row *offerImportRow, value string) error { row.packagingType = value; return nil }
+		case strings.HasPrefix(name, "cargo_") && offerImportCargo[strings.TrimPrefix(name, "cargo_")]:
+			index := cargoFields[strings.TrimPrefix(name, "cargo_")]
+			columns[i] = func(row *offerImportRow, value string) error {
+				if row.cargo == nil {
+					row.cargo = &dto.Cargo{}
+				}
+				return setImportValue(reflect.ValueOf(row.cargo).Elem().FieldByIndex(index), value)
+			}
+		case offerFields[name] != nil && !offerImportSkip[name]:
+			index := offerFields[name]
+			columns[i] = func(row *offerImportRow, value string) error {
+				return setImportValue(reflect.ValueOf(&row.offer).Elem().FieldByIndex(index), value)
+			}
+		default:
+			unknown = append(unknown, title)
+		}
+	}
+
+	if len(unknown) > 0 {
+		return nil, nil, fmt.Errorf("unknown columns: %s", strings.Join(unknown, ", "))
+	}
+	return columns, names, nil
+}
+
+// ImportOffers creates offers from the rows of a CSV or XLSX file. Every row
+// is checked like POST /offer/ and inserted in one transaction. With
+// dry_run (the default) the transaction is rolled back and only the report is
+// returned, otherwise it is committed when no row has errors.
+func ImportOffers(ctx *gin.Context) {
+	dryRun, err := strconv.ParseBool(ctx.DefaultQuery("dry_run", "true"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid dry_run", err.Error()))
+		return
+	}
+
+	fileHeader, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("File is required", err.Error()))
+		return
+	}
+	if fileHeader.Size > maxOfferImportSize {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("File is too large",
+			fmt.Sprintf("up to %d MB can be imported", maxOfferImportSize>>20)))
+		return
+	}
+	format, err := spreadsheet.FormatOf(fileHeader.Filename)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid file", err.Error()))
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid file", err.Error()))
+		return
+	}
+	defer file.Close()
+
+	rows, err := spreadsheet.Read(file, format)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid file", err.Error()))
+		return
+	}
+	if len(rows) < 2 {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid file", "the file has no rows below the header"))
+		return
+	}
+	if len(rows)-1 > dto.MaxOfferImportRows {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid file",
+			fmt.Sprintf("up to %d rows can be imported at once", dto.MaxOfferImportRows)))
+		return
+	}
+
+	columns, names, err := offerImportColumns(rows[0])
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid file", err.Error()))
+		return
+	}
+
+	vehicleTypes, err := repo.GetVehicleTypeIDsByName()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Error importing offers", err.Error()))
+		return
+	}
+	packagingTypes, err := repo.GetPackagingTypeIDsByName()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Error importing offers", err.Error()))
+		return
+	}
+
+	actor := offerActor(ctx)
+	report := dto.OfferImportReport{DryRun: dryRun, Columns: names, Rows: []dto.OfferImportRow{}}
+	var imported []offerImportRow
+
+	c := context.Background()
+	tx, err := db.DB.Begin(c)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Error importing offers", err.Error()))
+		return
+	}
+	defer tx.Rollback(c)
+
+	for i, cells := range rows[1:] {
+		if isBlankRow(cells) {
+			continue
+		}
+		result := dto.OfferImportRow{Row: i + 2}
+		row := offerImportRow{}
+
+		for j, value := range cells {
+			value = strings.TrimSpace(value)
+			if j >= len(columns) || columns[j] == nil || value == "" {
+				continue
+			}
+			if err := columns[j](&row, value); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", names[j], err))
+			}
+		}
+		result.Errors = append(result.Errors, resolveImportNames(&row, vehicleTypes, packagingTypes)...)
+
+		if len(result.Errors) == 0 {
+			if err := binding.Validator.ValidateStruct(&row.offer); err != nil {
+				result.Errors = append(result.Errors, err.Error())
+			} else if err := prepareOffer(&row.offer, actor); err != nil {
+				result.Errors = append(result.Errors, err.Error())
+			} else if row.cargo != nil {
+				if err := prepareCargo(row.cargo); err != nil {
+					result.Errors = append(result.Errors, "cargo: "+err.Error())
+				}
+			}
+		}
+
+		// the row is inserted in a savepoint so database errors are reported
+		// for the row and do not abort the others
+		if len(result.Errors) == 0 {
+			if err := insertImportRow(c, tx, &row, &result, actor); err != nil {
+				result.Errors = append(result.Errors, err.Error())
+			}
+		}
+
+		report.Total++
+		if len(result.Errors) == 0 {
+			report.Valid++
+			imported = append(imported, row)
+		} else {
+			report.Invalid++
+		}
+		report.Rows = append(report.Rows, result)
+	}
+
+	if dryRun || report.Invalid > 0 {
+		// rolled back, the ids only existed inside the transaction
+		for i := range report.Rows {
+			report.Rows[i].OfferID, report.Rows[i].CargoID = 0, 0
+		}
+		status := http.StatusOK
+		message := "Offer import checked"
+		if !dryRun {
+			status = http.StatusUnprocessableEntity
+			message = "Offer import has errors, nothing was imported"
+		}
+		ctx.JSON(status, utils.FormatResponse(message, report))
+		return
+	}
+
+	if err := tx.Commit(c); err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Error importing offers", err.Error()))
+		return
+	}
+	report.Committed = true
+
+	for i, result := range report.Rows {
+		if imported[i].offer.OfferState == dto.OfferStateActive {
+			go notifySavedSearches(result.OfferID)
+		}
+	}
+
+	ctx.JSON(http.StatusCreated, utils.FormatResponse("Offers imported successfully", report))
+}
+
+func isBlankRow(cells []string) bool {
+	for _, cell := range cells {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func resolveImportNames(row *offerImportRow, vehicleTypes, packagingTypes map[string]int) []string {
+	var errs []string
+	if row.vehicleType != "" {
+		id, ok := vehicleTypes[strings.ToLower(row.vehicleType)]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("vehicle_type: unknown vehicle type %q", row.vehicleType))
+		}
+		row.offer.VehicleTypeID = id
+	}
+	if row.packagingType != "" {
+		id, ok := packagingTypes[strings.ToLower(row.packagingType)]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("packaging_type: unknown packaging type %q", row.packagingType))
+		}
+		row.offer.PackagingTypeID = id
+	}
+	return errs
+}
+
+// insertImportRow creates the cargo of the row, if any, and the offer
+func insertImportRow(c context.Context, tx pgx.Tx, row *offerImportRow, result *dto.OfferImportRow, actor dto.OfferActor) error {
+	savepoint, err := tx.Begin(c)
+	if err != nil {
+		return err
+	}
+	defer savepoint.Rollback(c)
+
+	if row.cargo != nil {
+		cargo := row.cargo
+		cargo.CompanyID = row.offer.CompanyID
+		cargo.VehicleTypeID = row.offer.VehicleTypeID
+		cargo.PackagingTypeID = row.offer.PackagingTypeID
+		err := savepoint.QueryRow(c,
+			queries.CreateCargo,
+			cargo.CompanyID, cargo.Name, cargo.Description, cargo.Info, cargo.Qty,
+			cargo.Weight, cargo.Meta, cargo.Meta2, cargo.Meta3, cargo.VehicleTypeID,
+			cargo.PackagingTypeID, cargo.GPS, cargo.Photo1URL, cargo.Photo2URL,
+			cargo.Photo3URL, cargo.Docs1URL, cargo.Docs2URL, cargo.Docs3URL, cargo.Note, cargo.WeightType,
+			cargo.LengthCM, cargo.WidthCM, cargo.HeightCM, cargo.MaxStack, cargo.TempMin, cargo.TempMax,
+			cargo.ADRClass, cargo.UNNumber,
+		).Scan(&result.CargoID)
+		if err != nil {
+			return fmt.Errorf("cargo: %w", err)
+		}
+		row.offer.CargoID = result.CargoID
+	}
+
+	id, err := insertOfferTx(c, savepoint, row.offer, actor)
+	if err != nil {
+		return err
+	}
+	result.OfferID = id
+
+	return savepoint.Commit(c)
+}
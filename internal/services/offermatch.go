@@ -0,0 +1,48 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"texApi/internal/dto"
+	"texApi/internal/repo"
+	"texApi/pkg/utils"
+)
+
+const defaultOfferMatchLimit = 20
+
+func GetOfferMatches(ctx *gin.Context) {
+	offerID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid offer ID", err.Error()))
+		return
+	}
+
+	var query dto.OfferMatchQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid query parameters", err.Error()))
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultOfferMatchLimit
+	}
+
+	matches, err := repo.GetOfferMatches(offerID, gpsScopeCompanyID(ctx), query.Limit)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, repo.ErrOfferNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, repo.ErrOfferAccess):
+			status = http.StatusForbidden
+		case errors.Is(err, repo.ErrOfferMatchRole):
+			status = http.StatusBadRequest
+		}
+		ctx.JSON(status, utils.FormatErrorResponse("Failed to match offer", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Offer matches retrieved successfully", matches))
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"texApi/config"
+	"texApi/internal/dto"
+	"texApi/internal/firebasePush"
+	"texApi/internal/repo"
+	"texApi/pkg/utils"
+)
+
+// negotiationErrorStatus maps negotiation errors of the repo to a response status
+func negotiationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repo.ErrOfferResponseNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repo.ErrNegotiationForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, repo.ErrNegotiationClosed), errors.Is(err, repo.ErrNegotiationTurn),
+		errors.Is(err, repo.ErrCounterExpired), errors.Is(err, repo.ErrOfferAlreadyAssigned):
+		return http.StatusConflict
+	default:
+		return tenderErrorStatus(err)
+	}
+}
+
+// CounterOfferResponse answers the latest terms of a response with new ones
+func CounterOfferResponse(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid offer response ID", err.Error()))
+		return
+	}
+
+	var counter dto.OfferResponseCounter
+	if err := ctx.ShouldBindJSON(&counter); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid request body", err.Error()))
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(config.ENV.OFFER_COUNTER_EXPIRY_HOURS) * time.Hour)
+	if counter.ExpiresAt != nil {
+		if !counter.ExpiresAt.After(now) {
+			ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid expires_at", "expires_at must be in the future"))
+			return
+		}
+		expiresAt = *counter.ExpiresAt
+	}
+	if counter.DeliveryStart != nil && counter.DeliveryEnd != nil && counter.DeliveryEnd.Before(*counter.DeliveryStart) {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid delivery dates", "delivery_end is before delivery_start"))
+		return
+	}
+
+	round, negotiation, err := repo.CounterOfferResponse(id, counter, expiresAt, offerActor(ctx))
+	if err != nil {
+		ctx.JSON(negotiationErrorStatus(err), utils.FormatErrorResponse("Offer response can not be countered", err.Error()))
+		return
+	}
+
+	go notifyOfferCounter(negotiation, round)
+
+	ctx.JSON(http.StatusCreated, utils.FormatResponse("Counter-offer sent", round))
+}
+
+// GetOfferResponseRounds returns the negotiation history of a response to its
+// companies and admins
+func GetOfferResponseRounds(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid offer response ID", err.Error()))
+		return
+	}
+
+	negotiation, err := repo.GetOfferNegotiation(id)
+	if err != nil {
+		ctx.JSON(negotiationErrorStatus(err), utils.FormatErrorResponse("Offer response not found", err.Error()))
+		return
+	}
+	if scope := gpsScopeCompanyID(ctx); scope != nil && !negotiation.Party(*scope) {
+		ctx.JSON(http.StatusForbidden, utils.FormatErrorResponse("Permission denied", repo.ErrNegotiationForbidden.Error()))
+		return
+	}
+
+	rounds, err := repo.GetOfferResponseRounds(id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve negotiation", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Offer response negotiation", rounds))
+}
+
+// RunOfferCounterExpiry declines the pending responses whose latest terms
+// expired and notifies both sides (called by scheduler)
+func RunOfferCounterExpiry(now time.Time) error {
+	expired, err := repo.ExpireOfferResponseCounters(now)
+	if err != nil {
+		return err
+	}
+
+	for _, negotiation := range expired {
+		title := fmt.Sprintf("Response to offer #%d expired", negotiation.OfferID)
+		content := fmt.Sprintf("The terms of round %d were not answered in time, the response #%d was declined.",
+			negotiation.Round, negotiation.ID)
+		for _, companyID := range []int{negotiation.CompanyID, negotiation.ToCompanyID} {
+			sendNegotiationNotification(companyID, "offer_counter_expired", title, content, map[string]interface{}{
+				"type":        "offer_counter_expired",
+				"offer_id":    negotiation.OfferID,
+				"response_id": negotiation.ID,
+			})
+		}
+	}
+
+	if len(expired) > 0 {
+		log.Printf("Declined %d offer responses with expired terms", len(expired))
+	}
+	return nil
+}
+
+func notifyOfferCounter(negotiation repo.OfferNegotiation, round dto.OfferResponseRound) {
+	title := fmt.Sprintf("Counter-offer on offer #%d", negotiation.OfferID)
+	content := fmt.Sprintf("Round %d of response #%d", round.Round, negotiation.ID)
+	if round.BidPrice != nil {
+		content += fmt.Sprintf(": %.2f", *round.BidPrice)
+	}
+	if round.ExpiresAt != nil {
+		content += fmt.Sprintf(", valid until %s", round.ExpiresAt.Format("2006-01-02 15:04"))
+	}
+	sendNegotiationNotification(negotiation.Answering(), "offer_counter", title, content+".", map[string]interface{}{
+		"type":        "offer_counter",
+		"offer_id":    negotiation.OfferID,
+		"response_id": negotiation.ID,
+		"round":       round.Round,
+	})
+}
+
+func sendNegotiationNotification(companyID int, notificationType, title, content string, extras map[string]interface{}) {
+	company, err := repo.GetCompanyByID(companyID)
+	if err != nil || company.UserID == 0 {
+		return
+	}
+
+	payload := firebasePush.NotificationPayload{
+		SenderName: "Offers",
+		UserID:     company.UserID,
+		Content:    content,
+		Title:      &title,
+		CreatedAt:  time.Now().Format(time.RFC3339),
+		Type:       notificationType,
+	}
+	if err := firebasePush.SendNotificationToUser(company.UserID, payload); err != nil {
+		log.Printf("Error sending negotiation notification to user %d: %v", company.UserID, err)
+	}
+
+	sendSystemMessage(company.UserID, title+"\n"+content, extras)
+}
@@ -166,6 +166,9 @@ func GetDetailedOfferResponseList(ctx *gin.Context) {
 	role := ctx.MustGet("role").(string)
 	if !(role == "admin" || role == "system") {
 		whereClauses = append(whereClauses, "ofr.deleted = 0")
+		whereClauses = append(whereClauses, sealedTenderBidFilter(argCounter))
+		args = append(args, ctx.MustGet("companyID").(int))
+		argCounter++
 	}
 
 	filters := map[string]string{
@@ -224,8 +227,14 @@ func GetDetailedOfferResponseList(ctx *gin.Context) {
 		query += " WHERE " + strings.Join(whereClauses, " AND ")
 	}
 
-	query += fmt.Sprintf(" ORDER BY ofr.%s %s LIMIT $%d OFFSET $%d",
-		orderBy, orderDir, argCounter, argCounter+1)
+	query += fmt.Sprintf(" ORDER BY ofr.%s %s", orderBy, orderDir)
+
+	if ctx.Query("format") != "" {
+		exportList(ctx, exportOfferResponses, query, args)
+		return
+	}
+
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argCounter, argCounter+1)
 	args = append(args, perPage, offset)
 
 	var responses []dto.OfferResponseDetails
@@ -280,9 +289,14 @@ func GetOfferResponse(ctx *gin.Context) {
         LEFT JOIN tbl_offer o ON ofr.offer_id = o.id
         WHERE (ofr.id::TEXT = $1 OR ofr.uuid::TEXT = $1) AND ofr.deleted = 0
     `
+	args := []interface{}{id}
+	if scope := gpsScopeCompanyID(ctx); scope != nil {
+		query += " AND " + sealedTenderBidFilter(2)
+		args = append(args, *scope)
+	}
 
 	var response dto.OfferResponseDetails
-	err := pgxscan.Get(context.Background(), db.DB, &response, query, id)
+	err := pgxscan.Get(context.Background(), db.DB, &response, query, args...)
 	if err != nil {
 		ctx.JSON(http.StatusNotFound,
 			utils.FormatErrorResponse("Offer response not found", err.Error()))
@@ -304,6 +318,15 @@ func CreateOfferResponse(ctx *gin.Context) {
 
 	offerResponse.CompanyID = companyID
 	offerResponse.State = "pending"
+	if offerResponse.ExpiresAt != nil && !offerResponse.ExpiresAt.After(time.Now()) {
+		ctx.JSON(http.StatusBadRequest,
+			utils.FormatErrorResponse("Invalid expires_at", "expires_at must be in the future"))
+		return
+	}
+	if offerResponse.ExpiresAt != nil {
+		expiresAt := offerResponse.ExpiresAt.UTC()
+		offerResponse.ExpiresAt = &expiresAt
+	}
 
 	company, err := repo.GetCompanyByID(offerResponse.ToCompanyID)
 	if err != nil {
@@ -324,19 +347,42 @@ func CreateOfferResponse(ctx *gin.Context) {
 		return
 	}
 
+	tx, err := db.DB.Begin(context.Background())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError,
+			utils.FormatErrorResponse("Transaction error", err.Error()))
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	tender, err := repo.CheckTenderBidTx(context.Background(), tx, offerResponse.OfferID, companyID, time.Now())
+	if err != nil {
+		ctx.JSON(tenderErrorStatus(err),
+			utils.FormatErrorResponse("Bid can not be placed", err.Error()))
+		return
+	}
+	if tender && (offerResponse.BidPrice == nil || *offerResponse.BidPrice <= 0) {
+		ctx.JSON(http.StatusBadRequest,
+			utils.FormatErrorResponse("Invalid bid", "bids on a tender need a bid_price"))
+		return
+	}
+
 	query := `
         INSERT INTO tbl_offer_response (
             company_id, offer_id, to_company_id, state,
             bid_price, title, note, reason,
-            meta, meta2, meta3, value, rating
+            meta, meta2, meta3, value, rating,
+            payment_method, payment_term, delivery_start, delivery_end,
+            last_company_id, expires_at
         ) VALUES (
-            $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
+            $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13,
+            $14::payment_method_t, $15, $16::date, $17::date, $1, $18
         ) RETURNING id, uuid
     `
 
 	var responseID int
 	var responseUUID string
-	err = db.DB.QueryRow(
+	err = tx.QueryRow(
 		context.Background(),
 		query,
 		offerResponse.CompanyID, offerResponse.OfferID,
@@ -345,7 +391,9 @@ func CreateOfferResponse(ctx *gin.Context) {
 		offerResponse.Note, offerResponse.Reason,
 		offerResponse.Meta, offerResponse.Meta2,
 		offerResponse.Meta3, offerResponse.Value,
-		offerResponse.Rating,
+		offerResponse.Rating, offerResponse.PaymentMethod,
+		offerResponse.PaymentTerm, offerResponse.DeliveryStart,
+		offerResponse.DeliveryEnd, offerResponse.ExpiresAt,
 	).Scan(&responseID, &responseUUID)
 
 	if err != nil {
@@ -354,6 +402,20 @@ func CreateOfferResponse(ctx *gin.Context) {
 		return
 	}
 
+	_, err = repo.RecordOfferResponseRound(context.Background(), tx, responseID, dto.NegotiationOffer,
+		offerActor(ctx), offerResponse.Note)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError,
+			utils.FormatErrorResponse("Error creating offer response", err.Error()))
+		return
+	}
+
+	if err = tx.Commit(context.Background()); err != nil {
+		ctx.JSON(http.StatusInternalServerError,
+			utils.FormatErrorResponse("Error committing transaction", err.Error()))
+		return
+	}
+
 	go sendOfferResponseNotification(company.UserID, fmt.Sprintf("New offer response: %s", utils.SafeString(offerResponse.Title)), offerResponse)
 
 	ctx.JSON(http.StatusCreated, utils.FormatResponse("Successfully created!", gin.H{
@@ -416,22 +478,11 @@ func UpdateOfferResponse(ctx *gin.Context) {
 		return
 	}
 
-	var toCompanyID int
-	err := db.DB.QueryRow(
-		context.Background(),
-		`SELECT to_company_id FROM tbl_offer_response WHERE id = $1 AND deleted = 0`,
-		id,
-	).Scan(&toCompanyID)
-
-	if err != nil {
-		ctx.JSON(http.StatusNotFound,
-			utils.FormatErrorResponse("Offer response not found", err.Error()))
-		return
-	}
-
-	if toCompanyID != companyID {
-		ctx.JSON(http.StatusForbidden,
-			utils.FormatErrorResponse("Permission denied", "Only the recipient company can update this response"))
+	// an accept takes the latest recorded terms, new terms are a counter round
+	if offerResponse.ChangesTerms() {
+		ctx.JSON(http.StatusBadRequest,
+			utils.FormatErrorResponse("Terms can not be changed here",
+				"bid_price, payment and delivery dates are changed with POST /offer-response/:id/counter"))
 		return
 	}
 
@@ -443,65 +494,76 @@ func UpdateOfferResponse(ctx *gin.Context) {
 	}
 	defer tx.Rollback(context.Background())
 
-	if offerResponse.State != nil && *offerResponse.State == "accepted" {
-		var offerID int
-		err = tx.QueryRow(
-			context.Background(),
-			`SELECT offer_id FROM tbl_offer_response WHERE id = $1`,
-			id,
-		).Scan(&offerID)
-
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError,
-				utils.FormatErrorResponse("Error fetching offer ID", err.Error()))
+	// the offer is locked before the response, an accept waits for a
+	// concurrent one and then sees its executor
+	accepting := offerResponse.State != nil && *offerResponse.State == "accepted"
+	if accepting {
+		if _, err := repo.LockResponseOffer(context.Background(), tx, id); err != nil {
+			ctx.JSON(negotiationErrorStatus(err),
+				utils.FormatErrorResponse("Offer response can not be accepted", err.Error()))
 			return
 		}
+	}
 
-		_, err = tx.Exec(
-			context.Background(),
-			`UPDATE tbl_offer_response 
-             SET state = 'declined', updated_at = CURRENT_TIMESTAMP
-             WHERE offer_id = $1 AND id != $2 AND state = 'pending'`,
-			offerID, id,
-		)
+	negotiation, err := repo.LockOfferNegotiation(context.Background(), tx, id)
+	if err != nil {
+		ctx.JSON(negotiationErrorStatus(err),
+			utils.FormatErrorResponse("Offer response not found", err.Error()))
+		return
+	}
 
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError,
-				utils.FormatErrorResponse("Error updating other responses", err.Error()))
-			return
-		}
+	// the latest terms are answered by the other side, the recipient for a new response
+	if negotiation.Answering() != companyID {
+		ctx.JSON(http.StatusForbidden,
+			utils.FormatErrorResponse("Permission denied", "Only the company answering the latest terms can update this response"))
+		return
+	}
+
+	if accepting && negotiation.State != "pending" {
+		ctx.JSON(http.StatusConflict,
+			utils.FormatErrorResponse("Offer response can not be accepted", repo.ErrNegotiationClosed.Error()))
+		return
+	}
+	if accepting && negotiation.Expired(time.Now()) {
+		ctx.JSON(http.StatusConflict,
+			utils.FormatErrorResponse("Offer response can not be accepted", repo.ErrCounterExpired.Error()))
+		return
+	}
+
+	// an accepted state is set by AcceptOfferResponseTx below
+	state := offerResponse.State
+	if accepting {
+		state = nil
 	}
 
 	query := `
         UPDATE tbl_offer_response SET
             state = COALESCE($1, state),
-            bid_price = COALESCE($2, bid_price),
-            title = COALESCE($3, title),
-            note = COALESCE($4, note),
-            reason = COALESCE($5, reason),
-            meta = COALESCE($6, meta),
-            meta2 = COALESCE($7, meta2),
-            meta3 = COALESCE($8, meta3),
-            value = COALESCE($9, value),
-            rating = COALESCE($10, rating),
+            title = COALESCE($2, title),
+            note = COALESCE($3, note),
+            reason = COALESCE($4, reason),
+            meta = COALESCE($5, meta),
+            meta2 = COALESCE($6, meta2),
+            meta3 = COALESCE($7, meta3),
+            value = COALESCE($8, value),
+            rating = COALESCE($9, rating),
             updated_at = CURRENT_TIMESTAMP
-        WHERE id = $11 AND deleted = 0
-        RETURNING id, offer_id, company_id, bid_price, state
+        WHERE id = $10 AND deleted = 0
+        RETURNING id, state
     `
 
-	var updatedID, offerID, responseCompanyID int
-	var bidPrice *float64
-	var state string
+	var updatedID int
+	var updatedState string
 	err = tx.QueryRow(
 		context.Background(),
 		query,
-		offerResponse.State, offerResponse.BidPrice,
+		state,
 		offerResponse.Title, offerResponse.Note,
 		offerResponse.Reason, offerResponse.Meta,
 		offerResponse.Meta2, offerResponse.Meta3,
 		offerResponse.Value, offerResponse.Rating,
 		id,
-	).Scan(&updatedID, &offerID, &responseCompanyID, &bidPrice, &state)
+	).Scan(&updatedID, &updatedState)
 
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError,
@@ -509,25 +571,22 @@ func UpdateOfferResponse(ctx *gin.Context) {
 		return
 	}
 
-	if state == "accepted" && bidPrice != nil {
-		_, err = tx.Exec(
-			context.Background(),
-			`UPDATE tbl_offer 
-			SET 
-			   exec_company_id = $1,
-			   offer_price = $2::numeric,
-			   total_price = CASE 
-				   WHEN tax > 0 THEN $2::numeric + ($2::numeric * tax / 100)
-				   ELSE $2::numeric
-			   END,
-			   updated_at = CURRENT_TIMESTAMP
-			WHERE id = $3 AND deleted = 0`,
-			responseCompanyID, *bidPrice, offerID,
-		)
-
+	if offerResponse.State != nil && updatedState == "declined" && negotiation.State != "declined" {
+		_, err = repo.RecordOfferResponseRound(context.Background(), tx, updatedID, dto.NegotiationDecline,
+			offerActor(ctx), offerResponse.Reason)
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError,
-				utils.FormatErrorResponse("Error updating main offer", err.Error()))
+				utils.FormatErrorResponse("Error updating offer response", err.Error()))
+			return
+		}
+	}
+
+	if accepting {
+		_, err = repo.AcceptOfferResponseTx(context.Background(), tx, updatedID,
+			offerActor(ctx), fmt.Sprintf("offer response #%d accepted", updatedID))
+		if err != nil {
+			ctx.JSON(negotiationErrorStatus(err),
+				utils.FormatErrorResponse("Offer can not be assigned", err.Error()))
 			return
 		}
 	}
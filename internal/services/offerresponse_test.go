@@ -0,0 +1,346 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	db "texApi/database"
+	"texApi/internal/dto"
+	"texApi/internal/repo"
+	"texApi/pkg/utils"
+)
+
+// testDB connects to the database of TEST_DATABASE_URL, a database created by
+// scripts/init-db.sh. The test is skipped when it is not set.
+func testDB(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	previous := db.DB
+	db.DB = pool
+	t.Cleanup(func() {
+		db.DB = previous
+		pool.Close()
+	})
+}
+
+// testCleanup runs the statement when the test ends. Cleanups run in reverse
+// order, so rows are deleted before the rows they reference when they are
+// created after them.
+func testCleanup(t *testing.T, query string, args ...interface{}) {
+	t.Cleanup(func() {
+		if _, err := db.DB.Exec(context.Background(), query, args...); err != nil {
+			t.Errorf("failed to clean up %q: %v", query, err)
+		}
+	})
+}
+
+func testCompany(t *testing.T, name string) int {
+	var id int
+	err := db.DB.QueryRow(context.Background(),
+		`INSERT INTO tbl_company (user_id, role_id, company_name)
+		 SELECT (SELECT id FROM tbl_user ORDER BY id LIMIT 1), (SELECT id FROM tbl_role ORDER BY id LIMIT 1), $1
+		 RETURNING id`,
+		name).Scan(&id)
+	if err != nil {
+		t.Fatalf("failed to create company: %v", err)
+	}
+	testCleanup(t, `DELETE FROM tbl_company WHERE id = $1`, id)
+	return id
+}
+
+// testOffer creates an active offer of the owner. Its responses, their rounds
+// and its history are deleted before it, and before the companies created
+// earlier in the test.
+func testOffer(t *testing.T, ownerID int) int {
+	var id int
+	err := db.DB.QueryRow(context.Background(),
+		`INSERT INTO tbl_offer (company_id, offer_state) VALUES ($1, 'active') RETURNING id`,
+		ownerID).Scan(&id)
+	if err != nil {
+		t.Fatalf("failed to create offer: %v", err)
+	}
+	testCleanup(t, `DELETE FROM tbl_offer WHERE id = $1`, id)
+	testCleanup(t, `DELETE FROM tbl_offer_state_history WHERE offer_id = $1`, id)
+	testCleanup(t, `DELETE FROM tbl_offer_response WHERE offer_id = $1`, id)
+	testCleanup(t, `DELETE FROM tbl_offer_response_round
+		 WHERE response_id IN (SELECT id FROM tbl_offer_response WHERE offer_id = $1)`, id)
+	return id
+}
+
+// testOfferResponse creates a pending bid of the company on the offer
+func testOfferResponse(t *testing.T, offerID, companyID, ownerID int, bidPrice float64) int {
+	var id int
+	err := db.DB.QueryRow(context.Background(),
+		`INSERT INTO tbl_offer_response (company_id, offer_id, to_company_id, last_company_id, bid_price)
+		 VALUES ($1, $2, $3, $1, $4) RETURNING id`,
+		companyID, offerID, ownerID, bidPrice).Scan(&id)
+	if err != nil {
+		t.Fatalf("failed to create offer response: %v", err)
+	}
+	return id
+}
+
+// offerResponseStates maps the responses of the offer to their state
+func offerResponseStates(t *testing.T, offerID int) map[int]string {
+	rows, err := db.DB.Query(context.Background(),
+		`SELECT id, state::text FROM tbl_offer_response WHERE offer_id = $1`, offerID)
+	if err != nil {
+		t.Fatalf("failed to read offer responses: %v", err)
+	}
+	defer rows.Close()
+
+	states := map[int]string{}
+	for rows.Next() {
+		var id int
+		var state string
+		if err := rows.Scan(&id, &state); err != nil {
+			t.Fatalf("failed to read offer response: %v", err)
+		}
+		states[id] = state
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("failed to read offer responses: %v", err)
+	}
+	return states
+}
+
+// acceptOfferResponse accepts the response as a user of the company
+func acceptOfferResponse(companyID, responseID int) (int, utils.UniversalResponse) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodPut, "/offer-response/"+strconv.Itoa(responseID),
+		strings.NewReader(`{"state": "accepted"}`))
+	ctx.Request.Header.Set("Content-Type", "application/json")
+	ctx.Params = gin.Params{{Key: "id", Value: strconv.Itoa(responseID)}}
+	ctx.Set("id", 0)
+	ctx.Set("companyID", companyID)
+	ctx.Set("role", "carrier")
+
+	UpdateOfferResponse(ctx)
+
+	var body utils.UniversalResponse
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w.Code, body
+}
+
+// acceptConcurrently accepts every response at once, as the company it maps
+// to. Exactly one accept must succeed, the others must find the offer
+// assigned. It returns the accepted response.
+func acceptConcurrently(t *testing.T, accepts map[int]int) int {
+	type result struct {
+		responseID int
+		status     int
+		body       utils.UniversalResponse
+	}
+	results := make(chan result, len(accepts))
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for responseID, companyID := range accepts {
+		wg.Add(1)
+		go func(responseID, companyID int) {
+			defer wg.Done()
+			<-start
+			status, body := acceptOfferResponse(companyID, responseID)
+			results <- result{responseID, status, body}
+		}(responseID, companyID)
+	}
+	close(start)
+	wg.Wait()
+	close(results)
+
+	winner := 0
+	for r := range results {
+		switch r.status {
+		case http.StatusOK:
+			if winner != 0 {
+				t.Fatalf("responses %d and %d were both accepted", winner, r.responseID)
+			}
+			winner = r.responseID
+		case http.StatusConflict:
+			if r.body.ErrorMsg != repo.ErrOfferAlreadyAssigned.Error() {
+				t.Errorf("response %d: error %q, want %q", r.responseID, r.body.ErrorMsg, repo.ErrOfferAlreadyAssigned)
+			}
+		default:
+			t.Errorf("response %d: status %d, body %+v", r.responseID, r.status, r.body)
+		}
+	}
+	if winner == 0 {
+		t.Fatal("no response was accepted")
+	}
+	return winner
+}
+
+func TestUpdateOfferResponseConcurrentAccept(t *testing.T) {
+	testDB(t)
+	ctx := context.Background()
+
+	ownerID := testCompany(t, "accept test owner")
+
+	const bidders = 4
+	var bidderIDs []int
+	for i := 0; i < bidders; i++ {
+		bidderIDs = append(bidderIDs, testCompany(t, "accept test bidder "+strconv.Itoa(i)))
+	}
+
+	offerID := testOffer(t, ownerID)
+	responses := make(map[int]int, bidders) // response ID -> bidder company
+	for i, companyID := range bidderIDs {
+		responses[testOfferResponse(t, offerID, companyID, ownerID, float64(1000+i))] = companyID
+	}
+
+	accepts := make(map[int]int, bidders)
+	for responseID := range responses {
+		accepts[responseID] = ownerID
+	}
+	winner := acceptConcurrently(t, accepts)
+
+	var execCompanyID int
+	var offerState string
+	err := db.DB.QueryRow(ctx,
+		`SELECT exec_company_id, offer_state::text FROM tbl_offer WHERE id = $1`,
+		offerID).Scan(&execCompanyID, &offerState)
+	if err != nil {
+		t.Fatalf("failed to read offer: %v", err)
+	}
+	if execCompanyID != responses[winner] {
+		t.Errorf("exec_company_id is %d, want %d of response %d", execCompanyID, responses[winner], winner)
+	}
+	if offerState != "assigned" {
+		t.Errorf("offer_state is %s, want assigned", offerState)
+	}
+
+	for id, state := range offerResponseStates(t, offerID) {
+		want := "declined"
+		if id == winner {
+			want = "accepted"
+		}
+		if state != want {
+			t.Errorf("response %d is %s, want %s", id, state, want)
+		}
+	}
+}
+
+func TestUpdateOfferResponseBidderAcceptsCounter(t *testing.T) {
+	testDB(t)
+	ctx := context.Background()
+
+	ownerID := testCompany(t, "counter test owner")
+	bidderID := testCompany(t, "counter test bidder")
+	offerID := testOffer(t, ownerID)
+	responseID := testOfferResponse(t, offerID, bidderID, ownerID, 1000)
+
+	// the owner answers the bid with new terms, the bidder answers them
+	price, term := 1200.0, "50% on loading"
+	_, _, err := repo.CounterOfferResponse(responseID, dto.OfferResponseCounter{
+		BidPrice:    &price,
+		PaymentTerm: &term,
+	}, time.Now().Add(time.Hour), dto.OfferActor{CompanyID: ownerID, Role: "carrier"})
+	if err != nil {
+		t.Fatalf("failed to counter: %v", err)
+	}
+
+	if status, body := acceptOfferResponse(bidderID, responseID); status != http.StatusOK {
+		t.Fatalf("accept: status %d, body %+v", status, body)
+	}
+
+	var execCompanyID int
+	var offerState string
+	var offerPrice float64
+	var paymentTerm *string
+	err = db.DB.QueryRow(ctx,
+		`SELECT exec_company_id, offer_state::text, offer_price, payment_term FROM tbl_offer WHERE id = $1`,
+		offerID).Scan(&execCompanyID, &offerState, &offerPrice, &paymentTerm)
+	if err != nil {
+		t.Fatalf("failed to read offer: %v", err)
+	}
+	if execCompanyID != bidderID || offerState != dto.OfferStateAssigned {
+		t.Errorf("offer is %s with executor %d, want assigned with %d", offerState, execCompanyID, bidderID)
+	}
+	if offerPrice != price || paymentTerm == nil || *paymentTerm != term {
+		t.Errorf("offer terms are %v, %v, want the countered %v, %q", offerPrice, paymentTerm, price, term)
+	}
+
+	var actorCompanyID int
+	err = db.DB.QueryRow(ctx,
+		`SELECT actor_company_id FROM tbl_offer_state_history
+		 WHERE offer_id = $1 AND to_state = 'assigned' ORDER BY id DESC LIMIT 1`,
+		offerID).Scan(&actorCompanyID)
+	if err != nil {
+		t.Fatalf("failed to read offer state history: %v", err)
+	}
+	if actorCompanyID != bidderID {
+		t.Errorf("assign was recorded for company %d, want the bidder %d", actorCompanyID, bidderID)
+	}
+}
+
+func TestUpdateOfferResponseCounterAcceptRace(t *testing.T) {
+	testDB(t)
+	ctx := context.Background()
+
+	ownerID := testCompany(t, "race test owner")
+	counteredID := testCompany(t, "race test countered bidder")
+	competingID := testCompany(t, "race test competing bidder")
+	offerID := testOffer(t, ownerID)
+	counteredResponse := testOfferResponse(t, offerID, counteredID, ownerID, 1000)
+	competingResponse := testOfferResponse(t, offerID, competingID, ownerID, 1100)
+
+	price := 1050.0
+	_, _, err := repo.CounterOfferResponse(counteredResponse, dto.OfferResponseCounter{BidPrice: &price},
+		time.Now().Add(time.Hour), dto.OfferActor{CompanyID: ownerID, Role: "carrier"})
+	if err != nil {
+		t.Fatalf("failed to counter: %v", err)
+	}
+
+	// the bidder accepts the counter while the owner accepts the other bid
+	accepts := map[int]int{counteredResponse: counteredID, competingResponse: ownerID}
+	executors := map[int]int{counteredResponse: counteredID, competingResponse: competingID}
+	winner := acceptConcurrently(t, accepts)
+
+	var execCompanyID int
+	var offerState string
+	var offerPrice float64
+	err = db.DB.QueryRow(ctx,
+		`SELECT exec_company_id, offer_state::text, offer_price FROM tbl_offer WHERE id = $1`,
+		offerID).Scan(&execCompanyID, &offerState, &offerPrice)
+	if err != nil {
+		t.Fatalf("failed to read offer: %v", err)
+	}
+	if execCompanyID != executors[winner] || offerState != dto.OfferStateAssigned {
+		t.Errorf("offer is %s with executor %d, want assigned with %d", offerState, execCompanyID, executors[winner])
+	}
+	wantPrice := 1100.0
+	if winner == counteredResponse {
+		wantPrice = price
+	}
+	if offerPrice != wantPrice {
+		t.Errorf("offer_price is %v, want %v of response %d", offerPrice, wantPrice, winner)
+	}
+
+	for id, state := range offerResponseStates(t, offerID) {
+		want := "declined"
+		if id == winner {
+			want = "accepted"
+		}
+		if state != want {
+			t.Errorf("response %d is %s, want %s", id, state, want)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"texApi/config"
+	"texApi/internal/dto"
+	"texApi/internal/repo"
+	"texApi/pkg/utils"
+)
+
+func offerReviewErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repo.ErrReviewNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repo.ErrReviewForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, repo.ErrReviewTarget):
+		return http.StatusBadRequest
+	case errors.Is(err, repo.ErrReviewOfferState), errors.Is(err, repo.ErrReviewDuplicate):
+		return http.StatusConflict
+	default:
+		return offerStateErrorStatus(err)
+	}
+}
+
+// reviewListParams reads the page of a review list, 20 reviews by default
+func reviewListParams(ctx *gin.Context) dto.OfferReviewListParams {
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(ctx.DefaultQuery("per_page", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+	return dto.OfferReviewListParams{Page: page, PerPage: perPage}
+}
+
+func writeReviewList(ctx *gin.Context, params dto.OfferReviewListParams) {
+	reviews, total, err := repo.ListOfferReviews(params)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve reviews", err.Error()))
+		return
+	}
+	if reviews == nil {
+		reviews = []dto.OfferReview{}
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Reviews", utils.PaginatedResponse{
+		Total:   total,
+		Page:    params.Page,
+		PerPage: params.PerPage,
+		Data:    reviews,
+	}))
+}
+
+// CreateOfferReview rates a party of the completed offer. With
+// OFFER_REVIEW_PREMODERATION the review waits for an admin before it counts.
+func CreateOfferReview(ctx *gin.Context) {
+	offerID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid offer ID", err.Error()))
+		return
+	}
+
+	var input dto.OfferReviewInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid request body", err.Error()))
+		return
+	}
+
+	state := dto.ReviewStatePublished
+	if config.ENV.OFFER_REVIEW_PREMODERATION {
+		state = dto.ReviewStatePending
+	}
+
+	review, err := repo.CreateOfferReview(offerID, input, offerActor(ctx), state)
+	if err != nil {
+		ctx.JSON(offerReviewErrorStatus(err), utils.FormatErrorResponse("Review can not be created", err.Error()))
+		return
+	}
+	if review.State == dto.ReviewStatePublished {
+		notifyOfferReview(review)
+	}
+
+	ctx.JSON(http.StatusCreated, utils.FormatResponse("Review created", review))
+}
+
+// GetOfferReviews lists the reviews of the offer, admins also see the
+// pending and hidden ones
+func GetOfferReviews(ctx *gin.Context) {
+	offerID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid offer ID", err.Error()))
+		return
+	}
+
+	params := reviewListParams(ctx)
+	params.OfferID = offerID
+	if !offerActor(ctx).IsAdmin() {
+		params.States = []string{dto.ReviewStatePublished}
+	}
+	writeReviewList(ctx, params)
+}
+
+// GetCompanyReviews lists the published reviews of the company
+func GetCompanyReviews(ctx *gin.Context) {
+	companyID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid company ID", err.Error()))
+		return
+	}
+
+	params := reviewListParams(ctx)
+	params.TargetCompanyID = companyID
+	params.States = []string{dto.ReviewStatePublished}
+	writeReviewList(ctx, params)
+}
+
+// GetDriverReviews lists the published reviews of the driver
+func GetDriverReviews(ctx *gin.Context) {
+	driverID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid driver ID", err.Error()))
+		return
+	}
+
+	params := reviewListParams(ctx)
+	params.TargetDriverID = driverID
+	params.States = []string{dto.ReviewStatePublished}
+	writeReviewList(ctx, params)
+}
+
+// GetReviewList is the moderation list of admins, filtered by state, company_id
+// and driver_id
+func GetReviewList(ctx *gin.Context) {
+	params := reviewListParams(ctx)
+	params.TargetCompanyID, _ = strconv.Atoi(ctx.Query("company_id"))
+	params.TargetDriverID, _ = strconv.Atoi(ctx.Query("driver_id"))
+	params.OfferID, _ = strconv.Atoi(ctx.Query("offer_id"))
+	if state := ctx.Query("state"); state != "" {
+		params.States = []string{state}
+	}
+	writeReviewList(ctx, params)
+}
+
+// ModerateOfferReview publishes, hides or holds back a review
+func ModerateOfferReview(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid review ID", err.Error()))
+		return
+	}
+
+	var input dto.OfferReviewModeration
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid request body", err.Error()))
+		return
+	}
+
+	before, err := repo.GetOfferReview(id)
+	if err != nil {
+		ctx.JSON(offerReviewErrorStatus(err), utils.FormatErrorResponse("Review not found", err.Error()))
+		return
+	}
+
+	review, err := repo.ModerateOfferReview(id, input, offerActor(ctx))
+	if err != nil {
+		ctx.JSON(offerReviewErrorStatus(err), utils.FormatErrorResponse("Review can not be moderated", err.Error()))
+		return
+	}
+	if before.State == dto.ReviewStatePending && review.State == dto.ReviewStatePublished {
+		notifyOfferReview(review)
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Review moderated", review))
+}
+
+func DeleteOfferReview(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid review ID", err.Error()))
+		return
+	}
+
+	if err := repo.DeleteOfferReview(id, offerActor(ctx)); err != nil {
+		ctx.JSON(offerReviewErrorStatus(err), utils.FormatErrorResponse("Review can not be deleted", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Review deleted", gin.H{"id": id}))
+}
+
+// notifyOfferReview tells the reviewed company about its new review, driver
+// reviews go to the company of the driver
+func notifyOfferReview(review dto.OfferReview) {
+	companyID := review.TargetCompanyID
+	subject := "your company"
+	if review.TargetDriverID != 0 {
+		driverCompanyID, err := repo.GetDriverCompanyID(review.TargetDriverID)
+		if err != nil {
+			return
+		}
+		companyID = driverCompanyID
+		subject = "your driver"
+	}
+
+	title := fmt.Sprintf("New review on offer #%d", review.OfferID)
+	content := fmt.Sprintf("%s rated %s %d/5.", review.ReviewerName, subject, review.Rating)
+	sendNegotiationNotification(companyID, "offer_review", title, content, map[string]interface{}{
+		"type":      "offer_review",
+		"offer_id":  review.OfferID,
+		"review_id": review.ID,
+		"rating":    review.Rating,
+	})
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"texApi/internal/dto"
+	"texApi/internal/repo"
+	"texApi/pkg/utils"
+)
+
+// SearchOffers is GET /offer/find/, full-text and radius search with the
+// filters of GET /offer/
+func SearchOffers(ctx *gin.Context) {
+	var query dto.OfferSearchQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid query parameters", err.Error()))
+		return
+	}
+
+	if (query.PickupLat == nil) != (query.PickupLng == nil) || (query.DropoffLat == nil) != (query.DropoffLng == nil) {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid query parameters",
+			"lat and lng must be sent together"))
+		return
+	}
+	if (query.PickupRadiusKM > 0 && query.PickupLat == nil) || (query.DropoffRadiusKM > 0 && query.DropoffLat == nil) {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid query parameters",
+			"a radius needs the lat and lng of its point"))
+		return
+	}
+
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PerPage == 0 {
+		query.PerPage = 10
+	}
+	if query.OrderBy == "" {
+		switch {
+		case query.Q != "":
+			query.OrderBy, query.OrderDir = "relevance", "DESC"
+		case query.PickupLat != nil:
+			query.OrderBy, query.OrderDir = "pickup_distance_km", "ASC"
+		case query.DropoffLat != nil:
+			query.OrderBy, query.OrderDir = "dropoff_distance_km", "ASC"
+		default:
+			query.OrderBy = "id"
+		}
+	}
+	if query.OrderDir == "" {
+		query.OrderDir = "DESC"
+	}
+	if err := repo.OfferSearchSort.ValidateOrderBy(query.OrderBy); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid query parameters", err.Error()))
+		return
+	}
+	if err := repo.OfferSearchSort.ValidateDirection(query.OrderDir); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid query parameters", err.Error()))
+		return
+	}
+
+	role := ctx.MustGet("role").(string)
+	offers, total, err := repo.SearchOffers(query, role == "admin" || role == "system")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Couldn't retrieve data", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Offer list", utils.PaginatedResponse{
+		Total:   total,
+		Page:    query.Page,
+		PerPage: query.PerPage,
+		Data:    offers,
+	}))
+}
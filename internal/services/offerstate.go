@@ -0,0 +1,63 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"texApi/internal/dto"
+	"texApi/internal/repo"
+	"texApi/pkg/utils"
+)
+
+func offerActor(ctx *gin.Context) dto.OfferActor {
+	return dto.OfferActor{
+		UserID:    ctx.MustGet("id").(int),
+		CompanyID: ctx.MustGet("companyID").(int),
+		Role:      ctx.MustGet("role").(string),
+	}
+}
+
+// offerStateErrorStatus maps lifecycle errors of the repo to a response status
+func offerStateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repo.ErrOfferNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repo.ErrOfferStateForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, repo.ErrOfferStateTransition):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func ChangeOfferState(ctx *gin.Context) {
+	offerID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid offer ID", err.Error()))
+		return
+	}
+
+	var input dto.OfferStateInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid request body", err.Error()))
+		return
+	}
+
+	change, err := repo.TransitionOffer(offerID, input.State, offerActor(ctx), input.Reason)
+	if err != nil {
+		ctx.JSON(offerStateErrorStatus(err), utils.FormatErrorResponse("Failed to change offer state", err.Error()))
+		return
+	}
+
+	if change.ToState == dto.OfferStateActive {
+		go notifySavedSearches(offerID)
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Offer state changed successfully", gin.H{
+		"change":      change,
+		"next_states": repo.OfferStateTransitions(change.ToState),
+	}))
+}
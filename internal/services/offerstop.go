@@ -0,0 +1,89 @@
+package services
+
+import (
+	"texApi/internal/dto"
+	"texApi/internal/repo"
+)
+
+// fillOfferRouteFromStops sets the from/to fields the offer lists and filters
+// work with to the first pickup and the last dropoff, unless they were sent
+func fillOfferRouteFromStops(offer *dto.Offer) {
+	if len(offer.Stops) == 0 {
+		return
+	}
+	first, last := offer.Stops[0], offer.Stops[len(offer.Stops)-1]
+
+	setIfEmpty := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	setIfZero := func(field *int, value int) {
+		if *field == 0 {
+			*field = value
+		}
+	}
+
+	setIfEmpty(&offer.FromCountry, first.Country)
+	setIfEmpty(&offer.FromRegion, first.Region)
+	setIfEmpty(&offer.FromAddress, first.Address)
+	setIfZero(&offer.FromCountryID, first.CountryID)
+	setIfZero(&offer.FromCityID, first.CityID)
+	setIfEmpty(&offer.ToCountry, last.Country)
+	setIfEmpty(&offer.ToRegion, last.Region)
+	setIfEmpty(&offer.ToAddress, last.Address)
+	setIfZero(&offer.ToCountryID, last.CountryID)
+	setIfZero(&offer.ToCityID, last.CityID)
+}
+
+// fillOfferUpdateRouteFromStops is fillOfferRouteFromStops for updates, the
+// fields left out of the update follow the new stops
+func fillOfferUpdateRouteFromStops(offer *dto.OfferUpdate) {
+	if offer.Stops == nil || len(*offer.Stops) == 0 {
+		return
+	}
+	stops := *offer.Stops
+	first, last := stops[0], stops[len(stops)-1]
+
+	setIfNil := func(field **string, value string) {
+		if *field == nil {
+			*field = &value
+		}
+	}
+	setIDIfNil := func(field **int, value int) {
+		if *field == nil {
+			*field = &value
+		}
+	}
+
+	setIfNil(&offer.FromCountry, first.Country)
+	setIfNil(&offer.FromRegion, first.Region)
+	setIfNil(&offer.FromAddress, first.Address)
+	setIDIfNil(&offer.FromCountryID, first.CountryID)
+	setIDIfNil(&offer.FromCityID, first.CityID)
+	setIfNil(&offer.ToCountry, last.Country)
+	setIfNil(&offer.ToRegion, last.Region)
+	setIfNil(&offer.ToAddress, last.Address)
+	setIDIfNil(&offer.ToCountryID, last.CountryID)
+	setIDIfNil(&offer.ToCityID, last.CityID)
+}
+
+// attachOfferStops loads the stops of the listed offers
+func attachOfferStops(offers []dto.OfferDetailedResponse) error {
+	if len(offers) == 0 {
+		return nil
+	}
+	ids := make([]int, len(offers))
+	for i := range offers {
+		ids[i] = offers[i].ID
+	}
+
+	stops, err := repo.GetOfferStops(ids)
+	if err != nil {
+		return err
+	}
+	for i := range offers {
+		offers[i].Stops = stops[offers[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"texApi/internal/dto"
+	"texApi/internal/firebasePush"
+	"texApi/internal/repo"
+	"texApi/pkg/recurrence"
+	"texApi/pkg/utils"
+)
+
+// validateTemplateRecurrence checks the rule and the date range of a template
+func validateTemplateRecurrence(rule recurrence.Rule, startsOn, endsOn *time.Time) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	if startsOn != nil && endsOn != nil && endsOn.Before(*startsOn) {
+		return fmt.Errorf("ends_on is before starts_on")
+	}
+	return nil
+}
+
+func offerTemplateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repo.ErrOfferTemplateNotFound), errors.Is(err, repo.ErrOfferNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repo.ErrOfferStops):
+		return http.StatusBadRequest
+	default:
+		return planErrorStatus(err)
+	}
+}
+
+func CreateOfferTemplate(ctx *gin.Context) {
+	var input dto.OfferTemplateInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid request body", err.Error()))
+		return
+	}
+
+	if input.Recurrence == "" {
+		input.Recurrence = recurrence.None
+	}
+	rule := recurrence.Rule{Kind: input.Recurrence, Weekdays: input.Weekdays, MonthDay: input.MonthDay, Cron: input.Cron}
+	if err := validateTemplateRecurrence(rule, input.StartsOn, input.EndsOn); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid recurrence", err.Error()))
+		return
+	}
+
+	id, err := repo.CreateOfferTemplate(input, ctx.MustGet("id").(int), gpsScopeCompanyID(ctx))
+	if err != nil {
+		ctx.JSON(offerTemplateErrorStatus(err), utils.FormatErrorResponse("Failed to create offer template", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, utils.FormatResponse("Offer template created successfully", gin.H{"id": id}))
+}
+
+func GetOfferTemplates(ctx *gin.Context) {
+	templates, err := repo.GetOfferTemplates(gpsScopeCompanyID(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve offer templates", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Offer templates retrieved successfully", templates))
+}
+
+func GetOfferTemplate(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid offer template ID", err.Error()))
+		return
+	}
+
+	template, err := repo.GetOfferTemplate(id, gpsScopeCompanyID(ctx))
+	if err != nil {
+		ctx.JSON(offerTemplateErrorStatus(err), utils.FormatErrorResponse("Failed to retrieve offer template", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Offer template retrieved successfully", template))
+}
+
+func UpdateOfferTemplate(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid offer template ID", err.Error()))
+		return
+	}
+
+	var input dto.OfferTemplateUpdate
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid request body", err.Error()))
+		return
+	}
+
+	if input.Recurrence != nil {
+		rule := recurrence.Rule{Kind: *input.Recurrence, Weekdays: input.Weekdays, MonthDay: input.MonthDay, Cron: input.Cron}
+		if err := validateTemplateRecurrence(rule, input.StartsOn, input.EndsOn); err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid recurrence", err.Error()))
+			return
+		}
+	}
+
+	if err := repo.UpdateOfferTemplate(id, gpsScopeCompanyID(ctx), input); err != nil {
+		ctx.JSON(offerTemplateErrorStatus(err), utils.FormatErrorResponse("Failed to update offer template", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Offer template updated successfully", gin.H{"id": id}))
+}
+
+func DeleteOfferTemplate(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid offer template ID", err.Error()))
+		return
+	}
+
+	if err := repo.DeleteOfferTemplate(id, gpsScopeCompanyID(ctx)); err != nil {
+		ctx.JSON(offerTemplateErrorStatus(err), utils.FormatErrorResponse("Failed to delete offer template", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Offer template deleted successfully", gin.H{"id": id}))
+}
+
+// CreateOfferFromTemplate creates an offer from the template right away, with
+// the dates shifted to the given delivery start
+func CreateOfferFromTemplate(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid offer template ID", err.Error()))
+		return
+	}
+
+	var input dto.OfferFromTemplateInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid request body", err.Error()))
+		return
+	}
+
+	if _, err := repo.GetOfferTemplate(id, gpsScopeCompanyID(ctx)); err != nil {
+		ctx.JSON(offerTemplateErrorStatus(err), utils.FormatErrorResponse("Failed to create offer", err.Error()))
+		return
+	}
+
+	day := input.DeliveryStart.UTC()
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	offerID, created, err := repo.CreateOfferFromTemplate(id, day, false, offerActor(ctx))
+	if err != nil {
+		ctx.JSON(offerTemplateErrorStatus(err), utils.FormatErrorResponse("Failed to create offer", err.Error()))
+		return
+	}
+	if !created {
+		ctx.JSON(http.StatusConflict, utils.FormatErrorResponse("Failed to create offer",
+			"the template already has an offer for this day"))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, utils.FormatResponse("Offer created successfully", gin.H{"id": offerID}))
+}
+
+// RunOfferRecurrence creates the offers of recurring templates lead_days
+// ahead and notifies the owners (called by scheduler)
+func RunOfferRecurrence(now time.Time) error {
+	templates, err := repo.GetRecurringOfferTemplates()
+	if err != nil {
+		return err
+	}
+
+	for _, template := range templates {
+		var offerIDs []int
+		for _, day := range template.Upcoming(now.UTC(), template.LeadDays) {
+			offerID, created, err := repo.CreateOfferFromTemplate(template.ID, day, true, dto.OfferActor{
+				UserID:    template.UserID,
+				CompanyID: template.CompanyID,
+				Role:      "system",
+			})
+			if err != nil {
+				log.Printf("Error creating offer of template %d for %s: %v", template.ID, day.Format("2006-01-02"), err)
+				break
+			}
+			if created {
+				offerIDs = append(offerIDs, offerID)
+			}
+		}
+
+		if len(offerIDs) > 0 {
+			notifyOfferTemplateRun(template, offerIDs)
+		}
+	}
+	return nil
+}
+
+func notifyOfferTemplateRun(template repo.OfferTemplateScan, offerIDs []int) {
+	title := fmt.Sprintf("New offer from template \"%s\"", template.Name)
+	if len(offerIDs) > 1 {
+		title = fmt.Sprintf("%d new offers from template \"%s\"", len(offerIDs), template.Name)
+	}
+	content := fmt.Sprintf("Offers created: %v", offerIDs)
+
+	payload := firebasePush.NotificationPayload{
+		SenderName: "Offers",
+		UserID:     template.UserID,
+		Content:    content,
+		Title:      &title,
+		CreatedAt:  time.Now().Format(time.RFC3339),
+		Type:       "offer_template",
+	}
+	if err := firebasePush.SendNotificationToUser(template.UserID, payload); err != nil {
+		log.Printf("Error sending offer template notification to user %d: %v", template.UserID, err)
+	}
+
+	sendSystemMessage(template.UserID, title+"\n"+content, map[string]interface{}{
+		"type":        "offer_template",
+		"template_id": template.ID,
+		"offer_ids":   offerIDs,
+	})
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"texApi/internal/dto"
+	"texApi/internal/firebasePush"
+	"texApi/internal/repo"
+	"texApi/pkg/utils"
+)
+
+// tenderErrorStatus maps tender errors of the repo to a response status
+func tenderErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repo.ErrTenderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repo.ErrTenderForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, repo.ErrTenderWeights):
+		return http.StatusBadRequest
+	case errors.Is(err, repo.ErrTenderOffer), errors.Is(err, repo.ErrTenderOpen), errors.Is(err, repo.ErrTenderClosed),
+		errors.Is(err, repo.ErrTenderHasBids), errors.Is(err, repo.ErrTenderDuplicateBid):
+		return http.StatusConflict
+	default:
+		return offerStateErrorStatus(err)
+	}
+}
+
+// sealedTenderBidFilter hides the bids of other companies on sealed tenders
+// that are still open, the offer owner sees them all. The query needs the
+// response as ofr and its offer as o.
+func sealedTenderBidFilter(param int) string {
+	return fmt.Sprintf(`(ofr.company_id = $%d OR o.company_id = $%d OR NOT EXISTS (
+		SELECT 1 FROM tbl_offer_tender t WHERE t.offer_id = ofr.offer_id AND t.mode = 'sealed' AND t.state = 'open'))`,
+		param, param)
+}
+
+// SaveOfferTender opens a tender on the offer or changes its open tender
+func SaveOfferTender(ctx *gin.Context) {
+	offerID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid offer ID", err.Error()))
+		return
+	}
+
+	var input dto.OfferTenderInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid request body", err.Error()))
+		return
+	}
+	if !input.Deadline.After(time.Now()) {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid deadline", "deadline must be in the future"))
+		return
+	}
+
+	tender, err := repo.SaveOfferTender(offerID, input, offerActor(ctx))
+	if err != nil {
+		ctx.JSON(tenderErrorStatus(err), utils.FormatErrorResponse("Tender can not be saved", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Tender saved", tender))
+}
+
+// GetOfferTender returns the tender of the offer. Bidders see the bid count,
+// their own bid and the lowest bid unless the tender is sealed and open, the
+// owner and admins also see the ranked bids.
+func GetOfferTender(ctx *gin.Context) {
+	offerID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid offer ID", err.Error()))
+		return
+	}
+
+	tender, err := repo.GetOfferTender(offerID)
+	if err != nil {
+		ctx.JSON(tenderErrorStatus(err), utils.FormatErrorResponse("Tender not found", err.Error()))
+		return
+	}
+	owner, err := repo.GetOfferOwner(offerID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, utils.FormatErrorResponse("Offer not found", err.Error()))
+		return
+	}
+	bids, err := repo.GetTenderBids(offerID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve bids", err.Error()))
+		return
+	}
+
+	actor := offerActor(ctx)
+	manager := actor.IsAdmin() || (actor.CompanyID != 0 && actor.CompanyID == owner.CompanyID)
+	sealed := tender.Mode == dto.TenderModeSealed && tender.State == dto.TenderStateOpen
+
+	details := dto.OfferTenderDetails{OfferTender: tender}
+	for _, bid := range tender.Rank(bids) {
+		if bid.State == "pending" {
+			details.BidCount++
+			if !sealed || manager {
+				if details.LowestBid == nil || bid.BidPrice < *details.LowestBid {
+					price := bid.BidPrice
+					details.LowestBid = &price
+				}
+			}
+		}
+		if bid.CompanyID == actor.CompanyID && details.MyBid == nil {
+			myBid := bid
+			details.MyBid = &myBid
+		}
+		if manager {
+			details.Bids = append(details.Bids, bid)
+		}
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Offer tender", details))
+}
+
+// DeleteOfferTender cancels the open tender of the offer
+func DeleteOfferTender(ctx *gin.Context) {
+	offerID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid offer ID", err.Error()))
+		return
+	}
+
+	if err := repo.DeleteOfferTender(offerID, offerActor(ctx)); err != nil {
+		ctx.JSON(tenderErrorStatus(err), utils.FormatErrorResponse("Tender can not be cancelled", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Tender cancelled", gin.H{"offer_id": offerID}))
+}
+
+// RunTenderClose closes the tenders past their deadline, awards them by their
+// rule and notifies the owner and the bidders (called by scheduler)
+func RunTenderClose(now time.Time) error {
+	ids, err := repo.GetDueTenderOfferIDs(now)
+	if err != nil {
+		return err
+	}
+
+	closed := 0
+	for _, id := range ids {
+		tender, err := repo.CloseTender(id, now)
+		if err != nil {
+			log.Printf("Error closing tender of offer %d: %v", id, err)
+			continue
+		}
+		if tender == nil {
+			continue
+		}
+		closed++
+		notifyTenderClosed(*tender)
+	}
+
+	if closed > 0 {
+		log.Printf("Closed %d tenders", closed)
+	}
+	return nil
+}
+
+func notifyTenderClosed(tender repo.ClosedTender) {
+	extras := map[string]interface{}{
+		"type":     "offer_tender",
+		"offer_id": tender.OfferID,
+		"state":    tender.State,
+	}
+
+	title := fmt.Sprintf("Tender on offer #%d closed", tender.OfferID)
+	var content string
+	switch {
+	case tender.State == dto.TenderStateNoBids:
+		content = "The tender closed without bids."
+	case tender.Winner != nil:
+		content = fmt.Sprintf("%d bids, the tender was awarded to %s for %.2f (response #%d).",
+			len(tender.Bids), tender.Winner.CompanyName, tender.Winner.BidPrice, tender.Winner.ResponseID)
+	case tender.Note != "":
+		content = fmt.Sprintf("%d bids, the automatic award failed (%s). Please choose the winner.", len(tender.Bids), tender.Note)
+	default:
+		content = fmt.Sprintf("%d bids, please choose the winner.", len(tender.Bids))
+	}
+	if tender.OwnerUserID != 0 {
+		sendTenderNotification(tender.OwnerUserID, title, content, extras)
+	}
+
+	for _, bid := range tender.Bids {
+		if bid.UserID == 0 {
+			continue
+		}
+		var bidContent string
+		switch {
+		case tender.Winner == nil:
+			bidContent = fmt.Sprintf("Your bid of %.2f is being reviewed by the offer owner.", bid.BidPrice)
+		case bid.ResponseID == tender.Winner.ResponseID:
+			bidContent = fmt.Sprintf("Your bid of %.2f won the tender.", bid.BidPrice)
+		default:
+			bidContent = fmt.Sprintf("Your bid of %.2f was not selected.", bid.BidPrice)
+		}
+		bidExtras := map[string]interface{}{
+			"type":        "offer_tender",
+			"offer_id":    tender.OfferID,
+			"response_id": bid.ResponseID,
+			"state":       tender.State,
+		}
+		sendTenderNotification(bid.UserID, title, bidContent, bidExtras)
+	}
+}
+
+func sendTenderNotification(userID int, title, content string, extras map[string]interface{}) {
+	payload := firebasePush.NotificationPayload{
+		SenderName: "Offers",
+		UserID:     userID,
+		Content:    content,
+		Title:      &title,
+		CreatedAt:  time.Now().Format(time.RFC3339),
+		Type:       "offer_tender",
+	}
+	if err := firebasePush.SendNotificationToUser(userID, payload); err != nil {
+		log.Printf("Error sending tender notification to user %d: %v", userID, err)
+	}
+
+	sendSystemMessage(userID, title+"\n"+content, extras)
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"texApi/internal/repo"
+	"texApi/pkg/utils"
+)
+
+// planErrorStatus maps quota errors of the repo to a response status
+func planErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repo.ErrPlanFeatureUnavailable), errors.Is(err, repo.ErrPlanQuotaExceeded):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GetPlanUsage returns the plan of the company with its usage in the current
+// billing cycle, admins may pass company_id
+func GetPlanUsage(ctx *gin.Context) {
+	companyID := ctx.MustGet("companyID").(int)
+	if scope := gpsScopeCompanyID(ctx); scope == nil && ctx.Query("company_id") != "" {
+		id, err := strconv.Atoi(ctx.Query("company_id"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid company ID", err.Error()))
+			return
+		}
+		companyID = id
+	}
+
+	usage, err := repo.GetPlanUsage(companyID, time.Now())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve plan usage", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Plan usage", usage))
+}
@@ -693,7 +693,7 @@ func findMatchingOffers(filters dto.PriceQuoteAnalysisFilters) ([]map[string]int
 	var stats OfferStats
 	var matchingCriteria []string
 
-	whereParts := []string{"deleted = 0", "active = 1", "offer_state != 'disabled'"}
+	whereParts := []string{"deleted = 0", "active = 1", "offer_state NOT IN ('draft', 'cancelled')"}
 	args := []interface{}{}
 	argIndex := 1
 
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"texApi/config"
+	"texApi/internal/dto"
+	"texApi/internal/firebasePush"
+	"texApi/internal/repo"
+	"texApi/pkg/smtp"
+	"texApi/pkg/utils"
+)
+
+const maxSavedSearches = 20 // per user
+
+func CreateSavedSearch(ctx *gin.Context) {
+	var input dto.SavedSearchInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid request body", err.Error()))
+		return
+	}
+
+	if input.Filters == nil {
+		var filters dto.OfferSearchFilters
+		if err := ctx.ShouldBindQuery(&filters); err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid query parameters", err.Error()))
+			return
+		}
+		input.Filters = &filters
+	}
+
+	userID := ctx.MustGet("id").(int)
+	count, err := repo.CountSavedSearches(userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to create saved search", err.Error()))
+		return
+	}
+	if count >= maxSavedSearches {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Saved search limit reached",
+			fmt.Sprintf("up to %d searches can be saved", maxSavedSearches)))
+		return
+	}
+
+	id, err := repo.CreateSavedSearch(userID, ctx.MustGet("companyID").(int), input)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to create saved search", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, utils.FormatResponse("Saved search created successfully", gin.H{"id": id}))
+}
+
+func GetSavedSearches(ctx *gin.Context) {
+	searches, err := repo.GetSavedSearches(ctx.MustGet("id").(int))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve saved searches", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Saved searches retrieved successfully", searches))
+}
+
+func GetSavedSearch(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid saved search ID", err.Error()))
+		return
+	}
+
+	search, err := repo.GetSavedSearch(id, ctx.MustGet("id").(int))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, utils.FormatErrorResponse("Saved search not found", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Saved search retrieved successfully", search))
+}
+
+func UpdateSavedSearch(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid saved search ID", err.Error()))
+		return
+	}
+
+	var input dto.SavedSearchInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid request body", err.Error()))
+		return
+	}
+
+	if err := repo.UpdateSavedSearch(id, ctx.MustGet("id").(int), input); err != nil {
+		ctx.JSON(http.StatusNotFound, utils.FormatErrorResponse("Failed to update saved search", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Saved search updated successfully", gin.H{"id": id}))
+}
+
+func DeleteSavedSearch(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid saved search ID", err.Error()))
+		return
+	}
+
+	if err := repo.DeleteSavedSearch(id, ctx.MustGet("id").(int)); err != nil {
+		ctx.JSON(http.StatusNotFound, utils.FormatErrorResponse("Failed to delete saved search", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Saved search deleted successfully", gin.H{"id": id}))
+}
+
+// notifySavedSearches matches an offer that became active against the saved
+// searches. Instant searches are notified right away, daily ones wait for the digest.
+func notifySavedSearches(offerID int) {
+	recipients, err := repo.MatchSavedSearches(offerID)
+	if err != nil {
+		log.Printf("Error matching saved searches for offer %d: %v", offerID, err)
+		return
+	}
+
+	var offers []dto.OfferBrief
+	for _, recipient := range recipients {
+		if recipient.Frequency != dto.SearchFrequencyInstant {
+			continue
+		}
+		if offers == nil {
+			if offers, err = repo.GetSavedSearchMatchOffers(recipient.MatchIDs); err != nil {
+				log.Printf("Error loading offer %d for saved searches: %v", offerID, err)
+				return
+			}
+		}
+		deliverSavedSearch(recipient, offers, false)
+	}
+}
+
+// RunSavedSearchDigest sends the pending matches of daily searches once a day,
+// at SAVED_SEARCH_DIGEST_HOUR or on the first run after it (called by scheduler)
+func RunSavedSearchDigest(now time.Time) error {
+	cutoff := time.Date(now.Year(), now.Month(), now.Day(), config.ENV.SAVED_SEARCH_DIGEST_HOUR, 0, 0, 0, now.Location())
+	if now.Before(cutoff) {
+		return nil
+	}
+
+	recipients, err := repo.GetDueSavedSearchDigests(cutoff)
+	if err != nil {
+		return err
+	}
+
+	for _, recipient := range recipients {
+		offers, err := repo.GetSavedSearchMatchOffers(recipient.MatchIDs)
+		if err != nil {
+			log.Printf("Error loading digest of saved search %d: %v", recipient.ID, err)
+			continue
+		}
+		deliverSavedSearch(recipient, offers, true)
+	}
+	return nil
+}
+
+func offerBriefLine(offer dto.OfferBrief) string {
+	return fmt.Sprintf("#%d %s, %s → %s, %s: %.2f %s, from %s",
+		offer.ID, offer.FromCountry, offer.FromRegion, offer.ToCountry, offer.ToRegion,
+		offer.OfferPrice, offer.Currency, offer.DeliveryStart.Format("2006-01-02"))
+}
+
+// deliverSavedSearch sends the offers through the channels of the search and
+// marks its matches notified. Matches whose offer is gone are only marked.
+func deliverSavedSearch(recipient dto.SavedSearchRecipient, offers []dto.OfferBrief, digest bool) {
+	if len(offers) > 0 {
+		title := fmt.Sprintf("New offer for \"%s\"", recipient.Name)
+		if len(offers) > 1 {
+			title = fmt.Sprintf("%d new offers for \"%s\"", len(offers), recipient.Name)
+		}
+
+		lines := make([]string, len(offers))
+		offerIDs := make([]int, len(offers))
+		for i, offer := range offers {
+			lines[i] = offerBriefLine(offer)
+			offerIDs[i] = offer.ID
+		}
+		content := strings.Join(lines, "\n")
+
+		if recipient.NotifyPush == 1 {
+			payload := firebasePush.NotificationPayload{
+				SenderName: "Offers",
+				UserID:     recipient.UserID,
+				Content:    content,
+				Title:      &title,
+				CreatedAt:  time.Now().Format(time.RFC3339),
+				Type:       "saved_search",
+			}
+			if err := firebasePush.SendNotificationToUser(recipient.UserID, payload); err != nil {
+				log.Printf("Error sending saved search notification to user %d: %v", recipient.UserID, err)
+			}
+		}
+
+		if recipient.NotifyEmail == 1 && recipient.Email != "" {
+			if err := smtp.SendNotificationEmail(recipient.Email, title,
+				"These offers match your saved search.", lines, ""); err != nil {
+				log.Printf("Error sending saved search email to user %d: %v", recipient.UserID, err)
+			}
+		}
+
+		if recipient.NotifyChat == 1 {
+			sendSystemMessage(recipient.UserID, title+"\n"+content, map[string]interface{}{
+				"type":      "saved_search",
+				"search_id": recipient.ID,
+				"offer_ids": offerIDs,
+				"digest":    digest,
+			})
+		}
+	}
+
+	if err := repo.MarkSavedSearchNotified(recipient.ID, recipient.MatchIDs, digest); err != nil {
+		log.Printf("Error marking saved search %d notified: %v", recipient.ID, err)
+	}
+}
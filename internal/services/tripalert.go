@@ -0,0 +1,187 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"texApi/internal/dto"
+	"texApi/internal/firebasePush"
+	"texApi/internal/repo"
+	"texApi/pkg/utils"
+)
+
+var tripAlertTitles = map[string]string{
+	dto.TripAlertDeviation: "Vehicle left the route corridor",
+	dto.TripAlertIdle:      "Vehicle is idle for too long",
+	dto.TripAlertSpeed:     "Vehicle exceeded the speed limit",
+}
+
+var tripAlertUnits = map[string]string{
+	dto.TripAlertDeviation: "km",
+	dto.TripAlertIdle:      "min",
+	dto.TripAlertSpeed:     "km/h",
+}
+
+// tripIDParam parses :id and checks the caller takes part in the trip
+func tripIDParam(ctx *gin.Context) (int, bool) {
+	tripID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid trip ID", err.Error()))
+		return 0, false
+	}
+
+	if scope := gpsScopeCompanyID(ctx); scope != nil && !repo.CanCompanyAccessTrip(tripID, *scope) {
+		ctx.JSON(http.StatusForbidden, utils.FormatErrorResponse("Access denied", "You don't have access to this trip"))
+		return 0, false
+	}
+
+	return tripID, true
+}
+
+func SaveTripRule(ctx *gin.Context) {
+	tripID, ok := tripIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	var input dto.TripRuleInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid input data", err.Error()))
+		return
+	}
+
+	if input.MaxDeviationKM == nil && input.MaxIdleMin == nil && input.MaxSpeedKMH == nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("At least one rule is required",
+			"set max_deviation_km, max_idle_min or max_speed_kmh"))
+		return
+	}
+
+	id, err := repo.SaveTripRule(tripID, ctx.MustGet("companyID").(int), input)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Failed to save trip rule", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Trip rule saved successfully", gin.H{"id": id}))
+}
+
+func GetTripRule(ctx *gin.Context) {
+	tripID, ok := tripIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	rule, err := repo.GetTripRule(tripID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, utils.FormatErrorResponse("Trip rule not found", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Trip rule retrieved successfully", rule))
+}
+
+func DeleteTripRule(ctx *gin.Context) {
+	tripID, ok := tripIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	if err := repo.DeleteTripRule(tripID); err != nil {
+		ctx.JSON(http.StatusNotFound, utils.FormatErrorResponse("Trip rule not found", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Trip rule deleted successfully", gin.H{"trip_id": tripID}))
+}
+
+func GetTripAlerts(ctx *gin.Context) {
+	var query dto.TripAlertQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.FormatErrorResponse("Invalid query parameters", err.Error()))
+		return
+	}
+
+	query.ScopeCompanyID = gpsScopeCompanyID(ctx)
+
+	alerts, err := repo.GetTripAlerts(query)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.FormatErrorResponse("Failed to retrieve trip alerts", err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.FormatResponse("Trip alerts retrieved successfully", alerts))
+}
+
+// notifyTripAlerts sends every new alert to the owners of the trip's offers,
+// as a push and as a chat system message
+func notifyTripAlerts(alerts []dto.TripAlert) {
+	if len(alerts) == 0 {
+		return
+	}
+
+	tripIDs := make([]int, 0, len(alerts))
+	for _, alert := range alerts {
+		tripIDs = append(tripIDs, alert.TripID)
+	}
+
+	tripOffers, err := repo.GetTripOfferIDs(tripIDs)
+	if err != nil {
+		log.Printf("Failed to get trip alert recipients: %v", err)
+		return
+	}
+
+	var offerIDs []int
+	for _, ids := range tripOffers {
+		offerIDs = append(offerIDs, ids...)
+	}
+	owners, err := repo.GetOfferOwners(offerIDs)
+	if err != nil {
+		log.Printf("Failed to get trip alert recipients: %v", err)
+		return
+	}
+
+	for _, alert := range alerts {
+		title := tripAlertTitles[alert.AlertType]
+		content := fmt.Sprintf("%s: %.1f %s, limit %.1f %s (trip #%d, vehicle #%d)",
+			title, alert.Value, tripAlertUnits[alert.AlertType],
+			alert.LimitValue, tripAlertUnits[alert.AlertType], alert.TripID, alert.VehicleID)
+
+		notified := make(map[int]bool)
+		for _, offerID := range tripOffers[alert.TripID] {
+			owner, ok := owners[offerID]
+			if !ok || owner.UserID == 0 || notified[owner.UserID] {
+				continue
+			}
+			notified[owner.UserID] = true
+
+			payload := firebasePush.NotificationPayload{
+				SenderName: "GPS",
+				UserID:     owner.UserID,
+				Content:    content,
+				Title:      &title,
+				CreatedAt:  alert.AlertDt.Format(time.RFC3339),
+				Type:       "trip_alert",
+			}
+			if err := firebasePush.SendNotificationToUser(owner.UserID, payload); err != nil {
+				log.Printf("Error sending trip alert notification to user %d: %v", owner.UserID, err)
+			}
+
+			sendSystemMessage(owner.UserID, content, map[string]interface{}{
+				"type":        "trip_alert",
+				"alert_id":    alert.ID,
+				"alert_type":  alert.AlertType,
+				"trip_id":     alert.TripID,
+				"offer_id":    offerID,
+				"vehicle_id":  alert.VehicleID,
+				"value":       alert.Value,
+				"limit_value": alert.LimitValue,
+				"coordinates": alert.Coordinates,
+				"alert_dt":    alert.AlertDt,
+			})
+		}
+	}
+}
@@ -45,6 +45,11 @@ func CreateVehicle(ctx *gin.Context) {
 		vehicle.Meta2,
 		vehicle.Meta3,
 		vehicle.Available,
+		vehicle.PayloadKG,
+		vehicle.VolumeM3,
+		vehicle.LoadingMeters,
+		vehicle.Reefer,
+		vehicle.ADR,
 	).Scan(&id)
 
 	if err != nil {
@@ -91,6 +96,11 @@ func UpdateVehicle(ctx *gin.Context) {
 		vehicle.Meta2,
 		vehicle.Meta3,
 		vehicle.Available,
+		vehicle.PayloadKG,
+		vehicle.VolumeM3,
+		vehicle.LoadingMeters,
+		vehicle.Reefer,
+		vehicle.ADR,
 	).Scan(&updatedID)
 
 	if err != nil {
@@ -327,7 +337,8 @@ func GetVehicleList(ctx *gin.Context) {
 		vd.photo3_url, vd.docs1_url, vd.docs2_url,
 		vd.docs3_url, vd.view_count, vd.created_at,
 		vd.updated_at, vd.active, vd.deleted, vd.total_count,
-		vd.meta, vd.meta2, vd.meta3, vd.available,
+		vd.meta, vd.meta2, vd.meta3, vd.available, vd.payload_kg,
+		vd.volume_m3, vd.loading_meters, vd.reefer, vd.adr,
 		json_build_object(
 			'id', c.id,
 			'company_name', c.company_name,
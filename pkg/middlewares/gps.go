@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"net/http"
+	"texApi/internal/repo"
+	"texApi/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const GPSTokenHeader = "X-GPS-Token"
+
+// GuardGPSDevice accepts a device token bound to a driver/vehicle through the
+// X-GPS-Token header and falls back to the regular user Guard otherwise.
+func GuardGPSDevice(ctx *gin.Context) {
+	token := ctx.GetHeader(GPSTokenHeader)
+	if token == "" {
+		Guard(ctx)
+		return
+	}
+
+	gpsToken, err := repo.GetGPSTokenByValue(token)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, utils.FormatErrorResponse("Unauthorized", err.Error()))
+		return
+	}
+
+	ctx.Set("gpsToken", gpsToken)
+	ctx.Set("companyID", gpsToken.CompanyID)
+	// device tokens are API access of the company's plan
+	RequirePlanAPIAccess(ctx)
+}
@@ -0,0 +1,60 @@
+package middlewares
+
+import (
+	"net/http"
+	"time"
+
+	"texApi/config"
+	"texApi/internal/dto"
+	"texApi/internal/repo"
+	"texApi/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// planEntitlement loads the plan of the request's company. It returns false
+// when the request needs no check: quotas are off or an admin calls.
+func planEntitlement(ctx *gin.Context) (dto.PlanEntitlement, bool) {
+	role, _ := ctx.Get("role")
+	if !config.ENV.PLAN_QUOTAS_ENABLED || role == "admin" || role == "system" {
+		return dto.PlanEntitlement{}, false
+	}
+
+	entitlement, err := repo.GetCompanyEntitlement(ctx.MustGet("companyID").(int), time.Now())
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, utils.FormatErrorResponse("Couldn't check your plan", err.Error()))
+		return entitlement, false
+	}
+	return entitlement, true
+}
+
+// RequirePlanGPS lets companies whose plan has at least the GPS tracking level
+// through. Use it after Guard.
+func RequirePlanGPS(level string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		entitlement, check := planEntitlement(ctx)
+		if check && !dto.PlanLevelAtLeast(entitlement.GPSLevel(), level) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, utils.FormatErrorResponse(
+				"GPS tracking is not available on your plan",
+				"this feature needs the "+level+" GPS tracking level, your plan has "+entitlement.GPSLevel()))
+			return
+		}
+		if !ctx.IsAborted() {
+			ctx.Next()
+		}
+	}
+}
+
+// RequirePlanAPIAccess lets companies whose plan has API access through. Use
+// it after Guard.
+func RequirePlanAPIAccess(ctx *gin.Context) {
+	entitlement, check := planEntitlement(ctx)
+	if check && !entitlement.APIAccess() {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, utils.FormatErrorResponse(
+			"API access is not available on your plan", ""))
+		return
+	}
+	if !ctx.IsAborted() {
+		ctx.Next()
+	}
+}
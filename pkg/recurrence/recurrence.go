@@ -0,0 +1,216 @@
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	None    = "none"
+	Weekly  = "weekly"
+	Monthly = "monthly"
+	Cron    = "cron"
+)
+
+// Rule says on which days something repeats. Times of day are not part of a
+// rule, days are compared in the location of the times passed in.
+type Rule struct {
+	Kind     string
+	Weekdays []int  // Weekly: 1 = Monday .. 7 = Sunday
+	MonthDay int    // Monthly: 1-31, shorter months use their last day
+	Cron     string // Cron: "minute hour day-of-month month day-of-week", only the day fields are used
+}
+
+type cronDays struct {
+	dom, month, dow map[int]bool
+	domAny, dowAny  bool
+}
+
+// Validate checks that the rule can produce days
+func (r Rule) Validate() error {
+	switch r.Kind {
+	case None:
+		return nil
+	case Weekly:
+		if len(r.Weekdays) == 0 {
+			return fmt.Errorf("weekly recurrence needs at least one weekday")
+		}
+		for _, day := range r.Weekdays {
+			if day < 1 || day > 7 {
+				return fmt.Errorf("weekday %d is out of range 1-7", day)
+			}
+		}
+	case Monthly:
+		if r.MonthDay < 1 || r.MonthDay > 31 {
+			return fmt.Errorf("month day %d is out of range 1-31", r.MonthDay)
+		}
+	case Cron:
+		if _, err := parseCron(r.Cron); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown recurrence: %s", r.Kind)
+	}
+	return nil
+}
+
+// Between returns the days of the rule from from to to, both included, as
+// midnights in the location of from
+func (r Rule) Between(from, to time.Time) ([]time.Time, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	if r.Kind == None {
+		return nil, nil
+	}
+
+	var cron cronDays
+	if r.Kind == Cron {
+		cron, _ = parseCron(r.Cron)
+	}
+
+	var days []time.Time
+	day := truncateDay(from)
+	last := truncateDay(to.In(from.Location()))
+	for !day.After(last) {
+		if r.matches(day, cron) {
+			days = append(days, day)
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return days, nil
+}
+
+func (r Rule) matches(day time.Time, cron cronDays) bool {
+	switch r.Kind {
+	case Weekly:
+		weekday := isoWeekday(day)
+		for _, d := range r.Weekdays {
+			if d == weekday {
+				return true
+			}
+		}
+	case Monthly:
+		monthDay := r.MonthDay
+		if lastDay := daysInMonth(day); monthDay > lastDay {
+			monthDay = lastDay
+		}
+		return day.Day() == monthDay
+	case Cron:
+		if !cron.month[int(day.Month())] {
+			return false
+		}
+		domMatch := cron.dom[day.Day()]
+		dowMatch := cron.dow[int(day.Weekday())]
+		// like cron, a restricted day of month and day of week match either one
+		switch {
+		case cron.domAny && cron.dowAny:
+			return true
+		case cron.domAny:
+			return dowMatch
+		case cron.dowAny:
+			return domMatch
+		default:
+			return domMatch || dowMatch
+		}
+	}
+	return false
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func isoWeekday(t time.Time) int {
+	if t.Weekday() == time.Sunday {
+		return 7
+	}
+	return int(t.Weekday())
+}
+
+func daysInMonth(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+}
+
+func parseCron(spec string) (cronDays, error) {
+	var days cronDays
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return days, fmt.Errorf("cron expression needs 5 fields, got %d", len(fields))
+	}
+
+	if _, err := parseCronField(fields[0], 0, 59); err != nil {
+		return days, fmt.Errorf("minute: %w", err)
+	}
+	if _, err := parseCronField(fields[1], 0, 23); err != nil {
+		return days, fmt.Errorf("hour: %w", err)
+	}
+
+	var err error
+	if days.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return days, fmt.Errorf("day of month: %w", err)
+	}
+	if days.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return days, fmt.Errorf("month: %w", err)
+	}
+	if days.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return days, fmt.Errorf("day of week: %w", err)
+	}
+	if days.dow[7] {
+		days.dow[0] = true // 7 is Sunday as well
+	}
+	days.domAny = strings.HasPrefix(fields[2], "*")
+	days.dowAny = strings.HasPrefix(fields[4], "*")
+
+	return days, nil
+}
+
+// parseCronField reads a comma separated list of *, n, a-b with an optional /step
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := make(map[int]bool)
+
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangePart = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+
+		lo, hi := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(bounds[0])
+			hi, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil || lo > hi {
+				return nil, fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			value, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", rangePart)
+			}
+			lo, hi = value, value
+			if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max {
+			return nil, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			values[v] = true
+		}
+	}
+
+	return values, nil
+}
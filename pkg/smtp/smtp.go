@@ -3,9 +3,9 @@ package smtp
 import (
 	"bytes"
 	"fmt"
+	"html/template"
 	"log"
 	"net/smtp"
-	"text/template"
 )
 
 type SMTPConfig struct {
@@ -30,6 +30,7 @@ type EmailData struct {
 	OTP         string
 	Link        string
 	LogoURL     string
+	Items       []string
 }
 
 func SendOTPEmail(recipient, otp string) error {
@@ -49,14 +50,36 @@ func SendOTPEmail(recipient, otp string) error {
 		return err
 	}
 
+	return sendHTMLEmail(recipient, "Your OTP Code", emailBody)
+}
+
+// SendNotificationEmail sends a message with a list of items (e.g. offers)
+// and an optional link
+func SendNotificationEmail(recipient, subject, description string, items []string, link string) error {
+	emailData := EmailData{
+		Title:       subject,
+		Description: description,
+		Items:       items,
+		Link:        link,
+		LogoURL:     DefaultConfig.LogoURL,
+	}
+
+	emailBody, err := parseTemplate("assets/notification_template.html", emailData)
+	if err != nil {
+		return err
+	}
+
+	return sendHTMLEmail(recipient, subject, emailBody)
+}
+
+func sendHTMLEmail(recipient, subject, body string) error {
 	from := DefaultConfig.SenderEmail
 	to := []string{recipient}
-	subject := "Your OTP Code"
-	msg := []byte(fmt.Sprintf("To: %s\r\nSubject: %s\r\nMIME-version: 1.0;\r\nContent-Type: text/html; charset=\"UTF-8\";\r\n\r\n%s", recipient, subject, emailBody))
+	msg := []byte(fmt.Sprintf("To: %s\r\nSubject: %s\r\nMIME-version: 1.0;\r\nContent-Type: text/html; charset=\"UTF-8\";\r\n\r\n%s", recipient, subject, body))
 
 	auth := smtp.PlainAuth("", DefaultConfig.SenderEmail, DefaultConfig.Password, DefaultConfig.SMTPHost)
 
-	err = smtp.SendMail(DefaultConfig.SMTPHost+":"+DefaultConfig.SMTPPort, auth, from, to, msg)
+	err := smtp.SendMail(DefaultConfig.SMTPHost+":"+DefaultConfig.SMTPPort, auth, from, to, msg)
 	if err != nil {
 		return fmt.Errorf("failed to send email: %w", err)
 	}
@@ -0,0 +1,234 @@
+package spreadsheet
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+const FormatPDF = "pdf"
+
+// ContentTypes of the formats Writer writes
+var ContentTypes = map[string]string{
+	FormatCSV:  "text/csv; charset=utf-8",
+	FormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	FormatPDF:  "application/pdf",
+}
+
+// Writer writes a table row by row. Cells are strings, float64 numbers or nil.
+// CSV rows are written through right away, XLSX and PDF files on Close.
+type Writer interface {
+	WriteRow(cells []interface{}) error
+	Close() error
+}
+
+// NewWriter starts a table with the header in the format, title is used as the
+// sheet name and the PDF heading
+func NewWriter(w io.Writer, format, title string, header []string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, header)
+	case FormatXLSX:
+		return newXLSXWriter(w, title, header)
+	case FormatPDF:
+		return newPDFWriter(w, title, header), nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func cellText(cell interface{}) string {
+	switch v := cell.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, header []string) (*csvWriter, error) {
+	// the BOM makes Excel read the file as UTF-8
+	if _, err := w.Write([]byte("\xef\xbb\xbf")); err != nil {
+		return nil, err
+	}
+	writer := &csvWriter{writer: csv.NewWriter(w)}
+	if err := writer.writer.Write(header); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (c *csvWriter) WriteRow(cells []interface{}) error {
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		record[i] = cellText(cell)
+	}
+	return c.writer.Write(record)
+}
+
+func (c *csvWriter) Close() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+type xlsxWriter struct {
+	out    io.Writer
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	row    int
+}
+
+func newXLSXWriter(w io.Writer, title string, header []string) (*xlsxWriter, error) {
+	file := excelize.NewFile()
+	sheet := sheetName(title)
+	if err := file.SetSheetName("Sheet1", sheet); err != nil {
+		return nil, err
+	}
+	stream, err := file.NewStreamWriter(sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := &xlsxWriter{out: w, file: file, stream: stream, row: 1}
+	bold, err := file.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return nil, err
+	}
+	cells := make([]interface{}, len(header))
+	for i, title := range header {
+		cells[i] = excelize.Cell{StyleID: bold, Value: title}
+	}
+	if err := stream.SetRow("A1", cells); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// sheetName keeps a title within the 31 characters sheet names may have and
+// drops the characters they may not
+func sheetName(title string) string {
+	runes := []rune(strings.TrimSpace(strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`:\/?*[]`, r) {
+			return -1
+		}
+		return r
+	}, title)))
+	if len(runes) == 0 {
+		return "Sheet1"
+	}
+	if len(runes) > 31 {
+		runes = runes[:31]
+	}
+	return string(runes)
+}
+
+func (x *xlsxWriter) WriteRow(cells []interface{}) error {
+	x.row++
+	cell, err := excelize.CoordinatesToCellName(1, x.row)
+	if err != nil {
+		return err
+	}
+	return x.stream.SetRow(cell, cells)
+}
+
+func (x *xlsxWriter) Close() error {
+	defer x.file.Close()
+	if err := x.stream.Flush(); err != nil {
+		return err
+	}
+	return x.file.Write(x.out)
+}
+
+type pdfWriter struct {
+	out    io.Writer
+	pdf    *fpdf.Fpdf
+	header []string
+	widths []float64
+}
+
+const (
+	pdfFont       = "go"
+	pdfFontSize   = 7
+	pdfLineHeight = 5
+)
+
+func newPDFWriter(w io.Writer, title string, header []string) *pdfWriter {
+	pdf := fpdf.New("L", "mm", "A4", "")
+	// the Go fonts cover Latin, Cyrillic and the Turkmen letters
+	pdf.AddUTF8FontFromBytes(pdfFont, "", goregular.TTF)
+	pdf.AddUTF8FontFromBytes(pdfFont, "B", gobold.TTF)
+	pdf.SetMargins(8, 10, 8)
+	pdf.SetAutoPageBreak(true, 10)
+
+	writer := &pdfWriter{out: w, pdf: pdf, header: header}
+	pageWidth, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	width := (pageWidth - left - right) / float64(max(len(header), 1))
+	writer.widths = make([]float64, len(header))
+	for i := range header {
+		writer.widths[i] = width
+	}
+
+	pdf.SetHeaderFunc(func() {
+		if pdf.PageNo() == 1 {
+			pdf.SetFont(pdfFont, "B", 12)
+			pdf.CellFormat(0, 8, title, "", 1, "L", false, 0, "")
+		}
+		pdf.SetFont(pdfFont, "B", pdfFontSize)
+		pdf.SetFillColor(230, 230, 230)
+		for i, title := range writer.header {
+			pdf.CellFormat(writer.widths[i], pdfLineHeight, writer.fit(title, writer.widths[i]), "1", 0, "L", true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont(pdfFont, "", pdfFontSize)
+	})
+	pdf.AddPage()
+	return writer
+}
+
+// fit cuts the text to the cell width
+func (p *pdfWriter) fit(text string, width float64) string {
+	limit := width - 2*p.pdf.GetCellMargin()
+	if p.pdf.GetStringWidth(text) <= limit {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && p.pdf.GetStringWidth(string(runes)+"…") > limit {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+func (p *pdfWriter) WriteRow(cells []interface{}) error {
+	for i, cell := range cells {
+		if i >= len(p.widths) {
+			break
+		}
+		align := "L"
+		if _, ok := cell.(float64); ok {
+			align = "R"
+		}
+		p.pdf.CellFormat(p.widths[i], pdfLineHeight, p.fit(cellText(cell), p.widths[i]), "1", 0, align, false, 0, "")
+	}
+	p.pdf.Ln(-1)
+	return p.pdf.Error()
+}
+
+func (p *pdfWriter) Close() error {
+	return p.pdf.Output(p.out)
+}
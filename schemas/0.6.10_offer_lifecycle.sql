@@ -0,0 +1,41 @@
+-- offer_state gets its own lifecycle type, old state_t values are mapped:
+-- enabled -> active, working -> in_transit, archived -> completed,
+-- disabled/deleted -> cancelled
+CREATE TYPE offer_state_t AS ENUM (
+    'draft', 'pending', 'active', 'assigned', 'in_transit', 'delivered', 'completed', 'cancelled'
+    );
+
+ALTER TABLE tbl_offer ALTER COLUMN offer_state DROP DEFAULT;
+ALTER TABLE tbl_offer
+    ALTER COLUMN offer_state TYPE offer_state_t USING (
+        CASE offer_state::text
+            WHEN 'enabled' THEN 'active'
+            WHEN 'working' THEN 'in_transit'
+            WHEN 'archived' THEN 'completed'
+            WHEN 'disabled' THEN 'cancelled'
+            WHEN 'deleted' THEN 'cancelled'
+            ELSE offer_state::text
+            END
+        )::offer_state_t;
+ALTER TABLE tbl_offer ALTER COLUMN offer_state SET DEFAULT 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_offer_state ON tbl_offer (offer_state) WHERE deleted = 0;
+
+CREATE TABLE IF NOT EXISTS tbl_offer_state_history
+(
+    id               SERIAL PRIMARY KEY,
+    offer_id         INT           NOT NULL REFERENCES tbl_offer (id) ON DELETE CASCADE,
+    from_state       offer_state_t,         -- NULL when the offer was created
+    to_state         offer_state_t NOT NULL,
+    actor_user_id    INT           NOT NULL DEFAULT 0,
+    actor_company_id INT           NOT NULL DEFAULT 0,
+    actor_role       VARCHAR(20)   NOT NULL DEFAULT '',
+    reason           TEXT          NOT NULL DEFAULT '',
+    created_at       TIMESTAMP     NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_offer_state_history_offer ON tbl_offer_state_history (offer_id, created_at);
+
+INSERT INTO tbl_offer_state_history (offer_id, to_state, actor_role, reason, created_at)
+SELECT id, offer_state, 'system', 'state before lifecycle migration', COALESCE(updated_at, CURRENT_TIMESTAMP)
+FROM tbl_offer;
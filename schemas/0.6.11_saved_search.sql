@@ -0,0 +1,37 @@
+CREATE TYPE search_frequency_t AS ENUM ('instant', 'daily');
+
+-- filters hold the GET /offer/ query parameters the search was saved with
+CREATE TABLE IF NOT EXISTS tbl_saved_search
+(
+    id             SERIAL PRIMARY KEY,
+    uuid           UUID                        DEFAULT gen_random_uuid(),
+    user_id        INT                NOT NULL REFERENCES tbl_user (id) ON DELETE CASCADE,
+    company_id     INT                NOT NULL DEFAULT 0,
+    name           VARCHAR(200)       NOT NULL DEFAULT '',
+    filters        JSONB              NOT NULL DEFAULT '{}',
+    frequency      search_frequency_t NOT NULL DEFAULT 'instant',
+    notify_push    INT                NOT NULL DEFAULT 1,
+    notify_email   INT                NOT NULL DEFAULT 0,
+    notify_chat    INT                NOT NULL DEFAULT 0,
+    last_digest_at TIMESTAMP,
+    created_at     TIMESTAMP          NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at     TIMESTAMP          NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    active         INT                NOT NULL DEFAULT 1,
+    deleted        INT                NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_saved_search_user ON tbl_saved_search (user_id) WHERE deleted = 0;
+
+-- every offer matched by a search once, notified_at is set when it was sent
+-- (instantly or with the daily digest)
+CREATE TABLE IF NOT EXISTS tbl_saved_search_match
+(
+    id          SERIAL PRIMARY KEY,
+    search_id   INT       NOT NULL REFERENCES tbl_saved_search (id) ON DELETE CASCADE,
+    offer_id    INT       NOT NULL REFERENCES tbl_offer (id) ON DELETE CASCADE,
+    notified_at TIMESTAMP,
+    created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (search_id, offer_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_saved_search_match_pending ON tbl_saved_search_match (search_id) WHERE notified_at IS NULL;
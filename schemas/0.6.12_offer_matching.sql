@@ -0,0 +1,14 @@
+-- vehicle payload for carrier/load matching, 0 = unknown
+ALTER TABLE tbl_vehicle ADD COLUMN IF NOT EXISTS payload_kg INT NOT NULL DEFAULT 0;
+
+-- past lanes of carriers
+CREATE INDEX IF NOT EXISTS idx_offer_exec_lane ON tbl_offer (exec_company_id, LOWER(from_country), LOWER(to_country))
+    WHERE offer_state IN ('delivered', 'completed') AND deleted = 0;
+
+-- open loads for carrier offers
+CREATE INDEX IF NOT EXISTS idx_offer_open_loads ON tbl_offer (offer_role, validity_end)
+    WHERE offer_state = 'active' AND deleted = 0;
+
+-- pickup point estimate of offers without a pickup geofence
+CREATE INDEX IF NOT EXISTS idx_trip_from_country ON tbl_trip (LOWER(from_country))
+    WHERE from_location IS NOT NULL AND deleted = 0;
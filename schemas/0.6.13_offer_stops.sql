@@ -0,0 +1,50 @@
+CREATE TYPE offer_stop_kind_t AS ENUM ('pickup', 'dropoff');
+
+-- ordered pickup and dropoff points of multi-stop offers, the from_*/to_*
+-- columns of tbl_offer keep the first pickup and the last dropoff
+CREATE TABLE IF NOT EXISTS tbl_offer_stop
+(
+    id                SERIAL PRIMARY KEY,
+    offer_id          INT               NOT NULL REFERENCES tbl_offer (id) ON DELETE CASCADE,
+    seq               INT               NOT NULL,
+    kind              offer_stop_kind_t NOT NULL,
+    country           VARCHAR(100)      NOT NULL DEFAULT '',
+    country_id        INT               NOT NULL DEFAULT 0,
+    region            VARCHAR(100)      NOT NULL DEFAULT '',
+    city_id           INT               NOT NULL DEFAULT 0,
+    address           VARCHAR(500)      NOT NULL DEFAULT '',
+    location          GEOMETRY(POINT, 4326),
+    window_start      TIMESTAMP,
+    window_end        TIMESTAMP,
+    contact_name      VARCHAR(200)      NOT NULL DEFAULT '',
+    contact_phone     VARCHAR(100)      NOT NULL DEFAULT '',
+    cargo_id          INT               NOT NULL DEFAULT 0,
+    cargo_qty         INT               NOT NULL DEFAULT 0,
+    cargo_weight      DECIMAL(10, 2)    NOT NULL DEFAULT 0,
+    cargo_weight_type weight_type_t     NOT NULL DEFAULT 'kg',
+    note              VARCHAR(1000)     NOT NULL DEFAULT '',
+    created_at        TIMESTAMP         NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (offer_id, seq),
+
+    CONSTRAINT valid_stop_window CHECK (window_end IS NULL OR window_start IS NULL OR window_end >= window_start)
+);
+
+-- planned stops of a trip, seeded from the stops of its offers
+CREATE TABLE IF NOT EXISTS tbl_trip_waypoint
+(
+    id            BIGSERIAL PRIMARY KEY,
+    trip_id       INT               NOT NULL REFERENCES tbl_trip (id) ON DELETE CASCADE,
+    offer_id      INT               NOT NULL REFERENCES tbl_offer (id) ON DELETE CASCADE,
+    offer_stop_id INT REFERENCES tbl_offer_stop (id) ON DELETE SET NULL,
+    seq           INT               NOT NULL,
+    kind          offer_stop_kind_t NOT NULL,
+    address       VARCHAR(800)      NOT NULL DEFAULT '',
+    location      GEOMETRY(POINT, 4326),
+    window_start  TIMESTAMP,
+    window_end    TIMESTAMP,
+    created_at    TIMESTAMP         NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (trip_id, seq)
+);
+
+CREATE INDEX idx_offer_stop_offer ON tbl_offer_stop (offer_id, seq);
+CREATE INDEX idx_offer_stop_location_gist ON tbl_offer_stop USING GIST (location);
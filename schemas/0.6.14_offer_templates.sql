@@ -0,0 +1,50 @@
+CREATE TYPE recurrence_t AS ENUM ('none', 'weekly', 'monthly', 'cron');
+
+-- offer saved for reuse, offer and stops are snapshots of the source offer and
+-- anchor_date its delivery_start, new offers are shifted by occurrence - anchor
+CREATE TABLE IF NOT EXISTS tbl_offer_template
+(
+    id              SERIAL PRIMARY KEY,
+    uuid            UUID                  DEFAULT gen_random_uuid(),
+    user_id         INT          NOT NULL REFERENCES tbl_user (id) ON DELETE CASCADE,
+    company_id      INT          NOT NULL DEFAULT 0,
+    source_offer_id INT          NOT NULL DEFAULT 0,
+    name            VARCHAR(200) NOT NULL DEFAULT '',
+    offer           JSONB        NOT NULL DEFAULT '{}',
+    stops           JSONB        NOT NULL DEFAULT '[]',
+    anchor_date     DATE         NOT NULL,
+    offer_state     offer_state_t NOT NULL DEFAULT 'pending', -- state of the created offers, pending or draft
+
+    recurrence      recurrence_t NOT NULL DEFAULT 'none',
+    weekdays        INT[]        NOT NULL DEFAULT '{}', -- weekly, 1 = Monday .. 7 = Sunday
+    month_day       INT          NOT NULL DEFAULT 0,    -- monthly, 1-31
+    cron            VARCHAR(100) NOT NULL DEFAULT '',   -- cron, day fields are used
+    starts_on       DATE,
+    ends_on         DATE,
+    lead_days       INT          NOT NULL DEFAULT 7,    -- offers are created this many days ahead
+    last_occurrence DATE,
+
+    created_at      TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    active          INT          NOT NULL DEFAULT 1,
+    deleted         INT          NOT NULL DEFAULT 0,
+
+    CONSTRAINT valid_template_lead_days CHECK (lead_days BETWEEN 0 AND 60),
+    CONSTRAINT valid_template_month_day CHECK (month_day BETWEEN 0 AND 31)
+);
+
+-- offers created from templates, one per occurrence
+CREATE TABLE IF NOT EXISTS tbl_offer_template_run
+(
+    id              SERIAL PRIMARY KEY,
+    template_id     INT       NOT NULL REFERENCES tbl_offer_template (id) ON DELETE CASCADE,
+    offer_id        INT       NOT NULL REFERENCES tbl_offer (id) ON DELETE CASCADE,
+    occurrence_date DATE      NOT NULL,
+    scheduled       BOOLEAN   NOT NULL DEFAULT TRUE,
+    created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (template_id, occurrence_date)
+);
+
+CREATE INDEX idx_offer_template_user ON tbl_offer_template (user_id) WHERE deleted = 0;
+CREATE INDEX idx_offer_template_recurring ON tbl_offer_template (recurrence)
+    WHERE recurrence <> 'none' AND active = 1 AND deleted = 0;
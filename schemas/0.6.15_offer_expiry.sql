@@ -0,0 +1,8 @@
+-- offers past validity_end or delivery_end are archived by the expiry job
+ALTER TYPE offer_state_t ADD VALUE IF NOT EXISTS 'archived';
+
+CREATE INDEX IF NOT EXISTS idx_offer_expiry ON tbl_offer (validity_end, delivery_end)
+    WHERE offer_state IN ('pending', 'active') AND deleted = 0;
+
+CREATE INDEX IF NOT EXISTS idx_offer_response_pending ON tbl_offer_response (offer_id)
+    WHERE state = 'pending' AND deleted = 0;
@@ -0,0 +1,91 @@
+CREATE EXTENSION IF NOT EXISTS "pg_trgm";
+CREATE EXTENSION IF NOT EXISTS "unaccent";
+
+-- unaccent is only stable, indexes need an immutable wrapper
+CREATE OR REPLACE FUNCTION f_unaccent(TEXT) RETURNS TEXT AS
+$$
+SELECT public.unaccent('public.unaccent', $1)
+$$ LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT;
+
+-- search document of an offer: note, addresses, stop addresses, cargo name and
+-- description. Kept apart from tbl_offer so SELECT o.* stays unchanged.
+CREATE TABLE IF NOT EXISTS tbl_offer_search
+(
+    offer_id      INT PRIMARY KEY REFERENCES tbl_offer (id) ON DELETE CASCADE,
+    search_text   TEXT     NOT NULL DEFAULT '', -- lowercased and unaccented, for trigram matching
+    search_vector TSVECTOR NOT NULL DEFAULT ''::tsvector
+);
+
+CREATE INDEX IF NOT EXISTS idx_offer_search_vector ON tbl_offer_search USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_offer_search_trgm ON tbl_offer_search USING GIN (search_text gin_trgm_ops);
+
+-- the offers are in several languages, 'simple' does not stem for any of them
+CREATE OR REPLACE FUNCTION offer_search_refresh(p_offer_id INT) RETURNS VOID AS
+$$
+INSERT INTO tbl_offer_search (offer_id, search_text, search_vector)
+SELECT d.id, d.doc, to_tsvector('simple', d.doc)
+FROM (SELECT o.id,
+             f_unaccent(LOWER(concat_ws(' ',
+                 o.note, o.from_country, o.from_region, o.from_address,
+                 o.to_country, o.to_region, o.to_address,
+                 c.name, c.description,
+                 (SELECT string_agg(concat_ws(' ', s.country, s.region, s.address, s.note), ' ' ORDER BY s.seq)
+                  FROM tbl_offer_stop s WHERE s.offer_id = o.id)))) AS doc
+      FROM tbl_offer o
+      LEFT JOIN tbl_cargo c ON c.id = o.cargo_id
+      WHERE o.id = p_offer_id) d
+ON CONFLICT (offer_id) DO UPDATE
+    SET search_text = EXCLUDED.search_text, search_vector = EXCLUDED.search_vector;
+$$ LANGUAGE sql;
+
+CREATE OR REPLACE FUNCTION tbl_offer_search_trigger() RETURNS TRIGGER AS
+$$
+BEGIN
+    PERFORM offer_search_refresh(NEW.id);
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER offer_search_update
+    AFTER INSERT OR UPDATE OF note, from_country, from_region, from_address, to_country, to_region, to_address, cargo_id
+    ON tbl_offer
+    FOR EACH ROW
+EXECUTE FUNCTION tbl_offer_search_trigger();
+
+CREATE OR REPLACE FUNCTION tbl_offer_stop_search_trigger() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM offer_search_refresh(OLD.offer_id);
+    ELSE
+        PERFORM offer_search_refresh(NEW.offer_id);
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER offer_stop_search_update
+    AFTER INSERT OR UPDATE OR DELETE
+    ON tbl_offer_stop
+    FOR EACH ROW
+EXECUTE FUNCTION tbl_offer_stop_search_trigger();
+
+CREATE OR REPLACE FUNCTION tbl_cargo_search_trigger() RETURNS TRIGGER AS
+$$
+BEGIN
+    PERFORM offer_search_refresh(o.id) FROM tbl_offer o WHERE o.cargo_id = NEW.id;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER cargo_search_update
+    AFTER UPDATE OF name, description
+    ON tbl_cargo
+    FOR EACH ROW
+EXECUTE FUNCTION tbl_cargo_search_trigger();
+
+SELECT offer_search_refresh(id) FROM tbl_offer;
+
+-- radius search around pickup and dropoff points
+CREATE INDEX IF NOT EXISTS idx_offer_stop_geog ON tbl_offer_stop USING GIST ((location::geography))
+    WHERE location IS NOT NULL;
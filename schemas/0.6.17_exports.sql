@@ -0,0 +1,30 @@
+-- list exports too large to stream in the request run as jobs, the file is
+-- saved to tbl_media and served through /media/
+CREATE TYPE export_state_t AS ENUM ('pending', 'running', 'done', 'failed');
+
+ALTER TYPE media_context ADD VALUE IF NOT EXISTS 'export';
+
+-- xlsx mime type is longer than 20
+ALTER TABLE tbl_media ALTER COLUMN mime_type TYPE VARCHAR(100);
+
+CREATE TABLE IF NOT EXISTS tbl_export_job
+(
+    id          SERIAL PRIMARY KEY,
+    uuid        UUID           NOT NULL DEFAULT gen_random_uuid(),
+    user_id     INT            NOT NULL REFERENCES tbl_user (id) ON DELETE CASCADE,
+    company_id  INT            NOT NULL DEFAULT 0,
+    list        VARCHAR(50)    NOT NULL DEFAULT '', -- offers, my_offers, cargo, offer_responses
+    format      VARCHAR(10)    NOT NULL DEFAULT '', -- csv, xlsx, pdf
+    lang        VARCHAR(5)     NOT NULL DEFAULT 'en',
+    state       export_state_t NOT NULL DEFAULT 'pending',
+    row_count   INT            NOT NULL DEFAULT 0,
+    media_id    INT            NOT NULL DEFAULT 0,
+    url         VARCHAR(1000)  NOT NULL DEFAULT '',
+    error       TEXT           NOT NULL DEFAULT '',
+    created_at  TIMESTAMP      NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at  TIMESTAMP      NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_export_job_uuid ON tbl_export_job (uuid);
+CREATE INDEX IF NOT EXISTS idx_export_job_user ON tbl_export_job (user_id, created_at DESC);
@@ -0,0 +1,33 @@
+-- start of the company's billing cycles, usage is counted per cycle of the plan billing_cycle
+ALTER TABLE tbl_company ADD COLUMN IF NOT EXISTS plan_started_at TIMESTAMP;
+UPDATE tbl_company SET plan_started_at = created_at WHERE plan_started_at IS NULL;
+ALTER TABLE tbl_company ALTER COLUMN plan_started_at SET DEFAULT CURRENT_TIMESTAMP;
+
+-- tbl_plan row of the company, 0 = not linked yet, the plan enum decides
+ALTER TABLE tbl_company ADD COLUMN IF NOT EXISTS plan_id INT NOT NULL DEFAULT 0;
+
+-- link the companies still on the plan enum to the tbl_plan rows
+UPDATE tbl_company c
+SET plan_id = p.id
+FROM tbl_plan p
+WHERE c.plan_id = 0
+  AND p.deleted = 0
+  AND p.code = CASE c.plan
+                   WHEN 'start' THEN 'TEX_START'
+                   WHEN 'standard' THEN 'TEX_PRO'
+                   WHEN 'premium' THEN 'TEX_ENTERPRISE'
+      END;
+
+-- tbl_plan row a plan move switches the company to, 0 keeps its plan
+ALTER TABLE tbl_plan_moves ADD COLUMN IF NOT EXISTS plan_id INT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS tbl_plan_usage
+(
+    company_id  INT         NOT NULL REFERENCES tbl_company (id) ON DELETE CASCADE,
+    feature     VARCHAR(50) NOT NULL, -- load_posts, edocs
+    cycle_start TIMESTAMP   NOT NULL,
+    cycle_end   TIMESTAMP   NOT NULL,
+    used        INT         NOT NULL DEFAULT 0,
+    updated_at  TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (company_id, feature, cycle_start)
+);
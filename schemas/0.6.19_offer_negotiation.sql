@@ -0,0 +1,43 @@
+-- counter-offers: both sides of a response answer each other with new terms
+-- until one accepts, every round is kept in tbl_offer_response_round
+CREATE TYPE negotiation_action_t AS ENUM ('offer', 'counter', 'accept', 'decline', 'expire');
+
+ALTER TABLE tbl_offer_response
+    ADD COLUMN IF NOT EXISTS payment_method  payment_method_t,
+    ADD COLUMN IF NOT EXISTS payment_term    VARCHAR(200),
+    ADD COLUMN IF NOT EXISTS delivery_start  DATE,
+    ADD COLUMN IF NOT EXISTS delivery_end    DATE,
+    ADD COLUMN IF NOT EXISTS round           INT NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS last_company_id INT NOT NULL DEFAULT 0, -- company of the latest terms, the other side answers
+    ADD COLUMN IF NOT EXISTS expires_at      TIMESTAMP;              -- the latest terms can't be accepted after it
+
+UPDATE tbl_offer_response SET last_company_id = COALESCE(company_id, 0) WHERE last_company_id = 0;
+
+CREATE INDEX IF NOT EXISTS idx_offer_response_expires ON tbl_offer_response (expires_at)
+    WHERE state = 'pending' AND deleted = 0 AND expires_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS tbl_offer_response_round
+(
+    id             SERIAL PRIMARY KEY,
+    response_id    INT                  NOT NULL REFERENCES tbl_offer_response (id) ON DELETE CASCADE,
+    round          INT                  NOT NULL,
+    action         negotiation_action_t NOT NULL,
+    company_id     INT                  NOT NULL DEFAULT 0, -- 0 for the expiry job
+    user_id        INT                  NOT NULL DEFAULT 0,
+    bid_price      DECIMAL(10, 2),
+    payment_method payment_method_t,
+    payment_term   VARCHAR(200),
+    delivery_start DATE,
+    delivery_end   DATE,
+    note           VARCHAR(1000),
+    expires_at     TIMESTAMP,
+    created_at     TIMESTAMP            NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_offer_response_round ON tbl_offer_response_round (response_id, id);
+
+-- the existing responses are their first round
+INSERT INTO tbl_offer_response_round (response_id, round, action, company_id, bid_price, note, created_at)
+SELECT r.id, 1, 'offer', COALESCE(r.company_id, 0), r.bid_price, r.note, COALESCE(r.created_at, CURRENT_TIMESTAMP)
+FROM tbl_offer_response r
+WHERE NOT EXISTS (SELECT 1 FROM tbl_offer_response_round rr WHERE rr.response_id = r.id);
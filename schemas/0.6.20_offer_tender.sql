@@ -0,0 +1,24 @@
+-- tenders: an offer takes bids until its deadline, then the tender job awards
+-- the best bid or leaves the choice to the owner
+CREATE TYPE tender_mode_t AS ENUM ('open', 'sealed');
+CREATE TYPE tender_award_t AS ENUM ('manual', 'price', 'rating', 'score');
+CREATE TYPE tender_state_t AS ENUM ('open', 'closed', 'awarded', 'no_bids');
+
+CREATE TABLE IF NOT EXISTS tbl_offer_tender
+(
+    id                 SERIAL PRIMARY KEY,
+    offer_id           INT            NOT NULL UNIQUE REFERENCES tbl_offer (id) ON DELETE CASCADE,
+    mode               tender_mode_t  NOT NULL DEFAULT 'open',   -- sealed hides the bids from other bidders until the close
+    award_by           tender_award_t NOT NULL DEFAULT 'manual',
+    price_weight       NUMERIC(4, 3)  NOT NULL DEFAULT 0.7,      -- weights of the score award, their sum is 1
+    rating_weight      NUMERIC(4, 3)  NOT NULL DEFAULT 0.3,
+    deadline           TIMESTAMP      NOT NULL,
+    state              tender_state_t NOT NULL DEFAULT 'open',
+    winner_response_id INT            NOT NULL DEFAULT 0,
+    note               VARCHAR(1000)  NOT NULL DEFAULT '',       -- why an automatic award failed
+    closed_at          TIMESTAMP,
+    created_at         TIMESTAMP      NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at         TIMESTAMP      NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_offer_tender_deadline ON tbl_offer_tender (deadline) WHERE state = 'open';
@@ -0,0 +1,56 @@
+-- reviews: the parties of a completed offer rate each other, the published
+-- reviews make up the rating of the reviewed company or driver
+CREATE TYPE review_state_t AS ENUM ('pending', 'published', 'hidden');
+
+CREATE TABLE IF NOT EXISTS tbl_offer_review
+(
+    id                  SERIAL PRIMARY KEY,
+    offer_id            INT            NOT NULL REFERENCES tbl_offer (id) ON DELETE CASCADE,
+    reviewer_user_id    INT            NOT NULL DEFAULT 0,
+    reviewer_company_id INT            NOT NULL DEFAULT 0,
+    reviewer_driver_id  INT            NOT NULL DEFAULT 0,             -- set when the driver of the offer reviews
+    target_company_id   INT            NOT NULL DEFAULT 0,             -- the reviewed company or
+    target_driver_id    INT            NOT NULL DEFAULT 0,             -- the reviewed driver
+    rating              INT            NOT NULL,
+    review              VARCHAR(2000)  NOT NULL DEFAULT '',
+    state               review_state_t NOT NULL DEFAULT 'published',   -- pending waits for an admin (OFFER_REVIEW_PREMODERATION)
+    moderation_note     VARCHAR(1000)  NOT NULL DEFAULT '',
+    moderated_by        INT            NOT NULL DEFAULT 0,
+    moderated_at        TIMESTAMP,
+    created_at          TIMESTAMP      NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at          TIMESTAMP      NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted             INT            NOT NULL DEFAULT 0,
+    CONSTRAINT review_rating_range CHECK (rating >= 1 AND rating <= 5)
+);
+
+-- one review per reviewer and target of an offer
+CREATE UNIQUE INDEX IF NOT EXISTS idx_offer_review_unique
+    ON tbl_offer_review (offer_id, reviewer_company_id, reviewer_driver_id, target_company_id, target_driver_id)
+    WHERE deleted = 0;
+CREATE INDEX IF NOT EXISTS idx_offer_review_company ON tbl_offer_review (target_company_id) WHERE deleted = 0;
+CREATE INDEX IF NOT EXISTS idx_offer_review_driver ON tbl_offer_review (target_driver_id) WHERE deleted = 0;
+
+-- successful_ops counts the completed offers of the owner, the executor and the driver
+UPDATE tbl_company c
+SET successful_ops = ops.count
+FROM (
+    SELECT party.company_id, COUNT(DISTINCT party.offer_id) AS count
+    FROM (
+        SELECT id AS offer_id, company_id FROM tbl_offer WHERE offer_state = 'completed' AND deleted = 0
+        UNION ALL
+        SELECT id, exec_company_id FROM tbl_offer WHERE offer_state = 'completed' AND deleted = 0
+    ) party
+    WHERE party.company_id != 0
+    GROUP BY party.company_id
+) ops
+WHERE c.id = ops.company_id;
+
+UPDATE tbl_driver d
+SET successful_ops = ops.count
+FROM (
+    SELECT driver_id, COUNT(*) AS count
+    FROM tbl_offer
+    WHERE offer_state = 'completed' AND deleted = 0 AND driver_id != 0
+    GROUP BY driver_id
+) ops
+WHERE d.id = ops.driver_id;
@@ -0,0 +1,57 @@
+-- cargo measures: dimensions of one unit in cm, stacking, the required
+-- temperature and the ADR dangerous goods class. volume_m3, loading_meters
+-- and weight_kg are derived by tbl_cargo_measures_trigger.
+ALTER TABLE tbl_cargo
+    ADD COLUMN IF NOT EXISTS length_cm      NUMERIC(6, 2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS width_cm       NUMERIC(6, 2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS height_cm      NUMERIC(6, 2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS max_stack      INT           NOT NULL DEFAULT 1, -- units on top of each other, 1 = not stackable
+    ADD COLUMN IF NOT EXISTS temp_min       NUMERIC(4, 1),                    -- NULL = no temperature requirement
+    ADD COLUMN IF NOT EXISTS temp_max       NUMERIC(4, 1),
+    ADD COLUMN IF NOT EXISTS adr_class      VARCHAR(3)    NOT NULL DEFAULT '', -- '' = not dangerous goods
+    ADD COLUMN IF NOT EXISTS un_number      VARCHAR(4)    NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS volume_m3      NUMERIC       NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS loading_meters NUMERIC       NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS weight_kg      NUMERIC       NOT NULL DEFAULT 0;
+
+ALTER TABLE tbl_cargo
+    ADD CONSTRAINT cargo_max_stack CHECK (max_stack >= 1),
+    ADD CONSTRAINT cargo_temp_range CHECK (temp_min IS NULL OR temp_max IS NULL OR temp_min <= temp_max),
+    ADD CONSTRAINT cargo_un_number CHECK (un_number = '' OR adr_class != '');
+
+CREATE OR REPLACE FUNCTION tbl_cargo_measures_trigger() RETURNS TRIGGER AS
+$$
+BEGIN
+    -- same factors as weightUnitKG of the offer matching
+    NEW.weight_kg := ROUND(NEW.weight * CASE NEW.weight_type
+        WHEN 'g' THEN 0.001
+        WHEN 'lbs' THEN 0.45359237
+        WHEN 'oz' THEN 0.028349523125
+        WHEN 'st' THEN 6.35029318
+        WHEN 't' THEN 1000
+        WHEN 'tn' THEN 907.18474
+        ELSE 1 END, 3);
+    NEW.volume_m3 := ROUND(GREATEST(NEW.qty, 1) * NEW.length_cm * NEW.width_cm * NEW.height_cm / 1000000, 3);
+    -- floor length on a 2.4 m wide trailer, stacked units share a place
+    NEW.loading_meters := ROUND(CEIL(GREATEST(NEW.qty, 1)::NUMERIC / NEW.max_stack)
+        * NEW.length_cm * NEW.width_cm / 10000 / 2.4, 2);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER cargo_measures_update
+    BEFORE INSERT OR UPDATE
+    ON tbl_cargo
+    FOR EACH ROW
+EXECUTE FUNCTION tbl_cargo_measures_trigger();
+
+UPDATE tbl_cargo SET weight_kg = 0;
+
+CREATE INDEX IF NOT EXISTS idx_cargo_adr ON tbl_cargo (adr_class) WHERE adr_class != '';
+
+-- cargo space of vehicles for the matching, 0 = unknown
+ALTER TABLE tbl_vehicle
+    ADD COLUMN IF NOT EXISTS volume_m3      NUMERIC(6, 2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS loading_meters NUMERIC(5, 2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS reefer         INT           NOT NULL DEFAULT 0, -- temperature controlled body
+    ADD COLUMN IF NOT EXISTS adr            INT           NOT NULL DEFAULT 0; -- approved for dangerous goods
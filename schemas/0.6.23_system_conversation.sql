@@ -0,0 +1,8 @@
+-- the system conversation of each user, system messages are stored there so
+-- users that were offline find them in their chat history
+CREATE TABLE IF NOT EXISTS tbl_system_conversation
+(
+    user_id         INT       NOT NULL PRIMARY KEY REFERENCES tbl_user (id) ON DELETE CASCADE,
+    conversation_id INT       NOT NULL REFERENCES tbl_conversation (id) ON DELETE CASCADE,
+    created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
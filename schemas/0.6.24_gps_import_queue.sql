@@ -0,0 +1,16 @@
+-- background GPS imports are queued in the table, so imports survive restarts.
+-- payload holds the batch and its ingest scope until the import ends.
+ALTER TABLE tbl_gps_import
+    ADD COLUMN IF NOT EXISTS payload  JSONB,
+    ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_gps_import_pending ON tbl_gps_import (status, updated_at)
+    WHERE status IN ('queued', 'processing');
+
+-- imports queued in memory before are lost, there is nothing left to run
+UPDATE tbl_gps_import
+SET status = 'failed', error = 'interrupted by a restart', updated_at = CURRENT_TIMESTAMP
+WHERE status IN ('queued', 'processing');
+
+-- duplicates were counted as rejected too
+UPDATE tbl_gps_import SET rejected = rejected - duplicates WHERE rejected >= duplicates AND duplicates > 0;
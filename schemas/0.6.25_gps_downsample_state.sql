@@ -0,0 +1,18 @@
+-- thinning progress per retention level and vehicle: downsampled_until is the
+-- newest point thinned so far, checked_at the start of the run that thinned it.
+-- Points stored after checked_at are thinned even when they are older.
+CREATE TABLE IF NOT EXISTS tbl_gps_downsample_state
+(
+    level             plan_level_t NOT NULL,
+    vehicle_id        INT          NOT NULL,
+    downsampled_until TIMESTAMP    NOT NULL,
+    checked_at        TIMESTAMP    NOT NULL,
+    PRIMARY KEY (level, vehicle_id)
+);
+
+-- the single watermark per level skipped late points, the next run goes over
+-- the old points again and only removes what is left to thin
+ALTER TABLE tbl_gps_retention DROP COLUMN IF EXISTS downsampled_until;
+
+-- trip archives moved from UPLOAD_PATH/gps_archive to PRIVATE_PATH/gps_archive,
+-- archive_path stays relative so older files only need to be moved on disk
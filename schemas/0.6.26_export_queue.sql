@@ -0,0 +1,19 @@
+-- export jobs are run from the table, so jobs survive restarts. query and args
+-- are the list query of the request, file_path is relative to PRIVATE_PATH and
+-- the file is downloaded through /export/:uuid/file instead of /media/
+ALTER TABLE tbl_export_job
+    ADD COLUMN IF NOT EXISTS query     TEXT         NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS args      JSONB        NOT NULL DEFAULT '[]',
+    ADD COLUMN IF NOT EXISTS attempts  INT          NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS file_path VARCHAR(500) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_export_job_pending ON tbl_export_job (state, id)
+    WHERE state IN ('pending', 'running');
+
+-- jobs started before have no query to run again
+UPDATE tbl_export_job
+SET state = 'failed', error = 'interrupted by a restart', updated_at = CURRENT_TIMESTAMP, finished_at = CURRENT_TIMESTAMP
+WHERE state IN ('pending', 'running');
+
+-- files of older jobs stay in tbl_media under UPLOAD_PATH/exports
+ALTER TABLE tbl_export_job DROP COLUMN IF EXISTS media_id;
@@ -0,0 +1,49 @@
+CREATE TYPE geofence_kind_t AS ENUM ('pickup', 'dropoff');
+CREATE TYPE geofence_shape_t AS ENUM ('circle', 'polygon');
+CREATE TYPE geofence_event_t AS ENUM ('arrived_pickup', 'left_pickup', 'arrived_destination', 'left_destination');
+
+CREATE TABLE IF NOT EXISTS tbl_geofence
+(
+    id         SERIAL PRIMARY KEY,
+    uuid       UUID             NOT NULL DEFAULT gen_random_uuid(),
+    offer_id   INT              NOT NULL REFERENCES tbl_offer (id) ON DELETE CASCADE,
+    company_id INT              NOT NULL DEFAULT 0,
+    kind       geofence_kind_t  NOT NULL DEFAULT 'pickup',
+    shape      geofence_shape_t NOT NULL DEFAULT 'circle',
+    title      VARCHAR(200)     NOT NULL DEFAULT '',
+    center     GEOMETRY(POINT, 4326),                -- used by circle geofences
+    radius_m   DECIMAL(10, 2)   NOT NULL DEFAULT 0,  -- circle radius in meters
+    area       GEOMETRY(POLYGON, 4326),              -- used by polygon geofences
+    meta       TEXT             NOT NULL DEFAULT '',
+    created_at TIMESTAMP        NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP        NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    active     INT              NOT NULL DEFAULT 1,
+    deleted    INT              NOT NULL DEFAULT 0,
+
+    CONSTRAINT valid_geofence_shape CHECK (
+        (shape = 'circle' AND center IS NOT NULL AND radius_m > 0) OR
+        (shape = 'polygon' AND area IS NOT NULL)
+    )
+);
+
+CREATE TABLE IF NOT EXISTS tbl_geofence_event
+(
+    id          BIGSERIAL PRIMARY KEY,
+    geofence_id INT                         NOT NULL REFERENCES tbl_geofence (id) ON DELETE CASCADE,
+    offer_id    INT                         NOT NULL REFERENCES tbl_offer (id) ON DELETE CASCADE,
+    trip_id     INT REFERENCES tbl_trip (id),
+    vehicle_id  INT                         NOT NULL DEFAULT 0,
+    driver_id   INT                         NOT NULL DEFAULT 0,
+    gps_log_id  BIGINT                      NOT NULL DEFAULT 0,
+    event_type  geofence_event_t            NOT NULL,
+    coordinates GEOMETRY(POINT, 4326)       NOT NULL,
+    event_dt    TIMESTAMP WITHOUT TIME ZONE NOT NULL, -- log_dt of the point that crossed the boundary
+    created_at  TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_geofence_offer ON tbl_geofence (offer_id) WHERE deleted = 0;
+CREATE INDEX idx_geofence_center_gist ON tbl_geofence USING GIST (center);
+CREATE INDEX idx_geofence_area_gist ON tbl_geofence USING GIST (area);
+CREATE INDEX idx_geofence_event_state ON tbl_geofence_event (geofence_id, vehicle_id, event_dt);
+CREATE INDEX idx_geofence_event_offer ON tbl_geofence_event (offer_id, event_dt);
+CREATE INDEX idx_geofence_event_trip ON tbl_geofence_event (trip_id, event_dt);
@@ -0,0 +1,3 @@
+-- lane history lookups for ETA
+CREATE INDEX IF NOT EXISTS idx_trip_lane ON tbl_trip (from_country, to_country)
+    WHERE status = 'completed' AND deleted = 0;
@@ -0,0 +1,42 @@
+-- device tokens for GPS ingestion, bound to a driver and/or vehicle of the company
+CREATE TABLE IF NOT EXISTS tbl_gps_token
+(
+    id           SERIAL PRIMARY KEY,
+    uuid         UUID         NOT NULL DEFAULT gen_random_uuid(),
+    company_id   INT          NOT NULL REFERENCES tbl_company (id) ON DELETE CASCADE,
+    driver_id    INT          NOT NULL DEFAULT 0,
+    vehicle_id   INT          NOT NULL DEFAULT 0,
+    token_hash   VARCHAR(64)  NOT NULL, -- sha256 hex, plain token is shown only once
+    title        VARCHAR(200) NOT NULL DEFAULT '',
+    last_used_at TIMESTAMP,
+    expires_at   TIMESTAMP,
+    meta         TEXT         NOT NULL DEFAULT '',
+    created_at   TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at   TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    active       INT          NOT NULL DEFAULT 1,
+    deleted      INT          NOT NULL DEFAULT 0,
+
+    CONSTRAINT gps_token_bound CHECK (driver_id <> 0 OR vehicle_id <> 0)
+);
+
+-- points refused at ingestion, kept for troubleshooting devices
+CREATE TABLE IF NOT EXISTS tbl_gps_log_rejected
+(
+    id           BIGSERIAL PRIMARY KEY,
+    token_id     INT                         NOT NULL DEFAULT 0,
+    company_id   INT                         NOT NULL DEFAULT 0,
+    vehicle_id   INT                         NOT NULL DEFAULT 0,
+    driver_id    INT                         NOT NULL DEFAULT 0,
+    offer_id     INT,
+    trip_id      INT,
+    coordinates  GEOMETRY(POINT, 4326),
+    log_dt       TIMESTAMP WITHOUT TIME ZONE,
+    reason       VARCHAR(500)                NOT NULL DEFAULT '',
+    payload      JSONB                       NOT NULL DEFAULT '{}',
+    created_at   TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_gps_token_hash ON tbl_gps_token (token_hash);
+CREATE INDEX idx_gps_token_company ON tbl_gps_token (company_id) WHERE deleted = 0;
+CREATE INDEX idx_gps_log_rejected_company ON tbl_gps_log_rejected (company_id, created_at);
+CREATE INDEX idx_gps_log_rejected_vehicle ON tbl_gps_log_rejected (vehicle_id, created_at);
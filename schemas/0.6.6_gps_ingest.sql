@@ -0,0 +1,30 @@
+-- a vehicle can only be at one place at a time, duplicates come from devices re-sending buffers
+DELETE FROM tbl_gps_log a
+    USING tbl_gps_log b
+WHERE a.vehicle_id = b.vehicle_id
+  AND a.log_dt = b.log_dt
+  AND a.id > b.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_gps_log_vehicle_dt_unique ON tbl_gps_log (vehicle_id, log_dt);
+
+CREATE TYPE import_status_t AS ENUM ('queued', 'processing', 'completed', 'failed');
+
+-- background GPS imports for large batches
+CREATE TABLE IF NOT EXISTS tbl_gps_import
+(
+    id         SERIAL PRIMARY KEY,
+    uuid       UUID            NOT NULL DEFAULT gen_random_uuid(),
+    company_id INT             NOT NULL DEFAULT 0,
+    token_id   INT             NOT NULL DEFAULT 0,
+    status     import_status_t NOT NULL DEFAULT 'queued',
+    total      INT             NOT NULL DEFAULT 0,
+    accepted   INT             NOT NULL DEFAULT 0,
+    duplicates INT             NOT NULL DEFAULT 0,
+    rejected   INT             NOT NULL DEFAULT 0,
+    report     JSONB           NOT NULL DEFAULT '[]', -- [{index, reason}]
+    error      TEXT            NOT NULL DEFAULT '',
+    created_at TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP       NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_gps_import_company ON tbl_gps_import (company_id, created_at);
@@ -0,0 +1,18 @@
+-- filled when a trip ends, distance_km becomes the driven distance
+ALTER TABLE tbl_trip ADD COLUMN IF NOT EXISTS planned_distance_km DECIMAL(10, 2);
+ALTER TABLE tbl_trip ADD COLUMN IF NOT EXISTS moving_sec INT NOT NULL DEFAULT 0;
+ALTER TABLE tbl_trip ADD COLUMN IF NOT EXISTS idle_sec INT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS tbl_trip_stop
+(
+    id           BIGSERIAL PRIMARY KEY,
+    trip_id      INT                         NOT NULL REFERENCES tbl_trip (id) ON DELETE CASCADE,
+    location     GEOMETRY(POINT, 4326)       NOT NULL,
+    start_dt     TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    end_dt       TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    duration_sec INT                         NOT NULL DEFAULT 0,
+    point_count  INT                         NOT NULL DEFAULT 0,
+    created_at   TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_trip_stop_trip ON tbl_trip_stop (trip_id, start_dt);
@@ -0,0 +1,37 @@
+CREATE TYPE trip_alert_t AS ENUM ('deviation', 'idle', 'speed');
+
+-- monitoring rules of a trip, NULL limits are not checked
+CREATE TABLE IF NOT EXISTS tbl_trip_rule
+(
+    id               SERIAL PRIMARY KEY,
+    trip_id          INT       NOT NULL UNIQUE REFERENCES tbl_trip (id) ON DELETE CASCADE,
+    company_id       INT       NOT NULL DEFAULT 0,
+    max_deviation_km DECIMAL(10, 2),          -- distance from the corridor line
+    route            GEOMETRY(LINESTRING, 4326), -- planned route, straight from_location -> to_location when NULL
+    max_idle_min     INT,
+    max_speed_kmh    DECIMAL(6, 2),
+    created_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    active           INT       NOT NULL DEFAULT 1
+);
+
+-- an alert stays open until a point satisfies the rule again
+CREATE TABLE IF NOT EXISTS tbl_trip_alert
+(
+    id          BIGSERIAL PRIMARY KEY,
+    uuid        UUID                        NOT NULL DEFAULT gen_random_uuid(),
+    trip_id     INT                         NOT NULL REFERENCES tbl_trip (id) ON DELETE CASCADE,
+    vehicle_id  INT                         NOT NULL DEFAULT 0,
+    driver_id   INT                         NOT NULL DEFAULT 0,
+    gps_log_id  BIGINT                      NOT NULL DEFAULT 0,
+    alert_type  trip_alert_t                NOT NULL,
+    value       DECIMAL(10, 2)              NOT NULL DEFAULT 0, -- measured km, minutes or km/h
+    limit_value DECIMAL(10, 2)              NOT NULL DEFAULT 0,
+    coordinates GEOMETRY(POINT, 4326)       NOT NULL,
+    alert_dt    TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    resolved_dt TIMESTAMP WITHOUT TIME ZONE,
+    created_at  TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_trip_alert_trip ON tbl_trip_alert (trip_id, alert_dt);
+CREATE INDEX idx_trip_alert_open ON tbl_trip_alert (trip_id, alert_type) WHERE resolved_dt IS NULL;
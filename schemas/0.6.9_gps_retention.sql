@@ -0,0 +1,117 @@
+-- tbl_gps_log becomes a monthly partitioned table on log_dt. Unique keys of a
+-- partitioned table must contain log_dt, so the primary key is (id, log_dt).
+
+CREATE OR REPLACE FUNCTION gps_log_partition_name(month DATE) RETURNS TEXT AS
+$$
+SELECT 'tbl_gps_log_' || to_char(month, '"y"YYYY"m"MM');
+$$ LANGUAGE sql IMMUTABLE;
+
+-- creates the partition of the month, rows that landed in the default
+-- partition meanwhile are moved into it
+CREATE OR REPLACE FUNCTION gps_log_create_partition(month DATE) RETURNS VOID AS
+$$
+DECLARE
+    range_start DATE := date_trunc('month', month)::date;
+    range_end   DATE := (date_trunc('month', month) + INTERVAL '1 month')::date;
+    part_name   TEXT := gps_log_partition_name(range_start);
+BEGIN
+    IF to_regclass(part_name) IS NOT NULL THEN
+        RETURN;
+    END IF;
+
+    EXECUTE format('CREATE TABLE %I (LIKE tbl_gps_log INCLUDING DEFAULTS)', part_name);
+
+    IF to_regclass('tbl_gps_log_default') IS NOT NULL THEN
+        EXECUTE format(
+            'WITH moved AS (DELETE FROM tbl_gps_log_default WHERE log_dt >= %L AND log_dt < %L RETURNING *)
+             INSERT INTO %I SELECT * FROM moved', range_start, range_end, part_name);
+    END IF;
+
+    EXECUTE format('ALTER TABLE tbl_gps_log ATTACH PARTITION %I FOR VALUES FROM (%L) TO (%L)',
+                   part_name, range_start, range_end);
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER SEQUENCE tbl_gps_log_id_seq OWNED BY NONE;
+ALTER TABLE tbl_gps_log RENAME TO tbl_gps_log_old;
+ALTER TABLE tbl_gps_log_old DROP CONSTRAINT tbl_gps_log_pkey;
+
+DROP INDEX IF EXISTS idx_driver_log_dt;
+DROP INDEX IF EXISTS idx_trip_log_dt;
+DROP INDEX IF EXISTS idx_vehicle_log_dt;
+DROP INDEX IF EXISTS idx_coordinates_gist;
+DROP INDEX IF EXISTS idx_log_dt;
+DROP INDEX IF EXISTS idx_gps_log_vehicle_dt_unique;
+
+CREATE TABLE tbl_gps_log
+(
+    id            BIGINT                      NOT NULL DEFAULT nextval('tbl_gps_log_id_seq'),
+    company_id    INT REFERENCES tbl_company (id),
+    vehicle_id    INT                         NOT NULL DEFAULT 0,
+    driver_id     INT                         NOT NULL DEFAULT 0,
+    offer_id      INT REFERENCES tbl_offer (id),
+    trip_id       INT REFERENCES tbl_trip (id),
+    battery_level SMALLINT,
+    speed         DECIMAL(5, 2),
+    heading       DECIMAL(5, 2),
+    accuracy      DECIMAL(7, 2),
+    coordinates   GEOMETRY(POINT, 4326)       NOT NULL,
+    status        state_t                     NOT NULL DEFAULT 'active',
+    log_dt        TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    created_at    TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    PRIMARY KEY (id, log_dt)
+) PARTITION BY RANGE (log_dt);
+
+ALTER SEQUENCE tbl_gps_log_id_seq OWNED BY tbl_gps_log.id;
+
+-- catches points far in the past or future, the retention job creates months ahead
+CREATE TABLE tbl_gps_log_default PARTITION OF tbl_gps_log DEFAULT;
+
+DO
+$$
+DECLARE
+    month DATE;
+BEGIN
+    FOR month IN
+        SELECT DISTINCT date_trunc('month', log_dt)::date FROM tbl_gps_log_old
+        UNION
+        SELECT date_trunc('month', CURRENT_DATE + i * INTERVAL '1 month')::date FROM generate_series(0, 2) i
+    LOOP
+        PERFORM gps_log_create_partition(month);
+    END LOOP;
+END
+$$;
+
+INSERT INTO tbl_gps_log SELECT * FROM tbl_gps_log_old;
+DROP TABLE tbl_gps_log_old;
+
+CREATE INDEX idx_driver_log_dt ON tbl_gps_log (driver_id, log_dt);
+CREATE INDEX idx_trip_log_dt ON tbl_gps_log (trip_id, log_dt);
+CREATE INDEX idx_vehicle_log_dt ON tbl_gps_log (vehicle_id, log_dt);
+CREATE INDEX idx_coordinates_gist ON tbl_gps_log USING GIST (coordinates);
+CREATE INDEX idx_log_dt ON tbl_gps_log (log_dt);
+CREATE UNIQUE INDEX idx_gps_log_vehicle_dt_unique ON tbl_gps_log (vehicle_id, log_dt);
+
+-- retention per plan gps_tracking_level: raw points are kept raw_days, then
+-- thinned to one point per vehicle every downsample_sec, and deleted after
+-- keep_days (0 keeps them forever)
+CREATE TABLE IF NOT EXISTS tbl_gps_retention
+(
+    level             plan_level_t PRIMARY KEY,
+    raw_days          INT       NOT NULL,
+    downsample_sec    INT       NOT NULL,
+    keep_days         INT       NOT NULL DEFAULT 0,
+    downsampled_until TIMESTAMP,          -- points before this are already thinned
+    updated_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO tbl_gps_retention (level, raw_days, downsample_sec, keep_days)
+VALUES ('none', 7, 300, 30),
+       ('basic', 30, 120, 180),
+       ('advanced', 90, 60, 365),
+       ('full', 365, 30, 0)
+ON CONFLICT (level) DO NOTHING;
+
+-- closed trips are exported before their points are thinned
+ALTER TABLE tbl_trip ADD COLUMN IF NOT EXISTS archive_path VARCHAR(500);
+ALTER TABLE tbl_trip ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;